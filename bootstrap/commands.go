@@ -0,0 +1,303 @@
+package bootstrap
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anishmgoyal/calagora/constants"
+	"github.com/anishmgoyal/calagora/database"
+	"github.com/anishmgoyal/calagora/models"
+)
+
+// command is a subcommand of the calagora binary, used for maintenance
+// tasks that run alongside or instead of the server
+type command struct {
+	description string
+	run         func(args []string) bool
+}
+
+var commands = map[string]command{
+	"catalog": {
+		description: "Import books into the catalog used for textbook listings",
+		run:         catalogCommand,
+	},
+	"migrate": {
+		description: "Apply or revert schema migrations, or show their status",
+		run:         migrateCommand,
+	},
+	"reindex": {
+		description: "Rebuild the search index, or check it for problems",
+		run:         reindexCommand,
+	},
+}
+
+// RunCommand runs a subcommand of the calagora binary, and returns whether
+// or not it succeeded
+func RunCommand(name string, args []string) bool {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Println("Unknown command: " + name)
+		printCommandUsage()
+		return false
+	}
+	return cmd.run(args)
+}
+
+func printCommandUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Usage: calagora [command] [arguments]")
+	fmt.Println("Runs the server if no command is given. Commands:")
+	for _, name := range names {
+		fmt.Println("  " + name + "\t" + commands[name].description)
+	}
+}
+
+// commandDatabaseConnection connects to the database the same way the
+// server does
+func commandDatabaseConnection() *sql.DB {
+	constants.LoadEnvironmentSettings()
+	return GetDatabaseConnection()
+}
+
+func catalogCommand(args []string) bool {
+	if len(args) != 2 || args[0] != "import" {
+		fmt.Println("Usage: calagora catalog import [file]")
+		fmt.Println("The file is a CSV file with the columns isbn, title, " +
+			"author and edition")
+		return false
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		fmt.Println("[ERROR] catalog: " + err.Error())
+		return false
+	}
+	defer file.Close()
+
+	db := commandDatabaseConnection()
+	defer db.Close()
+	imported, skipped, err := models.ImportBooks(db, file)
+	if err != nil {
+		return false
+	}
+	fmt.Println("[INFO] catalog: imported " + strconv.Itoa(imported) +
+		" books, skipped " + strconv.Itoa(skipped) + " lines")
+	return true
+}
+
+func migrateCommand(args []string) bool {
+	if len(args) == 0 {
+		fmt.Println("Usage: calagora migrate up|down|status [arguments]")
+		return false
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "up":
+		fake := flags.Bool("fake", false, "record migrations as applied "+
+			"without running them, for a database made from docker-db/schema.sql")
+		if err := flags.Parse(args[1:]); err != nil {
+			return false
+		}
+
+		db := commandDatabaseConnection()
+		defer db.Close()
+		count, err := database.MigrateUp(db, *fake)
+		fmt.Println("[INFO] migrate: applied " + strconv.Itoa(count) +
+			" migrations")
+		return err == nil
+	case "down":
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		if err := flags.Parse(args[1:]); err != nil {
+			return false
+		}
+		if *steps < 1 {
+			fmt.Println("-steps must be at least 1")
+			return false
+		}
+
+		db := commandDatabaseConnection()
+		defer db.Close()
+		count, err := database.MigrateDown(db, *steps)
+		fmt.Println("[INFO] migrate: reverted " + strconv.Itoa(count) +
+			" migrations")
+		if err != nil {
+			fmt.Println("[ERROR] migrate: " + err.Error())
+		}
+		return err == nil
+	case "status":
+		if err := flags.Parse(args[1:]); err != nil {
+			return false
+		}
+
+		db := commandDatabaseConnection()
+		defer db.Close()
+		statuses, err := database.GetMigrationStatus(db)
+		if err != nil {
+			return false
+		}
+		pending := 0
+		for _, status := range statuses {
+			if status.Applied {
+				fmt.Println("  applied  " + status.Migration.ID() + "\t" +
+					status.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Println("  pending  " + status.Migration.ID())
+				pending++
+			}
+		}
+		fmt.Println("[INFO] migrate: " + strconv.Itoa(pending) + " of " +
+			strconv.Itoa(len(statuses)) + " migrations pending")
+		return true
+	}
+
+	fmt.Println("Unknown migrate command: " + args[0])
+	return false
+}
+
+func reindexCommand(args []string) bool {
+	flags := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	batchSize := flags.Int("batch", 100, "number of listings to index at a time")
+	pause := flags.Duration("pause", 0, "time to wait between batches, to "+
+		"reduce load on a live server")
+	verify := flags.Bool("verify", false, "check the index for problems "+
+		"after rebuilding it")
+	verifyOnly := flags.Bool("verify-only", false, "check the index for "+
+		"problems without rebuilding it")
+	fix := flags.Bool("fix", false, "with -verify-only, index again any "+
+		"listings with problems")
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if *batchSize < 1 {
+		fmt.Println("-batch must be at least 1")
+		return false
+	}
+
+	db := commandDatabaseConnection()
+	defer db.Close()
+
+	if *verifyOnly {
+		report, ok := verifySearchIndex(db)
+		if !ok || report.IsConsistent() || !*fix {
+			return ok && report.IsConsistent()
+		}
+
+		ids := report.ListingIDs()
+		fmt.Println("[INFO] reindex: fixing " + strconv.Itoa(len(ids)) +
+			" listings")
+		failed := 0
+		for _, id := range ids {
+			if err := models.ReindexListing(db, id); err != nil {
+				fmt.Println("[ERROR] reindex: listing " + strconv.Itoa(id) + ": " +
+					err.Error())
+				failed++
+			}
+		}
+		if failed > 0 {
+			return false
+		}
+		report, ok = verifySearchIndex(db)
+		return ok && report.IsConsistent()
+	}
+
+	total, err := models.CountListings(db)
+	if err != nil {
+		fmt.Println("[ERROR] reindex: " + err.Error())
+		return false
+	}
+
+	// Listings are walked in order of ID rather than by page, so that
+	// listings created or deleted while this runs don't shift the batches
+	start := time.Now()
+	done, failed, lastID := 0, 0, 0
+	for {
+		ids, err := models.GetListingIDsAfter(db, lastID, *batchSize)
+		if err != nil {
+			fmt.Println("[ERROR] reindex: " + err.Error())
+			return false
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		for _, id := range ids {
+			if err := models.ReindexListing(db, id); err != nil {
+				fmt.Println("[ERROR] reindex: listing " + strconv.Itoa(id) + ": " +
+					err.Error())
+				failed++
+			}
+			done++
+		}
+		lastID = ids[len(ids)-1]
+
+		// New listings may push the count past the total found at the start
+		if done > total {
+			total = done
+		}
+		fmt.Println("[INFO] reindex: " + strconv.Itoa(done) + "/" +
+			strconv.Itoa(total) + " listings (" +
+			strconv.Itoa(done*100/total) + "%)")
+
+		if *pause > 0 {
+			time.Sleep(*pause)
+		}
+	}
+
+	fmt.Println("[INFO] reindex: finished " + strconv.Itoa(done) +
+		" listings in " + time.Since(start).String() + ", " +
+		strconv.Itoa(failed) + " failed")
+
+	if *verify {
+		report, ok := verifySearchIndex(db)
+		return ok && report.IsConsistent() && failed == 0
+	}
+	return failed == 0
+}
+
+// verifySearchIndex checks the search index and prints any problems found
+func verifySearchIndex(db *sql.DB) (*models.SearchIndexReport, bool) {
+	report, err := models.VerifySearchIndex(db)
+	if err != nil {
+		fmt.Println("[ERROR] reindex: " + err.Error())
+		return nil, false
+	}
+
+	printListingIDs("published listings missing from the index", report.Missing)
+	printListingIDs("unpublished listings in the index", report.Unpublished)
+	printListingIDs("deleted listings in the index", report.Orphaned)
+	printListingIDs("listings indexed by an older analyzer", report.Stale)
+	if report.IsConsistent() {
+		fmt.Println("[INFO] reindex: the search index is consistent")
+	}
+	return report, true
+}
+
+// maxPrintedListingIDs is the most listing IDs printed for each problem
+const maxPrintedListingIDs = 20
+
+func printListingIDs(problem string, ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+	printed := make([]string, 0, maxPrintedListingIDs)
+	for i := 0; i < len(ids) && i < maxPrintedListingIDs; i++ {
+		printed = append(printed, strconv.Itoa(ids[i]))
+	}
+	if len(ids) > maxPrintedListingIDs {
+		printed = append(printed, "...")
+	}
+	fmt.Println("[WARN] reindex: " + strconv.Itoa(len(ids)) + " " + problem +
+		": " + strings.Join(printed, ", "))
+}
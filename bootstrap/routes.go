@@ -31,22 +31,25 @@ func CreateRoutes() {
 	http.Handle(route("/info/help/", controllers.InfoHelp))
 	http.Handle(route("/info/tos/", controllers.InfoTos))
 
+	http.Handle(route("/listing/bump/", controllers.ListingBump))
 	http.Handle(route("/listing/create/", controllers.ListingCreate))
 	http.Handle(route("/listing/delete/", controllers.ListingDelete))
 	http.Handle(route("/listing/edit/", controllers.ListingEdit))
+	http.Handle(route("/listing/renew/", controllers.ListingRenew))
 	http.Handle(route("/listing/view/", controllers.ListingView))
 	http.Handle(route("/listing/section/", controllers.ListingSection))
 
+	http.Handle(route("/meetup/ics/", controllers.MeetupCalendar))
+	http.Handle(route("/meetup/", controllers.Meetup))
+
 	http.Handle(route("/message/client/", controllers.MessageClient))
 	http.Handle(route("/message/read/", controllers.MessageRead))
 
 	http.Handle(route("/offer/buyer/", controllers.OfferBuyer))
 	http.Handle(route("/offer/seller/", controllers.OfferSeller))
+	http.Handle(route("/offer/bundle/", controllers.OfferBundle))
 
-	http.Handle(route("/recover/user/", controllers.ResetPassword))
-	http.Handle(route("/recover/", controllers.RecoverPassword))
-
-	http.Handle(route("/search/", controllers.Search))
+	http.Handle(route("/review/", controllers.Review))
 
 	http.Handle(route("/upload/", controllers.Upload))
 
@@ -88,6 +91,35 @@ func CreateRoutes() {
 	http.Handle(route("/", controllers.Home))
 }
 
+// CreateDatabaseRoutes maps the URI's of features which need the database,
+// like search, so they aren't available on the memory store
+func CreateDatabaseRoutes() {
+	http.Handle(route("/admin/search/", controllers.AdminSearch))
+
+	http.Handle(route("/book/", controllers.BookView))
+
+	http.Handle(route("/recover/user/", controllers.ResetPassword))
+	http.Handle(route("/recover/", controllers.RecoverPassword))
+
+	http.Handle(route("/search/saved/", controllers.SavedSearches))
+	http.Handle(route("/search/", controllers.Search))
+
+	http.Handle(route("/wanted/create/", controllers.WantedCreate))
+	http.Handle(route("/wanted/close/", controllers.WantedClose))
+	http.Handle(route("/wanted/view/", controllers.WantedView))
+	http.Handle(route("/wanted/", controllers.WantedList))
+
+	http.Handle(route("/webapi/book/", controllers.WebAPIBook))
+
+	http.Handle(route("/webapi/listing/similar/", controllers.WebAPIListingSimilar))
+
+	http.Handle(route("/webapi/search/save/", controllers.WebAPISavedSearchCreate))
+	http.Handle(route("/webapi/search/saved/delete/", controllers.WebAPISavedSearchDelete))
+	http.Handle(route("/webapi/search/saved/", controllers.WebAPISavedSearches))
+	http.Handle(route("/webapi/search/suggest/", controllers.WebAPISearchSuggest))
+	http.Handle(route("/webapi/search/", controllers.WebAPISearch))
+}
+
 // Quick wrapper for StripPrefix which prevents typos
 func route(path string, callback http.HandlerFunc) (string, http.Handler) {
 	fn := callback
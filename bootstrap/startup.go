@@ -1,6 +1,7 @@
 package bootstrap
 
 import (
+	"database/sql"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -11,11 +12,23 @@ import (
 	"github.com/anishmgoyal/calagora/cache"
 	"github.com/anishmgoyal/calagora/constants"
 	"github.com/anishmgoyal/calagora/controllers"
+	"github.com/anishmgoyal/calagora/database"
 	"github.com/anishmgoyal/calagora/email"
+	"github.com/anishmgoyal/calagora/models"
 	"github.com/anishmgoyal/calagora/utils"
 	"github.com/anishmgoyal/calagora/wsock"
 )
 
+// memoryStorePlaces are the places available when running on the memory
+// store, matching the ones docker-db/schema.sql starts with
+var memoryStorePlaces = []models.Place{
+	{ID: 1, Abbreviation: "RU", Name: "Rutgers University",
+		EmailDomain: "rutgers.edu"},
+	{ID: 2, Abbreviation: "CUNY", Name: "City University of New York",
+		EmailDomain: "cuny.edu"},
+	{ID: 3, Abbreviation: "GM", Name: "Gmail Tests", EmailDomain: "gmail.com"},
+}
+
 // GlobalStart begins initialization for the application,
 // and notifies main() if an error occurrs.
 func GlobalStart() bool {
@@ -29,19 +42,47 @@ func GlobalStart() bool {
 	fmt.Println("[STARTUP] Loading Templates")
 	templates := GetTemplates()
 
-	fmt.Println("[STARTUP] Connecting to DB")
-	db := GetDatabaseConnection()
+	var db *sql.DB
+	var store *models.Store
+	if constants.UseMemoryStore {
+		fmt.Println("[STARTUP] Using Memory Store")
+		store = models.NewMemoryStore(memoryStorePlaces...)
+	} else {
+		fmt.Println("[STARTUP] Connecting to DB")
+		db = GetDatabaseConnection()
+
+		if constants.MigrateOnStart {
+			fmt.Println("[STARTUP] Applying Migrations")
+			if _, err := database.MigrateUp(db, false); err != nil {
+				return false
+			}
+		}
+
+		store = models.NewPostgresStore(db)
+	}
 
 	fmt.Println("[STARTUP] Initializing Services")
-	cache.BaseInitialization(db)
-	controllers.BaseInitialization(templates, db)
+	cache.BaseInitialization(db, store)
+	controllers.BaseInitialization(templates, db, store)
 	email.BaseInitialization(templates)
-	wsock.BaseInitialization(db)
-
-	go utils.SessionEvicter(db)
+	wsock.BaseInitialization(store)
+
+	go controllers.OfferExpirer()
+	go controllers.ListingExpiryReminder()
+	go controllers.ListingPublisher()
+	if db != nil {
+		go utils.SessionEvicter(db)
+		go models.RebuildStaleSearchIndex(db)
+		go models.RebuildStaleWantedIndex(db)
+		go models.RebuildStaleSavedSearches(db)
+		go cache.SuggestionRefresher()
+	}
 
 	fmt.Println("[STARTUP] Creating Routes")
 	CreateRoutes()
+	if db != nil {
+		CreateDatabaseRoutes()
+	}
 
 	var sslRedirect = func(w http.ResponseWriter, r *http.Request) {
 		host := r.Host
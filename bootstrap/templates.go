@@ -10,6 +10,11 @@ import (
 func GetTemplates() map[string]*template.Template {
 	templates := make(map[string]*template.Template)
 
+	templates["admin#search"] = loadTemplate("views/admin/search.html")
+
+	templates["book#view"] = loadTemplate("views/book/view.html",
+		"views/book/copies.html")
+
 	templates["home#index"] = loadTemplate("views/index.html")
 	templates["home#unsupported"] = loadBlankTemplate("views/unsupported.html")
 
@@ -18,27 +23,50 @@ func GetTemplates() map[string]*template.Template {
 	templates["info#help"] = loadTemplate("views/info/help.html")
 	templates["info#tos"] = loadTemplate("views/info/tos.html")
 
-	templates["listing#create"] = loadTemplate("views/listing/create.html")
-	templates["listing#edit"] = loadTemplate("views/listing/edit.html")
+	templates["listing#create"] = loadTemplate("views/listing/create.html",
+		"views/listing/offer_rules.html", "views/listing/attributes.html")
+	templates["listing#edit"] = loadTemplate("views/listing/edit.html",
+		"views/listing/offer_rules.html", "views/listing/attributes.html")
 	templates["listing#section"] = loadTemplate("views/listing/section.html")
 	templates["listing#selling"] = loadTemplate("views/listing/selling.html")
-	templates["listing#view"] = loadTemplate("views/listing/view.html")
+	templates["listing#view"] = loadTemplate("views/listing/view.html",
+		"views/review/reviews.html", "views/book/copies.html")
+
+	templates["meetup#view"] = loadTemplate("views/meetup/view.html")
 
 	templates["message#client"] = loadTemplate("views/message/client.html")
 
-	templates["offer#buyer"] = loadTemplate("views/offer/buyer.html")
-	templates["offer#buying"] = loadTemplate("views/offer/buying.html")
-	templates["offer#seller"] = loadTemplate("views/offer/seller.html")
+	templates["offer#buyer"] = loadTemplate("views/offer/buyer.html",
+		"views/offer/history.html", "views/offer/expiry.html")
+	templates["offer#bundle"] = loadTemplate("views/offer/bundle.html",
+		"views/offer/history.html", "views/offer/expiry.html",
+		"views/offer/bundled.html")
+	templates["offer#buying"] = loadTemplate("views/offer/buying.html",
+		"views/review/reviews.html")
+	templates["offer#seller"] = loadTemplate("views/offer/seller.html",
+		"views/offer/history.html", "views/offer/expiry.html",
+		"views/offer/bundled.html")
 
 	templates["recover#index"] = loadTemplate("views/recover/index.html")
 	templates["recover#reset"] = loadTemplate("views/recover/reset.html")
 
+	templates["review#create"] = loadTemplate("views/review/create.html",
+		"views/review/reviews.html")
+
+	templates["search#saved"] = loadTemplate("views/search/saved.html")
 	templates["search#search"] = loadTemplate("views/search/search.html")
 
 	templates["user#login"] = loadTemplate("views/user/login.html")
-	templates["user#profile"] = loadTemplate("views/user/profile.html")
+	templates["user#profile"] = loadTemplate("views/user/profile.html",
+		"views/review/reviews.html")
+	templates["user#public"] = loadTemplate("views/user/public.html",
+		"views/review/reviews.html")
 	templates["user#register"] = loadTemplate("views/user/register.html")
 
+	templates["wanted#create"] = loadTemplate("views/wanted/create.html")
+	templates["wanted#list"] = loadTemplate("views/wanted/list.html")
+	templates["wanted#view"] = loadTemplate("views/wanted/view.html")
+
 	templates["email#default"] = loadEmailTemplate("views/layouts/email.html")
 	templates["email#plain"] = loadEmailTemplate("views/layouts/email_plain.html")
 
@@ -57,18 +85,23 @@ func loadBlankTemplate(fpath string) *template.Template {
 			fpath))
 }
 
-func loadTemplate(fpath string) *template.Template {
+// loadTemplate loads a view in the default layout, along with any partials
+// the view uses
+func loadTemplate(fpath string, partials ...string) *template.Template {
 
 	funcs := template.FuncMap{
 		"title":   strings.Title,
 		"compare": strings.Compare,
 	}
 
+	files := append([]string{
+		"views/layouts/default.html",
+		"views/layouts/sidebar.html",
+		fpath,
+	}, partials...)
+
 	return template.Must(
-		template.New("").Funcs(funcs).ParseFiles(
-			"views/layouts/default.html",
-			"views/layouts/sidebar.html",
-			fpath))
+		template.New("").Funcs(funcs).ParseFiles(files...))
 }
 
 func emailHelperIsEven(i int) bool {
@@ -1,15 +1,23 @@
 package cache
 
-import "database/sql"
+import (
+	"database/sql"
+
+	"github.com/anishmgoyal/calagora/models"
+)
 
 // Base contains essential information for cache operations
 var Base struct {
-	// Db is the handle to the database connection
+	// Db is the handle to the database connection, which is nil when
+	// running on the memory store
 	Db *sql.DB
+	// Store is where cached models are loaded from
+	Store *models.Store
 }
 
 // BaseInitialization sets up any caching that is to be performed
-func BaseInitialization(db *sql.DB) {
+func BaseInitialization(db *sql.DB, store *models.Store) {
 	Base.Db = db
+	Base.Store = store
 	initPlaceCache()
 }
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"strings"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// Spelling corrections are found by walking the word trie for a place
+// while computing the edit distance to each word in it. Branches are cut
+// off as soon as every word under them must be too far away, so only a
+// small part of the trie is visited for each misspelled word
+
+// maxEditDistance gets how many single character edits a word can be from
+// a correction. Short words only allow one edit, or nearly every short
+// word would be a correction for every other
+func maxEditDistance(word string) int {
+	if len([]rune(word)) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// contains returns true if a word was inserted into the trie
+func (t *suggestionTrie) contains(word string) bool {
+	node := t.root
+	for _, r := range word {
+		child, ok := node.children[r]
+		if !ok {
+			return false
+		}
+		node = child
+	}
+	return node.terminal != nil
+}
+
+// closest finds the word in the trie with the fewest edits from word, up to
+// maxDist edits away. Ties go to the word appearing in the most listings
+func (t *suggestionTrie) closest(word string, maxDist int) *suggestion {
+	target := []rune(word)
+	row := make([]int, len(target)+1)
+	for i := range row {
+		row[i] = i
+	}
+
+	var best *suggestion
+	bestDist := maxDist + 1
+	var walk func(node *suggestionNode, prev []int)
+	walk = func(node *suggestionNode, prev []int) {
+		for r, child := range node.children {
+			cur := make([]int, len(prev))
+			cur[0] = prev[0] + 1
+			rowMin := cur[0]
+			for i := 1; i < len(cur); i++ {
+				cost := 1
+				if target[i-1] == r {
+					cost = 0
+				}
+				cur[i] = minInt(prev[i]+1, cur[i-1]+1, prev[i-1]+cost)
+				if cur[i] < rowMin {
+					rowMin = cur[i]
+				}
+			}
+
+			dist := cur[len(cur)-1]
+			if child.terminal != nil && (dist < bestDist || dist == bestDist &&
+				best != nil && child.terminal.weight > best.weight) {
+				best = child.terminal
+				bestDist = dist
+			}
+			if rowMin <= maxDist && rowMin <= bestDist {
+				walk(child, cur)
+			}
+		}
+	}
+	walk(t.root, row)
+	return best
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+// CorrectQuery suggests a spelling correction for a search query, using the
+// words indexed in a place, or every place if placeID is 0. Only plain
+// words are corrected; phrases and prefix* terms are left as they are.
+// Returns false if no words in the query needed correcting
+func CorrectQuery(placeID int, query string) (string, bool) {
+	suggestions.RLock()
+	place, ok := suggestions.places[placeID]
+	suggestions.RUnlock()
+	if !ok {
+		return query, false
+	}
+
+	fields := strings.Fields(query)
+	corrected := false
+	inPhrase := false
+	for i, field := range fields {
+		quotes := strings.Count(field, "\"")
+		plain := !inPhrase && quotes == 0 && !strings.HasSuffix(field, "*")
+		if quotes%2 == 1 {
+			inPhrase = !inPhrase
+		}
+		if !plain {
+			continue
+		}
+
+		words := utils.WordAnalyzer.Analyze(field)
+		if len(words) != 1 || place.words.contains(words[0]) {
+			continue
+		}
+		if match := place.words.closest(words[0],
+			maxEditDistance(words[0])); match != nil {
+
+			fields[i] = match.text
+			corrected = true
+		}
+	}
+
+	if !corrected {
+		return query, false
+	}
+	return strings.Join(fields, " "), true
+}
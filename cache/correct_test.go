@@ -0,0 +1,51 @@
+package cache
+
+import "testing"
+
+func TestCorrectQuery(t *testing.T) {
+	words := newSuggestionTrie()
+	words.insert("calculus", 4)
+	words.insert("textbook", 3)
+	words.insert("textbooks", 1)
+	words.insert("desk", 2)
+	words.finish()
+
+	suggestions.places = map[int]*placeSuggestions{
+		1: {words: words, titles: newSuggestionTrie()},
+	}
+	defer func() { suggestions.places = nil }()
+
+	corrections := map[string]string{
+		"calculus textbok":    "calculus textbook",
+		"Calculs the textbok": "calculus the textbook",
+		"dsek":                "dsek",
+		"desk \"calculs\"":    "desk \"calculs\"",
+		"calcul*":             "calcul*",
+	}
+	for query, expected := range corrections {
+		corrected, ok := CorrectQuery(1, query)
+		if corrected != expected {
+			t.Errorf("CorrectQuery(%q) = %q, want %q", query, corrected, expected)
+		}
+		if ok != (query != expected) {
+			t.Errorf("CorrectQuery(%q) returned %v", query, ok)
+		}
+	}
+}
+
+func TestSuggestionTrieClosest(t *testing.T) {
+	words := newSuggestionTrie()
+	words.insert("lamp", 1)
+	words.insert("camp", 5)
+	words.finish()
+
+	if match := words.closest("damp", 1); match == nil || match.text != "camp" {
+		t.Errorf("closest(\"damp\") = %v, want camp", match)
+	}
+	if match := words.closest("lamp", 1); match == nil || match.text != "lamp" {
+		t.Errorf("closest(\"lamp\") = %v, want lamp", match)
+	}
+	if match := words.closest("stamps", 1); match != nil {
+		t.Errorf("closest(\"stamps\") = %v, want nothing", match)
+	}
+}
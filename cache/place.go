@@ -18,7 +18,7 @@ func GetPlaceByID(id int) (*models.Place, error) {
 	var place *models.Place
 	var ok bool
 	if place, ok = places[id]; !ok {
-		place, err = models.GetPlaceByID(Base.Db, id)
+		place, err = Base.Store.Places.GetByID(id)
 		if place != nil {
 			places[id] = place
 		}
@@ -0,0 +1,288 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// Suggestions are served from a prefix tree per place, which is rebuilt
+// every few minutes from the listings changed in the search index. Each node
+// keeps its best completions, so a lookup only has to walk down the prefix
+
+const (
+	// MaxSuggestions is the most completions returned for a query
+	MaxSuggestions = 10
+	// suggestionRefreshInterval is how often the prefix trees are rebuilt
+	suggestionRefreshInterval = 5 * time.Minute
+	// suggestionFullRefreshInterval is how often every listing is read again,
+	// rather than only the ones changed since the last refresh
+	suggestionFullRefreshInterval = time.Hour
+	// suggestionRefreshOverlap is how far before the last refresh changes are
+	// read again, so that transactions committed while it ran aren't missed
+	suggestionRefreshOverlap = time.Minute
+	// allPlaces is the key for completions drawn from every place
+	allPlaces = 0
+)
+
+type suggestion struct {
+	text   string
+	weight int
+}
+
+type suggestionNode struct {
+	children map[rune]*suggestionNode
+	// terminal is set if a completion ends at this node
+	terminal *suggestion
+	// best holds the highest weighted completions under this node
+	best []*suggestion
+}
+
+// suggestionTrie is a prefix tree of completions keyed by their lower case
+// text
+type suggestionTrie struct {
+	root *suggestionNode
+}
+
+// placeSuggestions holds the completions available in a single place
+type placeSuggestions struct {
+	words  *suggestionTrie
+	titles *suggestionTrie
+}
+
+var suggestions struct {
+	sync.RWMutex
+	places map[int]*placeSuggestions
+}
+
+// suggestionSources holds the words and title of every listing which can be
+// suggested, keyed by listing ID, so that a refresh only has to read the
+// listings which changed
+var suggestionSources struct {
+	sync.Mutex
+	listings map[int]models.SearchSuggestionSource
+	// refreshed is the database time the sources were last read at
+	refreshed time.Time
+	// fullRefresh is when every listing was last read
+	fullRefresh time.Time
+}
+
+func newSuggestionTrie() *suggestionTrie {
+	return &suggestionTrie{root: &suggestionNode{}}
+}
+
+// insert adds a completion to the trie. Completions with the same key have
+// their weights combined
+func (t *suggestionTrie) insert(text string, weight int) {
+	node := t.root
+	for _, r := range normalizeSuggestion(text) {
+		if node.children == nil {
+			node.children = make(map[rune]*suggestionNode)
+		}
+		child, ok := node.children[r]
+		if !ok {
+			child = &suggestionNode{}
+			node.children[r] = child
+		}
+		node = child
+	}
+	if node.terminal == nil {
+		node.terminal = &suggestion{text: text}
+	}
+	node.terminal.weight += weight
+}
+
+// finish computes the best completions for every node. It must be called
+// after all completions are inserted, and before the trie is searched
+func (t *suggestionTrie) finish() {
+	t.root.finish()
+}
+
+func (n *suggestionNode) finish() {
+	candidates := make([]*suggestion, 0, MaxSuggestions+1)
+	if n.terminal != nil {
+		candidates = append(candidates, n.terminal)
+	}
+	for _, child := range n.children {
+		child.finish()
+		candidates = append(candidates, child.best...)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].weight != candidates[j].weight {
+			return candidates[i].weight > candidates[j].weight
+		}
+		return candidates[i].text < candidates[j].text
+	})
+	if len(candidates) > MaxSuggestions {
+		candidates = candidates[:MaxSuggestions]
+	}
+	n.best = candidates
+}
+
+// find returns the best completions for a prefix
+func (t *suggestionTrie) find(prefix string) []*suggestion {
+	node := t.root
+	for _, r := range prefix {
+		child, ok := node.children[r]
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+	return node.best
+}
+
+// normalizeSuggestion folds the case and accents of text the same way
+// search terms are, and collapses runs of whitespace, so that completions
+// can be matched against what a user has typed
+func normalizeSuggestion(text string) string {
+	words := utils.AccentFoldFilter(utils.CaseFoldFilter(strings.Fields(text)))
+	return strings.Join(words, " ")
+}
+
+// RefreshSuggestions reads the listings whose words or titles changed since
+// the last refresh, and rebuilds the completions for every place. Every
+// listing is read again once suggestionFullRefreshInterval has passed, which
+// drops the listings deleted in the meantime
+func RefreshSuggestions() error {
+	suggestionSources.Lock()
+	defer suggestionSources.Unlock()
+
+	full := suggestionSources.listings == nil ||
+		time.Since(suggestionSources.fullRefresh) >= suggestionFullRefreshInterval
+	var since time.Time
+	if !full {
+		since = suggestionSources.refreshed.Add(-suggestionRefreshOverlap)
+	}
+	sources, asOf, err := models.GetSearchSuggestionSources(Base.Db, since)
+	if err != nil {
+		return err
+	}
+
+	if full {
+		suggestionSources.listings = make(map[int]models.SearchSuggestionSource)
+		suggestionSources.fullRefresh = time.Now()
+	}
+	suggestionSources.refreshed = asOf
+	if !full && len(sources) == 0 {
+		return nil
+	}
+	applySuggestionSources(suggestionSources.listings, sources)
+	places := buildSuggestions(suggestionSources.listings)
+
+	suggestions.Lock()
+	suggestions.places = places
+	suggestions.Unlock()
+	return nil
+}
+
+// applySuggestionSources updates the sources kept for each listing with the
+// ones just read, dropping listings which can't be shown any more
+func applySuggestionSources(listings map[int]models.SearchSuggestionSource,
+	sources []models.SearchSuggestionSource) {
+
+	for _, source := range sources {
+		if source.Visible {
+			listings[source.ListingID] = source
+		} else {
+			delete(listings, source.ListingID)
+		}
+	}
+}
+
+// buildSuggestions builds the completions for every place from the words
+// and titles of its listings
+func buildSuggestions(
+	listings map[int]models.SearchSuggestionSource) map[int]*placeSuggestions {
+
+	// Completions for every place are also kept under allPlaces, for users
+	// who aren't searching within a single place
+	places := make(map[int]*placeSuggestions)
+	for _, source := range listings {
+		for _, placeID := range []int{source.PlaceID, allPlaces} {
+			place, ok := places[placeID]
+			if !ok {
+				place = &placeSuggestions{
+					words:  newSuggestionTrie(),
+					titles: newSuggestionTrie(),
+				}
+				places[placeID] = place
+			}
+			place.titles.insert(source.Title, 1)
+			for _, word := range source.Words {
+				place.words.insert(word, 1)
+			}
+		}
+	}
+	for _, place := range places {
+		place.words.finish()
+		place.titles.finish()
+	}
+	return places
+}
+
+// SuggestionRefresher rebuilds search completions periodically, so that
+// new listings show up as suggestions shortly after they are published
+func SuggestionRefresher() {
+	for {
+		start := time.Now()
+		if err := RefreshSuggestions(); err != nil {
+			fmt.Println("[ERROR] cache.SuggestionRefresher: " + err.Error())
+		} else {
+			fmt.Println("[INFO] cache.SuggestionRefresher: rebuilt in " +
+				strconv.FormatInt(int64(time.Since(start)/time.Millisecond), 10) +
+				"ms")
+		}
+		time.Sleep(suggestionRefreshInterval)
+	}
+}
+
+// GetSuggestions gets completions for a partially typed query in a place,
+// or in every place if placeID is 0. Listing titles starting with the query
+// are suggested first, followed by the query with its last word completed
+func GetSuggestions(placeID int, query string) []string {
+	suggestions.RLock()
+	place, ok := suggestions.places[placeID]
+	suggestions.RUnlock()
+
+	query = normalizeSuggestion(query)
+	if !ok || len(query) == 0 {
+		return []string{}
+	}
+
+	results := make([]string, 0, MaxSuggestions)
+	seen := make(map[string]bool)
+	add := func(text string) {
+		key := normalizeSuggestion(text)
+		if !seen[key] && len(results) < MaxSuggestions {
+			seen[key] = true
+			results = append(results, text)
+		}
+	}
+
+	for _, title := range place.titles.find(query) {
+		add(title.text)
+	}
+
+	// Only the word being typed is completed; the words before it are left
+	// alone
+	var before string
+	last := query
+	if i := strings.LastIndex(query, " "); i >= 0 {
+		before = query[:i+1]
+		last = query[i+1:]
+	}
+	if len(last) > 0 {
+		for _, word := range place.words.find(last) {
+			add(before + word.text)
+		}
+	}
+
+	return results
+}
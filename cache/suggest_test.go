@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anishmgoyal/calagora/models"
+)
+
+func TestSuggestionTrie(t *testing.T) {
+	trie := newSuggestionTrie()
+	trie.insert("calculus", 3)
+	trie.insert("calendar", 5)
+	trie.insert("camera", 1)
+	trie.insert("Calculus", 1)
+	trie.finish()
+
+	var texts []string
+	for _, s := range trie.find("cal") {
+		texts = append(texts, s.text)
+	}
+	if want := []string{"calendar", "calculus"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("find(\"cal\") = %v, want %v", texts, want)
+	}
+	if found := trie.find("calc"); len(found) != 1 || found[0].weight != 4 {
+		t.Errorf("find(\"calc\") = %v, want calculus with weight 4", found)
+	}
+	if found := trie.find("dog"); len(found) != 0 {
+		t.Errorf("find(\"dog\") = %v, want nothing", found)
+	}
+}
+
+func TestNormalizeSuggestion(t *testing.T) {
+	tests := map[string]string{
+		"café":              "cafe",
+		"Résumé":            "resume",
+		"  Crème   Brûlée ": "creme brulee",
+		"TI-84 Plus":        "ti-84 plus",
+	}
+	for text, expected := range tests {
+		if normalized := normalizeSuggestion(text); normalized != expected {
+			t.Errorf("Expected %q to normalize to %q, got %q", text, expected,
+				normalized)
+		}
+	}
+}
+
+func TestGetSuggestions(t *testing.T) {
+	words := newSuggestionTrie()
+	words.insert("calculus", 2)
+	words.insert("chemistry", 1)
+	words.finish()
+	titles := newSuggestionTrie()
+	titles.insert("Calculus Early Transcendentals", 1)
+	titles.finish()
+
+	suggestions.places = map[int]*placeSuggestions{
+		1: {words: words, titles: titles},
+	}
+	defer func() { suggestions.places = nil }()
+
+	got := GetSuggestions(1, "Calc")
+	want := []string{"Calculus Early Transcendentals", "calculus"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSuggestions(\"Calc\") = %v, want %v", got, want)
+	}
+
+	got = GetSuggestions(1, "intro  ch")
+	want = []string{"intro chemistry"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSuggestions(\"intro  ch\") = %v, want %v", got, want)
+	}
+
+	if got := GetSuggestions(2, "calc"); len(got) != 0 {
+		t.Errorf("GetSuggestions for an unknown place = %v, want nothing", got)
+	}
+}
+
+func TestBuildSuggestions(t *testing.T) {
+	listings := make(map[int]models.SearchSuggestionSource)
+	applySuggestionSources(listings, []models.SearchSuggestionSource{
+		{ListingID: 1, PlaceID: 1, Title: "Calculus", Visible: true,
+			Words: []string{"calculus", "textbook"}},
+		{ListingID: 2, PlaceID: 2, Title: "Camera", Visible: true,
+			Words: []string{"camera"}},
+		{ListingID: 3, PlaceID: 1, Title: "Calendar", Visible: true,
+			Words: []string{"calendar", "textbook"}},
+	})
+	// The second listing was put on hold
+	applySuggestionSources(listings, []models.SearchSuggestionSource{
+		{ListingID: 2, PlaceID: 2, Title: "Camera", Words: []string{"camera"}},
+	})
+
+	places := buildSuggestions(listings)
+	if _, ok := places[2]; ok {
+		t.Error("Got suggestions for a listing on hold")
+	}
+	if found := places[1].words.find("text"); len(found) != 1 ||
+		found[0].weight != 2 {
+
+		t.Errorf("find(\"text\") = %v, want textbook with weight 2", found)
+	}
+	if found := places[allPlaces].titles.find("ca"); len(found) != 2 {
+		t.Errorf("find(\"ca\") = %v, want two titles", found)
+	}
+}
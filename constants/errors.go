@@ -19,6 +19,11 @@ const (
 	// Error404 is to be sent when a requested resource was not found
 	Error404 = "not_found"
 
+	// ErrorConflict is to be sent when an action can't be performed because
+	// of the state a resource is in, such as accepting an offer on a listing
+	// which was already sold
+	ErrorConflict = "state_conflict"
+
 	// Error500 is a catch-all that can be sent on error
 	Error500 = "internal_error"
 )
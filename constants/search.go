@@ -2,6 +2,35 @@ package constants
 
 const (
 	// StopWords are words that are to be ignored by the search tool
-	StopWords = "and are for from has she that the was what when where who why " +
-		"will with yes"
+	StopWords = "an and are as at be by for from has in is it of on or she " +
+		"that the to was what when where who why will with yes"
+
+	// SearchConfiguration is the PostgreSQL text search configuration used
+	// to build and query the full text search index. Text is broken into
+	// terms by utils.SearchAnalyzer before it reaches PostgreSQL, so the
+	// configuration does no stemming or stop word removal of its own
+	SearchConfiguration = "simple"
+
+	// SearchAnalyzerVersion identifies the analyzer used to build the
+	// search index. It must be increased whenever utils.SearchAnalyzer or
+	// SearchSynonyms change, or what is indexed changes, so that listings
+	// and wanted posts are indexed again and saved searches are compiled
+	// again
+	SearchAnalyzerVersion = 3
 )
+
+// SearchSynonyms maps words to the word they should be searchable as.
+// Both listings and queries have their words replaced, so a search for
+// either word finds listings using either word
+var SearchSynonyms = map[string]string{
+	"couch":     "sofa",
+	"settee":    "sofa",
+	"tv":        "television",
+	"telly":     "television",
+	"bike":      "bicycle",
+	"fridge":    "refrigerator",
+	"mic":       "microphone",
+	"earphones": "headphones",
+	"sneakers":  "shoes",
+	"trainers":  "shoes",
+}
@@ -47,6 +47,15 @@ var DatabaseHost = "localhost:5432"
 // DatabaseExtraArgs is a query string with any connection parameters
 var DatabaseExtraArgs = "?sslmode=disable"
 
+// MigrateOnStart decides if pending schema migrations are applied when the
+// server starts
+var MigrateOnStart = false
+
+// UseMemoryStore decides if the server keeps everything in memory instead
+// of connecting to the database, for tests and demos. Search and the
+// features built on it aren't available without the database
+var UseMemoryStore = false
+
 // DoSendEmails decides if emails are sent out by the application
 var DoSendEmails = false
 
@@ -80,6 +89,20 @@ var SMTPAuthUser = ""
 // SMTPAuthPassword is the password for smtp
 var SMTPAuthPassword = ""
 
+// AdminUsernames is a comma separated list of users who may see admin pages
+var AdminUsernames = ""
+
+// IsAdminUsername returns true if a username is listed in AdminUsernames
+func IsAdminUsername(username string) bool {
+	for _, admin := range strings.Split(AdminUsernames, ",") {
+		admin = strings.TrimSpace(admin)
+		if len(admin) > 0 && strings.EqualFold(admin, username) {
+			return true
+		}
+	}
+	return false
+}
+
 // LoadEnvironmentSettings loads settings from environment variables
 func LoadEnvironmentSettings() {
 	loadIntSetting(&PortNum, "CALAGORA_PORT_NUM")
@@ -93,6 +116,8 @@ func LoadEnvironmentSettings() {
 	loadStringSetting(&DatabasePassword, "CALAGORA_DB_PWORD")
 	loadStringSetting(&DatabaseHost, "CALAGORA_DB_HOST")
 	loadStringSetting(&DatabaseExtraArgs, "CALAGORA_DB_ARGS")
+	loadBooleanSetting(&MigrateOnStart, "CALAGORA_MIGRATE_ON_START")
+	loadBooleanSetting(&UseMemoryStore, "CALAGORA_MEMORY_STORE")
 
 	loadBooleanSetting(&DoSendEmails, "CALAGORA_SEND_EMAILS")
 	loadBooleanSetting(&DoUploadAWS, "CALAGORA_UPLOAD_AWS")
@@ -108,6 +133,8 @@ func LoadEnvironmentSettings() {
 	loadStringSetting(&SMTPPort, "CALAGORA_SMTP_PORT")
 	loadStringSetting(&SMTPAuthUser, "CALAGORA_SMTP_USER")
 	loadStringSetting(&SMTPAuthPassword, "CALAGORA_SMTP_PASS")
+
+	loadStringSetting(&AdminUsernames, "CALAGORA_ADMINS")
 }
 
 func loadBooleanSetting(setting *bool, envKey string) {
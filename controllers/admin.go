@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/cache"
+	"github.com/anishmgoyal/calagora/constants"
+	"github.com/anishmgoyal/calagora/models"
+)
+
+const (
+	// adminSearchReportSize is the number of queries in each list in the
+	// search report
+	adminSearchReportSize = 50
+	// adminSearchReportDays is how many days the search report covers by
+	// default
+	adminSearchReportDays = 30
+)
+
+type adminSearchViewData struct {
+	Report     *models.SearchReport
+	Days       int
+	DayOptions []int
+	PlaceID    int
+	PlaceName  string
+}
+
+// IsAdmin returns true if the user is logged in as an admin
+func (vd ViewData) IsAdmin() bool {
+	return vd.Session != nil &&
+		constants.IsAdminUsername(vd.Session.User.Username)
+}
+
+// AdminSearch handles the route '/admin/search/'
+func AdminSearch(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+	if !viewData.IsAdmin() {
+		viewData.Forbidden(w)
+		return
+	}
+
+	days := adminSearchReportDays
+	if len(r.FormValue("days")) > 0 {
+		var err error
+		days, err = strconv.Atoi(r.FormValue("days"))
+		if err != nil || days < 1 || days > 365 {
+			viewData.NotFound(w)
+			return
+		}
+	}
+
+	data := &adminSearchViewData{
+		Days:       days,
+		DayOptions: []int{1, 7, 30, 90, 365},
+	}
+	if len(r.FormValue("place")) > 0 {
+		placeID, err := strconv.Atoi(r.FormValue("place"))
+		if err != nil || placeID <= 0 {
+			viewData.NotFound(w)
+			return
+		}
+		place, err := cache.GetPlaceByID(placeID)
+		if err != nil || place == nil {
+			viewData.NotFound(w)
+			return
+		}
+		data.PlaceID = placeID
+		data.PlaceName = place.Name
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	report, err := models.GetSearchReport(Base.Db, data.PlaceID, since,
+		adminSearchReportSize)
+	if err != nil {
+		viewData.InternalError(w)
+		return
+	}
+	data.Report = report
+
+	viewData.Data = data
+	RenderView(w, "admin#search", viewData)
+}
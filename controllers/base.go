@@ -38,8 +38,11 @@ type MessageViewData struct {
 var Base struct {
 	// Templates contains all views available to controllers
 	Templates map[string]*template.Template
-	// DB is the database connection to be used by controllers and passed to models
+	// DB is the database connection to be used by controllers and passed to models.
+	// It is nil when running on the memory store
 	Db *sql.DB
+	// Store is where controllers load and save models
+	Store *models.Store
 	// SupportEmail is the email address to provide users with on errors
 	SupportEmail string
 	// ImageChannel is a channel in which image process requests can be enqueued
@@ -49,25 +52,31 @@ var Base struct {
 }
 
 // BaseInitialization initializes all controllers
-func BaseInitialization(templates map[string]*template.Template, db *sql.DB) {
+func BaseInitialization(templates map[string]*template.Template, db *sql.DB,
+	store *models.Store) {
+
 	Base.Templates = templates
 	Base.Db = db
+	Base.Store = store
 	Base.SupportEmail = constants.SupportEmail
 	Base.ImageChannel = utils.StartImageService()
-	Base.WebsockChannel = wsock.StartWebsocketService(db)
+	Base.WebsockChannel = wsock.StartWebsocketService(Base.Store)
+
+	models.OnListingIndexed = alertSavedSearches
 }
 
 // BaseViewData gets any fields necessary for rendering a basic view
 func BaseViewData(w http.ResponseWriter, r *http.Request) ViewData {
-	session := models.GetSessionFromRequest(Base.Db, w, r)
+	session := models.GetSessionFromRequest(Base.Store.Sessions, w, r)
 	if session != nil {
 		// Keeps active sessions alive over time
-		go session.Update(Base.Db)
+		go Base.Store.Sessions.Update(session)
 	}
 	return ViewData{
 		Session: session,
 		Data:    nil,
 		Constants: map[string]interface{}{
+			"listing.attributes":     models.ListingAttributes,
 			"listing.conditionnames": models.ListingConditionNames,
 			"listing.conditions":     models.ListingConditions,
 			"listing.typenames":      models.ListingTypeNames,
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anishmgoyal/calagora/constants"
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+type bookViewData struct {
+	ISBN string
+	// Book is the catalog entry for the ISBN, which is nil if the book
+	// isn't in the catalog
+	Book   *models.Book
+	Copies []models.Listing
+}
+
+type webAPIBookResponse struct {
+	Successful bool         `json:"successful"`
+	Error      string       `json:"error,omitempty"`
+	Book       *models.Book `json:"book,omitempty"`
+}
+
+// BookView handles the route '/book/', which compares the copies of a
+// textbook listed at the user's place
+func BookView(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+
+	args := URIArgs(r)
+	if len(args) != 1 {
+		viewData.NotFound(w)
+		return
+	}
+	isbn, ok := utils.NormalizeISBN(args[0])
+	if !ok {
+		viewData.NotFound(w)
+		return
+	}
+
+	book, err := models.GetBookByISBN(Base.Db, isbn)
+	if err != nil {
+		viewData.InternalError(w)
+		return
+	}
+
+	options := bookCopiesQueryOpts(isbn)
+	if viewData.Session != nil {
+		options.PlaceID = viewData.Session.User.PlaceID
+		options.RestrictByPlace = true
+	}
+	copies := Base.Store.Listings.GetList(options)
+	if book == nil && len(copies) == 0 {
+		viewData.NotFound(w)
+		return
+	}
+
+	viewData.Data = &bookViewData{
+		ISBN:   isbn,
+		Book:   book,
+		Copies: copies,
+	}
+	RenderView(w, "book#view", viewData)
+}
+
+// WebAPIBook handles the route '/webapi/book/', which looks up a book in
+// the catalog by its ISBN so that a textbook listing can be filled in
+func WebAPIBook(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	response := webAPIBookResponse{
+		Successful: false,
+	}
+	if viewData.Session == nil {
+		response.Error = constants.ErrorAuth
+		RenderJSON(w, response)
+		return
+	}
+
+	if _, ok := utils.NormalizeISBN(r.FormValue("isbn")); !ok {
+		response.Error = constants.ErrorArguments
+		RenderJSON(w, response)
+		return
+	}
+
+	book, err := models.GetBookByISBN(Base.Db, r.FormValue("isbn"))
+	if err != nil {
+		response.Error = constants.Error500
+		RenderJSON(w, response)
+		return
+	} else if book == nil {
+		response.Error = constants.Error404
+		RenderJSON(w, response)
+		return
+	}
+
+	response.Successful = true
+	response.Book = book
+	RenderJSON(w, response)
+}
+
+// fillFromBookCatalog fills in the name and edition of a textbook listing
+// from the catalog, if the seller left them blank. This is done in the page
+// as the ISBN is entered, so it only matters without JavaScript
+func fillFromBookCatalog(listing *models.Listing) {
+	if listing.Type != models.ListingTextbook ||
+		len(listing.Attributes["isbn"]) == 0 || Base.Db == nil {
+
+		return
+	}
+	// The listing can still be created without the catalog, so errors are
+	// ignored
+	book, err := models.GetBookByISBN(Base.Db, listing.Attributes["isbn"])
+	if err != nil || book == nil {
+		return
+	}
+	if len(strings.TrimSpace(listing.Name)) == 0 {
+		listing.Name = book.Title
+		for len(listing.Name) > 40 {
+			_, size := utf8.DecodeLastRuneInString(listing.Name)
+			listing.Name = listing.Name[:len(listing.Name)-size]
+		}
+		listing.Name = strings.TrimSpace(listing.Name)
+	}
+	if len(strings.TrimSpace(listing.Attributes["edition"])) == 0 &&
+		len(book.Edition) > 0 {
+
+		listing.Attributes["edition"] = book.Edition
+	}
+}
+
+// bookCopiesQueryOpts builds the options for finding the copies of a
+// textbook which can still be bought, cheapest first
+func bookCopiesQueryOpts(isbn string) models.ListingQueryOpts {
+	return models.ListingQueryOpts{
+		ISBN:             isbn,
+		Status:           models.ListingListed,
+		RestrictByStatus: true,
+		HideDraft:        true,
+		HideExpired:      true,
+		Sort:             models.SortPriceAsc,
+	}
+}
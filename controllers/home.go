@@ -3,8 +3,6 @@ package controllers
 import (
 	"net/http"
 	"strings"
-
-	"github.com/anishmgoyal/calagora/models"
 )
 
 type homeData struct {
@@ -59,12 +57,12 @@ func (vd ViewData) Forbidden(w http.ResponseWriter) {
 func (vd ViewData) WrongPlace(w http.ResponseWriter, aPlaceID,
 	bPlaceID int) {
 
-	aPlace, err := models.GetPlaceByID(Base.Db, aPlaceID)
+	aPlace, err := Base.Store.Places.GetByID(aPlaceID)
 	if err != nil {
 		vd.InternalError(w)
 		return
 	}
-	bPlace, err := models.GetPlaceByID(Base.Db, bPlaceID)
+	bPlace, err := Base.Store.Places.GetByID(bPlaceID)
 	if err != nil {
 		vd.InternalError(w)
 		return
@@ -41,13 +41,13 @@ func WebAPIImageDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	image, err := models.GetImageByID(Base.Db, id)
+	image, err := Base.Store.Images.GetByID(id)
 	if err != nil || image.User.ID != viewData.Session.User.ID {
 		RenderJSON(w, response)
 		return
 	}
 
-	ok, err := image.Delete(Base.Db)
+	ok, err := Base.Store.Images.Delete(image)
 	if !ok && err != nil {
 		log.Println("Failed to delete file: ", err)
 		RenderJSON(w, response)
@@ -103,7 +103,7 @@ func WebAPIImageMeta(w http.ResponseWriter, r *http.Request) {
 			response.Images = append(response.Images, meta)
 			continue
 		}
-		image, err := models.GetImageByID(Base.Db, id)
+		image, err := Base.Store.Images.GetByID(id)
 		if err != nil || image.User.ID != viewData.Session.User.ID {
 			meta := imageMetaData{
 				ID:         idStr,
@@ -9,32 +9,112 @@ import (
 	"github.com/anishmgoyal/calagora/cache"
 	"github.com/anishmgoyal/calagora/constants"
 	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
 )
 
 type listingCreateData struct {
-	HasError bool
-	Error    models.ListingError
-	Listing  models.Listing
+	HasError   bool
+	Error      models.ListingError
+	Listing    models.Listing
+	Rules      models.OfferRules
+	RulesError models.OfferRulesError
+	// PublishAtClient is the time the draft is scheduled to be published,
+	// as shown in the form
+	PublishAtClient string
 }
 
 type listingEditData struct {
-	HasError bool
-	Error    models.ListingError
-	Listing  models.Listing
-	Images   []models.Image
+	HasError   bool
+	Error      models.ListingError
+	Listing    models.Listing
+	Images     []models.Image
+	Rules      models.OfferRules
+	RulesError models.OfferRulesError
+	// PublishAtClient is the time the draft is scheduled to be published,
+	// as shown in the form
+	PublishAtClient string
+}
+
+// listingAttributesFromForm reads the attributes for a listing type from
+// the form values attr_<name>. Attributes of other types are ignored, so
+// that switching a listing's type drops the ones it no longer has
+func listingAttributesFromForm(r *http.Request,
+	typeName string) map[string]string {
+
+	attributes := make(map[string]string)
+	for _, attr := range models.ListingAttributes[typeName] {
+		if value := r.FormValue("attr_" + attr.Name); len(value) > 0 {
+			attributes[attr.Name] = value
+		}
+	}
+	return attributes
+}
+
+// offerRulesFromForm reads a seller's offer rules from the form values
+// auto_accept, auto_decline and auto_decline_reply. A blank price leaves
+// its rule unset. The rules are returned with an error if they aren't valid
+func offerRulesFromForm(r *http.Request) (models.OfferRules,
+	*models.OfferRulesError) {
+
+	rules := models.OfferRules{
+		AcceptAtClient:     strings.TrimSpace(r.FormValue("auto_accept")),
+		DeclineBelowClient: strings.TrimSpace(r.FormValue("auto_decline")),
+		DeclineReply:       r.FormValue("auto_decline_reply"),
+	}
+
+	rulesErr := models.OfferRulesError{}
+	valid := true
+	if len(rules.AcceptAtClient) > 0 {
+		price, err := utils.PriceClientToServer(rules.AcceptAtClient)
+		if err != nil {
+			rulesErr.AcceptAt = "This must be a valid price"
+			valid = false
+		} else {
+			rules.AcceptAt = &price
+		}
+	}
+	if len(rules.DeclineBelowClient) > 0 {
+		price, err := utils.PriceClientToServer(rules.DeclineBelowClient)
+		if err != nil {
+			rulesErr.DeclineBelow = "This must be a valid price"
+			valid = false
+		} else {
+			rules.DeclineBelow = &price
+		}
+	}
+	if valid {
+		valid, rulesErr = rules.Validate()
+	}
+	if !valid {
+		return rules, &rulesErr
+	}
+	return rules, nil
 }
 
 type listingViewData struct {
 	Listing  models.Listing
 	Offer    *models.Offer
 	Images   []models.Image
+	Similar  []models.Listing
 	IsSeller bool
+	// Copies are the other listings for the same textbook, when the listing
+	// has an ISBN
+	Copies []models.Listing
 }
 
 type listingSectionData struct {
 	ActiveLink string
 	Type       string
 	TypeStr    string
+	Sorts      []sortOption
+}
+
+// listingFeedSorts are the orders the listing feed can be sorted in.
+// Relevance is left out, as there is no query to rank listings against
+var listingFeedSorts = []string{
+	models.SortNewest,
+	models.SortPriceAsc,
+	models.SortPriceDesc,
 }
 
 // WebAPIListings handles the route '/webapi/listings/'
@@ -71,17 +151,41 @@ func WebAPIListings(w http.ResponseWriter, r *http.Request) {
 	opts.RestrictByStatus = true
 
 	opts.HideDraft = true
+	opts.HideExpired = true
+
+	opts.Sort = listingFeedSort(r.FormValue("sort"))
+
+	// A cursor takes precedence over pageNum, so that listings posted while
+	// a user is paging through the feed don't push duplicates onto later
+	// pages
+	cursorStr := r.FormValue("cursor")
+	if len(cursorStr) > 0 {
+		opts.Cursor, err = models.ParseListingCursor(cursorStr)
+		if err != nil {
+			RenderJSON(w, nil)
+			return
+		}
+	}
 
 	opts.PageSize = pageSize
 	opts.PageNum = pageNum
 	opts.UsePaging = true
 
-	listings := models.GetListingList(Base.Db, opts)
+	listings := Base.Store.Listings.GetList(opts)
 	cache.MapPlaceToListings(listings)
+
+	// The next cursor is sent as a header so that the body stays a plain
+	// array of listings for existing clients
+	if len(listings) > 0 && len(listings) == pageSize {
+		w.Header().Set("X-Next-Cursor", models.NewListingCursor(opts.Sort,
+			&listings[len(listings)-1]).String())
+	}
 	RenderJSON(w, listings)
 }
 
-// WebAPIListingsUser handles the route '/webapi/listings/user/'
+// WebAPIListingsUser handles the route '/webapi/listings/user/'. Sellers
+// see their own drafts among their listings, and can get only their drafts
+// by passing drafts=only, or leave them out by passing drafts=none
 func WebAPIListingsUser(w http.ResponseWriter, r *http.Request) {
 	viewData := BaseViewData(w, r)
 	args := URIArgs(r)
@@ -97,8 +201,17 @@ func WebAPIListingsUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Drafts are only shown to their seller
+	isSeller := viewData.Session != nil && viewData.Session.User.ID == id
+	drafts := r.FormValue("drafts")
 	opts := models.ListingQueryOpts{}
-	opts.HideDraft = viewData.Session == nil || viewData.Session.User.ID != id
+	if isSeller && drafts == "only" {
+		opts.HidePublished = true
+	} else {
+		opts.HideDraft = !isSeller || drafts == "none"
+	}
+	opts.HideHeld = !isSeller
+	opts.HideExpired = !isSeller
 
 	opts.UserID = id
 	opts.RestrictByUser = true
@@ -123,15 +236,98 @@ func WebAPIListingsUser(w http.ResponseWriter, r *http.Request) {
 		pageNum = 0
 	}
 
+	opts.Sort = listingFeedSort(r.FormValue("sort"))
+
+	// A cursor takes precedence over pageNum, so that listings posted while
+	// a user is paging through the feed don't push duplicates onto later
+	// pages
+	cursorStr := r.FormValue("cursor")
+	if len(cursorStr) > 0 {
+		opts.Cursor, err = models.ParseListingCursor(cursorStr)
+		if err != nil {
+			RenderJSON(w, nil)
+			return
+		}
+	}
+
 	opts.PageSize = pageSize
 	opts.PageNum = pageNum
 	opts.UsePaging = true
 
-	listings := models.GetListingList(Base.Db, opts)
+	listings := Base.Store.Listings.GetList(opts)
 	cache.MapPlaceToListings(listings)
+
+	// The next cursor is sent as a header so that the body stays a plain
+	// array of listings for existing clients
+	if len(listings) > 0 && len(listings) == pageSize {
+		w.Header().Set("X-Next-Cursor", models.NewListingCursor(opts.Sort,
+			&listings[len(listings)-1]).String())
+	}
 	RenderJSON(w, listings)
 }
 
+type webAPIListingSimilarResponse struct {
+	Successful bool             `json:"successful"`
+	Error      string           `json:"error,omitempty"`
+	Listings   []models.Listing `json:"listings"`
+}
+
+// WebAPIListingSimilar handles the route '/webapi/listing/similar/'
+func WebAPIListingSimilar(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	response := webAPIListingSimilarResponse{
+		Successful: false,
+	}
+
+	args := URIArgs(r)
+	if len(args) != 1 {
+		response.Error = constants.ErrorArguments
+		RenderJSON(w, response)
+		return
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		response.Error = constants.Error404
+		RenderJSON(w, response)
+		return
+	}
+
+	listing, err := Base.Store.Listings.GetByID(id)
+	if err != nil || listing == nil {
+		response.Error = constants.Error404
+		RenderJSON(w, response)
+		return
+	}
+
+	isSeller := viewData.Session != nil &&
+		viewData.Session.User.ID == listing.User.ID
+	if !isSeller && !listing.Published {
+		response.Error = constants.Error404
+		RenderJSON(w, response)
+		return
+	}
+	if viewData.Session != nil &&
+		listing.User.PlaceID != viewData.Session.User.PlaceID {
+
+		response.Error = constants.Error403
+		RenderJSON(w, response)
+		return
+	}
+
+	similar, err := listing.GetSimilarListings(Base.Db,
+		models.SimilarListingsCount)
+	if err != nil {
+		response.Error = constants.Error500
+		RenderJSON(w, response)
+		return
+	}
+
+	response.Successful = true
+	response.Listings = similar
+	RenderJSON(w, response)
+}
+
 type webAPIListingDeleteResponse struct {
 	Successful bool   `json:"successful"`
 	Error      string `json:"error,omitempty"`
@@ -170,7 +366,7 @@ func WebAPIListingDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if err != nil || listing == nil {
 		response.Error = constants.Error404
 		RenderJSON(w, response)
@@ -184,7 +380,7 @@ func WebAPIListingDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok, _ := listing.Delete(Base.Db); !ok {
+	if ok, _ := Base.Store.Listings.Delete(listing); !ok {
 		response.Error = constants.Error500
 		RenderJSON(w, response)
 		return
@@ -231,22 +427,46 @@ func postCreate(w http.ResponseWriter, r *http.Request) {
 			Description: r.FormValue("description"),
 			User:        viewData.Session.User,
 		}
+		listing.Attributes = listingAttributesFromForm(r, listing.Type)
+		listing.PublishAt = listingPublishAtFromForm(r)
+		fillFromBookCatalog(&listing)
 
 		if strings.Compare(r.FormValue("submissionType"), "publish") == 0 {
 			listing.Published = true
 		}
 
-		valid, listingErr := listing.Create(Base.Db)
+		rules, rulesErr := offerRulesFromForm(r)
+		if rulesErr != nil {
+			viewData.Data = &listingCreateData{
+				HasError:        true,
+				Listing:         listing,
+				Rules:           rules,
+				RulesError:      *rulesErr,
+				PublishAtClient: r.FormValue("publish_at"),
+			}
+			RenderView(w, "listing#create", viewData)
+			return
+		}
+
+		valid, listingErr := Base.Store.Listings.Create(&listing)
 
 		if valid {
+			// The rules were already validated, so this can only fail on an
+			// error which has been logged
+			rules.ListingID = listing.ID
+			Base.Store.Listings.SaveOfferRules(&rules)
+
 			if (strings.Compare(r.FormValue("submissionType"), "addim")) == 0 {
 				// Here we set the checkbox to true for the user so that they
-				// don't accidentally leave new listings in draft state
-				listing.Published = true
+				// don't accidentally leave new listings in draft state, unless
+				// they scheduled the listing to be published later
+				listing.Published = !listing.IsScheduled()
 				viewData.Data = &listingEditData{
-					HasError: false,
-					Listing:  listing,
-					Images:   []models.Image{},
+					HasError:        false,
+					Listing:         listing,
+					Images:          []models.Image{},
+					Rules:           rules,
+					PublishAtClient: listingPublishAtClient(&listing),
 				}
 				RenderView(w, "listing#edit", viewData)
 			} else {
@@ -255,9 +475,11 @@ func postCreate(w http.ResponseWriter, r *http.Request) {
 			}
 		} else {
 			viewData.Data = &listingCreateData{
-				HasError: true,
-				Error:    *listingErr,
-				Listing:  listing,
+				HasError:        true,
+				Error:           *listingErr,
+				Listing:         listing,
+				Rules:           rules,
+				PublishAtClient: r.FormValue("publish_at"),
 			}
 			RenderView(w, "listing#create", viewData)
 		}
@@ -296,14 +518,14 @@ func getEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if err != nil || listing == nil {
 		viewData.NotFound(w)
 		return
 	}
 	cache.MapPlaceToListing(listing)
 
-	images, err := listing.GetImages(Base.Db)
+	images, err := Base.Store.Images.GetForListing(listing)
 	if err != nil {
 		viewData.InternalError(w)
 		return
@@ -314,10 +536,18 @@ func getEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rules, err := Base.Store.Listings.GetOfferRules(listing.ID)
+	if err != nil {
+		viewData.InternalError(w)
+		return
+	}
+
 	viewData.Data = &listingEditData{
-		HasError: false,
-		Listing:  *listing,
-		Images:   images,
+		HasError:        false,
+		Listing:         *listing,
+		Images:          images,
+		Rules:           *rules,
+		PublishAtClient: listingPublishAtClient(listing),
 	}
 	RenderView(w, "listing#edit", viewData)
 }
@@ -342,20 +572,25 @@ func postEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if listing == nil && err != nil {
 		viewData.NotFound(w)
 		return
 	}
 	cache.MapPlaceToListing(listing)
 
+	if listing.User.ID != viewData.Session.User.ID {
+		viewData.Forbidden(w)
+		return
+	}
+
 	primaryImage := r.FormValue("primaryImage")
 	primaryImageID, err := strconv.Atoi(primaryImage)
 	if err == nil {
 		// If this fails, it will currently silently fail. Need an
 		// unintrusive way of notifying the user, since the rest of the
 		// edit could succeed
-		listing.UpdatePrimaryImage(Base.Db, primaryImageID)
+		Base.Store.Images.SetPrimary(listing, primaryImageID)
 	}
 
 	listing.Name = r.FormValue("name")
@@ -363,26 +598,45 @@ func postEdit(w http.ResponseWriter, r *http.Request) {
 	listing.Type = r.FormValue("type")
 	listing.Condition = r.FormValue("condition")
 	listing.Description = r.FormValue("description")
+	listing.Attributes = listingAttributesFromForm(r, listing.Type)
 	listing.Published = strings.Compare(r.FormValue("published"), "1") == 0
+	listing.PublishAt = listingPublishAtFromForm(r)
 
-	valid, listingErr := listing.Save(Base.Db)
+	rules, rulesErr := offerRulesFromForm(r)
+	rules.ListingID = listing.ID
+	var listingErr *models.ListingError
+	valid := rulesErr == nil
+	if valid {
+		valid, listingErr = Base.Store.Listings.Save(listing)
+	}
+	if valid {
+		valid, rulesErr = Base.Store.Listings.SaveOfferRules(&rules)
+	}
 
 	if valid {
 		http.Redirect(w, r, "/listing/view/"+strconv.Itoa(listing.ID),
 			http.StatusFound)
 	} else {
-		images, err := listing.GetImages(Base.Db)
+		images, err := Base.Store.Images.GetForListing(listing)
 		if err != nil {
 			viewData.InternalError(w)
 			return
 		}
 
-		viewData.Data = &listingEditData{
-			HasError: true,
-			Error:    *listingErr,
-			Listing:  *listing,
-			Images:   images,
+		data := &listingEditData{
+			HasError:        true,
+			Listing:         *listing,
+			Images:          images,
+			Rules:           rules,
+			PublishAtClient: r.FormValue("publish_at"),
 		}
+		if listingErr != nil {
+			data.Error = *listingErr
+		}
+		if rulesErr != nil {
+			data.RulesError = *rulesErr
+		}
+		viewData.Data = data
 		RenderView(w, "listing#edit", viewData)
 	}
 }
@@ -404,7 +658,7 @@ func ListingView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if listing == nil || err != nil {
 		viewData.NotFound(w)
 		return
@@ -418,7 +672,7 @@ func ListingView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	images, err := listing.GetImages(Base.Db)
+	images, err := Base.Store.Images.GetForListing(listing)
 	if err != nil {
 		viewData.InternalError(w)
 		return
@@ -437,14 +691,45 @@ func ListingView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Listings opened from search results are counted as clicks on the
+	// search, for the search report
+	if searchID, err := strconv.Atoi(r.FormValue("sq")); err == nil &&
+		searchID > 0 && !isSeller && Base.Db != nil {
+
+		position, _ := strconv.Atoi(r.FormValue("pos"))
+		go models.RecordSearchClick(Base.Db, searchID, listing.ID, position)
+	}
+
 	lvd := &listingViewData{
 		Listing:  *listing,
 		Images:   images,
 		IsSeller: isSeller,
 	}
+	attachReputations(&lvd.Listing.User)
+
+	// Similar listings are nice to have, so the listing is still shown if
+	// they can't be found, or there is no search index on the memory store
+	if Base.Db != nil {
+		similar, err := listing.GetSimilarListings(Base.Db,
+			models.SimilarListingsCount)
+		if err == nil {
+			lvd.Similar = similar
+		}
+	}
+
+	if isbn := listing.Attributes["isbn"]; len(isbn) > 0 {
+		options := bookCopiesQueryOpts(isbn)
+		options.PlaceID = listing.User.PlaceID
+		options.RestrictByPlace = true
+		for _, other := range Base.Store.Listings.GetList(options) {
+			if other.ID != listing.ID {
+				lvd.Copies = append(lvd.Copies, other)
+			}
+		}
+	}
 
 	if viewData.Session != nil && !isSeller && listing != nil {
-		offer, err := viewData.Session.User.GetOfferOnListing(Base.Db, listing.ID)
+		offer, err := Base.Store.Offers.GetOnListing(&viewData.Session.User, listing.ID)
 		if err == nil && offer != nil {
 			lvd.Offer = offer
 		}
@@ -490,7 +775,7 @@ func postListingDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if err != nil || listing == nil ||
 		listing.User.ID != viewData.Session.User.ID {
 
@@ -499,7 +784,7 @@ func postListingDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	cache.MapPlaceToListing(listing)
 
-	ok, err := listing.Delete(Base.Db)
+	ok, err := Base.Store.Listings.Delete(listing)
 	if !ok {
 		if err != nil {
 			fmt.Println(err.Error())
@@ -527,12 +812,14 @@ func ListingSection(w http.ResponseWriter, r *http.Request) {
 
 func getListingSection(w http.ResponseWriter, r *http.Request) {
 	viewData := BaseViewData(w, r)
+	sorts := sortOptions(listingFeedSorts, listingFeedSort(r.FormValue("sort")))
 	args := URIArgs(r)
 	if len(args) == 0 {
 		viewData.Data = listingSectionData{
 			ActiveLink: "lnk_all",
 			Type:       "",
 			TypeStr:    "All Listings",
+			Sorts:      sorts,
 		}
 	} else {
 		typeNm := args[0]
@@ -545,11 +832,23 @@ func getListingSection(w http.ResponseWriter, r *http.Request) {
 			ActiveLink: "lnk_" + typeNm,
 			Type:       typeNm,
 			TypeStr:    typeStr,
+			Sorts:      sorts,
 		}
 	}
 	RenderView(w, "listing#section", viewData)
 }
 
+// listingFeedSort validates a sort order for the listing feed, defaulting
+// to newest first
+func listingFeedSort(sort string) string {
+	for _, feedSort := range listingFeedSorts {
+		if sort == feedSort {
+			return sort
+		}
+	}
+	return models.SortNewest
+}
+
 type sellerListViewData struct {
 	Listings []models.Listing
 }
@@ -563,14 +862,15 @@ func SellerList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	opts := models.ListingQueryOpts{
-		UserID:           viewData.Session.User.ID,
-		RestrictByUser:   true,
-		Status:           models.ListingListed,
-		RestrictByStatus: true,
-		UsePaging:        false,
+		UserID:         viewData.Session.User.ID,
+		RestrictByUser: true,
+		// Listings on hold are still being sold
+		Status:       models.ListingSold,
+		SkipByStatus: true,
+		UsePaging:    false,
 	}
 
-	listings := models.GetListingList(Base.Db, opts)
+	listings := Base.Store.Listings.GetList(opts)
 	cache.MapPlaceToListings(listings)
 	viewData.Data = &sellerListViewData{
 		Listings: listings,
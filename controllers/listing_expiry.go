@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/email"
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+const (
+	notifListingExpiring = "NOTIF_LISTING_EXPIRING"
+)
+
+// listingExpiryInterval is how often listings are checked for sellers to
+// remind about their expiry
+const listingExpiryInterval = time.Minute * 30
+
+// ListingExpiryReminder reminds sellers to renew their listings shortly
+// before they expire
+func ListingExpiryReminder() {
+	for {
+		listings, err := Base.Store.Listings.RemindExpiring(time.Now())
+		if err != nil {
+			fmt.Println("[ERROR] controllers.ListingExpiryReminder: " +
+				err.Error())
+		} else if len(listings) > 0 {
+			for _, listing := range listings {
+				seller := listing.User
+				email.ListingExpiringEmail(listing)
+				// Email addresses aren't sent over the websocket
+				listing.User.EmailAddress = ""
+				Base.WebsockChannel <- wsock.UserJSONNotification(&seller,
+					notifListingExpiring, listing, true)
+			}
+			fmt.Println("[INFO] controllers.ListingExpiryReminder: reminded " +
+				"sellers of " + strconv.Itoa(len(listings)) + " listings")
+		}
+		time.Sleep(listingExpiryInterval)
+	}
+}
+
+// ListingRenew handles the route '/listing/renew/', where a seller pushes
+// back the expiry of one of their listings
+func ListingRenew(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	listing := sellerListingFromPost(w, r, &viewData)
+	if listing == nil {
+		return
+	}
+
+	switch err := Base.Store.Listings.Renew(listing); err {
+	case nil:
+	case models.ErrListingDraft, models.ErrListingSold:
+		viewData.RenderMessage(w, true, "Can't Renew Listing",
+			"Only published listings which haven't been sold can be renewed.")
+		return
+	default:
+		fmt.Println("[ERROR] controllers.ListingRenew: " + err.Error())
+		viewData.InternalError(w)
+		return
+	}
+	http.Redirect(w, r, "/listing/view/"+strconv.Itoa(listing.ID),
+		http.StatusFound)
+}
+
+// ListingBump handles the route '/listing/bump/', where a seller moves one
+// of their listings back to the top of the listing feed
+func ListingBump(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	listing := sellerListingFromPost(w, r, &viewData)
+	if listing == nil {
+		return
+	}
+
+	switch err := Base.Store.Listings.Bump(listing); err {
+	case nil:
+	case models.ErrBumpTooSoon:
+		viewData.RenderMessage(w, true, "Can't Bump Listing Yet",
+			"Listings can only be bumped once a day. You can bump this listing "+
+				"again after "+listing.NextBump().Format("Jan 2, 3:04 PM")+".")
+		return
+	case models.ErrListingExpired:
+		viewData.RenderMessage(w, true, "Can't Bump Listing",
+			"This listing has expired. Renew it to show it to buyers again.")
+		return
+	case models.ErrListingDraft, models.ErrListingSold:
+		viewData.RenderMessage(w, true, "Can't Bump Listing",
+			"Only published listings which haven't been sold can be bumped.")
+		return
+	default:
+		fmt.Println("[ERROR] controllers.ListingBump: " + err.Error())
+		viewData.InternalError(w)
+		return
+	}
+	http.Redirect(w, r, "/listing/view/"+strconv.Itoa(listing.ID),
+		http.StatusFound)
+}
+
+// sellerListingFromPost loads the listing in the URI of a POST request made
+// by its seller. If the request isn't valid, or the listing doesn't belong
+// to the user, an error is written and nil is returned
+func sellerListingFromPost(w http.ResponseWriter, r *http.Request,
+	viewData *ViewData) *models.Listing {
+
+	if r.Method != http.MethodPost {
+		viewData.NotFound(w)
+		return nil
+	}
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return nil
+	}
+
+	args := URIArgs(r)
+	if len(args) != 1 {
+		viewData.NotFound(w)
+		return nil
+	}
+	if !viewData.ValidCsrf(r) {
+		http.Redirect(w, r, "/listing/view/"+args[0], http.StatusFound)
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		viewData.NotFound(w)
+		return nil
+	}
+
+	listing, err := Base.Store.Listings.GetByID(id)
+	if err != nil || listing == nil ||
+		listing.User.ID != viewData.Session.User.ID {
+
+		viewData.NotFound(w)
+		return nil
+	}
+	return listing
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+const (
+	notifListingPublished = "NOTIF_LISTING_PUBLISHED"
+)
+
+// listingPublishInterval is how often drafts are checked for ones which
+// are due to be published
+const listingPublishInterval = time.Minute
+
+// ListingPublisher publishes drafts once the time their sellers scheduled
+// them for has passed
+func ListingPublisher() {
+	for {
+		listings, err := Base.Store.Listings.PublishScheduled(time.Now())
+		if err != nil {
+			fmt.Println("[ERROR] controllers.ListingPublisher: " + err.Error())
+		} else if len(listings) > 0 {
+			for _, listing := range listings {
+				seller := listing.User
+				// Email addresses aren't sent over the websocket
+				listing.User.EmailAddress = ""
+				Base.WebsockChannel <- wsock.UserJSONNotification(&seller,
+					notifListingPublished, listing, true)
+			}
+			fmt.Println("[INFO] controllers.ListingPublisher: published " +
+				strconv.Itoa(len(listings)) + " scheduled listings")
+		}
+		time.Sleep(listingPublishInterval)
+	}
+}
+
+// listingPublishAtFromForm gets the time a draft is scheduled to be
+// published from the form value publish_at, which is nil if it was left
+// blank. An invalid time fails validation
+func listingPublishAtFromForm(r *http.Request) *time.Time {
+	if len(r.FormValue("publish_at")) == 0 {
+		return nil
+	}
+	publishAt := localTimeFromForm(r, "publish_at")
+	return &publishAt
+}
+
+// listingPublishAtClient formats the time a draft is scheduled to be
+// published for a datetime-local input
+func listingPublishAtClient(listing *models.Listing) string {
+	if listing.PublishAt == nil {
+		return ""
+	}
+	return listing.PublishAt.Format(datetimeLocalLayout)
+}
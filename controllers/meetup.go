@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/email"
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+const (
+	notifMeetupProposed = "NOTIF_MEETUP_PROPOSED"
+	notifMeetupAccepted = "NOTIF_MEETUP_ACCEPTED"
+	notifMeetupDeclined = "NOTIF_MEETUP_DECLINED"
+)
+
+// datetimeLocalLayout is the format of times sent by datetime-local inputs
+const datetimeLocalLayout = "2006-01-02T15:04"
+
+type meetupViewData struct {
+	Offer      models.Offer
+	Meetup     *models.Meetup
+	TimeClient string
+	Location   string
+	HasError   bool
+	Error      models.MeetupError
+	// CanAnswer is set when the meetup is waiting on an answer from the
+	// user viewing it
+	CanAnswer bool
+	// CanPropose is set while the offer is accepted, which is the only time
+	// a meetup can be planned or changed
+	CanPropose bool
+}
+
+// meetupNotification is sent to the other party under an offer when a
+// meetup is proposed or answered
+type meetupNotification struct {
+	models.Meetup
+	Listing models.Listing `json:"listing"`
+}
+
+// Meetup handles the route '/meetup/'
+func Meetup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getMeetup(w, r)
+	case http.MethodPost:
+		postMeetup(w, r)
+	default:
+		http.Error(w, "Not Found", http.StatusNotFound)
+	}
+}
+
+func getMeetup(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	offer := meetupOffer(w, r, &viewData.Session.User)
+	if offer == nil {
+		return
+	}
+	meetup, err := Base.Store.Meetups.GetForOffer(offer.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	viewData.Data = newMeetupViewData(offer, meetup, &viewData.Session.User)
+	RenderView(w, "meetup#view", viewData)
+}
+
+func postMeetup(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	if !viewData.ValidCsrf(r) {
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	user := &viewData.Session.User
+	offer := meetupOffer(w, r, user)
+	if offer == nil {
+		return
+	}
+	if offer.Status != models.OfferAccepted {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	meetup, err := Base.Store.Meetups.GetForOffer(offer.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	otherParty := offer.Buyer
+	if user.ID == offer.Buyer.ID {
+		otherParty = offer.Seller
+	}
+
+	switch action := r.FormValue("action"); action {
+	case "propose":
+		proposal := &models.Meetup{
+			OfferID:  offer.ID,
+			Proposer: *user,
+			Time:     meetupTimeFromForm(r),
+			Location: r.FormValue("location"),
+		}
+		if ok, meetupErr := Base.Store.Meetups.Propose(proposal); !ok {
+			data := newMeetupViewData(offer, meetup, user)
+			data.TimeClient = r.FormValue("time")
+			data.Location = proposal.Location
+			data.HasError = true
+			data.Error = *meetupErr
+			viewData.Data = data
+			RenderView(w, "meetup#view", viewData)
+			return
+		}
+		notifyMeetup(&otherParty, notifMeetupProposed, offer, proposal)
+	case models.MeetupAccepted, models.MeetupDeclined:
+		if meetup == nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		err := Base.Store.Meetups.Answer(meetup, user, action)
+		if err == models.ErrMeetupStatus {
+			// The meetup was rescheduled or answered first, so the user is
+			// shown where it stands now
+			http.Redirect(w, r, "/meetup/"+strconv.Itoa(offer.ID), http.StatusFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Internal Server Error",
+				http.StatusInternalServerError)
+			return
+		}
+		if action == models.MeetupAccepted {
+			notifyMeetup(&otherParty, notifMeetupAccepted, offer, meetup)
+			for _, party := range []models.User{offer.Buyer, offer.Seller} {
+				if recipient := Base.Store.Users.GetByID(party.ID); recipient != nil {
+					email.MeetupAcceptedEmail(*offer, meetup, *recipient)
+				}
+			}
+		} else {
+			notifyMeetup(&otherParty, notifMeetupDeclined, offer, meetup)
+		}
+	default:
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/meetup/"+strconv.Itoa(offer.ID), http.StatusFound)
+}
+
+// MeetupCalendar handles the route '/meetup/ics/', which downloads an
+// accepted meetup as a file that can be added to a calendar
+func MeetupCalendar(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	offer := meetupOffer(w, r, &viewData.Session.User)
+	if offer == nil {
+		return
+	}
+	meetup, err := Base.Store.Meetups.GetForOffer(offer.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if meetup == nil || meetup.Status != models.MeetupAccepted {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	event := meetup.CalendarEvent(offer.Listing.Name,
+		"https://www.calagora.com/meetup/"+strconv.Itoa(offer.ID))
+	w.Header().Set("Content-Type", "text/calendar; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"meetup.ics\"")
+	w.Write(event.ICS())
+}
+
+// meetupOffer loads the offer in the URI of a meetup page, along with its
+// listing and the public fields of its buyer and seller. Only the buyer and
+// seller of an accepted or completed offer can see its meetup. If the
+// offer can't be shown to user, an error is written and nil is returned
+func meetupOffer(w http.ResponseWriter, r *http.Request,
+	user *models.User) *models.Offer {
+
+	args := URIArgs(r)
+	if len(args) != 1 {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+
+	offer, err := Base.Store.Offers.GetByID(id)
+	if err != nil || offer == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+	if offer.Buyer.ID != user.ID && offer.Seller.ID != user.ID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+	if offer.Status != models.OfferAccepted &&
+		offer.Status != models.OfferCompleted {
+
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+
+	listing, err := Base.Store.Listings.GetByID(offer.Listing.ID)
+	buyer := Base.Store.Users.GetByID(offer.Buyer.ID)
+	seller := Base.Store.Users.GetByID(offer.Seller.ID)
+	if err != nil || listing == nil || buyer == nil || seller == nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil
+	}
+	offer.Listing = *listing
+	offer.Buyer = models.User{ID: buyer.ID, Username: buyer.Username,
+		DisplayName: buyer.DisplayName}
+	offer.Seller = models.User{ID: seller.ID, Username: seller.Username,
+		DisplayName: seller.DisplayName}
+	return offer
+}
+
+// newMeetupViewData gets the data for a meetup page, with the form filled
+// in with the current meetup so that it can be rescheduled
+func newMeetupViewData(offer *models.Offer, meetup *models.Meetup,
+	user *models.User) meetupViewData {
+
+	data := meetupViewData{
+		Offer:      *offer,
+		Meetup:     meetup,
+		CanPropose: offer.Status == models.OfferAccepted,
+	}
+	if meetup != nil {
+		data.TimeClient = meetup.Time.Format(datetimeLocalLayout)
+		data.Location = meetup.Location
+		data.CanAnswer = data.CanPropose &&
+			meetup.Status == models.MeetupProposed &&
+			meetup.Proposer.ID != user.ID
+	}
+	return data
+}
+
+// meetupTimeFromForm gets the time chosen for a meetup from the form value
+// time. A missing or invalid time gets the zero time, which fails
+// validation
+func meetupTimeFromForm(r *http.Request) time.Time {
+	return localTimeFromForm(r, "time")
+}
+
+// localTimeFromForm reads a datetime-local form value. Browsers send it
+// without a time zone, so it is read in the zone given by tz_offset, which
+// is the user's offset from UTC in minutes as given by JavaScript's
+// getTimezoneOffset. An invalid time gets the zero time
+func localTimeFromForm(r *http.Request, name string) time.Time {
+	location := time.Local
+	if offset, err := strconv.Atoi(r.FormValue("tz_offset")); err == nil {
+		location = time.FixedZone("", -offset*60)
+	}
+	localTime, err := time.ParseInLocation(datetimeLocalLayout,
+		r.FormValue(name), location)
+	if err != nil {
+		return time.Time{}
+	}
+	return localTime
+}
+
+// notifyMeetup tells the other party under an offer about a change to its
+// meetup
+func notifyMeetup(recipient *models.User, notifType string, offer *models.Offer,
+	meetup *models.Meetup) {
+
+	notification := meetupNotification{
+		Meetup:  *meetup,
+		Listing: offer.Listing,
+	}
+	notification.Proposer = offer.Buyer
+	if meetup.Proposer.ID == offer.Seller.ID {
+		notification.Proposer = offer.Seller
+	}
+	Base.WebsockChannel <- wsock.UserJSONNotification(recipient, notifType,
+		notification, true)
+}
+
+// sendOfferAcceptedEmail emails the buyer under an offer which was just
+// accepted, attaching its meetup if one was already planned
+func sendOfferAcceptedEmail(offer models.Offer) {
+	buyer := Base.Store.Users.GetByID(offer.Buyer.ID)
+	if buyer == nil {
+		return
+	}
+	offer.Buyer = *buyer
+	meetup, err := Base.Store.Meetups.GetForOffer(offer.ID)
+	if err != nil {
+		fmt.Println("[ERROR] controllers.sendOfferAcceptedEmail: " +
+			err.Error())
+	}
+	email.OfferAcceptedEmail(offer, meetup)
+}
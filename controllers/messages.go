@@ -68,7 +68,7 @@ func WebAPIMessageSend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer, err := models.GetOfferByID(Base.Db, id)
+	offer, err := Base.Store.Offers.GetByID(id)
 	if err != nil || offer == nil {
 		response.HasError = true
 		response.Error = "Not Found"
@@ -97,7 +97,7 @@ func WebAPIMessageSend(w http.ResponseWriter, r *http.Request) {
 		otherUser = &offer.Buyer
 	}
 
-	ok, messageErr := message.Create(Base.Db)
+	ok, messageErr := Base.Store.Messages.Create(&message)
 	if err != nil {
 		response.HasError = true
 		response.MessageError = *messageErr
@@ -161,7 +161,7 @@ func WebAPIMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer, err := models.GetOfferByID(Base.Db, id)
+	offer, err := Base.Store.Offers.GetByID(id)
 	if err != nil || offer == nil {
 		response.HasError = true
 		response.Error = "Failed to get conversation/offer."
@@ -178,7 +178,7 @@ func WebAPIMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	messages, err := offer.GetMessages(Base.Db, 100, page, viewData.Session.User.ID)
+	messages, err := Base.Store.Messages.GetForOffer(offer, 100, page, viewData.Session.User.ID)
 	if err != nil {
 		response.HasError = true
 		response.Error = "Failed to get messages."
@@ -210,7 +210,7 @@ func MessageRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	message := models.Message{ID: id}
-	message.MarkRead(Base.Db, viewData.Session.User.ID)
+	Base.Store.Messages.MarkRead(&message, viewData.Session.User.ID)
 	http.Error(w, "Command Confirmed", http.StatusOK)
 }
 
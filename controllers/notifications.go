@@ -30,7 +30,7 @@ func WebAPINotifications(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	notifications := viewData.Session.User.GetRecentNotifications(Base.Db, page)
+	notifications := Base.Store.Notifications.GetRecent(&viewData.Session.User, page)
 	response := webAPINotificationsResponse{
 		Notifications: notifications,
 	}
@@ -51,7 +51,7 @@ func WebAPINotificationCounts(w http.ResponseWriter, r *http.Request) {
 	}
 	user := viewData.Session.User
 	response := webAPINotificationCountsResponse{}
-	response.MessageCount = user.GetUnreadMessageCount(Base.Db)
-	response.NotificationCount = user.GetUnreadNotificationCount(Base.Db)
+	response.MessageCount = Base.Store.Messages.GetUnreadCount(&user)
+	response.NotificationCount = Base.Store.Notifications.GetUnreadCount(&user)
 	RenderJSON(w, response)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/anishmgoyal/calagora/constants"
 	"github.com/anishmgoyal/calagora/email"
@@ -23,6 +24,25 @@ type createOfferViewData struct {
 	Offer    models.Offer
 }
 
+// attachOfferHistory loads the history of each of a set of offers, so that
+// it can be shown with them. Offers are left without history on an error
+func attachOfferHistory(offers ...*models.Offer) {
+	ids := make([]int, 0, len(offers))
+	for _, offer := range offers {
+		if offer.ID > 0 {
+			ids = append(ids, offer.ID)
+		}
+	}
+	history, err := Base.Store.Offers.GetHistory(ids)
+	if err != nil {
+		fmt.Println("[ERROR] controllers.attachOfferHistory: " + err.Error())
+		return
+	}
+	for _, offer := range offers {
+		offer.History = history[offer.ID]
+	}
+}
+
 type buyerListViewData struct {
 	Offers []models.Offer
 }
@@ -31,6 +51,16 @@ type sellerViewData struct {
 	Offer []models.Offer
 }
 
+// attachBuyerReputations loads the reputation of the buyer of each of a
+// set of offers, so that sellers can see who they are dealing with
+func attachBuyerReputations(offers []models.Offer) {
+	buyers := make([]*models.User, 0, len(offers))
+	for i := range offers {
+		buyers = append(buyers, &offers[i].Buyer)
+	}
+	attachReputations(buyers...)
+}
+
 // OfferBuyer handles '/offer/buyer'
 func OfferBuyer(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -62,7 +92,7 @@ func getOfferBuyer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if err != nil || listing == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
@@ -84,8 +114,9 @@ func getOfferBuyer(w http.ResponseWriter, r *http.Request) {
 		Listing:  *listing,
 	}
 
-	offer, _ := viewData.Session.User.GetOfferOnListing(Base.Db, listing.ID)
+	offer, _ := Base.Store.Offers.GetOnListing(&viewData.Session.User, listing.ID)
 	if offer != nil {
+		attachOfferHistory(offer)
 		covd.Offer = *offer
 	}
 
@@ -112,7 +143,7 @@ func postOfferBuyer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if err != nil || listing == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
@@ -127,7 +158,7 @@ func postOfferBuyer(w http.ResponseWriter, r *http.Request) {
 	var ok bool
 	var offer *models.Offer
 
-	offer, _ = viewData.Session.User.GetOfferOnListing(Base.Db, listing.ID)
+	offer, _ = Base.Store.Offers.GetOnListing(&viewData.Session.User, listing.ID)
 
 	price, err := utils.PriceClientToServer(r.FormValue("price"))
 	if err != nil {
@@ -141,6 +172,15 @@ func postOfferBuyer(w http.ResponseWriter, r *http.Request) {
 		}
 		offer.BuyerComment = r.FormValue("buyer_comment")
 		offer.PriceClient = r.FormValue("price")
+	} else if offer == nil && listing.IsExpired() {
+		ok = false
+		offerErr = &models.OfferError{
+			Global: "This listing has expired, so it can't take new offers",
+		}
+		offer = &models.Offer{
+			BuyerComment: r.FormValue("buyer_comment"),
+			PriceClient:  r.FormValue("price"),
+		}
 	} else {
 		if offer == nil {
 			offer = &models.Offer{
@@ -148,34 +188,39 @@ func postOfferBuyer(w http.ResponseWriter, r *http.Request) {
 				PriceClient:  r.FormValue("price"),
 				BuyerComment: r.FormValue("buyer_comment"),
 				Status:       models.OfferOffered,
+				Expires:      offerExpiryFromForm(r),
 				Listing:      *listing,
 				Buyer:        viewData.Session.User,
 				Seller:       listing.User,
 			}
 
-			ok, offerErr = offer.Create(Base.Db)
+			ok, offerErr = Base.Store.Offers.Create(offer)
 			if ok {
 				email.NewOfferEmail(*offer)
 				offer.Listing = *listing
 				offer.Buyer = viewData.Session.User
 				Base.WebsockChannel <- wsock.UserJSONNotification(&listing.User,
 					"NOTIF_NEW_OFFER", offer, true)
+				applyOfferRules(offer, listing)
 			}
 		} else {
 			offer.Price = price
 			offer.PriceClient = r.FormValue("price")
 			offer.BuyerComment = r.FormValue("buyer_comment")
-			ok, offerErr = offer.Save(Base.Db)
+			offer.Expires = offerExpiryFromForm(r)
+			ok, offerErr = Base.Store.Offers.Revise(offer)
 			if ok {
 				offer.Listing = *listing
 				offer.Buyer = viewData.Session.User
 				Base.WebsockChannel <- wsock.UserJSONNotification(&listing.User,
 					"NOTIF_UPDATE_OFFER", offer, true)
+				applyOfferRules(offer, listing)
 			}
 		}
 	}
 
 	if !ok {
+		attachOfferHistory(offer)
 		viewData.Data = createOfferViewData{
 			HasError: true,
 			Error:    *offerErr,
@@ -188,6 +233,29 @@ func postOfferBuyer(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// applyOfferRules answers an offer a buyer just made with the offer rules
+// of its listing, and tells the buyer in the same way as if the seller had
+// answered it themselves
+func applyOfferRules(offer *models.Offer, listing *models.Listing) {
+	action, err := Base.Store.Offers.ApplyRules(offer)
+	if err != nil {
+		fmt.Println("[ERROR] controllers.applyOfferRules: " + err.Error())
+		return
+	}
+
+	offer.Seller = listing.User
+	offer.Listing = *listing
+	switch action {
+	case models.OfferActionAccept:
+		Base.WebsockChannel <- wsock.UserJSONNotification(&offer.Buyer,
+			"OFFER_ACCEPTED", offer, true)
+		sendOfferAcceptedEmail(*offer)
+	case models.OfferActionDecline:
+		Base.WebsockChannel <- wsock.UserJSONNotification(&offer.Buyer,
+			"NOTIF_OFFER_REJECTED", offer, true)
+	}
+}
+
 // OfferSeller handles the route '/offer/seller'
 func OfferSeller(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -219,7 +287,7 @@ func getOfferSeller(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
-	offer, err := models.GetOfferByID(Base.Db, id)
+	offer, err := Base.Store.Offers.GetByID(id)
 	if err != nil || offer == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
@@ -231,12 +299,14 @@ func getOfferSeller(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, offer.Listing.ID)
+	listing, err := Base.Store.Listings.GetByID(offer.Listing.ID)
 	if err != nil || listing == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
 
+	attachOfferHistory(offer)
+	attachOfferBundles(offer)
 	viewData.Data = createOfferViewData{
 		HasError: false,
 		Listing:  *listing,
@@ -264,17 +334,18 @@ func postOfferSeller(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer, err := models.GetOfferByID(Base.Db, id)
+	offer, err := Base.Store.Offers.GetByID(id)
 	if err != nil || offer == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, offer.Listing.ID)
+	listing, err := Base.Store.Listings.GetByID(offer.Listing.ID)
 	if err != nil || listing == nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+	attachOfferBundles(offer)
 
 	var offerErr *models.OfferError
 	var ok bool
@@ -290,15 +361,15 @@ func postOfferSeller(w http.ResponseWriter, r *http.Request) {
 		offer.Counter = counter
 		offer.CounterClient = r.FormValue("counter")
 		offer.SellerComment = r.FormValue("seller_comment")
-		offer.IsCountered = true
-		ok, offerErr = offer.Save(Base.Db)
+		offer.Expires = offerExpiryFromForm(r)
+		ok, offerErr = Base.Store.Offers.CounterOffer(offer)
 		if ok {
 			offer.Listing = *listing
 			offer.Seller = viewData.Session.User
 			Base.WebsockChannel <- wsock.UserJSONNotification(&offer.Buyer,
 				"NOTIF_OFFER_COUNTER", offer, true)
 			if !wasPreviouslyCountered {
-				buyer := models.GetUserByID(Base.Db, offer.Buyer.ID)
+				buyer := Base.Store.Users.GetByID(offer.Buyer.ID)
 				if buyer != nil {
 					offer.Buyer = *buyer
 					email.NewCounterEmail(*offer)
@@ -308,6 +379,7 @@ func postOfferSeller(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !ok {
+		attachOfferHistory(offer)
 		viewData.Data = createOfferViewData{
 			HasError: true,
 			Error:    *offerErr,
@@ -338,12 +410,21 @@ func getBuyerList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offers, err := viewData.Session.User.GetOffersAsBuyer(Base.Db)
+	offers, err := Base.Store.Offers.GetAsBuyer(&viewData.Session.User)
 	if err != nil {
 		http.Error(w, constants.Error500, http.StatusInternalServerError)
 		return
 	}
 
+	sellers := make([]*models.User, 0, len(offers))
+	offerRefs := make([]*models.Offer, 0, len(offers))
+	for i := range offers {
+		sellers = append(sellers, &offers[i].Seller)
+		offerRefs = append(offerRefs, &offers[i])
+	}
+	attachReputations(sellers...)
+	attachOfferBundles(offerRefs...)
+
 	viewData.Data = buyerListViewData{
 		Offers: offers,
 	}
@@ -368,13 +449,19 @@ func WebAPIOffersAsBuyer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offers, err := viewData.Session.User.GetOffersAsBuyer(Base.Db)
+	offers, err := Base.Store.Offers.GetAsBuyer(&viewData.Session.User)
 	if err != nil {
 		response.Error = err.Error()
 		RenderJSON(w, response)
 		return
 	}
 
+	offerRefs := make([]*models.Offer, 0, len(offers))
+	for i := range offers {
+		offerRefs = append(offerRefs, &offers[i])
+	}
+	attachOfferBundles(offerRefs...)
+
 	response.HasError = false
 	response.Offers = offers
 	RenderJSON(w, response)
@@ -410,7 +497,7 @@ func WebAPIOffersAsSeller(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	offers, err := viewData.Session.User.GetOffersAsSeller(Base.Db, pageNum,
+	offers, err := Base.Store.Offers.GetAsSeller(&viewData.Session.User, pageNum,
 		offerPageSize)
 	if err != nil {
 		response.Error = constants.Error500
@@ -419,6 +506,13 @@ func WebAPIOffersAsSeller(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	offerRefs := make([]*models.Offer, 0, len(offers))
+	for i := range offers {
+		offerRefs = append(offerRefs, &offers[i])
+	}
+	attachBuyerReputations(offers)
+	attachOfferBundles(offerRefs...)
+
 	response.Successful = true
 	response.Offers = offers
 	RenderJSON(w, response)
@@ -463,7 +557,7 @@ func WebAPIOfferDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer, err := models.GetOfferByID(Base.Db, id)
+	offer, err := Base.Store.Offers.GetByID(id)
 	if err != nil {
 		response.Error = "Not Found"
 		RenderJSON(w, response)
@@ -472,11 +566,16 @@ func WebAPIOfferDelete(w http.ResponseWriter, r *http.Request) {
 
 	if offer.Seller.ID == viewData.Session.User.ID ||
 		offer.Buyer.ID == viewData.Session.User.ID {
-		if ok := offer.Delete(Base.Db); ok {
+		if offer.Seller.ID == viewData.Session.User.ID {
+			err = Base.Store.Offers.Decline(offer)
+		} else {
+			err = Base.Store.Offers.Withdraw(offer)
+		}
+		if err == nil {
 
 			if offer.Seller.ID == viewData.Session.User.ID {
 				offer.Seller = viewData.Session.User
-				listing, err := models.GetListingByID(Base.Db, offer.Listing.ID)
+				listing, err := Base.Store.Listings.GetByID(offer.Listing.ID)
 				if err == nil && listing != nil {
 					offer.Listing = *listing
 					Base.WebsockChannel <- wsock.UserJSONNotification(&offer.Buyer,
@@ -484,7 +583,7 @@ func WebAPIOfferDelete(w http.ResponseWriter, r *http.Request) {
 				}
 			} else {
 				offer.Buyer = viewData.Session.User
-				listing, err := models.GetListingByID(Base.Db, offer.Listing.ID)
+				listing, err := Base.Store.Listings.GetByID(offer.Listing.ID)
 				if err == nil && listing != nil {
 					offer.Listing = *listing
 					Base.WebsockChannel <- wsock.UserJSONNotification(&offer.Seller,
@@ -495,6 +594,10 @@ func WebAPIOfferDelete(w http.ResponseWriter, r *http.Request) {
 			response.Successful = true
 			RenderJSON(w, response)
 			return
+		} else if err == models.ErrOfferStatus {
+			response.Error = constants.ErrorConflict
+			RenderJSON(w, response)
+			return
 		}
 		response.Error = "Unexpected Error"
 		RenderJSON(w, response)
@@ -538,7 +641,7 @@ func WebAPIListingOffer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer, err := viewData.Session.User.GetOfferOnListing(Base.Db, id)
+	offer, err := Base.Store.Offers.GetOnListing(&viewData.Session.User, id)
 	if err != nil {
 		response.Error = constants.Error500
 		RenderJSON(w, response)
@@ -589,7 +692,7 @@ func WebAPIListingOfferList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if err != nil || listing == nil {
 		response.Error = constants.Error404
 		RenderJSON(w, response)
@@ -611,13 +714,21 @@ func WebAPIListingOfferList(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	offers, err := listing.GetOffers(Base.Db, pageNum, offerPageSize)
+	offers, err := Base.Store.Offers.GetForListing(listing, pageNum, offerPageSize)
 	if err != nil {
 		response.Error = constants.Error500
 		RenderJSON(w, response)
 		return
 	}
 
+	offerRefs := make([]*models.Offer, 0, len(offers))
+	for i := range offers {
+		offerRefs = append(offerRefs, &offers[i])
+	}
+	attachOfferHistory(offerRefs...)
+	attachOfferBundles(offerRefs...)
+	attachBuyerReputations(offers)
+
 	response.Successful = true
 	response.Offers = offers
 	RenderJSON(w, response)
@@ -662,7 +773,7 @@ func WebAPIOfferAccept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer, err := models.GetOfferByID(Base.Db, id)
+	offer, err := Base.Store.Offers.GetByID(id)
 	if err != nil || offer == nil {
 		response.Error = constants.Error404
 		RenderJSON(w, response)
@@ -675,19 +786,47 @@ func WebAPIOfferAccept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer.Status = models.OfferAccepted
-	if ok, _ := offer.Save(Base.Db); !ok {
-		response.Error = constants.Error500
+	// The seller may give the buyer a number of days to finalize the deal in,
+	// and may hold the listing for the buyer for that long
+	offer.Expires = offerExpiryFromForm(r)
+	if offer.Expires != nil &&
+		offer.Expires.After(time.Now().AddDate(0, 0, models.MaxOfferExpiryDays)) {
+
+		response.Error = constants.ErrorArguments
+		RenderJSON(w, response)
+		return
+	}
+	if holdDays, err := strconv.Atoi(r.FormValue("hold_days")); err == nil &&
+		holdDays > 0 {
+
+		if holdDays > models.MaxListingHoldDays {
+			response.Error = constants.ErrorArguments
+			RenderJSON(w, response)
+			return
+		}
+		offer.Holding = true
+		offer.Expires = models.OfferExpiry(holdDays)
+	}
+	if err := Base.Store.Offers.Accept(offer); err != nil {
+		if err == models.ErrListingSold || err == models.ErrListingHeld ||
+			err == models.ErrListingExpired || err == models.ErrOfferStatus {
+
+			response.Error = constants.ErrorConflict
+		} else {
+			response.Error = constants.Error500
+		}
 		RenderJSON(w, response)
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, offer.Listing.ID)
+	listing, err := Base.Store.Listings.GetByID(offer.Listing.ID)
 	if err == nil && listing != nil {
 		offer.Seller = viewData.Session.User
 		offer.Listing = *listing
+		attachOfferBundles(offer)
 		Base.WebsockChannel <- wsock.UserJSONNotification(&offer.Buyer,
 			"OFFER_ACCEPTED", offer, true)
+		sendOfferAcceptedEmail(*offer)
 	}
 
 	response.Successful = true
@@ -732,7 +871,7 @@ func WebAPIOfferFinalize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer, err := models.GetOfferByID(Base.Db, id)
+	offer, err := Base.Store.Offers.GetByID(id)
 	if err != nil || offer == nil {
 		response.Error = "Offer does not exist"
 		RenderJSON(w, response)
@@ -745,17 +884,44 @@ func WebAPIOfferFinalize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offer.Status = models.OfferCompleted
-	if ok, _ := offer.Save(Base.Db); !ok {
+	closed, err := Base.Store.Offers.Finalize(offer)
+	if err == models.ErrListingSold {
+		response.Error = "Listing Already Sold"
+		RenderJSON(w, response)
+		return
+	} else if err == models.ErrListingHeld {
+		response.Error = "Listing On Hold For Another Buyer"
+		RenderJSON(w, response)
+		return
+	} else if err == models.ErrOfferStatus {
+		response.Error = "Offer Can't Be Finalized"
+		RenderJSON(w, response)
+		return
+	} else if err != nil {
 		response.Error = "Unexpected Error"
 		RenderJSON(w, response)
 		return
 	}
 
-	if ok, _ := offer.Listing.MarkSold(Base.Db); !ok {
-		response.Error = "Unexpected Error While Marking Listing"
-		RenderJSON(w, response)
-		return
+	// Each closed offer is on the listing it shared with the offer, which
+	// for bundles may not be the same one
+	listings := make(map[int]*models.Listing)
+	for i := range closed {
+		listing, ok := listings[closed[i].Listing.ID]
+		if !ok {
+			listing, err = Base.Store.Listings.GetByID(closed[i].Listing.ID)
+			if err != nil {
+				listing = nil
+			}
+			listings[closed[i].Listing.ID] = listing
+		}
+		if listing == nil {
+			continue
+		}
+		closed[i].Listing = *listing
+		closed[i].Seller = viewData.Session.User
+		Base.WebsockChannel <- wsock.UserJSONNotification(&closed[i].Buyer,
+			"NOTIF_LISTING_SOLD", closed[i], true)
 	}
 
 	response.Successful = true
@@ -779,7 +945,7 @@ func WebAPIConversationList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	offers, err := viewData.Session.User.GetConversationsForUser(Base.Db)
+	offers, err := Base.Store.Offers.GetConversations(&viewData.Session.User)
 	if err != nil {
 		response.HasError = true
 		response.Error = "Internal Error"
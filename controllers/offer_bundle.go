@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anishmgoyal/calagora/email"
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+type bundleOfferViewData struct {
+	HasError bool
+	Error    models.OfferError
+	// Listing is the listing the bundle was started from
+	Listing models.Listing
+	Offer   models.Offer
+	// Choices are the seller's other listings, which can be added to a new
+	// bundle
+	Choices []bundleChoice
+}
+
+// bundleChoice is a listing which can be added to a bundle offer
+type bundleChoice struct {
+	Listing  models.Listing
+	Selected bool
+}
+
+// attachOfferBundles loads the listings each of a set of bundle offers
+// covers, so that they can be shown with them. Offers are left without
+// their bundles on an error
+func attachOfferBundles(offers ...*models.Offer) {
+	ids := make([]int, 0, len(offers))
+	for _, offer := range offers {
+		if offer.IsBundle {
+			ids = append(ids, offer.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	bundles, err := Base.Store.Offers.GetBundles(ids)
+	if err != nil {
+		fmt.Println("[ERROR] controllers.attachOfferBundles: " + err.Error())
+		return
+	}
+	for _, offer := range offers {
+		offer.Bundle = bundles[offer.ID]
+	}
+}
+
+// OfferBundle handles the route '/offer/bundle/', where a buyer makes a
+// single offer on several listings from the same seller. The URI holds the
+// listing the bundle was started from, followed by the ID of the bundle
+// offer once it has been made
+func OfferBundle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getOfferBundle(w, r)
+	case http.MethodPost:
+		postOfferBundle(w, r)
+	default:
+		http.Error(w, "Not Found", http.StatusNotFound)
+	}
+}
+
+func getOfferBundle(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	args := URIArgs(r)
+	if len(args) != 1 && len(args) != 2 {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	listing := bundleListing(w, r, &viewData, args[0])
+	if listing == nil {
+		return
+	}
+
+	data := bundleOfferViewData{Listing: *listing}
+	if len(args) == 2 {
+		offer := bundleOffer(w, &viewData, args[1])
+		if offer == nil {
+			return
+		}
+		attachOfferHistory(offer)
+		data.Offer = *offer
+	} else {
+		data.Choices = bundleChoices(listing, nil)
+	}
+
+	viewData.Data = data
+	RenderView(w, "offer#bundle", viewData)
+}
+
+func postOfferBundle(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	if !viewData.ValidCsrf(r) {
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	listing := bundleListing(w, r, &viewData, r.FormValue("listing_id"))
+	if listing == nil {
+		return
+	}
+
+	offer := &models.Offer{}
+	if len(r.FormValue("offer_id")) > 0 {
+		if offer = bundleOffer(w, &viewData, r.FormValue("offer_id")); offer == nil {
+			return
+		}
+	}
+
+	selected := make(map[int]bool)
+	for _, value := range r.Form["bundle_listing"] {
+		if id, err := strconv.Atoi(value); err == nil {
+			selected[id] = true
+		}
+	}
+
+	var offerErr *models.OfferError
+	ok := false
+	offer.BuyerComment = r.FormValue("buyer_comment")
+	offer.PriceClient = r.FormValue("price")
+	price, err := utils.PriceClientToServer(r.FormValue("price"))
+	if err != nil {
+		offerErr = &models.OfferError{Price: "This must be a valid price"}
+	} else if offer.ID == 0 {
+		offer.Price = price
+		offer.Status = models.OfferOffered
+		offer.Expires = offerExpiryFromForm(r)
+		offer.Listing = *listing
+		offer.Buyer = viewData.Session.User
+		offer.Seller = listing.User
+		for id := range selected {
+			offer.Bundle = append(offer.Bundle, models.Listing{ID: id})
+		}
+
+		ok, offerErr = Base.Store.Offers.Create(offer)
+		if ok {
+			attachOfferBundles(offer)
+			email.NewOfferEmail(*offer)
+			offer.Listing = *listing
+			Base.WebsockChannel <- wsock.UserJSONNotification(&listing.User,
+				"NOTIF_NEW_OFFER", offer, true)
+		}
+	} else {
+		offer.Price = price
+		offer.Expires = offerExpiryFromForm(r)
+		ok, offerErr = Base.Store.Offers.Revise(offer)
+		if ok {
+			offer.Listing = *listing
+			offer.Buyer = viewData.Session.User
+			Base.WebsockChannel <- wsock.UserJSONNotification(&listing.User,
+				"NOTIF_UPDATE_OFFER", offer, true)
+		}
+	}
+
+	if ok {
+		http.Redirect(w, r, "/buying", http.StatusFound)
+		return
+	}
+
+	data := bundleOfferViewData{
+		HasError: true,
+		Error:    *offerErr,
+		Listing:  *listing,
+		Offer:    *offer,
+	}
+	if offer.ID > 0 {
+		attachOfferHistory(offer)
+		attachOfferBundles(offer)
+		data.Offer = *offer
+	} else {
+		data.Offer.Bundle = nil
+		data.Choices = bundleChoices(listing, selected)
+	}
+	viewData.Data = data
+	RenderView(w, "offer#bundle", viewData)
+}
+
+// bundleListing loads the listing a bundle offer was started from, which
+// the user viewing it must be able to make offers on. If it can't be
+// loaded, an error is written and nil is returned
+func bundleListing(w http.ResponseWriter, r *http.Request, viewData *ViewData,
+	idStr string) *models.Listing {
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+	listing, err := Base.Store.Listings.GetByID(id)
+	if err != nil || listing == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+
+	if listing.User.PlaceID != viewData.Session.User.PlaceID {
+		viewData.WrongPlace(w, listing.User.PlaceID, viewData.Session.User.PlaceID)
+		return nil
+	}
+
+	// Trying to make an offer on own listings
+	if listing.User.ID == viewData.Session.User.ID {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return nil
+	}
+	return listing
+}
+
+// bundleOffer loads a bundle offer made by the user viewing it, along with
+// the listings it covers. If it can't be loaded, an error is written and nil
+// is returned
+func bundleOffer(w http.ResponseWriter, viewData *ViewData,
+	idStr string) *models.Offer {
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+	offer, err := Base.Store.Offers.GetByID(id)
+	if err != nil || offer == nil || !offer.IsBundle ||
+		offer.Buyer.ID != viewData.Session.User.ID {
+
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil
+	}
+	attachOfferBundles(offer)
+	return offer
+}
+
+// bundleChoices gets the seller's other open listings, which can be added
+// to a bundle started from listing, marking the ones in selected
+func bundleChoices(listing *models.Listing,
+	selected map[int]bool) []bundleChoice {
+
+	listings := Base.Store.Listings.GetList(models.ListingQueryOpts{
+		UserID:           listing.User.ID,
+		RestrictByUser:   true,
+		Status:           models.ListingListed,
+		RestrictByStatus: true,
+		HideDraft:        true,
+		HideExpired:      true,
+	})
+	choices := make([]bundleChoice, 0, len(listings))
+	for _, other := range listings {
+		if other.ID == listing.ID {
+			continue
+		}
+		choices = append(choices, bundleChoice{
+			Listing:  other,
+			Selected: selected[other.ID],
+		})
+	}
+	return choices
+}
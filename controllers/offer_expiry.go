@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/email"
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+// offerExpiryInterval is how often offers are checked for expiry
+const offerExpiryInterval = time.Minute * 10
+
+// OfferExpirer expires offers, counter offers and accepted deals which have
+// gone past their expiry, and tells both the buyer and the seller
+func OfferExpirer() {
+	for {
+		expired, err := Base.Store.Offers.Expire(time.Now())
+		if err != nil {
+			fmt.Println("[ERROR] controllers.OfferExpirer: " + err.Error())
+		} else if len(expired) > 0 {
+			for _, offer := range expired {
+				notifyOfferExpired(offer)
+			}
+			fmt.Println("[INFO] controllers.OfferExpirer: " +
+				strconv.Itoa(len(expired)) + " offers expired")
+		}
+		time.Sleep(offerExpiryInterval)
+	}
+}
+
+// notifyOfferExpired sends an expired offer to its buyer and seller
+func notifyOfferExpired(offer models.ExpiredOffer) {
+	buyer, seller := offer.Buyer, offer.Seller
+
+	notifType := "NOTIF_OFFER_EXPIRED"
+	if offer.Lapsed {
+		notifType = "NOTIF_DEAL_LAPSED"
+	}
+	// Email addresses aren't sent over the websocket
+	notification := offer.Offer
+	notification.Buyer.EmailAddress = ""
+	notification.Seller.EmailAddress = ""
+	Base.WebsockChannel <- wsock.UserJSONNotification(&buyer, notifType,
+		notification, true)
+	Base.WebsockChannel <- wsock.UserJSONNotification(&seller, notifType,
+		notification, true)
+
+	email.OfferExpiredEmail(offer, buyer)
+	email.OfferExpiredEmail(offer, seller)
+}
+
+// offerExpiryFromForm gets the expiry chosen for an offer from the number
+// of days in the form value expires_days. An offer without one doesn't
+// expire
+func offerExpiryFromForm(r *http.Request) *time.Time {
+	days, err := strconv.Atoi(r.FormValue("expires_days"))
+	if err != nil {
+		return nil
+	}
+	return models.OfferExpiry(days)
+}
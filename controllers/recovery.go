@@ -46,7 +46,7 @@ func postRecoverPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	emailAddr := r.FormValue("email_address")
-	user, err := models.GetUserByEmailAddress(Base.Db, emailAddr)
+	user, err := Base.Store.Users.GetByEmailAddress(emailAddr)
 	if err != nil {
 		viewData.InternalError(w)
 		return
@@ -156,7 +156,7 @@ func ResetPassword(w http.ResponseWriter, r *http.Request) {
 func postResetPassword(w http.ResponseWriter, r *http.Request, u models.User,
 	prr models.PasswordRecoveryRequest, recoveryString string, viewData ViewData) {
 
-	user := models.GetUserByID(Base.Db, u.ID)
+	user := Base.Store.Users.GetByID(u.ID)
 	if user == nil {
 		// This shouldn't be the case. If there is a password recovery
 		// request for a user, that user ought to exist
@@ -180,7 +180,7 @@ func postResetPassword(w http.ResponseWriter, r *http.Request, u models.User,
 
 	user.Password = r.FormValue("password")
 	user.PasswordConfirmation = r.FormValue("password_confirmation")
-	userValid, userErr := user.Validate(Base.Db, true, false)
+	userValid, userErr := Base.Store.Users.Validate(user, true, false)
 	if !userValid {
 		rpvd.UserError = userErr
 		valid = false
@@ -192,7 +192,7 @@ func postResetPassword(w http.ResponseWriter, r *http.Request, u models.User,
 		return
 	}
 
-	userValid, _ = user.Save(Base.Db)
+	userValid, _ = Base.Store.Users.Save(user)
 	if !userValid {
 		viewData.InternalError(w)
 		return
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+const (
+	notifNewReview = "NOTIF_NEW_REVIEW"
+)
+
+type reviewViewData struct {
+	Offer models.Offer
+	// Reviewee is the other party under the offer, who the user is reviewing
+	Reviewee models.User
+	Reviews  []models.Review
+	Review   models.Review
+	HasError bool
+	Error    models.ReviewError
+	// CanReview is set until the user has reviewed the offer
+	CanReview bool
+	// Ratings are the ratings that can be given, best first
+	Ratings []int
+}
+
+// Review handles the route '/review/', where the buyer and seller under a
+// completed offer review each other
+func Review(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getReview(w, r)
+	case http.MethodPost:
+		postReview(w, r)
+	default:
+		BaseViewData(w, r).NotFound(w)
+	}
+}
+
+func getReview(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	data := newReviewViewData(w, r, &viewData)
+	if data == nil {
+		return
+	}
+	viewData.Data = data
+	RenderView(w, "review#create", viewData)
+}
+
+func postReview(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	if !viewData.ValidCsrf(r) {
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	data := newReviewViewData(w, r, &viewData)
+	if data == nil {
+		return
+	}
+
+	rating, _ := strconv.Atoi(r.FormValue("rating"))
+	review := models.Review{
+		OfferID:  data.Offer.ID,
+		Reviewer: viewData.Session.User,
+		Rating:   rating,
+		Comment:  r.FormValue("comment"),
+	}
+	if ok, reviewErr := Base.Store.Reviews.Create(&review); !ok {
+		data.Review = review
+		data.HasError = true
+		data.Error = *reviewErr
+		viewData.Data = data
+		RenderView(w, "review#create", viewData)
+		return
+	}
+
+	review.Reviewer = models.User{
+		ID:          viewData.Session.User.ID,
+		Username:    viewData.Session.User.Username,
+		DisplayName: viewData.Session.User.DisplayName,
+	}
+	review.Listing = data.Offer.Listing
+	Base.WebsockChannel <- wsock.UserJSONNotification(&data.Reviewee,
+		notifNewReview, review, true)
+
+	http.Redirect(w, r, "/user/profile/"+data.Reviewee.Username,
+		http.StatusFound)
+}
+
+// newReviewViewData loads the completed offer in the URI of a review page
+// along with its reviews. If the offer can't be reviewed by the user
+// viewing it, an error is written and nil is returned
+func newReviewViewData(w http.ResponseWriter, r *http.Request,
+	viewData *ViewData) *reviewViewData {
+
+	args := URIArgs(r)
+	if len(args) != 1 {
+		viewData.NotFound(w)
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		viewData.NotFound(w)
+		return nil
+	}
+
+	offer, err := Base.Store.Offers.GetByID(id)
+	if err != nil || offer == nil || offer.Status != models.OfferCompleted {
+		viewData.NotFound(w)
+		return nil
+	}
+	user := &viewData.Session.User
+	revieweeID := offer.Seller.ID
+	if user.ID == offer.Seller.ID {
+		revieweeID = offer.Buyer.ID
+	} else if user.ID != offer.Buyer.ID {
+		viewData.NotFound(w)
+		return nil
+	}
+
+	listing, err := Base.Store.Listings.GetByID(offer.Listing.ID)
+	reviewee := Base.Store.Users.GetByID(revieweeID)
+	reviews, reviewsErr := Base.Store.Reviews.GetForOffer(offer.ID)
+	if err != nil || listing == nil || reviewee == nil || reviewsErr != nil {
+		viewData.InternalError(w)
+		return nil
+	}
+	offer.Listing = *listing
+
+	data := &reviewViewData{
+		Offer: *offer,
+		Reviewee: models.User{
+			ID:          reviewee.ID,
+			Username:    reviewee.Username,
+			DisplayName: reviewee.DisplayName,
+		},
+		Reviews:   reviews,
+		Review:    models.Review{Rating: models.MaxReviewRating},
+		CanReview: true,
+	}
+	for rating := models.MaxReviewRating; rating >= models.MinReviewRating; rating-- {
+		data.Ratings = append(data.Ratings, rating)
+	}
+	for _, review := range reviews {
+		if review.Reviewer.ID == user.ID {
+			data.CanReview = false
+		}
+	}
+	return data
+}
+
+// attachReputations loads the reputation of each of a set of users, so
+// that it can be shown with them. Users are left without a reputation on
+// an error
+func attachReputations(users ...*models.User) {
+	ids := make([]int, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	reputations, err := Base.Store.Reviews.GetReputations(ids)
+	if err != nil {
+		fmt.Println("[ERROR] controllers.attachReputations: " + err.Error())
+		return
+	}
+	for _, user := range users {
+		reputation := reputations[user.ID]
+		user.Reputation = &reputation
+	}
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/anishmgoyal/calagora/constants"
+	"github.com/anishmgoyal/calagora/email"
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+const (
+	notifSavedSearchMatch = "SAVED_SEARCH_MATCH"
+)
+
+type savedSearchViewData struct {
+	Searches []savedSearchLink
+}
+
+// savedSearchLink is a saved search along with a link to run it
+type savedSearchLink struct {
+	Search models.SavedSearch
+	URL    string
+}
+
+type webAPISavedSearchResponse struct {
+	Successful   bool                     `json:"successful"`
+	Error        string                   `json:"error,omitempty"`
+	ErrorDetails *models.SavedSearchError `json:"error_details,omitempty"`
+	Search       *models.SavedSearch      `json:"saved_search,omitempty"`
+}
+
+type webAPISavedSearchesResponse struct {
+	Successful bool                 `json:"successful"`
+	Error      string               `json:"error,omitempty"`
+	Searches   []models.SavedSearch `json:"saved_searches"`
+}
+
+type webAPISavedSearchDeleteResponse struct {
+	Successful bool   `json:"successful"`
+	Error      string `json:"error,omitempty"`
+}
+
+// savedSearchMatch is sent to a user when a listing matching one of their
+// saved searches is published
+type savedSearchMatch struct {
+	Search  models.SavedSearch `json:"saved_search"`
+	Listing models.Listing     `json:"listing"`
+}
+
+// SavedSearches handles the route '/search/saved/'
+func SavedSearches(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	searches, err := viewData.Session.User.GetSavedSearches(Base.Db)
+	if err != nil {
+		viewData.InternalError(w)
+		return
+	}
+
+	links := make([]savedSearchLink, 0, len(searches))
+	for _, search := range searches {
+		links = append(links, savedSearchLink{
+			Search: search,
+			URL: searchPageURL(search.Query, searchFilterData{
+				MinPrice:  search.MinPriceClient,
+				MaxPrice:  search.MaxPriceClient,
+				Type:      search.Type,
+				Condition: search.Condition,
+			}) + "1",
+		})
+	}
+
+	viewData.Data = &savedSearchViewData{
+		Searches: links,
+	}
+	RenderView(w, "search#saved", viewData)
+}
+
+// WebAPISavedSearches handles the route '/webapi/search/saved/'
+func WebAPISavedSearches(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	response := webAPISavedSearchesResponse{
+		Successful: false,
+	}
+	if viewData.Session == nil {
+		response.Error = constants.ErrorAuth
+		RenderJSON(w, response)
+		return
+	}
+
+	searches, err := viewData.Session.User.GetSavedSearches(Base.Db)
+	if err != nil {
+		response.Error = constants.Error500
+		RenderJSON(w, response)
+		return
+	}
+
+	response.Successful = true
+	response.Searches = searches
+	RenderJSON(w, response)
+}
+
+// WebAPISavedSearchCreate handles the route '/webapi/search/save/'. It
+// accepts the same query and filter parameters as '/search/'
+func WebAPISavedSearchCreate(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	response := webAPISavedSearchResponse{
+		Successful: false,
+	}
+	if viewData.Session == nil {
+		response.Error = constants.ErrorAuth
+		RenderJSON(w, response)
+		return
+	}
+
+	if !viewData.ValidCsrf(r) {
+		response.Error = constants.ErrorCSRF
+		RenderJSON(w, response)
+		return
+	}
+
+	filters, filterData := searchFiltersFromRequest(r, viewData)
+	search := &models.SavedSearch{
+		User:        viewData.Session.User,
+		PlaceID:     filters.PlaceID,
+		Query:       r.FormValue("q"),
+		Type:        filterData.Type,
+		Condition:   filterData.Condition,
+		EmailAlerts: r.FormValue("email_alerts") == "true",
+		Attributes:  filters.Attributes,
+	}
+	if filters.RestrictByMinPrice {
+		search.MinPrice = &filters.MinPrice
+		search.MinPriceClient = utils.PriceServerToClient(filters.MinPrice)
+	}
+	if filters.RestrictByMaxPrice {
+		search.MaxPrice = &filters.MaxPrice
+		search.MaxPriceClient = utils.PriceServerToClient(filters.MaxPrice)
+	}
+
+	ok, searchErr := search.Create(Base.Db)
+	if !ok {
+		response.Error = constants.ErrorArguments
+		response.ErrorDetails = searchErr
+		RenderJSON(w, response)
+		return
+	}
+
+	response.Successful = true
+	response.Search = search
+	RenderJSON(w, response)
+}
+
+// WebAPISavedSearchDelete handles the route '/webapi/search/saved/delete/'
+func WebAPISavedSearchDelete(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	response := webAPISavedSearchDeleteResponse{
+		Successful: false,
+	}
+	if viewData.Session == nil {
+		response.Error = constants.ErrorAuth
+		RenderJSON(w, response)
+		return
+	}
+
+	if !viewData.ValidCsrf(r) {
+		response.Error = constants.ErrorCSRF
+		RenderJSON(w, response)
+		return
+	}
+
+	args := URIArgs(r)
+	if len(args) != 1 {
+		response.Error = constants.ErrorArguments
+		RenderJSON(w, response)
+		return
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		response.Error = constants.Error404
+		RenderJSON(w, response)
+		return
+	}
+
+	search := models.SavedSearch{
+		ID:   id,
+		User: viewData.Session.User,
+	}
+	ok, err := search.Delete(Base.Db)
+	if err != nil {
+		response.Error = constants.Error500
+		RenderJSON(w, response)
+		return
+	} else if !ok {
+		response.Error = constants.Error404
+		RenderJSON(w, response)
+		return
+	}
+
+	response.Successful = true
+	RenderJSON(w, response)
+}
+
+// alertSavedSearches notifies the owners of any saved searches a newly
+// indexed listing matches. It is called by the search index as listings
+// are published
+func alertSavedSearches(listing *models.Listing) {
+	if listing.Status != models.ListingListed {
+		return
+	}
+
+	searches, err := listing.MatchSavedSearches(Base.Db)
+	if err != nil {
+		return
+	}
+
+	match := savedSearchMatch{
+		Listing: models.Listing{
+			ID:          listing.ID,
+			Name:        listing.Name,
+			Price:       listing.Price,
+			PriceClient: utils.PriceServerToClient(listing.Price),
+		},
+	}
+	for _, search := range searches {
+		match.Search = search
+		Base.WebsockChannel <- wsock.UserJSONNotification(&search.User,
+			notifSavedSearchMatch, match, true)
+		if search.EmailAlerts {
+			email.SavedSearchMatchEmail(search, match.Listing)
+		}
+	}
+}
@@ -2,72 +2,458 @@ package controllers
 
 import (
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
+	"github.com/anishmgoyal/calagora/cache"
+	"github.com/anishmgoyal/calagora/constants"
 	"github.com/anishmgoyal/calagora/models"
 	"github.com/anishmgoyal/calagora/utils"
 )
 
 type searchViewData struct {
-	Listings    []models.Listing `json:"listings"`
-	Query       string           `json:"query"`
-	Page        int              `json:"page"`
-	StartOffset int              `json:"start_offset"`
-	EndOffset   int              `json:"end_offset"`
-	MaxTotal    int              `json:"max_total"`
-	OutOf       int              `json:"out_of"`
+	Listings    []models.Listing     `json:"listings"`
+	Facets      *models.SearchFacets `json:"facets"`
+	TypeLinks   []searchFacetLink    `json:"-"`
+	CondLinks   []searchFacetLink    `json:"-"`
+	Sorts       []sortOption         `json:"-"`
+	Filters     searchFilterData     `json:"filters"`
+	Query       string               `json:"query"`
+	Sort        string               `json:"sort"`
+	NextCursor  string               `json:"next_cursor,omitempty"`
+	PageURL     string               `json:"-"`
+	Page        int                  `json:"page"`
+	StartOffset int                  `json:"start_offset"`
+	EndOffset   int                  `json:"end_offset"`
+	MaxTotal    int                  `json:"max_total"`
+	OutOf       int                  `json:"out_of"`
+
+	// DidYouMean is a spelling correction for a query which found nothing.
+	// If Corrected is set, the results are for DidYouMean rather than
+	// OriginalQuery
+	DidYouMean    string `json:"did_you_mean,omitempty"`
+	DidYouMeanURL string `json:"-"`
+	Corrected     bool   `json:"corrected"`
+	OriginalQuery string `json:"original_query,omitempty"`
+	OriginalURL   string `json:"-"`
+
+	// SearchID identifies the logged search, so that opening a listing
+	// through ListingURLs counts as a click on it
+	SearchID    int      `json:"search_id,omitempty"`
+	ListingURLs []string `json:"-"`
+
+	// AttributeFilters are the attributes of the selected type which
+	// results can be filtered on
+	AttributeFilters []models.ListingAttribute `json:"-"`
+	// BookURL links to the copies of a textbook side by side, when results
+	// are filtered by ISBN
+	BookURL string `json:"-"`
+}
+
+// sortOption is an option in a sort order dropdown
+type sortOption struct {
+	Name        string
+	Description string
+	Selected    bool
+}
+
+// sortOptions builds the options for a sort order dropdown
+func sortOptions(sorts []string, selected string) []sortOption {
+	options := make([]sortOption, 0, len(sorts))
+	for _, sort := range sorts {
+		options = append(options, sortOption{
+			Name:        sort,
+			Description: models.ListingSorts[sort],
+			Selected:    sort == selected,
+		})
+	}
+	return options
+}
+
+// searchFilterData holds filters as they were entered by the user, so
+// that they can be shown again in the search form
+type searchFilterData struct {
+	MinPrice  string `json:"min_price,omitempty"`
+	MaxPrice  string `json:"max_price,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	Place     string `json:"place,omitempty"`
+	Sort      string `json:"-"`
+	SearchID  int    `json:"-"`
+	// Attributes are the attribute filters for the selected type, keyed by
+	// their parameter names
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// searchFacetLink is a link which narrows a search down to a single value
+// of a facet, rendered alongside the number of results it would give
+type searchFacetLink struct {
+	Name        string
+	Description string
+	Count       int
+	URL         string
+	Selected    bool
+}
+
+type webAPISearchSuggestResponse struct {
+	Successful  bool     `json:"successful"`
+	Error       string   `json:"error,omitempty"`
+	Suggestions []string `json:"suggestions"`
+}
+
+type webAPISearchResponse struct {
+	Successful bool            `json:"successful"`
+	Error      string          `json:"error,omitempty"`
+	Results    *searchViewData `json:"results,omitempty"`
 }
 
 // Search handles the route '/search/'
 func Search(w http.ResponseWriter, r *http.Request) {
 	viewData := BaseViewData(w, r)
 
-	termMap := utils.GetSearchTermsForString(r.FormValue("q"), true)
-	terms := make([]string, len(termMap))
-	i := 0
-	for term := range termMap {
-		terms[i] = term
-		i++
+	data, err := doSearch(r, viewData)
+	if err != nil {
+		viewData.InternalError(w)
+		return
+	} else if data == nil {
+		viewData.NotFound(w)
+		return
+	}
+
+	viewData.Data = data
+	RenderView(w, "search#search", viewData)
+}
+
+// WebAPISearch handles the route '/webapi/search/'
+func WebAPISearch(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	response := webAPISearchResponse{
+		Successful: false,
 	}
 
+	data, err := doSearch(r, viewData)
+	if err != nil {
+		response.Error = constants.Error500
+		RenderJSON(w, response)
+		return
+	} else if data == nil {
+		response.Error = constants.ErrorArguments
+		RenderJSON(w, response)
+		return
+	}
+
+	response.Successful = true
+	response.Results = data
+	RenderJSON(w, response)
+}
+
+// WebAPISearchSuggest handles the route '/webapi/search/suggest/'
+func WebAPISearchSuggest(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	response := webAPISearchSuggestResponse{
+		Successful: false,
+	}
+
+	// Users who aren't logged in get suggestions from every place, unless
+	// they are searching a single place
+	var placeID int
+	if viewData.Session != nil {
+		placeID = viewData.Session.User.PlaceID
+	} else if len(r.FormValue("place")) > 0 {
+		id, err := strconv.Atoi(r.FormValue("place"))
+		if err != nil || id <= 0 {
+			response.Error = constants.ErrorArguments
+			RenderJSON(w, response)
+			return
+		}
+		placeID = id
+	}
+
+	response.Successful = true
+	response.Suggestions = cache.GetSuggestions(placeID, r.FormValue("q"))
+	RenderJSON(w, response)
+}
+
+// doSearch runs the search described by a request. Returns nil data if the
+// request's arguments are invalid
+func doSearch(r *http.Request, viewData ViewData) (*searchViewData, error) {
+	start := time.Now()
+	queryStr := r.FormValue("q")
+	query := utils.ParseSearchQuery(queryStr)
+
 	pageNumStr := "1"
 	if len(r.FormValue("page")) > 0 {
 		pageNumStr = r.FormValue("page")
 	}
 
 	page, err := strconv.Atoi(pageNumStr)
-	if err != nil {
-		viewData.NotFound(w)
-		return
+	if err != nil || page < 1 {
+		return nil, nil
 	}
 	// Correct for the human readable format for page numbers used
 	// by the client here
 	page = page - 1
 
-	placeID := -1
-	if viewData.Session != nil {
-		placeID = viewData.Session.User.PlaceID
+	filters, filterData := searchFiltersFromRequest(r, viewData)
+
+	// A query which is only an ISBN finds the copies of that book, however
+	// the ISBN was written, rather than listings which mention it
+	if isbn, ok := utils.NormalizeISBN(queryStr); ok {
+		query = utils.SearchQuery{}
+		filters.Types = []string{models.ListingTextbook}
+		filterData.Type = models.ListingTextbook
+		filters.Attributes, filterData.Attributes = models.ParseAttributeFilters(
+			models.ListingTextbook, func(key string) string {
+				if key == "attr_isbn" {
+					return isbn
+				}
+				return r.FormValue(key)
+			})
 	}
 
-	listings := []models.Listing{}
-	if len(terms) > 0 {
-		listings, err = models.DoSearchForTerms(Base.Db, terms, page, placeID)
+	paging := models.SearchPaging{
+		Sort: models.SortRelevance,
+		Page: page,
+	}
+	if _, ok := models.ListingSorts[r.FormValue("sort")]; ok {
+		paging.Sort = r.FormValue("sort")
+	}
+	if len(r.FormValue("cursor")) > 0 {
+		paging.Cursor, err = models.ParseListingCursor(r.FormValue("cursor"))
 		if err != nil {
-			viewData.InternalError(w)
-			return
+			return nil, nil
 		}
 	}
+	filterData.Sort = paging.Sort
 
-	numPages := models.GetPageCountForTerms(Base.Db, terms, placeID)
+	placeID := 0
+	if filters.RestrictByPlace {
+		placeID = filters.PlaceID
+	}
 
-	viewData.Data = searchViewData{
+	listings, err := models.DoSearchForTerms(Base.Db, query, filters, paging)
+	if err != nil {
+		return nil, err
+	}
+
+	// When nothing matches, the query may have a typo in it. If the corrected
+	// query finds listings they are shown instead, otherwise the correction
+	// is only suggested
+	var didYouMean, originalQuery string
+	if len(listings) == 0 && page == 0 && paging.Cursor == nil &&
+		!query.IsEmpty() {
+
+		if correction, ok := cache.CorrectQuery(placeID, queryStr); ok {
+			didYouMean = correction
+			correctedQuery := utils.ParseSearchQuery(correction)
+			correctedListings, err := models.DoSearchForTerms(Base.Db,
+				correctedQuery, filters, paging)
+			if err != nil {
+				return nil, err
+			}
+			if len(correctedListings) > 0 {
+				listings = correctedListings
+				query = correctedQuery
+				originalQuery = queryStr
+				queryStr = correction
+			}
+		}
+	}
+
+	var nextCursor string
+	if len(listings) == models.SearchPageSize {
+		nextCursor = models.NewListingCursor(paging.Sort,
+			&listings[len(listings)-1]).String()
+	}
+
+	facets, err := models.GetSearchFacets(Base.Db, query, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	numPages := models.GetPageCountForTerms(Base.Db, query, filters)
+
+	// Only the first page of a search is logged. Later pages are linked with
+	// the ID of the logged search, so clicks on them count towards it
+	searchID, err := strconv.Atoi(r.FormValue("sq"))
+	if err != nil || searchID < 0 {
+		searchID = 0
+	}
+	if page == 0 && paging.Cursor == nil && !query.IsEmpty() {
+		loggedQuery := queryStr
+		if len(originalQuery) > 0 {
+			loggedQuery = originalQuery
+		}
+		entry := models.NewSearchQueryLog(placeID, loggedQuery,
+			facets.Total(filters), time.Since(start), len(originalQuery) > 0)
+		searchID = 0
+		if entry.Create(Base.Db) == nil {
+			searchID = entry.ID
+		}
+	}
+
+	listingURLs := make([]string, 0, len(listings))
+	for i, listing := range listings {
+		listingURL := "/listing/view/" + strconv.Itoa(listing.ID)
+		if searchID > 0 {
+			listingURL += "?sq=" + strconv.Itoa(searchID) + "&pos=" +
+				strconv.Itoa(page*models.SearchPageSize+i+1)
+		}
+		listingURLs = append(listingURLs, listingURL)
+	}
+	pageData := filterData
+	pageData.SearchID = searchID
+
+	typeLinks := make([]searchFacetLink, 0, len(models.ListingTypeNames))
+	for _, typeName := range models.ListingTypeNames {
+		linkData := filterData
+		linkData.Type = typeName
+		linkData.Attributes = nil
+		typeLinks = append(typeLinks, searchFacetLink{
+			Name:        typeName,
+			Description: models.ListingTypes[typeName],
+			Count:       facets.Types[typeName],
+			URL:         searchPageURL(queryStr, linkData) + "1",
+			Selected:    typeName == filterData.Type,
+		})
+	}
+
+	// Conditions are filtered as "this condition or better", so the count
+	// for each link is the sum of the counts for all better conditions
+	condLinks := make([]searchFacetLink, 0, len(models.ListingConditionNames))
+	cumulative := 0
+	for _, condition := range models.ListingConditionNames[1:] {
+		cumulative += facets.Conditions[condition]
+		linkData := filterData
+		linkData.Condition = condition
+		condLinks = append(condLinks, searchFacetLink{
+			Name:        condition,
+			Description: models.ListingConditions[condition],
+			Count:       cumulative,
+			URL:         searchPageURL(queryStr, linkData) + "1",
+			Selected:    condition == filterData.Condition,
+		})
+	}
+
+	data := &searchViewData{
 		Listings:    listings,
-		Query:       r.FormValue("q"),
+		Facets:      facets,
+		TypeLinks:   typeLinks,
+		CondLinks:   condLinks,
+		Sorts:       sortOptions(models.ListingSortNames, paging.Sort),
+		Filters:     filterData,
+		Query:       queryStr,
+		Sort:        paging.Sort,
+		NextCursor:  nextCursor,
+		PageURL:     searchPageURL(queryStr, pageData),
 		Page:        page + 1,
-		StartOffset: page*50 + 1,
-		EndOffset:   page*50 + len(listings),
-		MaxTotal:    numPages * 50,
+		StartOffset: page*models.SearchPageSize + 1,
+		EndOffset:   page*models.SearchPageSize + len(listings),
+		MaxTotal:    numPages * models.SearchPageSize,
 		OutOf:       numPages,
+		SearchID:    searchID,
+		ListingURLs: listingURLs,
 	}
-	RenderView(w, "search#search", viewData)
+	for _, attr := range models.ListingAttributes[filterData.Type] {
+		if attr.Filterable {
+			data.AttributeFilters = append(data.AttributeFilters, attr)
+		}
+	}
+	if isbn := filterData.Attributes["attr_isbn"]; len(isbn) > 0 {
+		data.BookURL = "/book/" + isbn
+	}
+
+	if len(didYouMean) > 0 {
+		data.DidYouMean = didYouMean
+		data.DidYouMeanURL = searchPageURL(didYouMean, filterData) + "1"
+		data.Corrected = len(originalQuery) > 0
+	}
+	if data.Corrected {
+		data.OriginalQuery = originalQuery
+		data.OriginalURL = searchPageURL(originalQuery, filterData) + "1"
+	}
+	return data, nil
+}
+
+// searchFiltersFromRequest reads search filters from a request. Invalid
+// filters are ignored. Users who are logged in may only search their own
+// place
+func searchFiltersFromRequest(r *http.Request, viewData ViewData) (
+	models.SearchFilters, searchFilterData) {
+
+	var filters models.SearchFilters
+	var data searchFilterData
+
+	if viewData.Session != nil {
+		filters.PlaceID = viewData.Session.User.PlaceID
+		filters.RestrictByPlace = true
+	} else if placeID, err := strconv.Atoi(r.FormValue("place")); err == nil {
+		filters.PlaceID = placeID
+		filters.RestrictByPlace = true
+		data.Place = r.FormValue("place")
+	}
+
+	if minPrice, err := utils.PriceClientToServer(
+		r.FormValue("min_price")); err == nil {
+
+		filters.MinPrice = minPrice
+		filters.RestrictByMinPrice = true
+		data.MinPrice = r.FormValue("min_price")
+	}
+	if maxPrice, err := utils.PriceClientToServer(
+		r.FormValue("max_price")); err == nil {
+
+		filters.MaxPrice = maxPrice
+		filters.RestrictByMaxPrice = true
+		data.MaxPrice = r.FormValue("max_price")
+	}
+
+	typeName := r.FormValue("type")
+	if _, ok := models.ListingTypes[typeName]; ok {
+		filters.Types = []string{typeName}
+		data.Type = typeName
+		filters.Attributes, data.Attributes = models.ParseAttributeFilters(
+			typeName, r.FormValue)
+	}
+
+	condition := r.FormValue("condition")
+	if conditions := models.ListingConditionsAtLeast(condition); conditions != nil {
+		filters.Conditions = conditions
+		data.Condition = condition
+	}
+
+	return filters, data
+}
+
+// searchPageURL builds the URL for a page of search results, without the
+// page number. The page number can be appended to the end of the URL
+func searchPageURL(query string, filterData searchFilterData) string {
+	values := url.Values{}
+	values.Set("q", query)
+	if len(filterData.MinPrice) > 0 {
+		values.Set("min_price", filterData.MinPrice)
+	}
+	if len(filterData.MaxPrice) > 0 {
+		values.Set("max_price", filterData.MaxPrice)
+	}
+	if len(filterData.Type) > 0 {
+		values.Set("type", filterData.Type)
+	}
+	if len(filterData.Condition) > 0 {
+		values.Set("condition", filterData.Condition)
+	}
+	if len(filterData.Place) > 0 {
+		values.Set("place", filterData.Place)
+	}
+	if len(filterData.Sort) > 0 && filterData.Sort != models.SortRelevance {
+		values.Set("sort", filterData.Sort)
+	}
+	for key, value := range filterData.Attributes {
+		values.Set(key, value)
+	}
+	if filterData.SearchID > 0 {
+		values.Set("sq", strconv.Itoa(filterData.SearchID))
+	}
+	return "/search/?" + values.Encode() + "&page="
 }
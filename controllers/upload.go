@@ -106,7 +106,7 @@ func postUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := models.GetListingByID(Base.Db, id)
+	listing, err := Base.Store.Listings.GetByID(id)
 	if err != nil || listing == nil {
 		response.Error = "Couldn't Find Listing"
 		ru.AttemptSkipMultipart()
@@ -114,7 +114,7 @@ func postUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	imageCount, err := listing.GetImageCount(Base.Db)
+	imageCount, err := Base.Store.Images.GetCountForListing(listing)
 	if err != nil {
 		response.Error = "Couldn't Get Image Count For Listing"
 		ru.AttemptSkipMultipart()
@@ -139,7 +139,7 @@ func postUpload(w http.ResponseWriter, r *http.Request) {
 			Ordinal: 0,
 			User:    viewData.Session.User,
 		}
-		if ok, _ := image.Create(Base.Db); !ok {
+		if ok, _ := Base.Store.Images.Create(&image); !ok {
 			response.FailedImages = append(response.FailedImages, ipr.OriginalName)
 			ipr.File.Close()
 			os.Remove(ipr.File.Name())
@@ -162,7 +162,7 @@ func postUpload(w http.ResponseWriter, r *http.Request) {
 					// For testing, create a relative URL instead of an absolute url
 					image.URL = "/local/" + ipr.RequestedName
 				}
-				ok, _ := image.Save(Base.Db)
+				ok, _ := Base.Store.Images.Save(&image)
 
 				if !ok {
 					Base.WebsockChannel <- wsock.UserJSONNotification(
@@ -188,7 +188,7 @@ func postUpload(w http.ResponseWriter, r *http.Request) {
 
 			// This is called if an image cannot be successfully uploaded and saved
 			ipr.Error = func(ipr *utils.ImageProcessRequest) {
-				image.Delete(Base.Db)
+				Base.Store.Images.Delete(&image)
 
 				// Let the client know we failed
 				Base.WebsockChannel <- wsock.UserJSONNotification(
@@ -28,6 +28,16 @@ type profileData struct {
 	HasError bool
 	Error    models.UserError
 	User     models.User
+	Reviews  []models.Review
+}
+
+type publicProfileData struct {
+	User     models.User
+	Reviews  []models.Review
+	Page     int
+	PrevPage int
+	NextPage int
+	HasMore  bool
 }
 
 // ForceLogin redirects a user to the login page with a redirect back
@@ -71,7 +81,7 @@ func postLogin(w http.ResponseWriter, r *http.Request) {
 	} else {
 		username := strings.TrimSpace(strings.ToLower(r.FormValue("username")))
 		password := r.FormValue("password")
-		user := models.GetUserByUsername(Base.Db, username)
+		user := Base.Store.Users.GetByUsername(username)
 		valid, err := user.Authenticate(password)
 		if err != nil || !valid {
 
@@ -87,7 +97,7 @@ func postLogin(w http.ResponseWriter, r *http.Request) {
 				User:         *user,
 				BrowserAgent: r.Header.Get("User-Agent"),
 			}
-			created, _ := session.Create(Base.Db)
+			created, _ := Base.Store.Sessions.Create(&session)
 			if !created {
 				viewData.Data = &loginData{
 					HasError: true,
@@ -136,14 +146,66 @@ func getUserProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	viewData.Data = &profileData{
+	// Other users' profiles only show their reputation and reviews
+	if args := URIArgs(r); len(args) == 1 &&
+		args[0] != viewData.Session.User.Username {
+
+		getPublicProfile(w, r, viewData, args[0])
+		return
+	}
+
+	data := &profileData{
 		HasError: false,
 		User:     viewData.Session.User,
 	}
+	attachReputations(&data.User)
+	data.Reviews, _ = Base.Store.Reviews.GetForUser(data.User.ID, 0)
+	viewData.Data = data
 
 	RenderView(w, "user#profile", viewData)
 }
 
+// getPublicProfile shows the reputation and reviews of the user with the
+// username in the URI of '/user/profile/'
+func getPublicProfile(w http.ResponseWriter, r *http.Request,
+	viewData ViewData, username string) {
+
+	user := Base.Store.Users.GetByUsername(username)
+	if user == nil {
+		viewData.NotFound(w)
+		return
+	}
+
+	pageNum := 0
+	if pageNumStr := r.FormValue("page"); len(pageNumStr) > 0 {
+		pageNum, _ = strconv.Atoi(pageNumStr)
+		if pageNum < 0 {
+			pageNum = 0
+		}
+	}
+	reviews, err := Base.Store.Reviews.GetForUser(user.ID, pageNum)
+	if err != nil {
+		viewData.InternalError(w)
+		return
+	}
+
+	data := &publicProfileData{
+		User: models.User{
+			ID:          user.ID,
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+		},
+		Reviews:  reviews,
+		Page:     pageNum,
+		PrevPage: pageNum - 1,
+		NextPage: pageNum + 1,
+		HasMore:  len(reviews) == models.ReviewsPageSize,
+	}
+	attachReputations(&data.User)
+	viewData.Data = data
+	RenderView(w, "user#public", viewData)
+}
+
 func postUserProfile(w http.ResponseWriter, r *http.Request) {
 	viewData := BaseViewData(w, r)
 	if viewData.Session == nil {
@@ -155,7 +217,7 @@ func postUserProfile(w http.ResponseWriter, r *http.Request) {
 	viewData.Session.User.Password = r.FormValue("password")
 	viewData.Session.User.PasswordConfirmation = r.FormValue("password_confirmation")
 
-	valid, userErr := viewData.Session.User.Save(Base.Db)
+	valid, userErr := Base.Store.Users.Save(&viewData.Session.User)
 	if !valid {
 		viewData.Data = &profileData{
 			HasError: true,
@@ -203,7 +265,7 @@ func postRegister(w http.ResponseWriter, r *http.Request) {
 			Password:             r.FormValue("password"),
 			PasswordConfirmation: r.FormValue("password_confirmation"),
 		}
-		created, err := user.Create(Base.Db)
+		created, err := Base.Store.Users.Create(&user)
 		if !created {
 			viewData.Data = &registerData{
 				HasError: true,
@@ -246,14 +308,14 @@ func UserActivate(w http.ResponseWriter, r *http.Request) {
 
 	activation := args[1]
 
-	user := models.GetUserByID(Base.Db, id)
+	user := Base.Store.Users.GetByID(id)
 	if user == nil {
 		viewData.NotFound(w)
 		return
 	}
 
 	if strings.Compare(activation, user.Activation) == 0 {
-		if user.Activate(Base.Db) == nil {
+		if Base.Store.Users.Activate(user) == nil {
 			viewData.RenderMessage(w, false, "Account Activated",
 				"Your account has successfully been activated! You can now log "+
 					"in, post listings, make offers, and chat with other users.")
@@ -278,12 +340,12 @@ func UserLogout(w http.ResponseWriter, r *http.Request) {
 // Slightly different pattern from the other methods
 // Since no view is rendered, no BaseViewData is necessary
 func getLogout(w http.ResponseWriter, r *http.Request) {
-	session := models.GetSessionFromRequest(Base.Db, w, r)
+	session := models.GetSessionFromRequest(Base.Store.Sessions, w, r)
 	utils.DeleteCookie(w, "session_id")
 	utils.DeleteCookie(w, "session_secret")
 
 	if session != nil {
-		session.Delete(Base.Db)
+		Base.Store.Sessions.Delete(session)
 	}
 	http.Redirect(w, r, "/", http.StatusFound)
 }
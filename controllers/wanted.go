@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/anishmgoyal/calagora/email"
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
+	"github.com/anishmgoyal/calagora/wsock"
+)
+
+const (
+	notifWantedResponse = "NOTIF_WANTED_RESPONSE"
+)
+
+type wantedListViewData struct {
+	Posts   []models.WantedPost
+	Query   string
+	PageURL string
+	Page    int
+	OutOf   int
+	// MyPosts are the wanted posts made by the user viewing the list
+	MyPosts []models.WantedPost
+}
+
+type wantedCreateViewData struct {
+	HasError bool
+	Error    models.WantedError
+	Post     models.WantedPost
+}
+
+type wantedViewData struct {
+	Post models.WantedPost
+	// IsOwner is set when the user viewing the post made it, and can see
+	// its responses and close it
+	IsOwner   bool
+	Responses []models.WantedResponse
+	// Choices are the user's listings which can be offered for the post
+	Choices  []models.Listing
+	HasError bool
+	Error    models.WantedError
+}
+
+// WantedList handles the route '/wanted/', which lists and searches the
+// open wanted posts at the user's place
+func WantedList(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if len(r.FormValue("page")) == 0 {
+		page, err = 1, nil
+	}
+	if err != nil || page < 1 {
+		viewData.NotFound(w)
+		return
+	}
+
+	queryStr := r.FormValue("q")
+	query := utils.ParseSearchQuery(queryStr)
+	placeID := viewData.Session.User.PlaceID
+	posts, err := models.SearchWantedPosts(Base.Db, placeID, query, page-1)
+	if err != nil {
+		viewData.InternalError(w)
+		return
+	}
+
+	data := &wantedListViewData{
+		Posts:   posts,
+		Query:   queryStr,
+		PageURL: "/wanted/?" + url.Values{"q": {queryStr}}.Encode() + "&page=",
+		Page:    page,
+		OutOf:   models.GetWantedPageCount(Base.Db, placeID, query),
+	}
+	if page == 1 && query.IsEmpty() {
+		data.MyPosts, err = viewData.Session.User.GetWantedPosts(Base.Db)
+		if err != nil {
+			viewData.InternalError(w)
+			return
+		}
+	}
+
+	viewData.Data = data
+	RenderView(w, "wanted#list", viewData)
+}
+
+// WantedCreate handles the route '/wanted/create/'
+func WantedCreate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getWantedCreate(w, r)
+	case http.MethodPost:
+		postWantedCreate(w, r)
+	default:
+		BaseViewData(w, r).NotFound(w)
+	}
+}
+
+func getWantedCreate(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+	viewData.Data = &wantedCreateViewData{}
+	RenderView(w, "wanted#create", viewData)
+}
+
+func postWantedCreate(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	if !viewData.ValidCsrf(r) {
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	post := models.WantedPost{
+		User:           viewData.Session.User,
+		PlaceID:        viewData.Session.User.PlaceID,
+		Title:          r.FormValue("title"),
+		Description:    r.FormValue("description"),
+		MaxPriceClient: strings.TrimSpace(r.FormValue("max_price")),
+	}
+
+	var wantedErr *models.WantedError
+	ok := false
+	if len(post.MaxPriceClient) > 0 {
+		if price, err := utils.PriceClientToServer(post.MaxPriceClient); err != nil {
+			wantedErr = &models.WantedError{MaxPrice: "That price is invalid."}
+		} else {
+			post.MaxPrice = &price
+		}
+	}
+	if wantedErr == nil {
+		ok, wantedErr = post.Create(Base.Db)
+	}
+
+	if !ok {
+		viewData.Data = &wantedCreateViewData{
+			HasError: true,
+			Error:    *wantedErr,
+			Post:     post,
+		}
+		RenderView(w, "wanted#create", viewData)
+		return
+	}
+
+	http.Redirect(w, r, "/wanted/view/"+strconv.Itoa(post.ID), http.StatusFound)
+}
+
+// WantedView handles the route '/wanted/view/', where sellers respond to a
+// wanted post by offering one of their listings for it
+func WantedView(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getWantedView(w, r)
+	case http.MethodPost:
+		postWantedView(w, r)
+	default:
+		BaseViewData(w, r).NotFound(w)
+	}
+}
+
+func getWantedView(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	data := newWantedViewData(w, r, &viewData)
+	if data == nil {
+		return
+	}
+	viewData.Data = data
+	RenderView(w, "wanted#view", viewData)
+}
+
+func postWantedView(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	if !viewData.ValidCsrf(r) {
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	data := newWantedViewData(w, r, &viewData)
+	if data == nil {
+		return
+	}
+
+	var offer *models.Offer
+	var wantedErr *models.WantedError
+	listingID, err := strconv.Atoi(r.FormValue("listing_id"))
+	listing, listingErr := Base.Store.Listings.GetByID(listingID)
+	if err != nil || listingErr != nil || listing == nil ||
+		listing.User.ID != viewData.Session.User.ID {
+
+		wantedErr = &models.WantedError{Listing: "Choose one of your listings " +
+			"to offer."}
+	} else {
+		offer, wantedErr = data.Post.Respond(Base.Db, listing)
+	}
+
+	if wantedErr != nil {
+		data.HasError = true
+		data.Error = *wantedErr
+		viewData.Data = data
+		RenderView(w, "wanted#view", viewData)
+		return
+	}
+
+	offer.Seller = models.User{
+		ID:          viewData.Session.User.ID,
+		Username:    viewData.Session.User.Username,
+		DisplayName: viewData.Session.User.DisplayName,
+	}
+	email.WantedResponseEmail(data.Post, *offer)
+	offer.Buyer = models.User{
+		ID:          data.Post.User.ID,
+		Username:    data.Post.User.Username,
+		DisplayName: data.Post.User.DisplayName,
+	}
+	Base.WebsockChannel <- wsock.UserJSONNotification(&data.Post.User,
+		notifWantedResponse, offer, true)
+
+	http.Redirect(w, r, "/offer/seller/"+strconv.Itoa(offer.ID),
+		http.StatusFound)
+}
+
+// WantedClose handles the route '/wanted/close/', where a user closes one
+// of their wanted posts
+func WantedClose(w http.ResponseWriter, r *http.Request) {
+	viewData := BaseViewData(w, r)
+	if r.Method != http.MethodPost {
+		viewData.NotFound(w)
+		return
+	}
+	if viewData.Session == nil {
+		viewData.ForceLogin(w, r)
+		return
+	}
+
+	args := URIArgs(r)
+	if len(args) != 1 || !viewData.ValidCsrf(r) {
+		viewData.NotFound(w)
+		return
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		viewData.NotFound(w)
+		return
+	}
+
+	post := models.WantedPost{ID: id, User: viewData.Session.User}
+	if _, err := post.Close(Base.Db); err != nil {
+		viewData.InternalError(w)
+		return
+	}
+	http.Redirect(w, r, "/wanted/view/"+args[0], http.StatusFound)
+}
+
+// newWantedViewData loads the wanted post in the URI of a wanted post page,
+// along with its responses for its author or the listings which can be
+// offered for it for anyone else. If the post can't be viewed by the user
+// viewing it, an error is written and nil is returned
+func newWantedViewData(w http.ResponseWriter, r *http.Request,
+	viewData *ViewData) *wantedViewData {
+
+	args := URIArgs(r)
+	if len(args) != 1 {
+		viewData.NotFound(w)
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		viewData.NotFound(w)
+		return nil
+	}
+
+	post, err := models.GetWantedPostByID(Base.Db, id)
+	if err != nil {
+		viewData.InternalError(w)
+		return nil
+	} else if post == nil {
+		viewData.NotFound(w)
+		return nil
+	}
+
+	user := &viewData.Session.User
+	if post.PlaceID != user.PlaceID {
+		viewData.WrongPlace(w, post.PlaceID, user.PlaceID)
+		return nil
+	}
+
+	data := &wantedViewData{
+		Post:    *post,
+		IsOwner: post.User.ID == user.ID,
+	}
+	if data.IsOwner {
+		data.Responses, err = post.GetResponses(Base.Db)
+		if err != nil {
+			viewData.InternalError(w)
+			return nil
+		}
+	} else if post.Status == models.WantedOpen {
+		data.Choices = Base.Store.Listings.GetList(models.ListingQueryOpts{
+			UserID:           user.ID,
+			RestrictByUser:   true,
+			Status:           models.ListingListed,
+			RestrictByStatus: true,
+			HideDraft:        true,
+			HideExpired:      true,
+		})
+	}
+	return data
+}
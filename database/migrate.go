@@ -0,0 +1,458 @@
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migration_*.cal.sql
+var migrationFiles embed.FS
+
+// setupMigration creates the database and its role, so it can't be run
+// over a connection to that database. It is run by hand as a superuser, or
+// by the postgres image in docker-db
+const setupMigration = "setup"
+
+// Migration is a single versioned change to the schema, read from a
+// migration_<name>.cal.sql file
+type Migration struct {
+	Name    string
+	Version string
+	Depends []string
+	Up      string
+	Down    string
+}
+
+// ID gets the name and version of a migration, in the form used by
+// #<depend> lines
+func (m *Migration) ID() string {
+	return m.Name + ":" + m.Version
+}
+
+// MigrationStatus is whether or not a migration has been applied to a
+// database, and when
+type MigrationStatus struct {
+	Migration *Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads the migrations built into the binary, in the order
+// they should be applied
+func LoadMigrations() ([]*Migration, error) {
+	names, err := migrationFiles.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*Migration, 0, 30)
+	for _, entry := range names {
+		name := strings.TrimSuffix(strings.TrimPrefix(entry.Name(),
+			"migration_"), ".cal.sql")
+		if name == setupMigration {
+			continue
+		}
+
+		contents, err := migrationFiles.ReadFile(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseMigrations(name, string(contents))
+		if err != nil {
+			return nil, errors.New(entry.Name() + ": " + err.Error())
+		}
+		migrations = append(migrations, parsed...)
+	}
+	return orderMigrations(migrations)
+}
+
+// parseMigrations reads the #<up> and #<down> sections of a migration file
+func parseMigrations(name, contents string) ([]*Migration, error) {
+	byVersion := make(map[string]*Migration)
+	migrations := make([]*Migration, 0, 4)
+	getMigration := func(version string) *Migration {
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Name: name, Version: version}
+			byVersion[version] = m
+			migrations = append(migrations, m)
+		}
+		return m
+	}
+
+	var current *Migration
+	var isUp bool
+	var body []string
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(text, "#<") {
+			if current != nil {
+				body = append(body, scanner.Text())
+			} else if len(text) > 0 {
+				return nil, errors.New("line " + strconv.Itoa(line) +
+					": statement outside of a section")
+			}
+			continue
+		}
+
+		directive, arg, err := parseDirective(text)
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(line) + ": " + err.Error())
+		}
+		switch directive {
+		case "up", "down":
+			if current != nil {
+				return nil, errors.New("line " + strconv.Itoa(line) +
+					": section started before #<end>")
+			}
+			current = getMigration(arg)
+			isUp = directive == "up"
+			if (isUp && len(current.Up) > 0) || (!isUp && len(current.Down) > 0) {
+				return nil, errors.New("line " + strconv.Itoa(line) + ": duplicate " +
+					directive + " section for version " + arg)
+			}
+			body = body[:0]
+		case "depend":
+			if current == nil || !isUp {
+				return nil, errors.New("line " + strconv.Itoa(line) +
+					": #<depend> outside of an up section")
+			}
+			current.Depends = append(current.Depends, arg)
+		case "end":
+			if current == nil {
+				return nil, errors.New("line " + strconv.Itoa(line) +
+					": #<end> outside of a section")
+			}
+			statements := strings.TrimSpace(strings.Join(body, "\n"))
+			if isUp {
+				current.Up = statements
+			} else {
+				current.Down = statements
+			}
+			current = nil
+		default:
+			return nil, errors.New("line " + strconv.Itoa(line) +
+				": unknown directive " + directive)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, errors.New("missing #<end>")
+	}
+
+	for _, m := range migrations {
+		if len(m.Up) == 0 {
+			return nil, errors.New("version " + m.Version + " has no up section")
+		}
+	}
+	return migrations, nil
+}
+
+// parseDirective splits a line such as #<up "1.00"> into its directive and
+// quoted argument
+func parseDirective(text string) (string, string, error) {
+	if !strings.HasSuffix(text, ">") {
+		return "", "", errors.New("unterminated directive " + text)
+	}
+	fields := strings.SplitN(text[2:len(text)-1], " ", 2)
+	directive := fields[0]
+	if directive == "end" {
+		return directive, "", nil
+	}
+	if len(fields) != 2 {
+		return "", "", errors.New("#<" + directive + "> needs an argument")
+	}
+	arg, err := strconv.Unquote(strings.TrimSpace(fields[1]))
+	if err != nil || len(arg) == 0 {
+		return "", "", errors.New("bad argument to #<" + directive + ">")
+	}
+	return directive, arg, nil
+}
+
+// compareVersions compares dotted version numbers part by part, so that
+// 1.10 comes after 1.9
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aNum, bNum int
+		if i < len(aParts) {
+			aNum, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, _ = strconv.Atoi(bParts[i])
+		}
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// orderMigrations sorts migrations so that each comes after its
+// dependencies and after the earlier versions of the same file. Migrations
+// which could go in either order are sorted by name and version, so the
+// order never changes between runs
+func orderMigrations(migrations []*Migration) ([]*Migration, error) {
+	sort.Slice(migrations, func(i, j int) bool {
+		if migrations[i].Name != migrations[j].Name {
+			return migrations[i].Name < migrations[j].Name
+		}
+		return compareVersions(migrations[i].Version, migrations[j].Version) < 0
+	})
+
+	byID := make(map[string]*Migration)
+	for _, m := range migrations {
+		byID[m.ID()] = m
+	}
+
+	ordered := make([]*Migration, 0, len(migrations))
+	state := make(map[string]int)
+	const visiting, visited = 1, 2
+	var visit func(m *Migration) error
+	visit = func(m *Migration) error {
+		switch state[m.ID()] {
+		case visiting:
+			return errors.New("dependency cycle at " + m.ID())
+		case visited:
+			return nil
+		}
+		state[m.ID()] = visiting
+
+		depends := make([]string, 0, len(m.Depends)+1)
+		for _, other := range migrations {
+			if other.Name == m.Name &&
+				compareVersions(other.Version, m.Version) < 0 {
+
+				depends = append(depends, other.ID())
+			}
+		}
+		depends = append(depends, m.Depends...)
+		for _, id := range depends {
+			dependency, ok := byID[id]
+			if !ok {
+				return errors.New(m.ID() + " depends on unknown migration " + id)
+			}
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		state[m.ID()] = visited
+		ordered = append(ordered, m)
+		return nil
+	}
+
+	for _, m := range migrations {
+		if err := visit(m); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// ensureMigrationsTable creates the table recording applied migrations. A
+// database which already has tables but no record of migrations was made
+// from docker-db/schema.sql before migrations were tracked, and running
+// every migration against it would fail
+func ensureMigrationsTable(db *sql.DB) error {
+	var exists, hasSchema bool
+	err := db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL, "+
+		"to_regclass('users') IS NOT NULL").Scan(&exists, &hasSchema)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if hasSchema {
+		return errors.New("the database has tables but no schema_migrations; " +
+			"if it is up to date with docker-db/schema.sql, run " +
+			"`calagora migrate up -fake` to record that")
+	}
+	return createMigrationsTable(db)
+}
+
+func createMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"id SERIAL PRIMARY KEY, " +
+		"name VARCHAR(100) NOT NULL, " +
+		"version VARCHAR(20) NOT NULL, " +
+		"applied TIMESTAMP WITH TIME ZONE DEFAULT(now()), " +
+		"UNIQUE (name, version))")
+	return err
+}
+
+// getAppliedMigrations gets when each applied migration was applied, and
+// the IDs of the applied migrations, most recent last
+func getAppliedMigrations(db *sql.DB) (map[string]time.Time, []string,
+	error) {
+
+	rows, err := db.Query("SELECT name, version, applied FROM " +
+		"schema_migrations ORDER BY id")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]time.Time)
+	order := make([]string, 0, 30)
+	for rows.Next() {
+		var m Migration
+		var at time.Time
+		if err := rows.Scan(&m.Name, &m.Version, &at); err != nil {
+			return nil, nil, err
+		}
+		applied[m.ID()] = at
+		order = append(order, m.ID())
+	}
+	return applied, order, rows.Err()
+}
+
+// GetMigrationStatus gets every migration built into the binary, in the
+// order they are applied, along with whether or not each has been applied
+func GetMigrationStatus(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err = ensureMigrationsTable(db); err != nil {
+		fmt.Println("[ERROR] database.GetMigrationStatus: " + err.Error())
+		return nil, err
+	}
+	applied, _, err := getAppliedMigrations(db)
+	if err != nil {
+		fmt.Println("[ERROR] database.GetMigrationStatus: " + err.Error())
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := applied[m.ID()]
+		statuses = append(statuses, MigrationStatus{
+			Migration: m,
+			Applied:   ok,
+			AppliedAt: at,
+		})
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies every migration which hasn't been applied yet, each in
+// its own transaction, and returns the number applied. If fake is true,
+// the migrations are recorded as applied without being run, for databases
+// that were created from docker-db/schema.sql
+func MigrateUp(db *sql.DB, fake bool) (int, error) {
+	if fake {
+		if err := createMigrationsTable(db); err != nil {
+			fmt.Println("[ERROR] database.MigrateUp: " + err.Error())
+			return 0, err
+		}
+	}
+
+	statuses, err := GetMigrationStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+		m := status.Migration
+		up := m.Up
+		if fake {
+			up = ""
+		}
+		err := runMigration(db, up, "INSERT INTO schema_migrations (name, "+
+			"version) VALUES ($1, $2)", m)
+		if err != nil {
+			fmt.Println("[ERROR] database.MigrateUp: " + m.ID() + ": " +
+				err.Error())
+			return count, errors.New(m.ID() + ": " + err.Error())
+		}
+		fmt.Println("[INFO] migrate: applied " + m.ID())
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, up to steps of
+// them, and returns the number reverted
+func MigrateDown(db *sql.DB, steps int) (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	byID := make(map[string]*Migration)
+	for _, m := range migrations {
+		byID[m.ID()] = m
+	}
+
+	if err = ensureMigrationsTable(db); err != nil {
+		fmt.Println("[ERROR] database.MigrateDown: " + err.Error())
+		return 0, err
+	}
+	_, order, err := getAppliedMigrations(db)
+	if err != nil {
+		fmt.Println("[ERROR] database.MigrateDown: " + err.Error())
+		return 0, err
+	}
+
+	count := 0
+	for i := len(order) - 1; i >= 0 && count < steps; i-- {
+		m, ok := byID[order[i]]
+		if !ok {
+			return count, errors.New(order[i] + " is not built into this binary")
+		}
+		if len(m.Down) == 0 {
+			return count, errors.New(m.ID() + " has no down section")
+		}
+		err := runMigration(db, m.Down, "DELETE FROM schema_migrations "+
+			"WHERE name = $1 AND version = $2", m)
+		if err != nil {
+			fmt.Println("[ERROR] database.MigrateDown: " + m.ID() + ": " +
+				err.Error())
+			return count, errors.New(m.ID() + ": " + err.Error())
+		}
+		fmt.Println("[INFO] migrate: reverted " + m.ID())
+		count++
+	}
+	return count, nil
+}
+
+// runMigration runs the SQL for a migration and updates schema_migrations
+// in the same transaction, so that a failed migration leaves no trace
+func runMigration(db *sql.DB, migrationSQL, record string,
+	m *Migration) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if len(migrationSQL) > 0 {
+		if _, err = tx.Exec(migrationSQL); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err = tx.Exec(record, m.Name, m.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
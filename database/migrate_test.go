@@ -0,0 +1,95 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMigrations(t *testing.T) {
+	migrations, err := parseMigrations("widget", `#<up "1.00">
+#<depend "user:1.00">
+CREATE TABLE widgets (id SERIAL PRIMARY KEY);
+#<end>
+
+#<up "1.01">
+ALTER TABLE widgets ADD COLUMN name VARCHAR(20);
+#<end>
+
+#<down "1.01">
+ALTER TABLE widgets DROP COLUMN name;
+#<end>
+
+#<down "1.00">
+DROP TABLE widgets;
+#<end>
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Got %d migrations, expected 2", len(migrations))
+	}
+	first := migrations[0]
+	if first.ID() != "widget:1.00" || len(first.Depends) != 1 ||
+		first.Depends[0] != "user:1.00" {
+
+		t.Errorf("Got unexpected first migration: %+v", first)
+	}
+	if first.Up != "CREATE TABLE widgets (id SERIAL PRIMARY KEY);" ||
+		first.Down != "DROP TABLE widgets;" {
+
+		t.Errorf("Got unexpected SQL: %q / %q", first.Up, first.Down)
+	}
+
+	if _, err := parseMigrations("widget", "#<up \"1.00\">\nSELECT 1;\n"); err == nil {
+		t.Error("Parsed a migration without #<end>")
+	}
+	if _, err := parseMigrations("widget", "#<down \"1.00\">\nSELECT 1;\n#<end>"); err == nil {
+		t.Error("Parsed a migration without an up section")
+	}
+}
+
+func TestOrderMigrations(t *testing.T) {
+	migrations := []*Migration{
+		{Name: "b", Version: "1.10", Up: "x"},
+		{Name: "a", Version: "1.00", Up: "x", Depends: []string{"b:1.00"}},
+		{Name: "b", Version: "1.9", Up: "x"},
+		{Name: "b", Version: "1.00", Up: "x"},
+	}
+	ordered, err := orderMigrations(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(ordered))
+	for _, m := range ordered {
+		ids = append(ids, m.ID())
+	}
+	if got := strings.Join(ids, " "); got != "b:1.00 a:1.00 b:1.9 b:1.10" {
+		t.Errorf("Got order %s", got)
+	}
+
+	migrations = append(migrations, &Migration{Name: "c", Version: "1.00",
+		Up: "x", Depends: []string{"d:1.00"}})
+	if _, err := orderMigrations(migrations); err == nil {
+		t.Error("Ordered migrations with an unknown dependency")
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := make(map[string]bool)
+	for _, m := range migrations {
+		if m.Name == setupMigration {
+			t.Error("Loaded the setup migration")
+		}
+		for _, id := range m.Depends {
+			if !applied[id] {
+				t.Errorf("%s comes before its dependency %s", m.ID(), id)
+			}
+		}
+		applied[m.ID()] = true
+	}
+}
@@ -0,0 +1,14 @@
+#<up "1.00">
+
+CREATE TABLE books (
+  isbn CHAR(13) PRIMARY KEY,
+  title VARCHAR(255) NOT NULL,
+  author VARCHAR(255) NOT NULL,
+  edition VARCHAR(20) NOT NULL DEFAULT(''),
+  imported TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+#<end>
+
+#<down "1.00">
+DROP TABLE books;
+#<end>
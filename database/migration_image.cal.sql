@@ -1,5 +1,5 @@
 #<up "1.00">
-#<depend "users:1.00">
+#<depend "user:1.00">
 CREATE TABLE images (
     id serial primary key,
     media varchar(20),
@@ -12,8 +12,7 @@ CREATE TABLE images (
 );
 
 CREATE UNIQUE INDEX ind_images_id ON images (id);
-CREATE INDEX ind_images_media ON images (media);
-CREATE INDEX ind_images_media_id ON images (media_id);
+CREATE INDEX ind_images_media_media_id ON images (media, media_id);
 CREATE INDEX ind_images_user_id ON images (user_id);
 #<end>
 
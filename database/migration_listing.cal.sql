@@ -29,10 +29,58 @@ CREATE TABLE listings (
 
 CREATE UNIQUE INDEX ind_listings_id ON listings (id);
 CREATE INDEX ind_listings_user_id ON listings (user_id);
-CREATE INDEX ind_listings_place_id ON listings (place_id);
+CREATE INDEX ind_listings_place_id_type ON listings (place_id, type);
 CREATE INDEX ind_listings_type ON listings (type);
 #<end>
 
+#<up "1.01">
+#<depend "listing:1.00">
+CREATE TABLE listing_attributes (
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  name VARCHAR(40) NOT NULL,
+  value VARCHAR(255) NOT NULL,
+  number_value INT,
+  PRIMARY KEY (listing_id, name)
+);
+
+CREATE INDEX ind_listing_attributes_name_value ON listing_attributes (name, lower(value));
+CREATE INDEX ind_listing_attributes_name_number_value ON listing_attributes (name, number_value);
+#<end>
+
+#<up "1.02">
+#<depend "listing:1.01">
+ALTER TABLE listings ADD COLUMN expires TIMESTAMP WITH TIME ZONE;
+ALTER TABLE listings ADD COLUMN expiry_reminded BOOLEAN NOT NULL DEFAULT(false);
+ALTER TABLE listings ADD COLUMN bumped TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT(now());
+
+UPDATE listings SET bumped = COALESCE(created, now());
+UPDATE listings SET expires = now() + interval '30 days' WHERE published;
+
+CREATE INDEX ind_listings_expires ON listings (expires);
+CREATE INDEX ind_listings_bumped_id ON listings (bumped, id);
+#<end>
+
+#<up "1.03">
+#<depend "listing:1.02">
+ALTER TABLE listings ADD COLUMN publish_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX ind_listings_publish_at ON listings (publish_at);
+#<end>
+
+#<down "1.03">
+ALTER TABLE listings DROP COLUMN publish_at;
+#<end>
+
+#<down "1.02">
+ALTER TABLE listings DROP COLUMN bumped;
+ALTER TABLE listings DROP COLUMN expiry_reminded;
+ALTER TABLE listings DROP COLUMN expires;
+#<end>
+
+#<down "1.01">
+DROP TABLE listing_attributes;
+#<end>
+
 #<down "1.00">
 DROP TABLE listings;
 DROP TYPE listing_status;
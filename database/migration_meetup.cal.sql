@@ -0,0 +1,29 @@
+#<up "1.00">
+#<depend "user:1.00">
+#<depend "offer:1.00">
+CREATE TABLE meetups (
+  id SERIAL PRIMARY KEY,
+  offer_id INT NOT NULL UNIQUE REFERENCES offers(id) ON DELETE CASCADE,
+  proposer_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  meets_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  location VARCHAR(200) NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  modified TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+#<end>
+
+#<up "1.01">
+#<depend "meetup:1.00">
+-- sequence counts the changes to a meetup, so that calendars replace an
+-- event they already have with the newest version of it
+ALTER TABLE meetups ADD COLUMN sequence INT NOT NULL DEFAULT(0);
+#<end>
+
+#<down "1.01">
+ALTER TABLE meetups DROP COLUMN sequence;
+#<end>
+
+#<down "1.00">
+DROP TABLE meetups;
+#<end>
@@ -1,4 +1,5 @@
 #<up "1.00">
+#<depend "user:1.00">
 CREATE TABLE notifications (
   id serial primary key,
   user_id int references users(id) on delete cascade,
@@ -1,6 +1,6 @@
 #<up "1.00">
-#<depend "users:1.00">
-#<depend "listings:1.00">
+#<depend "user:1.00">
+#<depend "listing:1.00">
 CREATE TABLE offers (
   id serial primary key,
   price int not null,
@@ -23,6 +23,122 @@ CREATE INDEX ind_seller_id ON offers (seller_id);
 CREATE INDEX ind_buyer_id ON offers (buyer_id);
 #<end>
 
+#<up "1.01">
+CREATE TABLE offer_events (
+  id SERIAL PRIMARY KEY,
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  action VARCHAR(20) NOT NULL,
+  actor VARCHAR(20) NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  price INT,
+  comment VARCHAR(140),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_offer_events_offer_id ON offer_events (offer_id);
+
+-- Existing offers only kept their latest prices, so their history starts
+-- from those
+INSERT INTO offer_events (offer_id, action, actor, status, price, comment,
+  created)
+SELECT id, 'offer', 'buyer', 'offered', price, buyer_comment, created
+FROM offers;
+
+INSERT INTO offer_events (offer_id, action, actor, status, price, comment,
+  created)
+SELECT id, 'counter', 'seller', 'countered', counter, seller_comment, modified
+FROM offers WHERE is_countered;
+
+INSERT INTO offer_events (offer_id, action, actor, status, created)
+SELECT id, 'accept', 'seller', 'accepted', modified
+FROM offers WHERE status IN ('accepted', 'completed');
+
+INSERT INTO offer_events (offer_id, action, actor, status, created)
+SELECT id, 'complete', 'seller', 'completed', modified
+FROM offers WHERE status = 'completed';
+
+UPDATE offers SET status = 'countered' WHERE status = 'offered' AND
+  is_countered;
+#<end>
+
+#<up "1.02">
+ALTER TABLE offers ADD COLUMN expires TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX ind_offers_expires ON offers (expires);
+#<end>
+
+#<up "1.03">
+ALTER TABLE offer_events ADD COLUMN automatic BOOLEAN NOT NULL
+  DEFAULT(false);
+
+CREATE TABLE listing_offer_rules (
+  listing_id INT PRIMARY KEY REFERENCES listings(id) ON DELETE CASCADE,
+  accept_at INT,
+  decline_below INT,
+  decline_reply VARCHAR(140)
+);
+#<end>
+
+#<up "1.04">
+ALTER TABLE offers ADD COLUMN holding BOOLEAN NOT NULL DEFAULT(false);
+#<end>
+
+#<up "1.05">
+-- A bundle is an offer on several listings from the same seller, so it
+-- doesn't count against the one offer a buyer can make on each listing
+ALTER TABLE offers ADD COLUMN bundle BOOLEAN NOT NULL DEFAULT(false);
+ALTER TABLE offers DROP CONSTRAINT offers_listing_id_buyer_id_key;
+CREATE UNIQUE INDEX ind_offers_listing_buyer ON offers (listing_id, buyer_id)
+  WHERE NOT bundle;
+
+CREATE TABLE offer_bundle_listings (
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  PRIMARY KEY (offer_id, listing_id)
+);
+
+CREATE INDEX ind_offer_bundle_listings_listing_id ON offer_bundle_listings
+  (listing_id);
+#<end>
+
+#<down "1.05">
+UPDATE listings SET status = 'listed' WHERE status = 'transaction' AND id IN
+  (SELECT b.listing_id FROM offer_bundle_listings b, offers o WHERE
+  b.offer_id = o.id AND o.holding);
+DELETE FROM offers WHERE bundle;
+
+DROP TABLE offer_bundle_listings;
+
+DROP INDEX ind_offers_listing_buyer;
+ALTER TABLE offers ADD CONSTRAINT offers_listing_id_buyer_id_key
+  UNIQUE (listing_id, buyer_id);
+ALTER TABLE offers DROP COLUMN bundle;
+#<end>
+
+#<down "1.04">
+UPDATE listings SET status = 'listed' WHERE status = 'transaction';
+
+ALTER TABLE offers DROP COLUMN holding;
+#<end>
+
+#<down "1.03">
+DROP TABLE listing_offer_rules;
+
+ALTER TABLE offer_events DROP COLUMN automatic;
+#<end>
+
+#<down "1.02">
+ALTER TABLE offers DROP COLUMN expires;
+#<end>
+
+#<down "1.01">
+DROP TABLE offer_events;
+
+-- Closed offers used to be deleted
+DELETE FROM offers WHERE status IN ('declined', 'withdrawn', 'expired');
+UPDATE offers SET status = 'offered' WHERE status = 'countered';
+#<end>
+
 #<down "1.00">
 DROP TABLE offers;
 #<end>
@@ -8,9 +8,10 @@ CREATE TABLE places (
 
 CREATE UNIQUE INDEX ind_places_id ON places (id);
 CREATE UNIQUE INDEX ind_places_email_domain ON places (email_domain);
-#end
+#<end>
 
 #<up "1.01">
+#<depend "place:1.00">
 INSERT INTO places (abbr, name, email_domain)
 VALUES ('RU', 'Rutgers University', 'rutgers.edu'),
 ('CUNY', 'City University of New York', 'cuny.edu')
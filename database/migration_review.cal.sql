@@ -0,0 +1,21 @@
+#<up "1.00">
+#<depend "user:1.00">
+#<depend "offer:1.00">
+CREATE TABLE reviews (
+  id SERIAL PRIMARY KEY,
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  reviewer_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  reviewee_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL,
+  rating INT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+  comment VARCHAR(280),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  UNIQUE (offer_id, reviewer_id)
+);
+
+CREATE INDEX ind_reviews_reviewee_id ON reviews (reviewee_id);
+#<end>
+
+#<down "1.00">
+DROP TABLE reviews;
+#<end>
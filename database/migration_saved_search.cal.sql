@@ -0,0 +1,49 @@
+#<up "1.00">
+#<depend "user:1.00">
+#<depend "place:1.00">
+#<depend "listing:1.00">
+
+CREATE TABLE saved_searches (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  place_id INT NOT NULL REFERENCES places(id) ON DELETE CASCADE,
+  query VARCHAR(255) NOT NULL,
+  search_query TSQUERY,
+  min_price INT,
+  max_price INT,
+  listing_type listing_type,
+  listing_condition listing_condition,
+  email_alerts BOOLEAN NOT NULL DEFAULT(false),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_saved_searches_user_id ON saved_searches (user_id);
+CREATE INDEX ind_saved_searches_place_id ON saved_searches (place_id);
+
+CREATE TABLE saved_search_alerts (
+  saved_search_id INT NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  PRIMARY KEY (saved_search_id, listing_id)
+);
+
+CREATE INDEX ind_saved_search_alerts_listing_id ON saved_search_alerts (listing_id);
+#<end>
+
+#<up "1.01">
+#<depend "saved_search:1.00">
+-- Saved searches compiled by an older analyzer have an analyzer_version of
+-- 0, and are compiled again at startup
+ALTER TABLE saved_searches ADD COLUMN analyzer_version INT NOT NULL DEFAULT(0);
+CREATE INDEX ind_saved_searches_analyzer_version ON saved_searches (analyzer_version);
+#<end>
+
+#<down "1.01">
+DROP INDEX ind_saved_searches_analyzer_version;
+ALTER TABLE saved_searches DROP COLUMN analyzer_version;
+#<end>
+
+#<down "1.00">
+DROP TABLE saved_search_alerts;
+DROP TABLE saved_searches;
+#<end>
@@ -16,12 +16,79 @@ CREATE TABLE search_entries (
 );
 
 CREATE UNIQUE INDEX ind_search_entries_id ON search_entries (id);
-CREATE INDEX ind_search_entries_word ON search_entries (word);
-CREATE INDEX ind_search_entries_count ON search_entries (count);
-CREATE INDEX ind_search_entries_place_id ON search_entries (place_id);
+CREATE INDEX ind_search_entries_word_place_id ON search_entries (word, place_id);
 CREATE INDEX ind_search_entries_listing_type ON search_entries (listing_type);
 #<end>
 
+#<up "1.01">
+#<depend "search:1.00">
+
+CREATE TABLE search_documents (
+  listing_id INT PRIMARY KEY REFERENCES listings(id) ON DELETE CASCADE,
+  document TSVECTOR NOT NULL,
+  listing_name VARCHAR(255) NOT NULL,
+  listing_price INT NOT NULL,
+  listing_image VARCHAR(255) NOT NULL,
+  listing_type listing_type NOT NULL,
+  place_id INT NOT NULL REFERENCES places(id) ON DELETE CASCADE,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  modified TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_search_documents_document ON search_documents USING GIN (document);
+CREATE INDEX ind_search_documents_place_id ON search_documents (place_id);
+
+-- Existing listings are indexed by RebuildStaleSearchIndex at startup, so
+-- that the search config and type names come from the application
+#<end>
+
+#<up "1.02">
+#<depend "search:1.01">
+ALTER TABLE search_documents ADD COLUMN listing_condition listing_condition;
+UPDATE search_documents d SET listing_condition = l.condition
+  FROM listings l WHERE l.id = d.listing_id;
+ALTER TABLE search_documents ALTER COLUMN listing_condition SET NOT NULL;
+
+CREATE INDEX ind_search_documents_listing_price ON search_documents (listing_price);
+#<end>
+
+#<up "1.03">
+#<depend "search:1.02">
+-- Documents are now analyzed by the application before being stored. Rows
+-- from older versions have an analyzer_version of 0, and are indexed again
+-- at startup
+ALTER TABLE search_documents ADD COLUMN analyzer_version INT NOT NULL DEFAULT(0);
+CREATE INDEX ind_search_documents_analyzer_version ON search_documents (analyzer_version);
+#<end>
+
+#<up "1.04">
+#<depend "search:1.03">
+#<depend "listing:1.02">
+-- Search suggestions are refreshed from the rows changed since their last
+-- refresh
+CREATE INDEX ind_search_entries_modified ON search_entries (modified);
+CREATE INDEX ind_listings_modified ON listings (modified);
+#<end>
+
+#<down "1.04">
+DROP INDEX ind_listings_modified;
+DROP INDEX ind_search_entries_modified;
+#<end>
+
+#<down "1.03">
+DROP INDEX ind_search_documents_analyzer_version;
+ALTER TABLE search_documents DROP COLUMN analyzer_version;
+#<end>
+
+#<down "1.02">
+DROP INDEX ind_search_documents_listing_price;
+ALTER TABLE search_documents DROP COLUMN listing_condition;
+#<end>
+
+#<down "1.01">
+DROP TABLE search_documents;
+#<end>
+
 #<down "1.00">
-DROP TABLE search_entry;
+DROP TABLE search_entries;
 #<end>
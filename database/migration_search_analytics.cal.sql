@@ -0,0 +1,31 @@
+#<up "1.00">
+#<depend "place:1.00">
+#<depend "listing:1.00">
+
+CREATE TABLE search_queries (
+  id SERIAL PRIMARY KEY,
+  place_id INT REFERENCES places(id) ON DELETE SET NULL,
+  query VARCHAR(255) NOT NULL,
+  terms VARCHAR(255) NOT NULL,
+  result_count INT NOT NULL,
+  latency_ms INT NOT NULL,
+  corrected BOOLEAN NOT NULL DEFAULT(false),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_search_queries_created ON search_queries (created);
+CREATE INDEX ind_search_queries_terms ON search_queries (terms);
+
+CREATE TABLE search_clicks (
+  search_query_id INT NOT NULL REFERENCES search_queries(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  position INT NOT NULL,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  PRIMARY KEY (search_query_id, listing_id)
+);
+#<end>
+
+#<down "1.00">
+DROP TABLE search_clicks;
+DROP TABLE search_queries;
+#<end>
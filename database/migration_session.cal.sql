@@ -1,4 +1,5 @@
 #<up "1.00">
+#<depend "user:1.00">
 CREATE TABLE sessions (
   user_id int not null references users(id),
   session_id varchar(64) not null unique,
@@ -10,10 +11,9 @@ CREATE TABLE sessions (
 );
 
 CREATE INDEX ind_sessions_user_id ON sessions (user_id);
-CREATE UNIQUE INDEX ind_sessions_session_id ON sessions (session_id);
-CREATE INDEX ind_sessions_session_secret ON sessions (session_secret);
-#end
+CREATE UNIQUE INDEX ind_sessions_session_id_session_secret ON sessions (session_id, session_secret);
+#<end>
 
 #<down "1.00">
 drop table sessions
-#end
+#<end>
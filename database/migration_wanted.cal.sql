@@ -0,0 +1,44 @@
+#<up "1.00">
+#<depend "user:1.00">
+#<depend "place:1.00">
+#<depend "listing:1.00">
+#<depend "offer:1.00">
+
+CREATE TYPE wanted_status AS ENUM
+  ('open', 'closed');
+
+CREATE TABLE wanted_posts (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  place_id INT NOT NULL REFERENCES places(id) ON DELETE CASCADE,
+  title VARCHAR(100) NOT NULL,
+  description TEXT NOT NULL,
+  max_price INT,
+  status wanted_status NOT NULL DEFAULT('open'),
+  document TSVECTOR NOT NULL,
+  analyzer_version INT NOT NULL DEFAULT(0),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  modified TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_wanted_posts_document ON wanted_posts USING GIN (document);
+CREATE INDEX ind_wanted_posts_place_id ON wanted_posts (place_id);
+CREATE INDEX ind_wanted_posts_user_id ON wanted_posts (user_id);
+
+CREATE TABLE wanted_responses (
+  id SERIAL PRIMARY KEY,
+  wanted_id INT NOT NULL REFERENCES wanted_posts(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  UNIQUE (wanted_id, listing_id)
+);
+
+CREATE INDEX ind_wanted_responses_offer_id ON wanted_responses (offer_id);
+#<end>
+
+#<down "1.00">
+DROP TABLE wanted_responses;
+DROP TABLE wanted_posts;
+DROP TYPE wanted_status;
+#<end>
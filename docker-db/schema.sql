@@ -70,13 +70,31 @@ CREATE TABLE listings (
   place_id int not null references places(id) ON DELETE CASCADE,
   user_id int not null references users(id) ON DELETE CASCADE,
   created timestamp with time zone default (now()),
-  modified timestamp with time zone default (now())
+  modified timestamp with time zone default (now()),
+  expires timestamp with time zone,
+  expiry_reminded boolean not null default(false),
+  bumped timestamp with time zone not null default(now()),
+  publish_at timestamp with time zone
 );
 
 CREATE UNIQUE INDEX ind_listings_id ON listings (id);
 CREATE INDEX ind_listings_user_id ON listings (user_id);
 CREATE INDEX ind_listings_place_id_type ON listings (place_id, type);
 CREATE INDEX ind_listings_type ON listings (type);
+CREATE INDEX ind_listings_expires ON listings (expires);
+CREATE INDEX ind_listings_bumped_id ON listings (bumped, id);
+CREATE INDEX ind_listings_publish_at ON listings (publish_at);
+
+CREATE TABLE listing_attributes (
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  name VARCHAR(40) NOT NULL,
+  value VARCHAR(255) NOT NULL,
+  number_value INT,
+  PRIMARY KEY (listing_id, name)
+);
+
+CREATE INDEX ind_listing_attributes_name_value ON listing_attributes (name, lower(value));
+CREATE INDEX ind_listing_attributes_name_number_value ON listing_attributes (name, number_value);
 
 -- Offers Table
 CREATE TABLE offers (
@@ -92,13 +110,76 @@ CREATE TABLE offers (
   buyer_id int not null references users(id) on delete cascade,
   created timestamp with time zone default (now()),
   modified timestamp with time zone default (now()),
-  unique (listing_id, buyer_id)
+  expires timestamp with time zone,
+  holding boolean not null default(false),
+  bundle boolean not null default(false)
 );
 
 CREATE UNIQUE INDEX ind_offers_id ON offers (id);
 CREATE INDEX ind_listing_id ON offers (listing_id);
 CREATE INDEX ind_seller_id ON offers (seller_id);
 CREATE INDEX ind_buyer_id ON offers (buyer_id);
+CREATE INDEX ind_offers_expires ON offers (expires);
+CREATE UNIQUE INDEX ind_offers_listing_buyer ON offers (listing_id, buyer_id)
+  WHERE NOT bundle;
+
+CREATE TABLE offer_bundle_listings (
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  PRIMARY KEY (offer_id, listing_id)
+);
+
+CREATE INDEX ind_offer_bundle_listings_listing_id ON offer_bundle_listings
+  (listing_id);
+
+CREATE TABLE offer_events (
+  id SERIAL PRIMARY KEY,
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  action VARCHAR(20) NOT NULL,
+  actor VARCHAR(20) NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  price INT,
+  comment VARCHAR(140),
+  automatic BOOLEAN NOT NULL DEFAULT(false),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_offer_events_offer_id ON offer_events (offer_id);
+
+CREATE TABLE listing_offer_rules (
+  listing_id INT PRIMARY KEY REFERENCES listings(id) ON DELETE CASCADE,
+  accept_at INT,
+  decline_below INT,
+  decline_reply VARCHAR(140)
+);
+
+-- Meetups Table
+CREATE TABLE meetups (
+  id SERIAL PRIMARY KEY,
+  offer_id INT NOT NULL UNIQUE REFERENCES offers(id) ON DELETE CASCADE,
+  proposer_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  meets_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  location VARCHAR(200) NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  sequence INT NOT NULL DEFAULT(0),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  modified TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+-- Reviews Table
+CREATE TABLE reviews (
+  id SERIAL PRIMARY KEY,
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  reviewer_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  reviewee_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL,
+  rating INT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+  comment VARCHAR(280),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  UNIQUE (offer_id, reviewer_id)
+);
+
+CREATE INDEX ind_reviews_reviewee_id ON reviews (reviewee_id);
 
 -- Messages Table
 CREATE TABLE messages (
@@ -175,3 +256,160 @@ CREATE TABLE search_entries (
 CREATE UNIQUE INDEX ind_search_entries_id ON search_entries (id);
 CREATE INDEX ind_search_entries_word_place_id ON search_entries (word, place_id);
 CREATE INDEX ind_search_entries_listing_type ON search_entries (listing_type);
+
+CREATE TABLE search_documents (
+  listing_id INT PRIMARY KEY REFERENCES listings(id) ON DELETE CASCADE,
+  document TSVECTOR NOT NULL,
+  listing_name VARCHAR(255) NOT NULL,
+  listing_price INT NOT NULL,
+  listing_image VARCHAR(255) NOT NULL,
+  listing_type listing_type NOT NULL,
+  listing_condition listing_condition NOT NULL,
+  analyzer_version INT NOT NULL DEFAULT(0),
+  place_id INT NOT NULL REFERENCES places(id) ON DELETE CASCADE,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  modified TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_search_documents_document ON search_documents USING GIN (document);
+CREATE INDEX ind_search_documents_place_id ON search_documents (place_id);
+CREATE INDEX ind_search_documents_listing_price ON search_documents (listing_price);
+CREATE INDEX ind_search_documents_analyzer_version ON search_documents (analyzer_version);
+CREATE INDEX ind_search_entries_modified ON search_entries (modified);
+CREATE INDEX ind_listings_modified ON listings (modified);
+
+CREATE TABLE saved_searches (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  place_id INT NOT NULL REFERENCES places(id) ON DELETE CASCADE,
+  query VARCHAR(255) NOT NULL,
+  search_query TSQUERY,
+  min_price INT,
+  max_price INT,
+  listing_type listing_type,
+  listing_condition listing_condition,
+  email_alerts BOOLEAN NOT NULL DEFAULT(false),
+  analyzer_version INT NOT NULL DEFAULT(0),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_saved_searches_user_id ON saved_searches (user_id);
+CREATE INDEX ind_saved_searches_place_id ON saved_searches (place_id);
+CREATE INDEX ind_saved_searches_analyzer_version ON saved_searches (analyzer_version);
+
+CREATE TABLE saved_search_alerts (
+  saved_search_id INT NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  PRIMARY KEY (saved_search_id, listing_id)
+);
+
+CREATE INDEX ind_saved_search_alerts_listing_id ON saved_search_alerts (listing_id);
+
+CREATE TABLE search_queries (
+  id SERIAL PRIMARY KEY,
+  place_id INT REFERENCES places(id) ON DELETE SET NULL,
+  query VARCHAR(255) NOT NULL,
+  terms VARCHAR(255) NOT NULL,
+  result_count INT NOT NULL,
+  latency_ms INT NOT NULL,
+  corrected BOOLEAN NOT NULL DEFAULT(false),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_search_queries_created ON search_queries (created);
+CREATE INDEX ind_search_queries_terms ON search_queries (terms);
+
+CREATE TABLE search_clicks (
+  search_query_id INT NOT NULL REFERENCES search_queries(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  position INT NOT NULL,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  PRIMARY KEY (search_query_id, listing_id)
+);
+
+-- Wanted Posts
+CREATE TYPE wanted_status AS ENUM
+  ('open', 'closed');
+
+CREATE TABLE wanted_posts (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  place_id INT NOT NULL REFERENCES places(id) ON DELETE CASCADE,
+  title VARCHAR(100) NOT NULL,
+  description TEXT NOT NULL,
+  max_price INT,
+  status wanted_status NOT NULL DEFAULT('open'),
+  document TSVECTOR NOT NULL,
+  analyzer_version INT NOT NULL DEFAULT(0),
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  modified TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+CREATE INDEX ind_wanted_posts_document ON wanted_posts USING GIN (document);
+CREATE INDEX ind_wanted_posts_place_id ON wanted_posts (place_id);
+CREATE INDEX ind_wanted_posts_user_id ON wanted_posts (user_id);
+
+CREATE TABLE wanted_responses (
+  id SERIAL PRIMARY KEY,
+  wanted_id INT NOT NULL REFERENCES wanted_posts(id) ON DELETE CASCADE,
+  listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+  created TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  UNIQUE (wanted_id, listing_id)
+);
+
+CREATE INDEX ind_wanted_responses_offer_id ON wanted_responses (offer_id);
+
+-- Book Catalog
+CREATE TABLE books (
+  isbn CHAR(13) PRIMARY KEY,
+  title VARCHAR(255) NOT NULL,
+  author VARCHAR(255) NOT NULL,
+  edition VARCHAR(20) NOT NULL DEFAULT(''),
+  imported TIMESTAMP WITH TIME ZONE DEFAULT(now())
+);
+
+-- Schema Migrations
+-- Everything above is recorded as applied, so that `calagora migrate up`
+-- only runs migrations added after this file was last updated
+CREATE TABLE schema_migrations (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  version VARCHAR(20) NOT NULL,
+  applied TIMESTAMP WITH TIME ZONE DEFAULT(now()),
+  UNIQUE (name, version)
+);
+
+INSERT INTO schema_migrations (name, version)
+VALUES ('place', '1.00'),
+  ('user', '1.00'),
+  ('image', '1.00'),
+  ('listing', '1.00'),
+  ('offer', '1.00'),
+  ('message', '1.00'),
+  ('notification', '1.00'),
+  ('password_recovery', '1.00'),
+  ('place', '1.01'),
+  ('saved_search', '1.00'),
+  ('search', '1.00'),
+  ('search', '1.01'),
+  ('search', '1.02'),
+  ('search', '1.03'),
+  ('search_analytics', '1.00'),
+  ('session', '1.00'),
+  ('offer', '1.01'),
+  ('offer', '1.02'),
+  ('offer', '1.03'),
+  ('offer', '1.04'),
+  ('meetup', '1.00'),
+  ('review', '1.00'),
+  ('offer', '1.05'),
+  ('wanted', '1.00'),
+  ('listing', '1.01'),
+  ('book', '1.00'),
+  ('listing', '1.02'),
+  ('listing', '1.03'),
+  ('search', '1.04'),
+  ('saved_search', '1.01'),
+  ('meetup', '1.01');
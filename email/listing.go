@@ -0,0 +1,35 @@
+package email
+
+import (
+	"strconv"
+
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// ListingExpiringEmail is sent to a seller shortly before one of their
+// listings expires, so that they can renew it
+func ListingExpiringEmail(listing models.Listing) {
+	title := "Calagora - Listing Expiring Soon"
+	listingLink := makeLink("https://www.calagora.com/listing/view/"+
+		strconv.Itoa(listing.ID), listing.Name)
+	expiry := "soon"
+	if listing.Expires != nil {
+		expiry = "on " + listing.Expires.Format("Jan 2 at 3:04 PM")
+	}
+	paragraphs := []interface{}{
+		"Your listing " + listingLink + " expires " + expiry + ". Once it " +
+			"expires, buyers won't be able to find it.",
+		"If it's still for sale, you can renew it with one click at:",
+		makeURLLink("https://www.calagora.com/listing/view/" +
+			strconv.Itoa(listing.ID)),
+	}
+	email := &utils.Email{
+		To:            []string{listing.User.EmailAddress},
+		From:          Base.AutomatedEmail,
+		Subject:       title,
+		FormattedText: GenerateHTML(title, paragraphs),
+		PlainText:     GeneratePlain(title, paragraphs),
+	}
+	Base.EmailChannel <- email
+}
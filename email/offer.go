@@ -2,12 +2,14 @@ package email
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/anishmgoyal/calagora/models"
 	"github.com/anishmgoyal/calagora/utils"
 )
 
-// NewOfferEmail is sent when a user gets a new offer on a listing
+// NewOfferEmail is sent when a user gets a new offer on a listing, or on a
+// bundle of their listings
 func NewOfferEmail(offer models.Offer) {
 	title := "Calagora - New Offer"
 	paragraphs := []interface{}{
@@ -15,14 +17,27 @@ func NewOfferEmail(offer models.Offer) {
 			offer.PriceClient + " for your listing, " + makeLink(
 			"https://www.calagora.com/listing/view/"+
 				strconv.Itoa(offer.Listing.ID), offer.Listing.Name),
-		"You can accept, reject, or counter this offer by logging in and going " +
+	}
+	if len(offer.Bundle) > 0 {
+		// Only one link is found in each paragraph, so each listing in the
+		// bundle gets its own
+		paragraphs[0] = offer.Buyer.DisplayName + " offered you $" +
+			offer.PriceClient + " for a bundle of " +
+			strconv.Itoa(len(offer.Bundle)) + " of your listings:"
+		for _, listing := range offer.Bundle {
+			paragraphs = append(paragraphs, makeLink(
+				"https://www.calagora.com/listing/view/"+strconv.Itoa(listing.ID),
+				listing.Name))
+		}
+	}
+	paragraphs = append(paragraphs,
+		"You can accept, reject, or counter this offer by logging in and going "+
 			"to the page for your listing, which is at:",
-		makeURLLink("https://www.calagora.com/listing/view/" +
+		makeURLLink("https://www.calagora.com/listing/view/"+
 			strconv.Itoa(offer.Listing.ID)),
-		"Or you can view this offer, as well as offers for other listings, from " +
+		"Or you can view this offer, as well as offers for other listings, from "+
 			"the seller tab at:",
-		makeURLLink("https://www.calagora.com/selling/"),
-	}
+		makeURLLink("https://www.calagora.com/selling/"))
 	email := &utils.Email{
 		To:            []string{offer.Seller.EmailAddress},
 		From:          Base.AutomatedEmail,
@@ -43,8 +58,7 @@ func NewCounterEmail(offer models.Offer) {
 				strconv.Itoa(offer.Listing.ID), offer.Listing.Name) + " with $" +
 			offer.CounterClient,
 		"You can edit or revoke this offer from the buyer tab directly at:",
-		makeURLLink("https://www.calagora.com/offer/buyer/" +
-			strconv.Itoa(offer.Listing.ID)),
+		makeURLLink(buyerOfferURL(offer)),
 		"Or, from the listing's page at:",
 		makeURLLink("https://www.calagora.com/listing/view/" +
 			strconv.Itoa(offer.Listing.ID)),
@@ -62,8 +76,10 @@ func NewCounterEmail(offer models.Offer) {
 	Base.EmailChannel <- email
 }
 
-// OfferAcceptedEmail is sent when a user's offer is accepted
-func OfferAcceptedEmail(offer models.Offer) {
+// OfferAcceptedEmail is sent when a user's offer is accepted. If the offer
+// already has a meetup planned, it is attached so that it can be added to
+// a calendar
+func OfferAcceptedEmail(offer models.Offer, meetup *models.Meetup) {
 	title := "Calagora - Offer Accepted"
 	paragraphs := []interface{}{
 		offer.Seller.DisplayName + " has accepted your offer of $" +
@@ -76,7 +92,139 @@ func OfferAcceptedEmail(offer models.Offer) {
 			strconv.Itoa(offer.ID),
 	}
 	email := &utils.Email{
-		To:            []string{offer.Buyer.EmailAddress},
+		To:      []string{offer.Buyer.EmailAddress},
+		From:    Base.AutomatedEmail,
+		Subject: title,
+	}
+	if meetup != nil && meetup.Status == models.MeetupAccepted &&
+		meetup.Time.After(time.Now()) {
+
+		paragraphs = append(paragraphs, "You're meeting at "+meetup.Location+
+			" on "+meetup.Time.Format(meetupTimeFormat)+". The meetup is "+
+			"attached, so you can add it to your calendar.")
+		email.Attachments = append(email.Attachments,
+			meetupAttachment(offer, meetup))
+	} else {
+		paragraphs = append(paragraphs,
+			"You can also plan a time and place to meet at:",
+			makeURLLink(meetupURL(offer.ID)))
+	}
+	email.FormattedText = GenerateHTML(title, paragraphs)
+	email.PlainText = GeneratePlain(title, paragraphs)
+	Base.EmailChannel <- email
+}
+
+// MeetupAcceptedEmail is sent to both the buyer and the seller of an offer
+// when a meetup is agreed to, with the meetup attached so that it can be
+// added to a calendar
+func MeetupAcceptedEmail(offer models.Offer, meetup *models.Meetup,
+	recipient models.User) {
+
+	title := "Calagora - Meetup Planned"
+	paragraphs := []interface{}{
+		"The meetup for " + makeLink("https://www.calagora.com/listing/view/"+
+			strconv.Itoa(offer.Listing.ID), offer.Listing.Name) + " is planned " +
+			"for " + meetup.Time.Format(meetupTimeFormat) + " at " +
+			meetup.Location + ". It is attached, so you can add it to your " +
+			"calendar.",
+		"If plans change, you can reschedule it at:",
+		makeURLLink(meetupURL(offer.ID)),
+	}
+	email := &utils.Email{
+		To:            []string{recipient.EmailAddress},
+		From:          Base.AutomatedEmail,
+		Subject:       title,
+		FormattedText: GenerateHTML(title, paragraphs),
+		PlainText:     GeneratePlain(title, paragraphs),
+		Attachments:   []utils.EmailAttachment{meetupAttachment(offer, meetup)},
+	}
+	Base.EmailChannel <- email
+}
+
+// meetupTimeFormat is the format meetup times are written in, in emails
+const meetupTimeFormat = "Monday, Jan 2 at 3:04 PM MST"
+
+// meetupURL gets the page for planning the meetup under an offer
+func meetupURL(offerID int) string {
+	return "https://www.calagora.com/meetup/" + strconv.Itoa(offerID)
+}
+
+// meetupAttachment gets a meetup as a calendar file to attach to an email
+func meetupAttachment(offer models.Offer,
+	meetup *models.Meetup) utils.EmailAttachment {
+
+	event := meetup.CalendarEvent(offer.Listing.Name, meetupURL(offer.ID))
+	return utils.EmailAttachment{
+		Filename:    "meetup.ics",
+		ContentType: "text/calendar; charset=UTF-8; method=PUBLISH",
+		Content:     event.ICS(),
+	}
+}
+
+// OfferExpiredEmail is sent to both the buyer and the seller of an offer
+// when it expires, or when an accepted deal lapses without being finalized
+func OfferExpiredEmail(offer models.ExpiredOffer, recipient models.User) {
+	title := "Calagora - Offer Expired"
+	listingLink := makeLink("https://www.calagora.com/listing/view/"+
+		strconv.Itoa(offer.Listing.ID), offer.Listing.Name)
+	paragraphs := []interface{}{
+		"The offer of $" + offer.PriceClient + " from " +
+			offer.Buyer.DisplayName + " for " + listingLink + " has expired.",
+	}
+	if offer.Lapsed {
+		title = "Calagora - Deal Lapsed"
+		paragraphs[0] = "The deal between " + offer.Buyer.DisplayName +
+			" and " + offer.Seller.DisplayName + " for " + listingLink +
+			" lapsed, because it wasn't finalized in time."
+	}
+	if recipient.ID == offer.Seller.ID {
+		paragraphs = append(paragraphs,
+			"Your listing is still open to other offers. You can view it at:",
+			makeURLLink("https://www.calagora.com/listing/view/"+
+				strconv.Itoa(offer.Listing.ID)))
+	} else {
+		paragraphs = append(paragraphs,
+			"If you are still interested, you can make a new offer at:",
+			makeURLLink(buyerOfferURL(offer.Offer)))
+	}
+	email := &utils.Email{
+		To:            []string{recipient.EmailAddress},
+		From:          Base.AutomatedEmail,
+		Subject:       title,
+		FormattedText: GenerateHTML(title, paragraphs),
+		PlainText:     GeneratePlain(title, paragraphs),
+	}
+	Base.EmailChannel <- email
+}
+
+// buyerOfferURL gets the page where the buyer under an offer can change it
+func buyerOfferURL(offer models.Offer) string {
+	if offer.IsBundle {
+		return "https://www.calagora.com/offer/bundle/" +
+			strconv.Itoa(offer.Listing.ID) + "/" + strconv.Itoa(offer.ID)
+	}
+	return "https://www.calagora.com/offer/buyer/" +
+		strconv.Itoa(offer.Listing.ID)
+}
+
+// WantedResponseEmail is sent when a seller offers one of their listings
+// for a user's wanted post, which makes an offer on it for the user
+func WantedResponseEmail(post models.WantedPost, offer models.Offer) {
+	title := "Calagora - Response to Your Wanted Post"
+	paragraphs := []interface{}{
+		offer.Seller.DisplayName + " responded to your wanted post, \"" +
+			post.Title + "\", with their listing " + makeLink(
+			"https://www.calagora.com/listing/view/"+
+				strconv.Itoa(offer.Listing.ID), offer.Listing.Name),
+		"An offer of $" + offer.PriceClient + " was made on it for you. You " +
+			"can change or withdraw this offer from the buyer tab directly at:",
+		makeURLLink(buyerOfferURL(offer)),
+		"You can see every response to your post at:",
+		makeURLLink("https://www.calagora.com/wanted/view/" +
+			strconv.Itoa(post.ID)),
+	}
+	email := &utils.Email{
+		To:            []string{post.User.EmailAddress},
 		From:          Base.AutomatedEmail,
 		Subject:       title,
 		FormattedText: GenerateHTML(title, paragraphs),
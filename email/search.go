@@ -0,0 +1,38 @@
+package email
+
+import (
+	"strconv"
+
+	"github.com/anishmgoyal/calagora/models"
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// SavedSearchMatchEmail is sent when a listing matching one of a user's
+// saved searches is published
+func SavedSearchMatchEmail(search models.SavedSearch, listing models.Listing) {
+	title := "Calagora - New Listing For Your Search"
+	description := "one of your saved searches"
+	if len(search.Query) > 0 {
+		description = "your saved search, \"" + search.Query + "\""
+	}
+	paragraphs := []interface{}{
+		"A new listing matching " + description + " was just posted: " +
+			makeLink("https://www.calagora.com/listing/view/"+
+				strconv.Itoa(listing.ID), listing.Name) + ", for $" +
+			listing.PriceClient,
+		"You can view this listing at:",
+		makeURLLink("https://www.calagora.com/listing/view/" +
+			strconv.Itoa(listing.ID)),
+		"You can stop getting these emails by removing this search from your " +
+			"saved searches at:",
+		makeURLLink("https://www.calagora.com/search/saved/"),
+	}
+	email := &utils.Email{
+		To:            []string{search.User.EmailAddress},
+		From:          Base.AutomatedEmail,
+		Subject:       title,
+		FormattedText: GenerateHTML(title, paragraphs),
+		PlainText:     GeneratePlain(title, paragraphs),
+	}
+	Base.EmailChannel <- email
+}
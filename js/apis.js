@@ -96,4 +96,116 @@
     });
   };
 
+  window.saveSearch = function(params, successCallback)
+  {
+    var successFn = (successCallback)? successCallback : function(){};
+    var errorFn = function(message)
+    {
+      new Dialog({
+        title: "Failed to Save Search",
+        content: (typeof message === "string")? message : "We weren't able "+
+          "to save this search. Please try refreshing the page, or try again "+
+          "later.",
+        buttons: [{text: "OK", onclick: function(){}}]
+      });
+    };
+
+    params.csrfToken = window.csrfToken;
+    $.ajax({
+      url: "/webapi/search/save/",
+      cache: false,
+      data: params,
+      dataType: "json",
+      success: function(data)
+      {
+        if(data.successful)
+        {
+          successFn(data.saved_search);
+        }
+        else if(data.error_details)
+        {
+          errorFn(data.error_details.global || data.error_details.query);
+        }
+        else
+        {
+          errorFn();
+        }
+      },
+      error: errorFn
+    });
+  };
+
+  window.deleteSavedSearch = function(id, successCallback)
+  {
+    var successFn = (successCallback)? successCallback : function(){};
+    var errorFn = function()
+    {
+      new Dialog({
+        title: "Failed to Remove Search",
+        content: "We weren't able to remove that search. Please try "+
+          "refreshing the page, or try again later.",
+        buttons: [{text: "OK", onclick: function(){}}]
+      });
+    };
+
+    var doDelete = function()
+    {
+      $.ajax({
+        url: "/webapi/search/saved/delete/" + id,
+        cache: false,
+        data: {
+          csrfToken: window.csrfToken
+        },
+        dataType: "json",
+        success: function(data)
+        {
+          if(data.successful)
+          {
+            successFn();
+          }
+          else
+          {
+            errorFn();
+          }
+        },
+        error: errorFn
+      });
+    };
+
+    new Dialog({
+      title: "Remove Saved Search",
+      content: "Are you sure you would like to stop getting alerts for this "+
+        "search?",
+      buttons: [
+        {text: "Yes", onclick: doDelete},
+        {text: "No", onclick: function(){}, isAlt: true}
+      ]
+    });
+  };
+
+  // reputationText describes the reputation of a user loaded by the web
+  // api, as it is shown next to their name
+  window.reputationText = function(reputation)
+  {
+    if(!reputation || reputation.review_count == 0)
+    {
+      return "No reviews yet";
+    }
+    return "\u2605 " + reputation.rating_client + " (" +
+      reputation.review_count + (reputation.review_count == 1?
+        " review)" : " reviews)");
+  };
+
+  // bundleText lists the names of the listings a bundle offer loaded by the
+  // web api covers
+  window.bundleText = function(offer)
+  {
+    var names = [];
+    for(var i = 0; offer.bundle && i < offer.bundle.length; i++)
+    {
+      names.push(offer.bundle[i].name);
+    }
+    return names.join(", ");
+  };
+
 })( jQuery );
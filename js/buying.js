@@ -3,13 +3,9 @@
 
   window.doOfferDelete = function(id)
   {
-    window.deleteOffer(id, "Revoke", function()
+    window.deleteOffer(id, "Withdraw", function()
     {
-      var elem = document.getElementById("offer-stub-" + id);
-      if(elem)
-      {
-        elem.parentNode.removeChild(elem);
-      }
+      window.location.reload();
     });
   };
 
@@ -1,7 +1,7 @@
 (function()
 {
 
-  window.lightPager = function(ndTarget, query, min, currentPage, max)
+  window.lightPager = function(ndTarget, pageURL, min, currentPage, max)
   {
     var numForStage = [3, 4, 2];
     var startForStage = [min,
@@ -18,8 +18,7 @@
         ndSkipFirst.innerHTML = "&#10094;&#10094;";
         ndSkipFirst.onclick = function()
         {
-          window.location.href = "/search/?q="+
-            encodeURIComponent(query)+"&page="+
+          window.location.href = pageURL+
             (min);
         }
         ndTarget.appendChild(ndSkipFirst);
@@ -31,8 +30,7 @@
         ndBackOne.innerHTML = "&#10094;";
         ndBackOne.onclick = function()
         {
-          window.location.href = "/search/?q="+
-            encodeURIComponent(query)+"&page="+
+          window.location.href = pageURL+
             (currentPage-1);
         };
         ndTarget.appendChild(ndBackOne);
@@ -51,8 +49,7 @@
         ndForwardOne.innerHTML = "&#10095;";
         ndForwardOne.onclick = function()
         {
-          window.location.href="/search/?q="+
-            encodeURIComponent(query)+"&page="+
+          window.location.href=pageURL+
             (currentPage+1);
         };
         ndTarget.appendChild(ndForwardOne);
@@ -64,8 +61,7 @@
         ndSkipLast.innerHTML = "&#10095;&#10095;";
         ndSkipLast.onclick = function()
         {
-          window.location.href="/search/?q="+
-            encodeURIComponent(query)+"&page="+
+          window.location.href=pageURL+
             (max);
         };
         ndTarget.appendChild(ndSkipLast);
@@ -79,8 +75,7 @@
         ndBackOne.innerHTML = "&#10094;";
         ndBackOne.onclick = function()
         {
-          window.location.href = "/search/?q="+
-            encodeURIComponent(query)+"&page="+
+          window.location.href = pageURL+
             (currentPage-1);
         };
         ndTarget.appendChild(ndBackOne);
@@ -117,8 +112,7 @@
             ndPage.appendChild(document.createTextNode(current));
             ndPage.onclick = function(current)
             {
-              window.location.href = "/search/?q="+
-                encodeURIComponent(query)+"&page="+
+              window.location.href = pageURL+
                 (current);
             }.bind(window, current);
             ndTarget.appendChild(ndPage);
@@ -135,8 +129,7 @@
         ndForwardOne.innerHTML = "&#10095;";
         ndForwardOne.onclick = function()
         {
-          window.location.href = "/search/?q="+
-            encodeURIComponent(query)+"&page="+
+          window.location.href = pageURL+
             (currentPage+1);
         };
         ndTarget.appendChild(ndForwardOne);
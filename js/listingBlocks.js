@@ -15,7 +15,16 @@
     var listingTarget = document.getElementById("listing-list");
     var listingProgress = document.getElementById("listing-progress");
     var moreButton = document.getElementById("listing-more");
+    var sortSelect = document.getElementById("listing-sort");
     var loadedPageCount = 0;
+    var nextCursor = "";
+
+    sortSelect.onchange = function()
+    {
+      window.location.href = window.location.pathname + "?sort=" +
+        encodeURIComponent(sortSelect.value);
+    };
+
     var pager = new Pager({
       addPagerFunctionality: true,
       button: moreButton,
@@ -31,9 +40,15 @@
           data: {
             pageNum: page,
             pageSize: pageSize,
-            type: window.section
+            type: window.section,
+            sort: sortSelect.value,
+            cursor: nextCursor
+          },
+          success: function(data, status, xhr)
+          {
+            nextCursor = xhr.getResponseHeader("X-Next-Cursor") || "";
+            success(data);
           },
-          success: success,
           error: error
         });
       },
@@ -98,38 +113,47 @@
 
   if (window.currentUser && !window.sectionMode)
   {
-    var myListingTarget = document.getElementById("my-listing-list");
-    var myListingProgress = document.getElementById("my-listing-progress");
+    loadUserListings(document.getElementById("my-listing-list"),
+      document.getElementById("my-listing-progress"), {
+        pageSize: 50,
+        status: "listed",
+        drafts: "none"
+      }, "your most recently posted listings");
+    loadUserListings(document.getElementById("my-draft-list"),
+      document.getElementById("my-draft-progress"), {
+        pageSize: 50,
+        drafts: "only"
+      }, "your drafts");
+  }
 
+  function loadUserListings(target, progress, data, listOf)
+  {
     $.ajax({
       url: "/webapi/listings/user/" + currentUser.id,
       cache: false,
       dataType: "json",
-      data: {
-        pageSize: 50,
-        status: "listed"
-      },
+      data: data,
       success: function(data)
       {
         if(data && data.length > 0)
         {
           for(var i = 0; i < data.length; i++)
           {
-            addListing(data[i], myListingTarget);
+            addListing(data[i], target);
           }
         }
         else
         {
-          addNoneFoundMessage(myListingTarget);
+          addNoneFoundMessage(target);
         }
       },
       error: function()
       {
-        addErrorMessage(myListingTarget, "your most recently posted listings");
+        addErrorMessage(target, listOf);
       },
       complete: function()
       {
-        myListingProgress.parentNode.removeChild(myListingProgress);
+        progress.parentNode.removeChild(progress);
       }
     });
   }
@@ -153,12 +177,13 @@
     ndPlace.className = "listing-place";
     ndPlace.appendChild(document.createTextNode(listing.user.place));
 
-    if(!listing.published)
+    var ndSchedule = null;
+    if(listing.publish_at)
     {
-      var ndAsterisk = document.createElement("span");
-      ndAsterisk.style.fontWeight = "normal";
-      ndAsterisk.innerHTML = "*";
-      ndName.appendChild(ndAsterisk);
+      ndSchedule = document.createElement("div");
+      ndSchedule.className = "small";
+      ndSchedule.appendChild(document.createTextNode("Publishes " +
+        new Date(listing.publish_at).toLocaleString()));
     }
 
     var ndPrice = document.createElement("div");
@@ -173,6 +198,10 @@
       ndListing.appendChild(ndPlace);
     }
     ndListing.appendChild(ndPrice);
+    if(ndSchedule)
+    {
+      ndListing.appendChild(ndSchedule);
+    }
 
     ndListing.onclick = function()
     {
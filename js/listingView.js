@@ -123,14 +123,30 @@
           var ndTable = document.createElement("table");
           ndTable.className = "il";
 
-          ndTable.appendChild(createTableRow("Buyer", offer.buyer.display_name));
+          ndTable.appendChild(createTableRow("Buyer", offer.buyer.display_name +
+            " (" + reputationText(offer.buyer.reputation) + ")"));
           ndTable.appendChild(createTableRow("Amount", "$" + offer.price));
+          if(offer.is_bundle)
+          {
+            ndTable.appendChild(createTableRow("Bundle", bundleText(offer)));
+          }
           if(offer.buyer_comment.length > 0)
           {
             ndTable.appendChild(createTableRow("Buyer Comments", offer.buyer_comment));
           }
-          ndTable.appendChild(createTableRow("Accepted?", (offer.status == "accepted")? "Yes" : "No"));
-          if(offer.is_countered)
+          ndTable.appendChild(createTableRow("Status", offerStatusText(offer.status)));
+          if(offer.expires && (offer.status == "offered" ||
+            offer.status == "countered" || offer.status == "accepted"))
+          {
+            ndTable.appendChild(createTableRow("Expires",
+              new Date(offer.expires).toLocaleString()));
+          }
+          if(offer.holding)
+          {
+            ndTable.appendChild(createTableRow("Listing",
+              "On hold for this buyer"));
+          }
+          if(offer.status == "countered")
           {
             ndTable.appendChild(createTableRow("Counter", "$" + offer.counter));
             if(offer.seller_comment.length > 0)
@@ -140,23 +156,27 @@
           }
 
           ndOffer.appendChild(ndTable);
+          if(offer.history)
+          {
+            ndOffer.appendChild(createHistoryTable(offer.history));
+          }
 
-          if(offer.status != "accepted")
+          if(offer.status == "offered" || offer.status == "countered")
           {
             var ndAccept = document.createElement("button");
             ndAccept.id = "offer-" + offer.id + "-accept";
             ndAccept.appendChild(document.createTextNode("Accept Offer"));
             ndAccept.onclick = acceptOffer.bind(window, offer.id);
             ndOffer.appendChild(ndAccept);
-          }
 
-          var counterText = ((offer.is_countered)? "Edit " : "")+
-            "Counter Offer";
-          var ndCounter = document.createElement("button");
-          ndCounter.id = "offer-" + offer.id + "-counter";
-          ndCounter.appendChild(document.createTextNode(counterText));
-          ndCounter.onclick = counterOffer.bind(window, offer.id);
-          ndOffer.appendChild(ndCounter);
+            var counterText = ((offer.status == "countered")? "Edit " : "")+
+              "Counter Offer";
+            var ndCounter = document.createElement("button");
+            ndCounter.id = "offer-" + offer.id + "-counter";
+            ndCounter.appendChild(document.createTextNode(counterText));
+            ndCounter.onclick = counterOffer.bind(window, offer.id);
+            ndOffer.appendChild(ndCounter);
+          }
 
           if(offer.status == "accepted")
           {
@@ -169,11 +189,15 @@
             ndOffer.appendChild(ndViewConversation);
           }
 
-          var ndDelete = document.createElement("button");
-          ndDelete.id = "offer-" + offer.id + "-delete";
-          ndDelete.appendChild(document.createTextNode("Reject Offer"));
-          ndDelete.onclick = deleteOffer.bind(window, offer.id);
-          ndOffer.appendChild(ndDelete);
+          if(offer.status == "offered" || offer.status == "countered" ||
+            offer.status == "accepted")
+          {
+            var ndDelete = document.createElement("button");
+            ndDelete.id = "offer-" + offer.id + "-delete";
+            ndDelete.appendChild(document.createTextNode("Decline Offer"));
+            ndDelete.onclick = deleteOffer.bind(window, offer.id);
+            ndOffer.appendChild(ndDelete);
+          }
 
           target.appendChild(ndOffer);
         }
@@ -194,6 +218,28 @@
     pager.nextPage();
   };
 
+  function offerStatusText(status)
+  {
+    return status.charAt(0).toUpperCase() + status.slice(1);
+  }
+
+  function createHistoryTable(history)
+  {
+    var ndTable = document.createElement("table");
+    ndTable.className = "il";
+    for(var i = 0; i < history.length; i++)
+    {
+      var event = history[i];
+      var text = event.description;
+      if(event.comment)
+      {
+        text += ": \u201c" + event.comment + "\u201d";
+      }
+      ndTable.appendChild(createTableRow(offerStatusText(event.actor), text));
+    }
+    return ndTable;
+  }
+
   function createTableRow(headerText, valueText)
   {
     var ndRow = document.createElement("tr");
@@ -248,13 +294,17 @@
               url: "/webapi/offer/accept/" + id,
               cache: false,
               dataType: "json",
-              data: {csrfToken: window.csrfToken},
+              data: {
+                csrfToken: window.csrfToken,
+                hold_days: $("#offer-hold-days").val() || 0
+              },
               success: successFn,
               error: errorFn
             });
 
             var ndOffer = document.getElementById("offer-" + id);
             var ndAccept = document.getElementById("offer-" + id + "-accept");
+            var ndCounter = document.getElementById("offer-" + id + "-counter");
             var ndDelete = document.getElementById("offer-" + id + "-delete");
 
             var ndViewConversation = document.createElement("button");
@@ -264,6 +314,7 @@
             ndViewConversation.onclick = viewConversation.bind(window, id);
 
             ndOffer.removeChild(ndAccept);
+            ndOffer.removeChild(ndCounter);
             ndOffer.insertBefore(ndViewConversation, ndDelete);
           }},
         {text: "No", onclick: function(){}, isAlt: true}
@@ -287,7 +338,7 @@
     {
       new Dialog({
         title: "Error Occurred",
-        content: "An error occurred while rejecting that offer. Please "+
+        content: "An error occurred while declining that offer. Please "+
           "refresh the page or try again later. If this issue persists, "+
           "please contact support@calagora.com.",
         buttons: [{text: "OK", onclick: function(){}}]
@@ -320,7 +371,7 @@
 
     new Dialog({
       title: "Are You Sure?",
-      content: "Are you sure you would like to reject this offer? This "+
+      content: "Are you sure you would like to decline this offer? This "+
         "action is irreversible.",
       buttons: [
         {text: "Yes", onclick: doDelete},
@@ -223,6 +223,7 @@ if(!window.jQuery)
       var ndQ = document.getElementById("q");
       if(ndQ)
       {
+        window.attachSearchSuggestions(ndQ);
         ndQ.click();
         ndQ.focus();
         ndQ.ontouchstart = function() { ndQ.focus(); };
@@ -231,6 +232,58 @@ if(!window.jQuery)
     }, 1);
   };
 
+  /**
+   * Shows completions from the search suggestion api under a search input
+   * as the user types
+   */
+  window.attachSearchSuggestions = function(ndInput)
+  {
+    var ndList = document.createElement("datalist");
+    ndList.id = ndInput.id + "-suggestions";
+    ndInput.parentNode.appendChild(ndList);
+    ndInput.setAttribute("list", ndList.id);
+    ndInput.setAttribute("autocomplete", "off");
+
+    var timeout = null;
+    var request = null;
+    $(ndInput).on("input", function()
+    {
+      clearTimeout(timeout);
+      timeout = setTimeout(function()
+      {
+        if(request)
+        {
+          request.abort();
+        }
+        request = $.ajax({
+          url: "/webapi/search/suggest/",
+          cache: false,
+          dataType: "json",
+          data: {
+            q: ndInput.value
+          },
+          success: function(data)
+          {
+            if(!data.successful)
+            {
+              return;
+            }
+            while(ndList.firstChild)
+            {
+              ndList.removeChild(ndList.firstChild);
+            }
+            for(var i = 0; i < data.suggestions.length; i++)
+            {
+              var ndOption = document.createElement("option");
+              ndOption.value = data.suggestions[i];
+              ndList.appendChild(ndOption);
+            }
+          }
+        });
+      }, 100);
+    });
+  };
+
   window.openProfileWindow = function()
   {
     if(window.currentUser)
@@ -516,7 +516,18 @@
   {
     if (activeConversation)
     {
-      window.location = "/offer/buyer/" + activeConversation.listing.id;
+      window.location = activeConversation.is_bundle?
+        "/offer/bundle/" + activeConversation.listing.id + "/" +
+          activeConversation.id :
+        "/offer/buyer/" + activeConversation.listing.id;
+    }
+  };
+
+  window.planMeetup = function()
+  {
+    if (activeConversation)
+    {
+      window.location = "/meetup/" + activeConversation.id;
     }
   };
 
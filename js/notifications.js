@@ -150,16 +150,119 @@
         link: "/listing/view/" + value.listing.id
       };
     },
+    NOTIF_OFFER_EXPIRED: function(value)
+    {
+      return {
+        title: "Offer Expired",
+        content: "The offer of $" + value.price + " for " +
+          value.listing.name + " expired.",
+        link: "/listing/view/" + value.listing.id
+      };
+    },
+    NOTIF_DEAL_LAPSED: function(value)
+    {
+      return {
+        title: "Deal Lapsed",
+        content: "The accepted offer of $" + value.price + " for " +
+          value.listing.name + " lapsed because it wasn't finalized in time.",
+        link: "/listing/view/" + value.listing.id
+      };
+    },
+    NOTIF_LISTING_SOLD: function(value)
+    {
+      return {
+        title: "Listing Sold",
+        content: value.listing.name + " was sold to someone else, so your "+
+          "offer of $" + value.price + " was closed.",
+        link: "/listing/view/" + value.listing.id
+      };
+    },
     OFFER_ACCEPTED: function(value)
     {
       return {
         title: "Offer Accepted",
         content: value.seller.display_name + " accepted your offer of $"+
-          value.price + " for " + value.listing.name + ". You can now chat "+
-          "with them by clicking here!",
+          value.price + " for " + value.listing.name + "." +
+          (value.holding? " They are holding it for you until " +
+            new Date(value.expires).toLocaleString() + "." : "") +
+          " You can now chat with them by clicking here!",
         link: "/message/client/#conversation" + value.id
       };
     },
+    NOTIF_MEETUP_PROPOSED: function(value)
+    {
+      return {
+        title: "Meetup Proposed",
+        content: value.proposer.display_name + " proposed meeting at "+
+          value.location + " on " + new Date(value.time).toLocaleString() +
+          " for " + value.listing.name + ".",
+        link: "/meetup/" + value.offer_id
+      };
+    },
+    NOTIF_MEETUP_ACCEPTED: function(value)
+    {
+      return {
+        title: "Meetup Accepted",
+        content: "Your meetup at " + value.location + " on "+
+          new Date(value.time).toLocaleString() + " for " +
+          value.listing.name + " was accepted.",
+        link: "/meetup/" + value.offer_id
+      };
+    },
+    NOTIF_MEETUP_DECLINED: function(value)
+    {
+      return {
+        title: "Meetup Declined",
+        content: "Your meetup at " + value.location + " for " +
+          value.listing.name + " was declined. You can propose another time.",
+        link: "/meetup/" + value.offer_id
+      };
+    },
+    NOTIF_NEW_REVIEW: function(value)
+    {
+      return {
+        title: "New Review",
+        content: value.reviewer.display_name + " gave you " + value.rating +
+          " out of 5 for " + value.listing.name + ".",
+        link: "/user/profile/"
+      };
+    },
+    NOTIF_WANTED_RESPONSE: function(value)
+    {
+      return {
+        title: "Wanted Post Response",
+        content: value.seller.display_name + " offered " +
+          value.listing.name + " for $" + value.price + " in response to "+
+          "your wanted post.",
+        link: "/offer/buyer/" + value.listing.id
+      };
+    },
+    NOTIF_LISTING_PUBLISHED: function(value)
+    {
+      return {
+        title: "Listing Published",
+        content: value.name + " was published as you scheduled.",
+        link: "/listing/view/" + value.id
+      };
+    },
+    NOTIF_LISTING_EXPIRING: function(value)
+    {
+      return {
+        title: "Listing Expiring",
+        content: value.name + " expires soon. Renew it to keep showing it "+
+          "to buyers.",
+        link: "/listing/view/" + value.id
+      };
+    },
+    SAVED_SEARCH_MATCH: function(value)
+    {
+      return {
+        title: "New Listing",
+        content: value.listing.name + " ($" + value.listing.price + ") "+
+          "matches one of your saved searches.",
+        link: "/listing/view/" + value.listing.id
+      };
+    },
     NEW_MESSAGE: function(value)
     {
       if(value.sender.id != window.currentUser.id)
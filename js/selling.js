@@ -57,6 +57,11 @@
         for(var i = 0; i < offers.length; i++)
         {
           var offer = offers[i];
+          if(offer.status == "declined" || offer.status == "withdrawn" ||
+            offer.status == "expired")
+          {
+            continue;
+          }
           var ndOffer = document.createElement("div");
           ndOffer.id = "offer-" + offer.id;
           ndOffer.className = "feedItem";
@@ -69,20 +74,30 @@
           ndBuyerLink.appendChild(document.createTextNode(
             offer.buyer.display_name));
           ndText.appendChild(ndBuyerLink);
+          ndText.appendChild(document.createTextNode(" (" +
+            reputationText(offer.buyer.reputation) + ")"));
 
           var text = " offered you $"+
             offer.price + " for ";
           ndText.appendChild(document.createTextNode(text));
 
-          var ndListingLink = document.createElement("a");
-          ndListingLink.href = "/listing/view/" + offer.listing.id;
-          ndListingLink.appendChild(document.createTextNode(
-            offer.listing.name));
-          ndText.appendChild(ndListingLink);
+          if(offer.is_bundle)
+          {
+            ndText.appendChild(document.createTextNode("a bundle of " +
+              bundleText(offer)));
+          }
+          else
+          {
+            var ndListingLink = document.createElement("a");
+            ndListingLink.href = "/listing/view/" + offer.listing.id;
+            ndListingLink.appendChild(document.createTextNode(
+              offer.listing.name));
+            ndText.appendChild(ndListingLink);
+          }
 
           ndText.appendChild(document.createTextNode("."));
 
-          if(offer.is_countered)
+          if(offer.status == "countered")
           {
             var counterText = " Your counter offer is $" +
               offer.counter + ".";
@@ -91,7 +106,9 @@
 
           if(offer.status == "accepted")
           {
-            var acceptedText = " (You have accepted this offer).";
+            var acceptedText = offer.holding?
+              " (You have accepted this offer, and are holding the listing "+
+              "for this buyer)." : " (You have accepted this offer).";
             ndText.appendChild(document.createTextNode(acceptedText));
           }
 
@@ -110,18 +127,18 @@
 
             var buttons = [];
 
-            var counterText = (offer.is_countered)?
-              "Edit Counter Offer" : "Counter Offer";
-            buttons.push({
-              text: counterText,
-              onclick: function()
-              {
-                window.location.href = "/offer/seller/" + offer.id;
-              }
-            });
-
-            if (offer.status == "offered")
+            if (offer.status == "offered" || offer.status == "countered")
             {
+              var counterText = (offer.status == "countered")?
+                "Edit Counter Offer" : "Counter Offer";
+              buttons.push({
+                text: counterText,
+                onclick: function()
+                {
+                  window.location.href = "/offer/seller/" + offer.id;
+                }
+              });
+
               buttons.unshift({
                 text: "Accept",
                 onclick: function()
@@ -131,7 +148,7 @@
                     title: "Accept Offer",
                     content: "Are you sure you would like to accept this "+
                       "offer? This will allow you to chat with the person "+
-                      "who made this offer. You can reject the offer later "+
+                      "who made this offer. You can decline the offer later "+
                       "if you change your mind.",
                     buttons: [
                       {text: "Yes", onclick: function()
@@ -200,57 +217,71 @@
               });
             }
 
-            buttons.push({
-              text: "Reject",
-              onclick: function()
-              {
-                var rejectFn = function()
+            if (offer.status == "completed")
+            {
+              buttons.push({
+                text: "Review Buyer",
+                onclick: function()
                 {
-                  var successFn = function()
-                  {
-                    var elem = document.getElementById("offer-" + offer.id);
-                    elem.parentNode.removeChild(elem);
-                  };
-                  var errorFn = function()
+                  window.location.href = "/review/" + offer.id;
+                }
+              });
+            }
+
+            if (offer.status != "completed")
+            {
+              buttons.push({
+                text: "Decline",
+                onclick: function()
+                {
+                  var rejectFn = function()
                   {
-                    new Dialog({
-                      title: "Failed To Reject Offer",
-                      content: "An unexpected error occurred and we were not "+
-                        "able to mark that offer as rejected. Please try "+
-                        "refreshing the page, or try again later.",
-                      buttons: [{text: "OK", onclick: function(){}}]
-                    });
-                  }
-                  $.ajax({
-                    url: "/webapi/offer/delete/" + offer.id,
-                    cache: false,
-                    dataType: "json",
-                    data: {csrfToken: window.csrfToken},
-                    success: function(data)
+                    var successFn = function()
                     {
-                      if(data.successful)
-                      {
-                        successFn();
-                      }
-                      else
+                      var elem = document.getElementById("offer-" + offer.id);
+                      elem.parentNode.removeChild(elem);
+                    };
+                    var errorFn = function()
+                    {
+                      new Dialog({
+                        title: "Failed To Decline Offer",
+                        content: "An unexpected error occurred and we were not "+
+                          "able to mark that offer as declined. Please try "+
+                          "refreshing the page, or try again later.",
+                        buttons: [{text: "OK", onclick: function(){}}]
+                      });
+                    }
+                    $.ajax({
+                      url: "/webapi/offer/delete/" + offer.id,
+                      cache: false,
+                      dataType: "json",
+                      data: {csrfToken: window.csrfToken},
+                      success: function(data)
                       {
-                        errorFn();
-                      }
-                    },
-                    error: errorFn
+                        if(data.successful)
+                        {
+                          successFn();
+                        }
+                        else
+                        {
+                          errorFn();
+                        }
+                      },
+                      error: errorFn
+                    });
+                  }
+                  new Dialog({
+                    title: "Are You Sure?",
+                    content: "Are you sure you would like to decline this "+
+                      "offer? This action cannot be reversed.",
+                    buttons: [
+                      {text: "Yes", onclick: rejectFn},
+                      {text: "No", onclick: function(){}, isAlt: true}
+                    ]
                   });
                 }
-                new Dialog({
-                  title: "Are You Sure?",
-                  content: "Are you sure you would like to reject this "+
-                    "offer? This action cannot be reversed.",
-                  buttons: [
-                    {text: "Yes", onclick: rejectFn},
-                    {text: "No", onclick: function(){}, isAlt: true}
-                  ]
-                });
-              }
-            });
+              });
+            }
 
             new OptionPane({
               title: "Offer of $" + offer.price,
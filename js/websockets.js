@@ -135,6 +135,30 @@
         link: "/listing/view/" + offer.listing.id
       });
     },
+    "NOTIF_OFFER_EXPIRED": function(offer)
+    {
+      Toast({
+        content: "The offer of $" + offer.price + " for " +
+          offer.listing.name + " expired",
+        link: "/listing/view/" + offer.listing.id
+      });
+    },
+    "NOTIF_DEAL_LAPSED": function(offer)
+    {
+      Toast({
+        content: "The accepted offer of $" + offer.price + " for " +
+          offer.listing.name + " lapsed because it wasn't finalized in time",
+        link: "/listing/view/" + offer.listing.id
+      });
+    },
+    "NOTIF_LISTING_SOLD": function(offer)
+    {
+      Toast({
+        content: offer.listing.name + " was sold to someone else, so your "+
+          "offer of $" + offer.price + " was closed",
+        link: "/listing/view/" + offer.listing.id
+      });
+    },
     "OFFER_ACCEPTED": function(offer)
     {
       Toast({
@@ -143,6 +167,71 @@
         link: "/message/client/#conversation" + offer.id
       });
     },
+    "NOTIF_MEETUP_PROPOSED": function(meetup)
+    {
+      Toast({
+        content: meetup.proposer.display_name + " proposed meeting at " +
+          meetup.location + " on " + new Date(meetup.time).toLocaleString() +
+          " for " + meetup.listing.name,
+        link: "/meetup/" + meetup.offer_id
+      });
+    },
+    "NOTIF_MEETUP_ACCEPTED": function(meetup)
+    {
+      Toast({
+        content: "Your meetup at " + meetup.location + " for " +
+          meetup.listing.name + " was accepted",
+        link: "/meetup/" + meetup.offer_id
+      });
+    },
+    "NOTIF_MEETUP_DECLINED": function(meetup)
+    {
+      Toast({
+        content: "Your meetup at " + meetup.location + " for " +
+          meetup.listing.name + " was declined",
+        link: "/meetup/" + meetup.offer_id
+      });
+    },
+    "NOTIF_NEW_REVIEW": function(review)
+    {
+      Toast({
+        content: review.reviewer.display_name + " gave you " + review.rating +
+          " out of 5 for " + review.listing.name,
+        link: "/user/profile/"
+      });
+    },
+    "NOTIF_WANTED_RESPONSE": function(offer)
+    {
+      Toast({
+        content: offer.seller.display_name + " offered " +
+          offer.listing.name + " for $" + offer.price + " in response to "+
+          "your wanted post",
+        link: "/offer/buyer/" + offer.listing.id
+      });
+    },
+    "NOTIF_LISTING_PUBLISHED": function(listing)
+    {
+      Toast({
+        content: listing.name + " was published as you scheduled",
+        link: "/listing/view/" + listing.id
+      });
+    },
+    "NOTIF_LISTING_EXPIRING": function(listing)
+    {
+      Toast({
+        content: listing.name + " expires soon. Renew it to keep showing it "+
+          "to buyers",
+        link: "/listing/view/" + listing.id
+      });
+    },
+    "SAVED_SEARCH_MATCH": function(match)
+    {
+      Toast({
+        content: match.listing.name + " was just posted for $" +
+          match.listing.price + ", and matches one of your saved searches",
+        link: "/listing/view/" + match.listing.id
+      });
+    },
     "NEW_MESSAGE": function(message)
     {
       if(message.sender.id != window.currentUser.id)
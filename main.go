@@ -1,11 +1,20 @@
 package main
 
 import (
+	"os"
+
 	"github.com/anishmgoyal/calagora/bootstrap"
 	_ "github.com/lib/pq"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if !bootstrap.RunCommand(os.Args[1], os.Args[2:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if !bootstrap.GlobalStart() {
 		panic("Failed to start server.")
 	}
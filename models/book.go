@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// Book is an entry in the book catalog, which is used to fill in textbook
+// listings from their ISBN
+type Book struct {
+	ISBN    string `json:"isbn"`
+	Title   string `json:"title"`
+	Author  string `json:"author"`
+	Edition string `json:"edition"`
+}
+
+// GetBookByISBN looks up a book in the catalog by an ISBN-10 or ISBN-13.
+// Nil is returned if the ISBN isn't valid or the book isn't in the catalog
+func GetBookByISBN(db *sql.DB, isbn string) (*Book, error) {
+	isbn, ok := utils.NormalizeISBN(isbn)
+	if !ok {
+		return nil, nil
+	}
+
+	var book Book
+	err := db.QueryRow("SELECT isbn, title, author, edition FROM books "+
+		"WHERE isbn = $1", isbn).Scan(&book.ISBN, &book.Title, &book.Author,
+		&book.Edition)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		fmt.Println("[ERROR] models.GetBookByISBN: " + err.Error())
+		return nil, err
+	}
+	return &book, nil
+}
+
+// parseBookRecord reads a book from a line of a catalog file, which has
+// the columns isbn, title, author and edition. The edition may be left
+// out. An error message is returned if the line isn't a valid book
+func parseBookRecord(record []string) (*Book, string) {
+	if len(record) < 3 || len(record) > 4 {
+		return nil, "expected 3 or 4 columns, found " + strconv.Itoa(len(record))
+	}
+
+	isbn, ok := utils.NormalizeISBN(record[0])
+	if !ok {
+		return nil, "invalid ISBN " + record[0]
+	}
+	book := &Book{
+		ISBN:   isbn,
+		Title:  strings.TrimSpace(record[1]),
+		Author: strings.TrimSpace(record[2]),
+	}
+	if len(record) == 4 {
+		book.Edition = strings.TrimSpace(record[3])
+	}
+
+	if len(book.Title) == 0 || len(book.Title) > 255 {
+		return nil, "titles must be between 1 and 255 characters long"
+	}
+	if len(book.Author) > 255 {
+		return nil, "authors can't be longer than 255 characters"
+	}
+	if len(book.Edition) > 20 {
+		return nil, "editions can't be longer than 20 characters"
+	}
+	return book, ""
+}
+
+// ImportBooks adds the books in a CSV file to the catalog, replacing any
+// already there with the same ISBN. A header line starting with "isbn" is
+// skipped. Invalid lines are reported and skipped, and the numbers of books
+// imported and lines skipped are returned
+func ImportBooks(db *sql.DB, r io.Reader) (int, int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	imported, skipped := 0, 0
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		statement, err := tx.Prepare("INSERT INTO books (isbn, title, author, " +
+			"edition) VALUES ($1, $2, $3, $4) ON CONFLICT (isbn) DO UPDATE SET " +
+			"title = $2, author = $3, edition = $4, imported = now()")
+		if err != nil {
+			return err
+		}
+		defer statement.Close()
+
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if line == 1 && len(record) > 0 &&
+				strings.EqualFold(strings.TrimSpace(record[0]), "isbn") {
+
+				continue
+			}
+
+			book, errMessage := parseBookRecord(record)
+			if book == nil {
+				fmt.Println("[WARN] models.ImportBooks: skipped line " +
+					strconv.Itoa(line) + ": " + errMessage)
+				skipped++
+				continue
+			}
+			_, err = statement.Exec(book.ISBN, book.Title, book.Author,
+				book.Edition)
+			if err != nil {
+				return err
+			}
+			imported++
+		}
+	})
+	if err != nil {
+		fmt.Println("[ERROR] models.ImportBooks: " + err.Error())
+		return 0, skipped, err
+	}
+	return imported, skipped, nil
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBookRecord(t *testing.T) {
+	book, errMessage := parseBookRecord([]string{"0-262-03384-4",
+		" Introduction to Algorithms ", "Cormen", "3rd"})
+	if book == nil {
+		t.Fatal("Failed to parse book: " + errMessage)
+	}
+	if book.ISBN != "9780262033848" || book.Title != "Introduction to Algorithms" ||
+		book.Author != "Cormen" || book.Edition != "3rd" {
+
+		t.Errorf("Got unexpected book: %+v", book)
+	}
+
+	invalid := [][]string{
+		{"0-262-03384-5", "Introduction to Algorithms", "Cormen"},
+		{"9780262033848", "", "Cormen"},
+		{"9780262033848", "Introduction to Algorithms"},
+		{"9780262033848", "Introduction to Algorithms", "Cormen",
+			strings.Repeat("a", 21)},
+	}
+	for _, record := range invalid {
+		if book, _ := parseBookRecord(record); book != nil {
+			t.Errorf("Parsed invalid record %q as %+v", record, book)
+		}
+	}
+}
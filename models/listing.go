@@ -3,6 +3,7 @@ package models
 import (
 	"bytes"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"strconv"
@@ -28,6 +29,25 @@ type Listing struct {
 	User        User      `json:"user"`
 	Created     time.Time `json:"created"`
 	Modified    time.Time `json:"modified"`
+
+	// Attributes hold the fields particular to the listing's type, keyed by
+	// the names in ListingAttributes. They are only loaded with a single
+	// listing
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Expires is when a published listing stops being shown to buyers,
+	// unless its seller renews it. Bumped is when it was last moved to the
+	// top of the listing feed
+	Expires *time.Time `json:"expires,omitempty"`
+	Bumped  time.Time  `json:"bumped"`
+
+	// PublishAt is when a draft is published automatically, if its seller
+	// scheduled it
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+
+	// searchRank is how relevant a listing was to a search query, and is
+	// only set on listings returned by a search
+	searchRank float32
 }
 
 // ListingError contains fields that can be used to return
@@ -39,7 +59,10 @@ type ListingError struct {
 	Condition   string `json:"conition,omitempty"`
 	Status      string `json:"status,omitempty"`
 	Description string `json:"description,omitempty"`
+	PublishAt   string `json:"publish_at,omitempty"`
 	Global      string `json:"global,omitempty"`
+	// Attributes are errors in the listing's attributes, keyed by name
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // ListingQueryOpts allows a user to specify how
@@ -64,9 +87,116 @@ type ListingQueryOpts struct {
 	HideDraft     bool
 	HidePublished bool
 
+	// HideHeld leaves out listings on hold for a buyer, which only their
+	// seller should see
+	HideHeld bool
+
+	// HideExpired leaves out published listings past their expiry, which
+	// only their seller should see
+	HideExpired bool
+
+	// ISBN, if set, restricts listings to copies of the textbook with that
+	// normalized ISBN
+	ISBN string
+
+	Sort string
+
 	PageSize  int
 	PageNum   int
 	UsePaging bool
+	// Cursor, if set, is used instead of PageNum when paging
+	Cursor *ListingCursor
+}
+
+const (
+	// SortRelevance orders search results by how well they match a query
+	SortRelevance = "relevance"
+	// SortNewest orders listings from newest to oldest
+	SortNewest = "newest"
+	// SortPriceAsc orders listings from cheapest to most expensive
+	SortPriceAsc = "price_asc"
+	// SortPriceDesc orders listings from most expensive to cheapest
+	SortPriceDesc = "price_desc"
+)
+
+// ListingSortNames is an array of the orders listings can be sorted in
+var ListingSortNames = []string{
+	SortRelevance,
+	SortNewest,
+	SortPriceAsc,
+	SortPriceDesc,
+}
+
+// ListingSorts is a map of sort orders and their descriptions
+var ListingSorts = map[string]string{
+	SortRelevance: "Best Match",
+	SortNewest:    "Newest",
+	SortPriceAsc:  "Price: Low to High",
+	SortPriceDesc: "Price: High to Low",
+}
+
+// ListingCursor marks the last listing on a page of listings, so that the
+// next page can pick up after it even if listings are added in the meantime
+type ListingCursor struct {
+	Sort   string
+	ID     int
+	Price  int
+	Rank   float32
+	Bumped time.Time
+}
+
+// NewListingCursor creates a cursor pointing after a listing in a list
+// sorted by sort
+func NewListingCursor(sort string, listing *Listing) *ListingCursor {
+	return &ListingCursor{
+		Sort:   sort,
+		ID:     listing.ID,
+		Price:  listing.Price,
+		Rank:   listing.searchRank,
+		Bumped: listing.Bumped,
+	}
+}
+
+// String encodes a cursor so it can be handed to a client
+func (c *ListingCursor) String() string {
+	raw := c.Sort + "~" + strconv.Itoa(c.ID) + "~" + strconv.Itoa(c.Price) +
+		"~" + strconv.FormatFloat(float64(c.Rank), 'g', -1, 32) + "~" +
+		strconv.FormatInt(c.Bumped.UnixNano(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseListingCursor decodes a cursor created by ListingCursor.String
+func ParseListingCursor(encoded string) (*ListingCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(string(raw), "~")
+	if len(parts) != 5 {
+		return nil, errors.New("Malformed cursor")
+	}
+	if _, ok := ListingSorts[parts[0]]; !ok {
+		return nil, errors.New("Unknown sort order " + parts[0])
+	}
+
+	cursor := ListingCursor{Sort: parts[0]}
+	if cursor.ID, err = strconv.Atoi(parts[1]); err != nil {
+		return nil, err
+	}
+	if cursor.Price, err = strconv.Atoi(parts[2]); err != nil {
+		return nil, err
+	}
+	rank, err := strconv.ParseFloat(parts[3], 32)
+	if err != nil {
+		return nil, err
+	}
+	cursor.Rank = float32(rank)
+	bumped, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	cursor.Bumped = time.Unix(0, bumped)
+	return &cursor, nil
 }
 
 const (
@@ -114,13 +244,17 @@ var ListingTypes = map[string]string{
 const (
 	// ListingListed is a listing with no active offers
 	ListingListed = "listed"
+	// ListingTransaction is a listing held for a buyer whose offer was
+	// accepted
+	ListingTransaction = "transaction"
 	// ListingSold is a listing that has been sold
 	ListingSold = "sold"
 )
 
 var listingStatuses = map[string]bool{
-	ListingListed: true,
-	ListingSold:   true,
+	ListingListed:      true,
+	ListingTransaction: true,
+	ListingSold:        true,
 }
 
 const (
@@ -162,6 +296,20 @@ var ListingConditions = map[string]string{
 	ListingCondForParts:  "For Parts",
 }
 
+// ListingConditionsAtLeast gets the conditions, from best to worst, that are
+// as good as or better than cond. Returns nil for conditions that can't be
+// compared, like ListingCondNA
+func ListingConditionsAtLeast(cond string) []string {
+	for i := 1; i < len(ListingConditionNames); i++ {
+		if strings.Compare(ListingConditionNames[i], cond) == 0 {
+			conditions := make([]string, i)
+			copy(conditions, ListingConditionNames[1:i+1])
+			return conditions
+		}
+	}
+	return nil
+}
+
 // Validate checks if the fields of a given listing confirm
 // to certain constraints
 func (listing *Listing) Validate() (bool, ListingError) {
@@ -208,6 +356,28 @@ func (listing *Listing) Validate() (bool, ListingError) {
 		err.Description = "The description cannot exceed 2500 characters."
 	}
 
+	if listing.PublishAt != nil {
+		now := time.Now()
+		if listing.PublishAt.IsZero() {
+			valid = false
+			err.PublishAt = "That time is invalid."
+		} else if listing.PublishAt.Before(now) {
+			valid = false
+			err.PublishAt = "A draft can't be scheduled in the past."
+		} else if listing.PublishAt.After(
+			now.AddDate(0, 0, MaxListingScheduleDays)) {
+
+			valid = false
+			err.PublishAt = "A draft can't be scheduled more than " +
+				strconv.Itoa(MaxListingScheduleDays) + " days ahead."
+		}
+	}
+
+	if attributeErrors := listing.validateAttributes(); attributeErrors != nil {
+		valid = false
+		err.Attributes = attributeErrors
+	}
+
 	return valid, err
 }
 
@@ -217,6 +387,10 @@ func (listing *Listing) Normalize() {
 		listing.Name = strings.TrimSpace(listing.Name)
 		listing.Description = strings.TrimSpace(listing.Description)
 	}
+	// Only drafts are waiting to be published
+	if listing.Published {
+		listing.PublishAt = nil
+	}
 }
 
 // Create creates a new listing, or returns validation errors
@@ -228,11 +402,19 @@ func (listing *Listing) Create(db *sql.DB) (bool, *ListingError) {
 		return false, &validationError
 	}
 
+	listing.Expires = nil
+	if listing.Published {
+		expires := time.Now().Add(ListingLifetime)
+		listing.Expires = &expires
+	}
+
 	rows, err := db.Query("INSERT INTO listings (name, price, type, condition, "+
-		"status, description, published, place_id, user_id) VALUES ($1, $2, $3, "+
-		"$4, $5, $6, $7, $8, $9) RETURNING id", listing.Name, listing.Price,
-		listing.Type, listing.Condition, listing.Status, listing.Description,
-		listing.Published, listing.User.PlaceID, listing.User.ID)
+		"status, description, published, place_id, user_id, expires, "+
+		"publish_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) "+
+		"RETURNING id, bumped", listing.Name, listing.Price, listing.Type,
+		listing.Condition, listing.Status, listing.Description,
+		listing.Published, listing.User.PlaceID, listing.User.ID,
+		listing.Expires, listing.PublishAt)
 	if err != nil {
 		fmt.Println("ERROR!")
 		fmt.Println(err.Error())
@@ -243,7 +425,7 @@ func (listing *Listing) Create(db *sql.DB) (bool, *ListingError) {
 	defer rows.Close()
 
 	if rows.Next() {
-		rows.Scan(&listing.ID)
+		rows.Scan(&listing.ID, &listing.Bumped)
 	} else {
 		// The listing was created... but we don't have its ID
 		return true, &ListingError{
@@ -251,6 +433,13 @@ func (listing *Listing) Create(db *sql.DB) (bool, *ListingError) {
 		}
 	}
 
+	if err := writeListingAttributes(db, listing); err != nil {
+		fmt.Println("[ERROR] models.Listing.Create: " + err.Error())
+		return true, &ListingError{
+			Global: "An unexpected error occurred.",
+		}
+	}
+
 	go listing.DoRebuildSearchIndex(db)
 	return true, nil
 }
@@ -263,11 +452,18 @@ func (listing *Listing) Save(db *sql.DB) (bool, *ListingError) {
 		return false, &validationError
 	}
 
+	// A draft being published gets a fresh expiry, and goes to the top of
+	// the listing feed
 	res, err := db.Exec("UPDATE listings SET name = $1, price = $2, "+
 		"type = $3, condition = $4, status = $5, description = $6, "+
-		"published = $7, modified = now() WHERE id = $8", listing.Name,
-		listing.Price, listing.Type, listing.Condition, listing.Status,
-		listing.Description, listing.Published, listing.ID)
+		"published = $7, modified = now(), expires = CASE WHEN $7 AND NOT "+
+		"published THEN $9 ELSE expires END, expiry_reminded = CASE WHEN $7 "+
+		"AND NOT published THEN false ELSE expiry_reminded END, bumped = CASE "+
+		"WHEN $7 AND NOT published THEN now() ELSE bumped END, publish_at = $10 "+
+		"WHERE id = $8", listing.Name, listing.Price, listing.Type,
+		listing.Condition, listing.Status, listing.Description,
+		listing.Published, listing.ID, time.Now().Add(ListingLifetime),
+		listing.PublishAt)
 	if err != nil {
 		fmt.Println("ERROR!")
 		fmt.Println(err.Error())
@@ -276,6 +472,13 @@ func (listing *Listing) Save(db *sql.DB) (bool, *ListingError) {
 		}
 	}
 
+	if err := writeListingAttributes(db, listing); err != nil {
+		fmt.Println("[ERROR] models.Listing.Save: " + err.Error())
+		return false, &ListingError{
+			Global: "An unexpected error occurred.",
+		}
+	}
+
 	go listing.DoRebuildSearchIndex(db)
 
 	numAffected, _ := res.RowsAffected()
@@ -295,24 +498,39 @@ func (listing *Listing) Delete(db *sql.DB) (bool, error) {
 	if err != nil {
 		return false, errors.New("Failed to get images for deletion")
 	}
-	for _, image := range images {
-		ok, _ := image.Delete(db)
-		if !ok {
-			return false, errors.New("Failed to delete all images")
-		}
-	}
 
-	res, err := db.Exec("DELETE FROM listings WHERE id = $1", listing.ID)
-	if err != nil {
-		return false, err
-	}
-	num, err := res.RowsAffected()
+	// The listing and its images are deleted together, and the uploaded
+	// files only once the rows are gone, as files can't be put back if the
+	// transaction fails. Offers and their messages are deleted by cascade
+	err = inTransaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM images WHERE media = $1 AND media_id = $2",
+			MediaListing, listing.ID)
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec("DELETE FROM listings WHERE id = $1", listing.ID)
+		if err != nil {
+			return err
+		}
+		num, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if num != 1 {
+			return errors.New("Deleted incorrect number of rows (" +
+				strconv.FormatInt(num, 10) + ")")
+		}
+		return nil
+	})
 	if err != nil {
 		return false, err
 	}
-	if num != 1 {
-		return false, errors.New("Deleted incorrect number of rows (" +
-			strconv.FormatInt(num, 10) + ")")
+
+	for _, image := range images {
+		if len(image.URL) > 0 && !utils.DeleteImage(image.URL) {
+			fmt.Println("[WARN] models.Listing.Delete: failed to delete " +
+				image.URL)
+		}
 	}
 	return true, nil
 }
@@ -340,8 +558,9 @@ func (listing *Listing) MarkSold(db *sql.DB) (bool, error) {
 func GetListingByID(db *sql.DB, id int) (*Listing, error) {
 	rows, err := db.Query("SELECT l.id, l.name, l.price, l.type, l.condition, "+
 		"l.status, l.description, l.place_id, l.published, u.id, u.username, "+
-		"u.display_name, u.email_address, l.created, l.modified FROM listings l, "+
-		"users u WHERE l.user_id = u.id AND l.id = $1", id)
+		"u.display_name, u.email_address, l.created, l.modified, l.expires, "+
+		"l.bumped, l.publish_at FROM listings l, users u WHERE l.user_id = u.id "+
+		"AND l.id = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -352,8 +571,16 @@ func GetListingByID(db *sql.DB, id int) (*Listing, error) {
 			&listing.Condition, &listing.Status, &listing.Description,
 			&listing.User.PlaceID, &listing.Published, &listing.User.ID,
 			&listing.User.Username, &listing.User.DisplayName,
-			&listing.User.EmailAddress, &listing.Created, &listing.Modified)
+			&listing.User.EmailAddress, &listing.Created, &listing.Modified,
+			&listing.Expires, &listing.Bumped, &listing.PublishAt)
 		listing.PriceClient = utils.PriceServerToClient(listing.Price)
+		rows.Close()
+
+		attributes, err := getListingAttributes(db, listing.ID)
+		if err != nil {
+			return nil, err
+		}
+		listing.Attributes = attributes
 		return &listing, nil
 	}
 	return nil, nil
@@ -367,7 +594,8 @@ func GetListingList(db *sql.DB, options ListingQueryOpts) []Listing {
 	var buffer bytes.Buffer
 	buffer.WriteString("SELECT l.id, l.name, l.price, l.type, l.condition, " +
 		"l.status, l.description, l.published, l.place_id, u.id, u.username, " +
-		"u.display_name, u.email_address, u.place_id, i.URL FROM listings l JOIN " +
+		"u.display_name, u.email_address, u.place_id, i.URL, l.expires, " +
+		"l.bumped, l.publish_at FROM listings l JOIN " +
 		"users u ON l.user_id = u.id LEFT JOIN images i ON i.media_id = l.id " +
 		"WHERE (i.id = (SELECT id FROM images WHERE media='" + MediaListing +
 		"' AND media_id = l.id ORDER BY ordinal ASC LIMIT 1) OR i.id IS NULL)")
@@ -381,7 +609,7 @@ func GetListingList(db *sql.DB, options ListingQueryOpts) []Listing {
 		args = append(args, options.PlaceID)
 		argCount++
 	} else if options.SkipByPlace {
-		buffer.WriteString(" AND (l.place_id = $" + strconv.Itoa(argCount) + ")")
+		buffer.WriteString(" AND (l.place_id <> $" + strconv.Itoa(argCount) + ")")
 		args = append(args, options.PlaceID)
 		argCount++
 	}
@@ -422,15 +650,63 @@ func GetListingList(db *sql.DB, options ListingQueryOpts) []Listing {
 		buffer.WriteString(" AND NOT l.published")
 	}
 
-	buffer.WriteString(" ORDER BY l.id DESC")
+	if options.HideHeld {
+		buffer.WriteString(" AND l.status <> '" + ListingTransaction + "'")
+	}
+
+	if options.HideExpired {
+		buffer.WriteString(" AND (l.expires IS NULL OR l.expires > now())")
+	}
+
+	if len(options.ISBN) > 0 {
+		buffer.WriteString(" AND EXISTS (SELECT 1 FROM listing_attributes a " +
+			"WHERE a.listing_id = l.id AND a.name = 'isbn' AND a.value = $" +
+			strconv.Itoa(argCount) + ")")
+		args = append(args, options.ISBN)
+		argCount++
+	}
+
+	useCursor := options.UsePaging && options.Cursor != nil &&
+		strings.Compare(options.Cursor.Sort, options.Sort) == 0
+
+	switch options.Sort {
+	case SortPriceAsc:
+		if useCursor {
+			buffer.WriteString(" AND (l.price, l.id) > ($" +
+				strconv.Itoa(argCount) + ", $" + strconv.Itoa(argCount+1) + ")")
+			args = append(args, options.Cursor.Price, options.Cursor.ID)
+			argCount += 2
+		}
+		buffer.WriteString(" ORDER BY l.price ASC, l.id ASC")
+	case SortPriceDesc:
+		if useCursor {
+			buffer.WriteString(" AND (l.price, l.id) < ($" +
+				strconv.Itoa(argCount) + ", $" + strconv.Itoa(argCount+1) + ")")
+			args = append(args, options.Cursor.Price, options.Cursor.ID)
+			argCount += 2
+		}
+		buffer.WriteString(" ORDER BY l.price DESC, l.id DESC")
+	default:
+		// Listings are ordered by when they were last bumped, which is when
+		// they were published unless their seller has bumped them since
+		if useCursor {
+			buffer.WriteString(" AND (l.bumped, l.id) < ($" +
+				strconv.Itoa(argCount) + ", $" + strconv.Itoa(argCount+1) + ")")
+			args = append(args, options.Cursor.Bumped, options.Cursor.ID)
+			argCount += 2
+		}
+		buffer.WriteString(" ORDER BY l.bumped DESC, l.id DESC")
+	}
 
 	if options.UsePaging {
 		buffer.WriteString(" LIMIT $" + strconv.Itoa(argCount))
 		args = append(args, options.PageSize)
 		argCount++
-		buffer.WriteString(" OFFSET $" + strconv.Itoa(argCount))
-		args = append(args, options.PageNum*options.PageSize)
-		argCount++
+		if !useCursor {
+			buffer.WriteString(" OFFSET $" + strconv.Itoa(argCount))
+			args = append(args, options.PageNum*options.PageSize)
+			argCount++
+		}
 	}
 
 	rows, err := db.Query(buffer.String(), args[:argCount-1]...)
@@ -446,7 +722,7 @@ func GetListingList(db *sql.DB, options ListingQueryOpts) []Listing {
 		err = rows.Scan(&l.ID, &l.Name, &l.Price, &l.Type, &l.Condition,
 			&l.Status, &l.Description, &l.Published, &l.User.PlaceID, &l.User.ID,
 			&l.User.Username, &l.User.DisplayName, &l.User.EmailAddress,
-			&l.User.PlaceID, &l.ImageURL)
+			&l.User.PlaceID, &l.ImageURL, &l.Expires, &l.Bumped, &l.PublishAt)
 		if err == nil {
 			if l.ImageURL == nil {
 				l.ImageURL = &ImageNotFound
@@ -0,0 +1,403 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+const (
+	// AttributeText is for attributes holding free text, like a course code
+	AttributeText = "text"
+	// AttributeNumber is for attributes holding a whole number, like mileage
+	AttributeNumber = "number"
+	// AttributeDate is for attributes holding a day, like a move in date
+	AttributeDate = "date"
+	// AttributeChoice is for attributes holding one of a fixed set of values
+	AttributeChoice = "choice"
+	// AttributeISBN is for attributes holding the ISBN of a book, which is
+	// stored as an ISBN-13
+	AttributeISBN = "isbn"
+	// AttributeCourse is for attributes holding a course code, like CS 111
+	AttributeCourse = "course"
+)
+
+// AttributeDateFormat is the format dates are entered and stored in
+const AttributeDateFormat = "2006-01-02"
+
+// ListingAttribute describes a field which listings of one type can have
+// on top of the fields every listing has
+type ListingAttribute struct {
+	Name  string
+	Label string
+	Kind  string
+	// MaxLength is the longest a text attribute can be
+	MaxLength int
+	// Min and Max bound the values of a number attribute
+	Min int
+	Max int
+	// ChoiceNames are the values of a choice attribute, in the order they
+	// are shown, and Choices maps them to their descriptions
+	ChoiceNames []string
+	Choices     map[string]string
+	// Searchable attributes are indexed along with the listing's name and
+	// description, and Filterable ones can narrow down search results
+	Searchable bool
+	Filterable bool
+}
+
+// ListingAttributeValue is an attribute of a listing as it is shown to
+// users
+type ListingAttributeValue struct {
+	Label string
+	Value string
+}
+
+// ListingAttributes are the attributes each type of listing can have.
+// Names are unique across every type, so that a form can hold the
+// attributes for all of them at once
+var ListingAttributes = map[string][]ListingAttribute{
+	ListingTextbook: {
+		{Name: "isbn", Label: "ISBN", Kind: AttributeISBN, MaxLength: 17,
+			Searchable: true, Filterable: true},
+		{Name: "edition", Label: "Edition", Kind: AttributeText, MaxLength: 20,
+			Searchable: true},
+		{Name: "course", Label: "Course", Kind: AttributeCourse, MaxLength: 20,
+			Searchable: true, Filterable: true},
+	},
+	ListingHousing: {
+		{Name: "move_in", Label: "Move In Date", Kind: AttributeDate,
+			Filterable: true},
+		{Name: "rent_period", Label: "Rent Period", Kind: AttributeChoice,
+			ChoiceNames: []string{"monthly", "semester", "yearly"},
+			Choices: map[string]string{
+				"monthly":  "Monthly",
+				"semester": "Per Semester",
+				"yearly":   "Yearly",
+			},
+			Filterable: true},
+		{Name: "bedrooms", Label: "Bedrooms", Kind: AttributeNumber, Min: 0,
+			Max: 20, Filterable: true},
+	},
+	ListingAutomotive: {
+		{Name: "make", Label: "Make", Kind: AttributeText, MaxLength: 30,
+			Searchable: true},
+		{Name: "model", Label: "Model", Kind: AttributeText, MaxLength: 30,
+			Searchable: true},
+		{Name: "year", Label: "Year", Kind: AttributeNumber, Min: 1900,
+			Max: 2100, Filterable: true},
+		{Name: "mileage", Label: "Mileage", Kind: AttributeNumber, Min: 0,
+			Max: 2000000, Filterable: true},
+	},
+}
+
+// GetListingAttribute finds an attribute of a listing type by its name
+func GetListingAttribute(typeName, name string) (ListingAttribute, bool) {
+	for _, attr := range ListingAttributes[typeName] {
+		if attr.Name == name {
+			return attr, true
+		}
+	}
+	return ListingAttribute{}, false
+}
+
+// Normalize checks a value entered for an attribute, and gets the value as
+// it is stored. An error message is returned if the value isn't valid
+func (a ListingAttribute) Normalize(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	switch a.Kind {
+	case AttributeNumber:
+		number, err := strconv.Atoi(strings.Replace(value, ",", "", -1))
+		if err != nil {
+			return "", a.Label + " must be a whole number."
+		}
+		if number < a.Min || number > a.Max {
+			return "", a.Label + " must be between " + strconv.Itoa(a.Min) +
+				" and " + strconv.Itoa(a.Max) + "."
+		}
+		return strconv.Itoa(number), ""
+	case AttributeDate:
+		date, err := time.Parse(AttributeDateFormat, value)
+		if err != nil {
+			return "", a.Label + " must be a date, like 2017-08-25."
+		}
+		return date.Format(AttributeDateFormat), ""
+	case AttributeChoice:
+		if _, ok := a.Choices[value]; !ok {
+			return "", "The " + strings.ToLower(a.Label) + " " + value +
+				" is invalid."
+		}
+		return value, ""
+	case AttributeISBN:
+		isbn, ok := utils.NormalizeISBN(value)
+		if !ok {
+			return "", a.Label + " must be a valid ISBN-10 or ISBN-13."
+		}
+		return isbn, ""
+	case AttributeCourse:
+		value = normalizeCourseCode(value)
+	}
+	if len(value) > a.MaxLength {
+		return "", a.Label + " can't be longer than " +
+			strconv.Itoa(a.MaxLength) + " characters."
+	}
+	return value, ""
+}
+
+// normalizeCourseCode writes a course code in capitals with a space
+// between its department and number, so that "cs111" and "CS 111" are
+// stored the same way
+func normalizeCourseCode(code string) string {
+	code = strings.ToUpper(strings.Join(strings.Fields(code), " "))
+	var buffer bytes.Buffer
+	var last rune
+	for _, r := range code {
+		if unicode.IsDigit(r) && unicode.IsLetter(last) {
+			buffer.WriteRune(' ')
+		}
+		buffer.WriteRune(r)
+		last = r
+	}
+	return buffer.String()
+}
+
+// Display gets a stored value of an attribute as it is shown to users
+func (a ListingAttribute) Display(value string) string {
+	if a.Kind == AttributeChoice {
+		return a.Choices[value]
+	}
+	return value
+}
+
+// validateAttributes checks the attributes of a listing against those of
+// its type, normalizing their values and dropping blank ones. Errors are
+// returned keyed by attribute name
+func (listing *Listing) validateAttributes() map[string]string {
+	var errs map[string]string
+	for name, value := range listing.Attributes {
+		if len(strings.TrimSpace(value)) == 0 {
+			delete(listing.Attributes, name)
+			continue
+		}
+		attr, ok := GetListingAttribute(listing.Type, name)
+		if !ok {
+			if errs == nil {
+				errs = make(map[string]string)
+			}
+			errs[name] = "Listings in this category don't have a " + name + "."
+			continue
+		}
+		normalized, errMessage := attr.Normalize(value)
+		if len(errMessage) > 0 {
+			if errs == nil {
+				errs = make(map[string]string)
+			}
+			errs[name] = errMessage
+			continue
+		}
+		listing.Attributes[name] = normalized
+	}
+	return errs
+}
+
+// AttributeValues gets the attributes a listing has, in the order they are
+// listed for its type
+func (listing Listing) AttributeValues() []ListingAttributeValue {
+	values := make([]ListingAttributeValue, 0, len(listing.Attributes))
+	for _, attr := range ListingAttributes[listing.Type] {
+		if value, ok := listing.Attributes[attr.Name]; ok {
+			values = append(values, ListingAttributeValue{
+				Label: attr.Label,
+				Value: attr.Display(value),
+			})
+		}
+	}
+	return values
+}
+
+// searchableAttributes gets the values of the attributes of a listing which
+// are indexed for search, separated by spaces
+func (listing *Listing) searchableAttributes() string {
+	values := make([]string, 0, len(listing.Attributes))
+	for _, attr := range ListingAttributes[listing.Type] {
+		if value, ok := listing.Attributes[attr.Name]; ok && attr.Searchable {
+			values = append(values, value)
+			// Course codes are also indexed without their spaces, for
+			// queries like "cs111"
+			if attr.Kind == AttributeCourse {
+				values = append(values, strings.Replace(value, " ", "", -1))
+			}
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+// copyAttributes copies a set of listing attributes, so that a listing
+// kept in memory doesn't share them with its callers
+func copyAttributes(attributes map[string]string) map[string]string {
+	if attributes == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		copied[name] = value
+	}
+	return copied
+}
+
+// writeListingAttributes replaces the attributes stored for a listing
+func writeListingAttributes(db *sql.DB, listing *Listing) error {
+	return inTransaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM listing_attributes WHERE listing_id = $1",
+			listing.ID)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(listing.Attributes))
+		for name := range listing.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := listing.Attributes[name]
+			var number *int
+			if attr, _ := GetListingAttribute(listing.Type, name); attr.Kind ==
+				AttributeNumber {
+
+				if n, err := strconv.Atoi(value); err == nil {
+					number = &n
+				}
+			}
+			_, err := tx.Exec("INSERT INTO listing_attributes (listing_id, name, "+
+				"value, number_value) VALUES ($1, $2, $3, $4)", listing.ID, name,
+				value, number)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// getListingAttributes gets the attributes stored for a listing, or nil if
+// it doesn't have any
+func getListingAttributes(db *sql.DB, listingID int) (map[string]string,
+	error) {
+
+	rows, err := db.Query("SELECT name, value FROM listing_attributes WHERE "+
+		"listing_id = $1", listingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attributes map[string]string
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if attributes == nil {
+			attributes = make(map[string]string)
+		}
+		attributes[name] = value
+	}
+	return attributes, rows.Err()
+}
+
+// AttributeFilter narrows search results down to listings with an
+// attribute matching Value, or within Min and Max for numbers and dates.
+// Blank fields aren't filtered on
+type AttributeFilter struct {
+	Attribute ListingAttribute
+	Value     string
+	Min       string
+	Max       string
+}
+
+// ParseAttributeFilters reads the filters on the attributes of a listing
+// type from a set of parameters. Text and choice attributes are matched by
+// the parameter attr_<name>, while numbers and dates are bounded by
+// attr_<name>_min and attr_<name>_max. Values which aren't valid are left
+// out, and the parameters used are returned alongside the filters
+func ParseAttributeFilters(typeName string, param func(string) string) (
+	[]AttributeFilter, map[string]string) {
+
+	var filters []AttributeFilter
+	var used map[string]string
+	read := func(attr ListingAttribute, key string) string {
+		if len(strings.TrimSpace(param(key))) == 0 {
+			return ""
+		}
+		value, errMessage := attr.Normalize(param(key))
+		if len(errMessage) > 0 {
+			return ""
+		}
+		if used == nil {
+			used = make(map[string]string)
+		}
+		used[key] = value
+		return value
+	}
+
+	for _, attr := range ListingAttributes[typeName] {
+		if !attr.Filterable {
+			continue
+		}
+		filter := AttributeFilter{Attribute: attr}
+		switch attr.Kind {
+		case AttributeNumber, AttributeDate:
+			filter.Min = read(attr, "attr_"+attr.Name+"_min")
+			filter.Max = read(attr, "attr_"+attr.Name+"_max")
+		default:
+			filter.Value = read(attr, "attr_"+attr.Name)
+		}
+		if len(filter.Value) > 0 || len(filter.Min) > 0 || len(filter.Max) > 0 {
+			filters = append(filters, filter)
+		}
+	}
+	return filters, used
+}
+
+// attributeFilterClause builds the conditions on search_documents d for a
+// set of attribute filters, appending any arguments they need to args
+func attributeFilterClause(filters []AttributeFilter, args []interface{}) (
+	string, []interface{}) {
+
+	var clause string
+	for _, filter := range filters {
+		args = append(args, filter.Attribute.Name)
+		condition := "a.name = $" + strconv.Itoa(len(args))
+
+		column := "a.value"
+		var min, max interface{} = filter.Min, filter.Max
+		if filter.Attribute.Kind == AttributeNumber {
+			column = "a.number_value"
+			min, _ = strconv.Atoi(filter.Min)
+			max, _ = strconv.Atoi(filter.Max)
+		}
+		if len(filter.Value) > 0 {
+			args = append(args, filter.Value)
+			condition += " AND lower(a.value) = lower($" +
+				strconv.Itoa(len(args)) + ")"
+		}
+		if len(filter.Min) > 0 {
+			args = append(args, min)
+			condition += " AND " + column + " >= $" + strconv.Itoa(len(args))
+		}
+		if len(filter.Max) > 0 {
+			args = append(args, max)
+			condition += " AND " + column + " <= $" + strconv.Itoa(len(args))
+		}
+		clause += " AND EXISTS (SELECT 1 FROM listing_attributes a WHERE " +
+			"a.listing_id = d.listing_id AND " + condition + ")"
+	}
+	return clause, args
+}
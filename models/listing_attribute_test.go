@@ -0,0 +1,68 @@
+package models
+
+import "testing"
+
+func TestListingAttributeNormalize(t *testing.T) {
+	tests := []struct {
+		typeName, name, value, normalized string
+		valid                             bool
+	}{
+		{ListingAutomotive, "mileage", "120,000", "120000", true},
+		{ListingAutomotive, "year", "1850", "", false},
+		{ListingAutomotive, "year", "new", "", false},
+		{ListingHousing, "move_in", "2017-09-01", "2017-09-01", true},
+		{ListingHousing, "move_in", "09/01/2017", "", false},
+		{ListingHousing, "rent_period", "semester", "semester", true},
+		{ListingHousing, "rent_period", "weekly", "", false},
+		{ListingTextbook, "course", " CS 111 ", "CS 111", true},
+		{ListingTextbook, "course", "math  1a", "MATH 1A", true},
+		{ListingTextbook, "course", "cs111", "CS 111", true},
+		{ListingTextbook, "isbn", "0-262-03384-4", "9780262033848", true},
+		{ListingTextbook, "isbn", "978-0-262-03384-7", "", false},
+	}
+	for _, test := range tests {
+		attr, ok := GetListingAttribute(test.typeName, test.name)
+		if !ok {
+			t.Fatalf("%s listings have no %s attribute", test.typeName,
+				test.name)
+		}
+		normalized, errMessage := attr.Normalize(test.value)
+		if (len(errMessage) == 0) != test.valid ||
+			normalized != test.normalized {
+
+			t.Errorf("%s %q normalized to %q (%s), expected %q", test.name,
+				test.value, normalized, errMessage, test.normalized)
+		}
+	}
+}
+
+func TestParseAttributeFilters(t *testing.T) {
+	params := map[string]string{
+		"attr_year_min":    "2005",
+		"attr_year_max":    "soon",
+		"attr_make":        "Honda",
+		"attr_mileage_max": "90,000",
+	}
+	filters, used := ParseAttributeFilters(ListingAutomotive,
+		func(key string) string { return params[key] })
+
+	// Make isn't filterable, and the invalid year bound is left out
+	if len(filters) != 2 || len(used) != 2 {
+		t.Fatalf("Got unexpected filters %+v from %+v", filters, used)
+	}
+	if filters[0].Attribute.Name != "year" || filters[0].Min != "2005" ||
+		filters[0].Max != "" {
+
+		t.Errorf("Got unexpected year filter: %+v", filters[0])
+	}
+	if filters[1].Attribute.Name != "mileage" || filters[1].Max != "90000" ||
+		used["attr_mileage_max"] != "90000" {
+
+		t.Errorf("Got unexpected mileage filter: %+v", filters[1])
+	}
+
+	clause, args := attributeFilterClause(filters, nil)
+	if len(args) != 4 || args[1] != 2005 || args[3] != 90000 {
+		t.Errorf("Got unexpected arguments %v for %s", args, clause)
+	}
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ListingLifetime is how long a published listing is shown to buyers
+	// before it expires, unless its seller renews it
+	ListingLifetime = time.Hour * 24 * 30
+	// ListingReminderWindow is how long before a listing expires its seller
+	// is reminded to renew it
+	ListingReminderWindow = time.Hour * 24 * 3
+	// ListingBumpInterval is how long a seller has to wait to bump a listing
+	// again
+	ListingBumpInterval = time.Hour * 24
+)
+
+var (
+	// ErrListingDraft is returned when renewing or bumping a listing which
+	// hasn't been published
+	ErrListingDraft = errors.New("The listing hasn't been published")
+	// ErrListingExpired is returned when bumping a listing which has to be
+	// renewed first
+	ErrListingExpired = errors.New("The listing has expired")
+	// ErrBumpTooSoon is returned when bumping a listing within
+	// ListingBumpInterval of its last bump
+	ErrBumpTooSoon = errors.New("The listing was bumped too recently")
+)
+
+// IsExpired returns whether a published listing has gone past its expiry
+func (listing Listing) IsExpired() bool {
+	return listing.Published && listing.Expires != nil &&
+		!listing.Expires.After(time.Now())
+}
+
+// NextBump gets the earliest time a listing can be bumped again
+func (listing Listing) NextBump() time.Time {
+	return listing.Bumped.Add(ListingBumpInterval)
+}
+
+// CanBump returns whether a listing can be bumped right now
+func (listing Listing) CanBump() bool {
+	return checkBump(&listing, time.Now()) == nil
+}
+
+// checkRenew checks that a listing can be renewed
+func checkRenew(listing *Listing) error {
+	if !listing.Published {
+		return ErrListingDraft
+	}
+	if listing.Status == ListingSold {
+		return ErrListingSold
+	}
+	return nil
+}
+
+// checkBump checks that a listing can be bumped at now
+func checkBump(listing *Listing, now time.Time) error {
+	if err := checkRenew(listing); err != nil {
+		return err
+	}
+	if listing.Expires != nil && !listing.Expires.After(now) {
+		return ErrListingExpired
+	}
+	if now.Before(listing.NextBump()) {
+		return ErrBumpTooSoon
+	}
+	return nil
+}
+
+// lockListingForRenewal locks a listing until the end of a transaction, and
+// loads what is needed to check whether it can be renewed or bumped
+func lockListingForRenewal(tx *sql.Tx, listing *Listing) error {
+	return tx.QueryRow("SELECT status, published, expires, bumped FROM "+
+		"listings WHERE id = $1 FOR UPDATE", listing.ID).Scan(&listing.Status,
+		&listing.Published, &listing.Expires, &listing.Bumped)
+}
+
+// Renew pushes the expiry of a published listing back to ListingLifetime
+// from now, bringing it back if it had expired
+func (listing *Listing) Renew(db *sql.DB) error {
+	return inTransaction(db, func(tx *sql.Tx) error {
+		if err := lockListingForRenewal(tx, listing); err != nil {
+			return err
+		}
+		if err := checkRenew(listing); err != nil {
+			return err
+		}
+
+		expires := time.Now().Add(ListingLifetime)
+		_, err := tx.Exec("UPDATE listings SET expires = $1, "+
+			"expiry_reminded = false, modified = now() WHERE id = $2", expires,
+			listing.ID)
+		if err != nil {
+			return err
+		}
+		listing.Expires = &expires
+		return nil
+	})
+}
+
+// Bump moves a listing back to the top of the listing feed. Listings can
+// be bumped once every ListingBumpInterval
+func (listing *Listing) Bump(db *sql.DB) error {
+	return inTransaction(db, func(tx *sql.Tx) error {
+		if err := lockListingForRenewal(tx, listing); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := checkBump(listing, now); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec("UPDATE listings SET bumped = $1 WHERE id = $2", now,
+			listing.ID)
+		if err != nil {
+			return err
+		}
+		listing.Bumped = now
+		return nil
+	})
+}
+
+// RemindExpiringListings finds the published listings still for sale which
+// expire within ListingReminderWindow of now, and whose sellers haven't been
+// reminded yet. They are marked as reminded, and returned with the names and email
+// addresses of their sellers
+func RemindExpiringListings(db *sql.DB, now time.Time) ([]Listing, error) {
+	rows, err := db.Query("UPDATE listings l SET expiry_reminded = true FROM "+
+		"users u WHERE u.id = l.user_id AND l.published AND l.status = $1 AND "+
+		"NOT l.expiry_reminded AND l.expires <= $2 RETURNING l.id, l.name, "+
+		"l.expires, u.id, u.username, u.display_name, u.email_address",
+		ListingListed, now.Add(ListingReminderWindow))
+	if err != nil {
+		fmt.Println("[ERROR] models.RemindExpiringListings: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	listings := make([]Listing, 0, 10)
+	for rows.Next() {
+		var listing Listing
+		err := rows.Scan(&listing.ID, &listing.Name, &listing.Expires,
+			&listing.User.ID, &listing.User.Username, &listing.User.DisplayName,
+			&listing.User.EmailAddress)
+		if err != nil {
+			return nil, err
+		}
+		listing.Published = true
+		listings = append(listings, listing)
+	}
+	return listings, rows.Err()
+}
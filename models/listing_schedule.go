@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaxListingScheduleDays is how far ahead a draft can be scheduled to be
+// published
+const MaxListingScheduleDays = 60
+
+// IsScheduled returns whether a listing is a draft waiting to be published
+// automatically
+func (listing Listing) IsScheduled() bool {
+	return !listing.Published && listing.PublishAt != nil
+}
+
+// PublishScheduledListings publishes the drafts scheduled to be published
+// by now, giving them a fresh expiry and moving them to the top of the
+// listing feed. Their search index entries are rebuilt before they are
+// returned with the email addresses of their sellers
+func PublishScheduledListings(db *sql.DB, now time.Time) ([]Listing, error) {
+	ids, err := queryListingIDs(db, "UPDATE listings SET published = true, "+
+		"publish_at = NULL, expires = $2, expiry_reminded = false, bumped = "+
+		"now(), modified = now() WHERE NOT published AND publish_at <= $1 "+
+		"RETURNING id", now, now.Add(ListingLifetime))
+	if err != nil {
+		fmt.Println("[ERROR] models.PublishScheduledListings: " + err.Error())
+		return nil, err
+	}
+
+	listings := make([]Listing, 0, len(ids))
+	for _, id := range ids {
+		listing, err := GetListingByID(db, id)
+		if err != nil || listing == nil {
+			fmt.Println("[ERROR] models.PublishScheduledListings: failed to " +
+				"load listing " + strconv.Itoa(id))
+			continue
+		}
+		// The listing is already published, so a failure here is left for
+		// RebuildStaleSearchIndex to pick up on the next start
+		if _, err := listing.DoRebuildSearchIndex(db); err != nil {
+			fmt.Println("[ERROR] models.PublishScheduledListings: listing " +
+				strconv.Itoa(id) + ": " + err.Error())
+		}
+		listings = append(listings, *listing)
+	}
+	return listings, nil
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+const (
+	// MeetupProposed is for a meetup waiting on an answer from the other
+	// party to the offer
+	MeetupProposed = "proposed"
+	// MeetupAccepted is for a meetup both parties agreed to
+	MeetupAccepted = "accepted"
+	// MeetupDeclined is for a meetup turned down by the other party. Either
+	// party can propose a new one
+	MeetupDeclined = "declined"
+)
+
+// MeetupLength is how long a meetup is shown as taking in calendars
+const MeetupLength = 30 * time.Minute
+
+// MaxMeetupDays is the furthest ahead a meetup can be proposed
+const MaxMeetupDays = 60
+
+// ErrMeetupStatus is returned when a meetup can't be answered, such as when
+// it has already been answered, or the user answering it proposed it
+var ErrMeetupStatus = errors.New("The meetup can't be answered")
+
+// Meetup is a time and place the buyer and seller under an accepted offer
+// plan to meet to hand over the listing. An offer has at most one meetup;
+// proposing another one reschedules it
+type Meetup struct {
+	ID       int       `json:"id"`
+	OfferID  int       `json:"offer_id"`
+	Proposer User      `json:"proposer"`
+	Time     time.Time `json:"time"`
+	Location string    `json:"location"`
+	Status   string    `json:"status"`
+	// Sequence counts the times the meetup was rescheduled or answered
+	Sequence int       `json:"sequence"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+}
+
+// MeetupError contains descriptions of validation errors that may exist in
+// a meetup
+type MeetupError struct {
+	Time     string `json:"time"`
+	Location string `json:"location"`
+	Global   string `json:"global"`
+}
+
+// Validate checks if the fields of a meetup are valid
+func (m *Meetup) Validate() (bool, MeetupError) {
+	err := MeetupError{}
+	valid := true
+	now := time.Now()
+	if m.Time.IsZero() {
+		err.Time = "A meetup needs a time."
+		valid = false
+	} else if m.Time.Before(now) {
+		err.Time = "A meetup can't be in the past."
+		valid = false
+	} else if m.Time.After(now.AddDate(0, 0, MaxMeetupDays)) {
+		err.Time = "A meetup can't be more than " + strconv.Itoa(MaxMeetupDays) +
+			" days away."
+		valid = false
+	}
+	if len(m.Location) == 0 {
+		err.Location = "A meetup needs a place to meet."
+		valid = false
+	} else if len(m.Location) > 200 {
+		err.Location = "A place to meet can't be longer than 200 characters."
+		valid = false
+	}
+	return valid, err
+}
+
+// Propose saves a meetup for an offer, replacing any meetup the offer
+// already had and waiting on an answer from the other party
+func (m *Meetup) Propose(db *sql.DB) (bool, *MeetupError) {
+	valid, validationError := m.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	m.Status = MeetupProposed
+	err := db.QueryRow("INSERT INTO meetups (offer_id, proposer_id, "+
+		"meets_at, location, status) VALUES ($1, $2, $3, $4, $5) "+
+		"ON CONFLICT (offer_id) DO UPDATE SET proposer_id = $2, meets_at = $3, "+
+		"location = $4, status = $5, sequence = meetups.sequence + 1, "+
+		"modified = now() RETURNING id, sequence, created, modified",
+		m.OfferID, m.Proposer.ID, m.Time, m.Location, m.Status).Scan(&m.ID,
+		&m.Sequence, &m.Created, &m.Modified)
+	if err != nil {
+		fmt.Println("[ERROR] models.Meetup.Propose: " + err.Error())
+		return false, &MeetupError{Global: "An unexpected error occurred."}
+	}
+	return true, nil
+}
+
+// Answer accepts or declines a proposed meetup for user, who can't be the
+// one who proposed it. It fails with ErrMeetupStatus if the meetup can't be
+// answered by user
+func (m *Meetup) Answer(db *sql.DB, user *User, status string) error {
+	if status != MeetupAccepted && status != MeetupDeclined {
+		return ErrMeetupStatus
+	}
+	err := db.QueryRow("UPDATE meetups SET status = $1, sequence = sequence + "+
+		"1, modified = now() WHERE id = $2 AND status = $3 AND proposer_id <> "+
+		"$4 RETURNING sequence, modified", status, m.ID, MeetupProposed,
+		user.ID).Scan(&m.Sequence, &m.Modified)
+	if err == sql.ErrNoRows {
+		return ErrMeetupStatus
+	} else if err != nil {
+		fmt.Println("[ERROR] models.Meetup.Answer: " + err.Error())
+		return err
+	}
+	m.Status = status
+	return nil
+}
+
+// GetMeetupForOffer gets the meetup for an offer, or nil if nobody has
+// proposed one yet
+func GetMeetupForOffer(db *sql.DB, offerID int) (*Meetup, error) {
+	m := Meetup{}
+	err := db.QueryRow("SELECT m.id, m.offer_id, m.proposer_id, u.username, "+
+		"u.display_name, m.meets_at, m.location, m.status, m.sequence, "+
+		"m.created, m.modified FROM meetups m, users u WHERE m.proposer_id = "+
+		"u.id AND m.offer_id = $1", offerID).Scan(&m.ID, &m.OfferID,
+		&m.Proposer.ID, &m.Proposer.Username, &m.Proposer.DisplayName, &m.Time,
+		&m.Location, &m.Status, &m.Sequence, &m.Created, &m.Modified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		fmt.Println("[ERROR] models.GetMeetupForOffer: " + err.Error())
+		return nil, err
+	}
+	return &m, nil
+}
+
+// CalendarEvent gets a meetup as an event which can be added to a calendar.
+// The UID stays the same when a meetup is rescheduled, and the sequence
+// goes up, so calendars update the event instead of adding another one
+func (m *Meetup) CalendarEvent(listingName, url string) utils.CalendarEvent {
+	return utils.CalendarEvent{
+		UID:      "meetup-" + strconv.Itoa(m.OfferID) + "@calagora.com",
+		Sequence: m.Sequence,
+		Start:    m.Time,
+		End:      m.Time.Add(MeetupLength),
+		Summary:  "Calagora meetup: " + listingName,
+		Location: m.Location,
+		Description: "Meeting to hand over " + listingName + ", arranged " +
+			"on Calagora.",
+		URL: url,
+	}
+}
@@ -2,43 +2,80 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/anishmgoyal/calagora/utils"
 )
 
 const (
-	// OfferOffered is for an offer not yet accepted
+	// OfferOffered is for an offer waiting on an answer from the seller
 	OfferOffered = "offered"
+	// OfferCountered is for an offer waiting on an answer from the buyer to
+	// a counter offer
+	OfferCountered = "countered"
 	// OfferAccepted is for an offer accepted by a seller
 	OfferAccepted = "accepted"
 	// OfferCompleted is for an offer accepted and completed by a seller
 	OfferCompleted = "completed"
+	// OfferDeclined is for an offer turned down by the seller, or closed
+	// when the listing was sold to someone else
+	OfferDeclined = "declined"
+	// OfferWithdrawn is for an offer taken back by the buyer
+	OfferWithdrawn = "withdrawn"
+	// OfferExpired is for an offer which went unanswered for too long
+	OfferExpired = "expired"
 )
 
 var offerStatuses = map[string]bool{
 	OfferOffered:   true,
+	OfferCountered: true,
 	OfferAccepted:  true,
 	OfferCompleted: true,
+	OfferDeclined:  true,
+	OfferWithdrawn: true,
+	OfferExpired:   true,
 }
 
-// Offer is a type for price offers a person may give to a seller
+var (
+	// ErrListingSold is returned when changing an offer on a listing which
+	// has already been sold
+	ErrListingSold = errors.New("The listing has already been sold")
+	// ErrOfferStatus is returned when an offer can't be changed from its
+	// current status, such as when accepting a completed offer
+	ErrOfferStatus = errors.New("The offer can't be changed from its status")
+	// ErrListingHeld is returned when changing an offer on a listing which
+	// the seller is holding for another buyer
+	ErrListingHeld = errors.New("The listing is on hold for another buyer")
+)
+
+// Offer is a type for price offers a person may give to a seller. A bundle
+// is a single offer on several listings from the same seller, which are
+// sold together. Listing is the one the bundle was started from, and
+// Bundle, when loaded, holds every listing the bundle covers
 type Offer struct {
-	ID            int       `json:"id"`
-	Price         int       `json:"price_server"`
-	PriceClient   string    `json:"price"`
-	Counter       int       `json:"counter_server"`
-	CounterClient string    `json:"counter"`
-	IsCountered   bool      `json:"is_countered"`
-	BuyerComment  string    `json:"buyer_comment"`
-	SellerComment string    `json:"seller_comment"`
-	Status        string    `json:"status"`
-	UnreadCount   int       `json:"unread_count"`
-	Listing       Listing   `json:"listing"`
-	Buyer         User      `json:"buyer"`
-	Seller        User      `json:"seller"`
-	Created       time.Time `json:"created"`
-	Modified      time.Time `json:"modified"`
+	ID            int          `json:"id"`
+	Price         int          `json:"price_server"`
+	PriceClient   string       `json:"price"`
+	Counter       int          `json:"counter_server"`
+	CounterClient string       `json:"counter"`
+	IsCountered   bool         `json:"is_countered"`
+	BuyerComment  string       `json:"buyer_comment"`
+	SellerComment string       `json:"seller_comment"`
+	Status        string       `json:"status"`
+	UnreadCount   int          `json:"unread_count"`
+	Listing       Listing      `json:"listing"`
+	Buyer         User         `json:"buyer"`
+	Seller        User         `json:"seller"`
+	History       []OfferEvent `json:"history,omitempty"`
+	Expires       *time.Time   `json:"expires,omitempty"`
+	Holding       bool         `json:"holding"`
+	IsBundle      bool         `json:"is_bundle"`
+	Bundle        []Listing    `json:"bundle,omitempty"`
+	Created       time.Time    `json:"created"`
+	Modified      time.Time    `json:"modified"`
 }
 
 // OfferError contains descriptions of validation errors that may exist in
@@ -49,9 +86,29 @@ type OfferError struct {
 	BuyerComment  string `json:"buyer_comment"`
 	SellerComment string `json:"seller_comment"`
 	Status        string `json:"status"`
+	Expires       string `json:"expires"`
+	Bundle        string `json:"bundle"`
 	Global        string `json:"global"`
 }
 
+// MaxOfferExpiryDays is the longest an offer or counter offer can be left
+// open for before it expires
+const MaxOfferExpiryDays = 14
+
+// MaxListingHoldDays is the longest a seller can hold a listing for a buyer
+// whose offer they accepted
+const MaxListingHoldDays = 7
+
+// OfferExpiry gets the time an offer left open for a number of days
+// expires, or nil if days is 0 and the offer doesn't expire
+func OfferExpiry(days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+	expires := time.Now().AddDate(0, 0, days)
+	return &expires
+}
+
 // Validate checks if the fields of an offer object are valid
 func (o *Offer) Validate() (bool, OfferError) {
 	err := OfferError{}
@@ -78,69 +135,430 @@ func (o *Offer) Validate() (bool, OfferError) {
 		err.Status = "The offer status is invalid"
 		valid = false
 	}
+	if o.Expires != nil {
+		now := time.Now()
+		if !o.Expires.After(now) ||
+			o.Expires.After(now.AddDate(0, 0, MaxOfferExpiryDays)) {
+
+			err.Expires = "An offer can be left open for at most " +
+				strconv.Itoa(MaxOfferExpiryDays) + " days."
+			valid = false
+		}
+	}
 	return valid, err
 }
 
-// Create inserts an offer into the database
+// offerPrices sets the prices shown to users for an offer
+func offerPrices(offer *Offer) {
+	offer.PriceClient = utils.PriceServerToClient(offer.Price)
+	if offer.IsCountered {
+		offer.CounterClient = utils.PriceServerToClient(offer.Counter)
+	}
+}
+
+// offerError describes an error from changing an offer in a way that can
+// be shown to the user who tried to change it
+func offerError(err error, caller string) *OfferError {
+	switch err {
+	case ErrListingSold:
+		return &OfferError{Global: "This listing has already been sold."}
+	case ErrOfferStatus:
+		return &OfferError{Global: "This offer can no longer be changed."}
+	case ErrListingHeld:
+		return &OfferError{Global: "This listing is on hold for another " +
+			"buyer."}
+	case ErrListingExpired:
+		return &OfferError{Global: "This listing has expired."}
+	case ErrBundleListing:
+		return &OfferError{Bundle: "Every listing in a bundle must be for " +
+			"sale by the same seller."}
+	}
+	fmt.Println("[ERROR] " + caller + ": " + err.Error())
+	return &OfferError{Global: "An unexpected error occurred."}
+}
+
+// Create inserts an offer into the database, starting its history with the
+// buyer's price. If Bundle is set, the offer is a bundle covering Listing
+// and every listing in Bundle
 func (o *Offer) Create(db *sql.DB) (bool, *OfferError) {
+	if valid, validationError := o.prepare(); !valid {
+		return valid, &validationError
+	}
+
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		return o.insert(tx)
+	})
+	if err != nil {
+		return false, offerError(err, "models.Offer.Create")
+	}
+
+	return true, nil
+}
 
-	o.Status = OfferOffered
+// prepare sets the status of a new offer and checks that it is valid
+func (o *Offer) prepare() (bool, OfferError) {
+	o.Status, _ = nextOfferStatus("", OfferActionOffer)
+	o.IsBundle = len(o.Bundle) > 0
 
 	valid, validationError := o.Validate()
-	if !valid {
-		return valid, &validationError
+	if valid && o.IsBundle {
+		valid, validationError = o.validateBundle()
 	}
+	return valid, validationError
+}
 
-	rows, err := db.Query("INSERT INTO offers (price, counter, buyer_comment, "+
-		"seller_comment, status, listing_id, buyer_id, seller_id) VALUES "+
-		"($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id", o.Price, o.Counter,
-		o.BuyerComment, o.SellerComment, o.Status, o.Listing.ID, o.Buyer.ID,
-		o.Seller.ID)
+// insert saves a prepared offer in a transaction, as long as every listing
+// it is on is still open
+func (o *Offer) insert(tx *sql.Tx) error {
+	price := o.Price
+	ids := o.bundleListingIDs()
+	listings, err := lockListings(tx, ids)
 	if err != nil {
-		return false, &OfferError{Global: "An unexpected error occurred."}
+		return err
 	}
-	defer rows.Close()
+	if err := checkListingsOpen(listings); err != nil {
+		return err
+	}
+	for _, listing := range listings {
+		if o.IsBundle &&
+			(listing.User.ID != o.Seller.ID || !listing.Published) {
 
-	if rows.Next() {
-		rows.Scan(&o.ID)
-	} else {
-		// The offer was created... but we don't have its ID
-		return false, &OfferError{Global: "An unexpected error occurred."}
+			return ErrBundleListing
+		}
 	}
 
-	return true, nil
+	err = tx.QueryRow("INSERT INTO offers (price, counter, buyer_comment, "+
+		"seller_comment, status, listing_id, buyer_id, seller_id, expires, "+
+		"bundle) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) "+
+		"RETURNING id", o.Price, o.Counter, o.BuyerComment, o.SellerComment,
+		o.Status, o.Listing.ID, o.Buyer.ID, o.Seller.ID, o.Expires,
+		o.IsBundle).Scan(&o.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; o.IsBundle && i < len(ids); i++ {
+		_, err = tx.Exec("INSERT INTO offer_bundle_listings (offer_id, "+
+			"listing_id) VALUES ($1, $2)", o.ID, ids[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return recordOfferEvent(tx, &OfferEvent{
+		OfferID: o.ID,
+		Action:  OfferActionOffer,
+		Status:  o.Status,
+		Price:   &price,
+		Comment: o.BuyerComment,
+	})
+}
+
+// Revise saves a new price from the buyer of an offer, taken from Price and
+// BuyerComment, which stands until Expires
+func (o *Offer) Revise(db *sql.DB) (bool, *OfferError) {
+	return o.propose(db, OfferActionOffer, o.Price, o.BuyerComment,
+		"price = $1, buyer_comment = $2", "models.Offer.Revise")
 }
 
-// Save saves changes made to an offer
-func (o *Offer) Save(db *sql.DB) (bool, *OfferError) {
+// CounterOffer saves a new price from the seller of an offer, taken from
+// Counter and SellerComment, which stands until Expires
+func (o *Offer) CounterOffer(db *sql.DB) (bool, *OfferError) {
+	o.IsCountered = true
+	return o.propose(db, OfferActionCounter, o.Counter, o.SellerComment,
+		"counter = $1, seller_comment = $2, is_countered = true",
+		"models.Offer.CounterOffer")
+}
+
+// propose takes an action which puts a new price on an offer. columns sets
+// the price and comment from $1 and $2
+func (o *Offer) propose(db *sql.DB, action string, price int,
+	comment, columns, caller string) (bool, *OfferError) {
 
 	valid, validationError := o.Validate()
 	if !valid {
 		return valid, &validationError
 	}
 
-	res, err := db.Exec("UPDATE offers SET price = $1, counter = $2, "+
-		"is_countered = $3, buyer_comment = $4, seller_comment = $5, "+
-		"status = $6, modified = now() WHERE id = $7", o.Price, o.Counter,
-		o.IsCountered, o.BuyerComment, o.SellerComment, o.Status, o.ID)
+	event := OfferEvent{Action: action, Price: &price, Comment: comment}
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		listings, err := lockOfferListings(tx, o)
+		if err != nil {
+			return err
+		}
+		if err := checkListingsOpen(listings); err != nil {
+			return err
+		}
+
+		if err := transitionOffer(tx, o.ID, &event); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE offers SET "+columns+", expires = $3 WHERE "+
+			"id = $4", price, comment, o.Expires, o.ID)
+		return err
+	})
+	if err != nil {
+		return false, offerError(err, caller)
+	}
+	o.Status = event.Status
+	return true, nil
+}
+
+// Decline turns an offer down on behalf of its seller
+func (o *Offer) Decline(db *sql.DB) error {
+	return o.close(db, OfferActionDecline, "models.Offer.Decline")
+}
+
+// Withdraw takes an offer back on behalf of its buyer
+func (o *Offer) Withdraw(db *sql.DB) error {
+	return o.close(db, OfferActionWithdraw, "models.Offer.Withdraw")
+}
+
+// close takes an action which ends negotiation on an offer
+func (o *Offer) close(db *sql.DB, action, caller string) error {
+	event := OfferEvent{Action: action}
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		if _, err := lockOfferListings(tx, o); err != nil {
+			return err
+		}
+		if err := transitionOffer(tx, o.ID, &event); err != nil {
+			return err
+		}
+		return releaseListingHold(tx, o)
+	})
+	if err != nil {
+		if err != ErrOfferStatus {
+			fmt.Println("[ERROR] " + caller + ": " + err.Error())
+		}
+		return err
+	}
+	o.Status = event.Status
+	o.Holding = false
+	return nil
+}
+
+// Accept marks an offer as accepted by the seller, as long as the offer is
+// still open and none of its listings have been sold or held for another
+// buyer. The deal lapses at Expires if it hasn't been finalized by then. If
+// Holding is set, the listings are held for the buyer until then, taking
+// them out of listings and search
+func (o *Offer) Accept(db *sql.DB) error {
+	if o.Holding && o.Expires == nil {
+		return ErrOfferStatus
+	}
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		listings, err := lockOfferListings(tx, o)
+		if err != nil {
+			return err
+		}
+		if err := checkListingsOpen(listings); err != nil {
+			return err
+		}
+		err = transitionOffer(tx, o.ID, &OfferEvent{Action: OfferActionAccept})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE offers SET expires = $1, holding = $2 WHERE "+
+			"id = $3", o.Expires, o.Holding, o.ID)
+		if err != nil || !o.Holding {
+			return err
+		}
+		for _, listing := range listings {
+			_, err = tx.Exec("UPDATE listings SET status = $1, modified = now() "+
+				"WHERE id = $2", ListingTransaction, listing.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if err != ErrListingSold && err != ErrListingHeld &&
+			err != ErrListingExpired && err != ErrOfferStatus {
+
+			fmt.Println("[ERROR] models.Offer.Accept: " + err.Error())
+		}
+		return err
+	}
+	o.Status = OfferAccepted
+	if o.Holding {
+		o.Listing.Status = ListingTransaction
+	}
+	return nil
+}
+
+// checkListingOpen checks that offers on a listing with status can still be
+// made and answered
+func checkListingOpen(status string) error {
+	switch status {
+	case ListingSold:
+		return ErrListingSold
+	case ListingTransaction:
+		return ErrListingHeld
+	}
+	return nil
+}
+
+// releaseListingHold puts an offer's listings back on the market if they
+// were being held for the offer's buyer. The listings must be locked by the
+// caller
+func releaseListingHold(tx *sql.Tx, o *Offer) error {
+	res, err := tx.Exec("UPDATE offers SET holding = false WHERE id = $1 AND "+
+		"holding", o.ID)
+	if err != nil {
+		return err
+	}
+	if num, err := res.RowsAffected(); err != nil || num == 0 {
+		return err
+	}
+	ids, err := offerListingIDs(tx, o)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		_, err = tx.Exec("UPDATE listings SET status = $1, modified = now() "+
+			"WHERE id = $2 AND status = $3", ListingListed, id,
+			ListingTransaction)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finalize completes an offer and marks its listings sold in a single
+// transaction. Every other open offer on any of the listings is declined,
+// and returned so that their buyers can be told the listing was sold. A
+// listing on hold can only be sold under the offer it is held for
+func (o *Offer) Finalize(db *sql.DB) ([]Offer, error) {
+	closed := make([]Offer, 0, 10)
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		listings, err := lockOfferListings(tx, o)
+		if err != nil {
+			return err
+		}
+		for _, listing := range listings {
+			if listing.Status == ListingSold {
+				return ErrListingSold
+			}
+		}
+
+		for _, listing := range listings {
+			if listing.Status != ListingTransaction {
+				continue
+			}
+			// Only the buyer the listing is held for can buy it
+			var held int
+			err = tx.QueryRow("SELECT count(1) FROM offers o WHERE "+
+				offersOnListing+" AND o.holding AND o.id <> $2", listing.ID,
+				o.ID).Scan(&held)
+			if err != nil {
+				return err
+			}
+			if held > 0 {
+				return ErrListingHeld
+			}
+		}
+
+		err = transitionOffer(tx, o.ID, &OfferEvent{Action: OfferActionComplete})
+		if err != nil {
+			return err
+		}
+		if err := releaseListingHold(tx, o); err != nil {
+			return err
+		}
+
+		for _, listing := range listings {
+			_, err = tx.Exec("UPDATE listings SET status = $1, modified = now() "+
+				"WHERE id = $2", ListingSold, listing.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		others, err := scanOtherOffers(tx, o, listings)
+		if err != nil {
+			return err
+		}
+		for _, offer := range others {
+			if !offer.Can(OfferActionDecline) {
+				continue
+			}
+			event := OfferEvent{Action: OfferActionDecline}
+			if err := transitionOffer(tx, offer.ID, &event); err != nil {
+				return err
+			}
+			offer.Status = event.Status
+			offerPrices(&offer)
+			closed = append(closed, offer)
+		}
+		return nil
+	})
 	if err != nil {
-		return false, &OfferError{Global: "An unexpected error occurred"}
+		if err != ErrListingSold && err != ErrListingHeld &&
+			err != ErrOfferStatus {
+
+			fmt.Println("[ERROR] models.Offer.Finalize: " + err.Error())
+		}
+		return nil, err
 	}
-	numAffected, _ := res.RowsAffected()
-	return numAffected == 1, nil
+	o.Status = OfferCompleted
+	o.Holding = false
+	o.Listing.Status = ListingSold
+	return closed, nil
 }
 
-// Delete removes an offer from the database
-func (o *Offer) Delete(db *sql.DB) bool {
-	res, err := db.Exec("DELETE FROM offers WHERE id = $1", o.ID)
+// scanOtherOffers gets the other offers on any of the listings of an
+// offer, each once. Listing is set to the one the other offer shares with
+// the offer, so that its buyer can be told which one was sold
+func scanOtherOffers(tx *sql.Tx, o *Offer, listings []Listing) ([]Offer,
+	error) {
+
+	offers := make([]Offer, 0, 10)
+	seen := make(map[int]bool)
+	for _, listing := range listings {
+		found, err := scanListingOffers(tx, listing.ID, o.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, offer := range found {
+			if !seen[offer.ID] {
+				seen[offer.ID] = true
+				offers = append(offers, offer)
+			}
+		}
+	}
+	return offers, nil
+}
+
+// scanListingOffers gets the offers on a listing other than the one with
+// skipID. The rows are read in full, so that the transaction can be used
+// again
+func scanListingOffers(tx *sql.Tx, listingID, skipID int) ([]Offer, error) {
+	rows, err := tx.Query("SELECT o.id, o.price, o.counter, o.is_countered, "+
+		"o.status, o.buyer_id, o.seller_id, o.bundle FROM offers o WHERE "+
+		offersOnListing+" AND o.id <> $2 ORDER BY o.id ASC", listingID, skipID)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := make([]Offer, 0, 10)
+	for rows.Next() {
+		offer := Offer{Listing: Listing{ID: listingID}}
+		err = rows.Scan(&offer.ID, &offer.Price, &offer.Counter,
+			&offer.IsCountered, &offer.Status, &offer.Buyer.ID, &offer.Seller.ID,
+			&offer.IsBundle)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, offer)
 	}
-	numAffected, _ := res.RowsAffected()
-	return numAffected == 1
+	return offers, rows.Err()
 }
 
-// GetOffers attaches a method to listings which gets all offers for a listing
+// GetOffers attaches a method to listings which gets all offers for a
+// listing, including bundles which cover it
 func (l *Listing) GetOffers(db *sql.DB, pageNum, pageSize int) (
 	[]Offer, error) {
 
@@ -150,8 +568,9 @@ func (l *Listing) GetOffers(db *sql.DB, pageNum, pageSize int) (
 	rows, err := db.Query("SELECT o.id, o.price, o.counter, o.is_countered, "+
 		"o.buyer_comment, o.seller_comment, o.status, o.listing_id, o.buyer_id, "+
 		"b.username, b.display_name, o.seller_id, s.username, s.display_name, "+
-		"o.created, o.modified FROM offers o, users b, users s WHERE "+
-		"o.buyer_id = b.id AND o.seller_id = s.id AND listing_id = $1 "+
+		"o.expires, o.holding, o.bundle, o.created, o.modified FROM offers o, "+
+		"users b, users s WHERE "+
+		"o.buyer_id = b.id AND o.seller_id = s.id AND "+offersOnListing+" "+
 		"LIMIT $2 OFFSET $3", l.ID, pageSize, pageNum*pageSize)
 	if err != nil {
 		return offers[:0], err
@@ -164,7 +583,8 @@ func (l *Listing) GetOffers(db *sql.DB, pageNum, pageSize int) (
 			&offer.BuyerComment, &offer.SellerComment, &offer.Status,
 			&offer.Listing.ID, &offer.Buyer.ID, &offer.Buyer.Username,
 			&offer.Buyer.DisplayName, &offer.Seller.ID, &offer.Seller.Username,
-			&offer.Seller.DisplayName, &offer.Created, &offer.Modified)
+			&offer.Seller.DisplayName, &offer.Expires, &offer.Holding,
+			&offer.IsBundle, &offer.Created, &offer.Modified)
 		if err == nil {
 			offer.PriceClient = utils.PriceServerToClient(offer.Price)
 			if offer.IsCountered {
@@ -182,13 +602,14 @@ func (l *Listing) GetOffers(db *sql.DB, pageNum, pageSize int) (
 // from a database to help with edits made to an offer
 func GetOfferByID(db *sql.DB, id int) (*Offer, error) {
 	row := db.QueryRow("SELECT id, price, counter, is_countered, buyer_comment, "+
-		"seller_comment, status, listing_id, buyer_id, seller_id, created, "+
-		"modified FROM offers WHERE id = $1", id)
+		"seller_comment, status, listing_id, buyer_id, seller_id, expires, "+
+		"holding, bundle, created, modified FROM offers WHERE id = $1", id)
 
 	var offer Offer
 	err := row.Scan(&offer.ID, &offer.Price, &offer.Counter, &offer.IsCountered,
 		&offer.BuyerComment, &offer.SellerComment, &offer.Status, &offer.Listing.ID,
-		&offer.Buyer.ID, &offer.Seller.ID, &offer.Created, &offer.Modified)
+		&offer.Buyer.ID, &offer.Seller.ID, &offer.Expires, &offer.Holding,
+		&offer.IsBundle, &offer.Created, &offer.Modified)
 	if err != nil {
 		return nil, err
 	}
@@ -210,8 +631,8 @@ func (u *User) GetOffersAsSeller(db *sql.DB, pageNum, pageSize int) (
 
 	rows, err := db.Query("SELECT o.id, o.price, o.counter, o.is_countered, "+
 		"o.buyer_comment, o.seller_comment, o.status, o.listing_id, l.name, "+
-		"o.buyer_id, b.username, b.display_name, o.created, o.modified FROM "+
-		"offers o, users b, listings l WHERE o.buyer_id = b.id AND "+
+		"o.buyer_id, b.username, b.display_name, o.expires, o.holding, "+
+		"o.bundle, o.created, o.modified FROM offers o, users b, listings l WHERE o.buyer_id = b.id AND "+
 		"o.listing_id = l.id AND o.seller_id = $1 ORDER BY modified DESC "+
 		"LIMIT $2 OFFSET $3", u.ID, pageSize, pageNum*pageSize)
 	if err != nil {
@@ -224,8 +645,8 @@ func (u *User) GetOffersAsSeller(db *sql.DB, pageNum, pageSize int) (
 		err = rows.Scan(&offer.ID, &offer.Price, &offer.Counter, &offer.IsCountered,
 			&offer.BuyerComment, &offer.SellerComment, &offer.Status,
 			&offer.Listing.ID, &offer.Listing.Name, &offer.Buyer.ID,
-			&offer.Buyer.Username, &offer.Buyer.DisplayName, &offer.Created,
-			&offer.Modified)
+			&offer.Buyer.Username, &offer.Buyer.DisplayName, &offer.Expires,
+			&offer.Holding, &offer.IsBundle, &offer.Created, &offer.Modified)
 
 		if err == nil {
 			offer.PriceClient = utils.PriceServerToClient(offer.Price)
@@ -248,8 +669,8 @@ func (u *User) GetOffersAsBuyer(db *sql.DB) ([]Offer, error) {
 
 	rows, err := db.Query("SELECT o.id, o.price, o.counter, o.is_countered, "+
 		"o.buyer_comment, o.seller_comment, o.status, o.listing_id, l.name, "+
-		"l.price, i.url, o.seller_id, s.username, s.display_name, o.created, "+
-		"o.modified FROM offers o JOIN users s ON o.seller_id = s.id JOIN "+
+		"l.price, i.url, o.seller_id, s.username, s.display_name, o.expires, "+
+		"o.holding, o.bundle, o.created, o.modified FROM offers o JOIN users s ON o.seller_id = s.id JOIN "+
 		"listings l ON o.listing_id = l.id LEFT JOIN images i ON i.media_id = "+
 		"o.listing_id WHERE (i.id = (SELECT id FROM images WHERE media='"+
 		MediaListing+"' AND media_id = o.listing_id ORDER BY ordinal ASC LIMIT 1)"+
@@ -265,7 +686,8 @@ func (u *User) GetOffersAsBuyer(db *sql.DB) ([]Offer, error) {
 			&offer.BuyerComment, &offer.SellerComment, &offer.Status,
 			&offer.Listing.ID, &offer.Listing.Name, &offer.Listing.Price,
 			&offer.Listing.ImageURL, &offer.Seller.ID, &offer.Seller.Username,
-			&offer.Seller.DisplayName, &offer.Created, &offer.Modified)
+			&offer.Seller.DisplayName, &offer.Expires, &offer.Holding,
+			&offer.IsBundle, &offer.Created, &offer.Modified)
 
 		if err == nil {
 			offer.PriceClient = utils.PriceServerToClient(offer.Price)
@@ -285,20 +707,22 @@ func (u *User) GetOffersAsBuyer(db *sql.DB) ([]Offer, error) {
 }
 
 // GetOfferOnListing attempts to get an offer that a user has made on a
-// listing
+// listing by itself, leaving out bundles
 func (u *User) GetOfferOnListing(db *sql.DB, id int) (*Offer, error) {
 	var offer Offer
 
 	row := db.QueryRow("SELECT o.id, o.price, o.counter, o.is_countered, "+
 		"o.buyer_comment, o.seller_comment, o.status, o.listing_id, o.seller_id, "+
-		"s.username, s.display_name, o.created, o.modified FROM offers o, users s "+
-		"WHERE o.seller_id = s.id AND o.buyer_id = $1 AND o.listing_id = $2",
+		"s.username, s.display_name, o.expires, o.holding, o.created, "+
+		"o.modified FROM "+
+		"offers o, users s WHERE o.seller_id = s.id AND o.buyer_id = $1 AND "+
+		"o.listing_id = $2 AND NOT o.bundle",
 		u.ID, id)
 
 	err := row.Scan(&offer.ID, &offer.Price, &offer.Counter, &offer.IsCountered,
 		&offer.BuyerComment, &offer.SellerComment, &offer.Status, &offer.Listing.ID,
 		&offer.Seller.ID, &offer.Seller.Username, &offer.Seller.DisplayName,
-		&offer.Created, &offer.Modified)
+		&offer.Expires, &offer.Holding, &offer.Created, &offer.Modified)
 	if err != nil {
 		return nil, err
 	}
@@ -317,7 +741,7 @@ func (u *User) GetConversationsForUser(db *sql.DB) ([]Offer, error) {
 
 	rows, err := db.Query("SELECT o.id, o.price, o.counter, "+
 		"o.is_countered, o.listing_id, l.name, o.seller_id, s.username, "+
-		"s.display_name, o.buyer_id, b.username, b.display_name, "+
+		"s.display_name, o.buyer_id, b.username, b.display_name, o.bundle, "+
 		"(SELECT count(1) FROM messages WHERE offer_id = o.id AND "+
 		"recepient_id = $1 AND seen = false) unread_count FROM offers o, "+
 		"users b, users s, listings l WHERE o.listing_id = l.id AND "+
@@ -334,7 +758,7 @@ func (u *User) GetConversationsForUser(db *sql.DB) ([]Offer, error) {
 			&offer.IsCountered, &offer.Listing.ID, &offer.Listing.Name,
 			&offer.Seller.ID, &offer.Seller.Username, &offer.Seller.DisplayName,
 			&offer.Buyer.ID, &offer.Buyer.Username, &offer.Buyer.DisplayName,
-			&offer.UnreadCount)
+			&offer.IsBundle, &offer.UnreadCount)
 		if err != nil {
 			continue
 		} else {
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// MaxBundleListings is the most listings a single bundle offer can cover
+const MaxBundleListings = 10
+
+// ErrBundleListing is returned when a bundle offer includes a listing which
+// isn't published by the bundle's seller
+var ErrBundleListing = errors.New("The listing can't be part of the bundle")
+
+// offersOnListing is a condition on offers o matching every offer on the
+// listing $1, including bundles which cover it
+const offersOnListing = "(o.listing_id = $1 OR o.id IN (SELECT offer_id " +
+	"FROM offer_bundle_listings WHERE listing_id = $1))"
+
+// bundleListingIDs gets the IDs of the listings a new offer is on, sorted
+// and without duplicates. A bundle covers its main listing along with
+// every listing in Bundle
+func (o *Offer) bundleListingIDs() []int {
+	seen := map[int]bool{o.Listing.ID: true}
+	ids := []int{o.Listing.ID}
+	for _, listing := range o.Bundle {
+		if !seen[listing.ID] {
+			seen[listing.ID] = true
+			ids = append(ids, listing.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// validateBundle checks that a new bundle offer covers a sensible number of
+// listings
+func (o *Offer) validateBundle() (bool, OfferError) {
+	err := OfferError{}
+	count := len(o.bundleListingIDs())
+	if count < 2 {
+		err.Bundle = "A bundle needs at least two listings."
+		return false, err
+	}
+	if count > MaxBundleListings {
+		err.Bundle = "A bundle can include at most " +
+			strconv.Itoa(MaxBundleListings) + " listings."
+		return false, err
+	}
+	return true, err
+}
+
+// checkListingsOpen checks that offers on every one of a set of listings
+// can still be made and answered. A listing past its expiry is closed until
+// its seller renews it
+func checkListingsOpen(listings []Listing) error {
+	var closed error
+	for _, listing := range listings {
+		switch err := checkListingOpen(listing.Status); err {
+		case ErrListingSold:
+			return err
+		case ErrListingHeld:
+			closed = err
+		default:
+			if listing.IsExpired() && closed == nil {
+				closed = ErrListingExpired
+			}
+		}
+	}
+	return closed
+}
+
+// offerListingIDs gets the IDs of the listings a saved offer is on, which
+// for a bundle is every listing it covers
+func offerListingIDs(tx *sql.Tx, o *Offer) ([]int, error) {
+	rows, err := tx.Query("SELECT listing_id FROM offer_bundle_listings "+
+		"WHERE offer_id = $1 ORDER BY listing_id ASC", o.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, MaxBundleListings)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		ids = append(ids, o.Listing.ID)
+	}
+	return ids, nil
+}
+
+// lockOfferListings locks every listing a saved offer is on until the end
+// of a transaction, so that offers on them can't change under the caller
+func lockOfferListings(tx *sql.Tx, o *Offer) ([]Listing, error) {
+	ids, err := offerListingIDs(tx, o)
+	if err != nil {
+		return nil, err
+	}
+	return lockListings(tx, ids)
+}
+
+// GetOfferBundles gets the listings covered by each of a set of bundle
+// offers, keyed by offer ID. Offers which aren't bundles are left out
+func GetOfferBundles(db *sql.DB, offerIDs []int) (map[int][]Listing, error) {
+	bundles := make(map[int][]Listing)
+	if len(offerIDs) == 0 {
+		return bundles, nil
+	}
+
+	placeholders := make([]string, 0, len(offerIDs))
+	args := make([]interface{}, 0, len(offerIDs))
+	for i, id := range offerIDs {
+		placeholders = append(placeholders, "$"+strconv.Itoa(i+1))
+		args = append(args, id)
+	}
+
+	rows, err := db.Query("SELECT b.offer_id, l.id, l.name, l.price, "+
+		"l.status FROM offer_bundle_listings b, listings l WHERE "+
+		"b.listing_id = l.id AND b.offer_id IN ("+
+		strings.Join(placeholders, ", ")+") ORDER BY b.offer_id, l.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var offerID int
+		var listing Listing
+		err = rows.Scan(&offerID, &listing.ID, &listing.Name, &listing.Price,
+			&listing.Status)
+		if err != nil {
+			return nil, err
+		}
+		listing.PriceClient = utils.PriceServerToClient(listing.Price)
+		bundles[offerID] = append(bundles[offerID], listing)
+	}
+	return bundles, rows.Err()
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OfferEvent is an entry in the history of an offer, recording an action
+// taken on it along with any price and comment given with the action.
+// Automatic events were taken by the seller's offer rules rather than by
+// the seller
+type OfferEvent struct {
+	ID          int       `json:"id"`
+	OfferID     int       `json:"offer_id"`
+	Action      string    `json:"action"`
+	Actor       string    `json:"actor"`
+	Status      string    `json:"status"`
+	Price       *int      `json:"-"`
+	PriceClient string    `json:"price,omitempty"`
+	Comment     string    `json:"comment,omitempty"`
+	Automatic   bool      `json:"automatic"`
+	Description string    `json:"description"`
+	Created     time.Time `json:"created"`
+}
+
+// transitionOffer takes the action in event on an offer, inside of a
+// transaction. The offer's row is locked while its status is checked, then
+// the new status is saved and the event added to the offer's history
+func transitionOffer(tx *sql.Tx, offerID int, event *OfferEvent) error {
+	var status string
+	err := tx.QueryRow("SELECT status FROM offers WHERE id = $1 FOR UPDATE",
+		offerID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrOfferStatus
+	} else if err != nil {
+		return err
+	}
+
+	next, err := nextOfferStatus(status, event.Action)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE offers SET status = $1, modified = now() WHERE "+
+		"id = $2", next, offerID)
+	if err != nil {
+		return err
+	}
+
+	event.OfferID = offerID
+	event.Status = next
+	return recordOfferEvent(tx, event)
+}
+
+// recordOfferEvent adds an event to the history of an offer
+func recordOfferEvent(tx *sql.Tx, event *OfferEvent) error {
+	event.Actor = offerTransitions[event.Action].by
+	err := tx.QueryRow("INSERT INTO offer_events (offer_id, action, actor, "+
+		"status, price, comment, automatic) VALUES ($1, $2, $3, $4, $5, $6, $7) "+
+		"RETURNING id, created", event.OfferID, event.Action, event.Actor,
+		event.Status, event.Price, event.Comment, event.Automatic).Scan(
+		&event.ID, &event.Created)
+	if err != nil {
+		return err
+	}
+	describeOfferEvent(event)
+	return nil
+}
+
+// GetOfferHistory gets the history of each of a set of offers, oldest event
+// first, keyed by offer ID
+func GetOfferHistory(db *sql.DB, offerIDs []int) (map[int][]OfferEvent,
+	error) {
+
+	history := make(map[int][]OfferEvent)
+	if len(offerIDs) == 0 {
+		return history, nil
+	}
+
+	placeholders := make([]string, 0, len(offerIDs))
+	args := make([]interface{}, 0, len(offerIDs))
+	for i, id := range offerIDs {
+		placeholders = append(placeholders, "$"+strconv.Itoa(i+1))
+		args = append(args, id)
+	}
+
+	rows, err := db.Query("SELECT id, offer_id, action, actor, status, price, "+
+		"comment, automatic, created FROM offer_events WHERE offer_id IN ("+
+		strings.Join(placeholders, ", ")+") ORDER BY created ASC, id ASC",
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event OfferEvent
+		var comment sql.NullString
+		err = rows.Scan(&event.ID, &event.OfferID, &event.Action, &event.Actor,
+			&event.Status, &event.Price, &comment, &event.Automatic,
+			&event.Created)
+		if err != nil {
+			return nil, err
+		}
+		event.Comment = comment.String
+		describeOfferEvent(&event)
+		history[event.OfferID] = append(history[event.OfferID], event)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpiredOffer is an offer closed because it went past its expiry. Lapsed
+// is set if the offer had been accepted, so a deal fell through
+type ExpiredOffer struct {
+	Offer
+	Lapsed bool
+}
+
+// ExpireOffers expires every offer which is past its expiry at now. When an
+// accepted offer lapses, its listing is taken off hold if it was held for
+// the buyer. The expired offers
+// are returned with the names and email addresses of their buyers and
+// sellers, so that both can be told
+func ExpireOffers(db *sql.DB, now time.Time) ([]ExpiredOffer, error) {
+	from := offerTransitions[OfferActionExpire].from
+	args := []interface{}{now}
+	placeholders := make([]string, 0, len(from))
+	for _, status := range from {
+		args = append(args, status)
+		placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+	}
+
+	rows, err := db.Query("SELECT id, listing_id FROM offers WHERE "+
+		"expires <= $1 AND status IN ("+strings.Join(placeholders, ", ")+
+		") ORDER BY expires ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	due := make([]Offer, 0, 10)
+	for rows.Next() {
+		var offer Offer
+		if err := rows.Scan(&offer.ID, &offer.Listing.ID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, offer)
+	}
+	rows.Close()
+
+	expired := make([]ExpiredOffer, 0, len(due))
+	for _, offer := range due {
+		lapsed, ok, err := expireOffer(db, &offer, now)
+		if err != nil {
+			fmt.Println("[ERROR] models.ExpireOffers: offer " +
+				strconv.Itoa(offer.ID) + ": " + err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		full, err := getExpiredOffer(db, offer.ID)
+		if err != nil {
+			fmt.Println("[ERROR] models.ExpireOffers: offer " +
+				strconv.Itoa(offer.ID) + ": " + err.Error())
+			continue
+		}
+		expired = append(expired, ExpiredOffer{Offer: *full, Lapsed: lapsed})
+	}
+	return expired, nil
+}
+
+// expireOffer expires a single offer, as long as it hasn't been changed to
+// expire later since it was found. It returns whether the offer had been
+// accepted, and whether it was expired at all
+func expireOffer(db *sql.DB, offer *Offer, now time.Time) (bool, bool,
+	error) {
+
+	lapsed, ok := false, false
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		if _, err := lockOfferListings(tx, offer); err != nil {
+			return err
+		}
+
+		var status string
+		err := tx.QueryRow("SELECT status FROM offers WHERE id = $1 AND "+
+			"expires <= $2 FOR UPDATE", offer.ID, now).Scan(&status)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = transitionOffer(tx, offer.ID, &OfferEvent{Action: OfferActionExpire})
+		if err == ErrOfferStatus {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		ok = true
+		lapsed = status == OfferAccepted
+
+		return releaseListingHold(tx, offer)
+	})
+	return lapsed, ok, err
+}
+
+// getExpiredOffer gets an offer along with its listing's name and the names
+// and email addresses of its buyer and seller
+func getExpiredOffer(db *sql.DB, id int) (*Offer, error) {
+	var offer Offer
+	err := db.QueryRow("SELECT o.id, o.price, o.counter, o.is_countered, "+
+		"o.status, o.listing_id, l.name, o.buyer_id, b.username, "+
+		"b.display_name, b.email_address, o.seller_id, s.username, "+
+		"s.display_name, s.email_address, o.expires, o.bundle FROM offers o "+
+		"JOIN listings l ON o.listing_id = l.id JOIN users b ON o.buyer_id = b.id "+
+		"JOIN users s ON o.seller_id = s.id WHERE o.id = $1", id).Scan(
+		&offer.ID, &offer.Price, &offer.Counter, &offer.IsCountered,
+		&offer.Status, &offer.Listing.ID, &offer.Listing.Name, &offer.Buyer.ID,
+		&offer.Buyer.Username, &offer.Buyer.DisplayName,
+		&offer.Buyer.EmailAddress, &offer.Seller.ID, &offer.Seller.Username,
+		&offer.Seller.DisplayName, &offer.Seller.EmailAddress, &offer.Expires,
+		&offer.IsBundle)
+	if err != nil {
+		return nil, err
+	}
+	offerPrices(&offer)
+	return &offer, nil
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// OfferRules are a seller's standing answers to offers on one of their
+// listings. Offers at or above AcceptAt are accepted, and offers below
+// DeclineBelow are declined with DeclineReply, as soon as they are made.
+// Either rule can be left unset. Rules are only shown to the seller, so
+// they aren't part of a listing's JSON
+type OfferRules struct {
+	ListingID          int
+	AcceptAt           *int
+	AcceptAtClient     string
+	DeclineBelow       *int
+	DeclineBelowClient string
+	DeclineReply       string
+}
+
+// OfferRulesError contains descriptions of validation errors that may exist
+// in a set of offer rules
+type OfferRulesError struct {
+	AcceptAt     string
+	DeclineBelow string
+	DeclineReply string
+	Global       string
+}
+
+// Validate checks if a set of offer rules is valid
+func (r *OfferRules) Validate() (bool, OfferRulesError) {
+	err := OfferRulesError{}
+	valid := true
+	if r.AcceptAt != nil && *r.AcceptAt < 0 {
+		err.AcceptAt = "A price can't be negative."
+		valid = false
+	}
+	if r.DeclineBelow != nil && *r.DeclineBelow < 0 {
+		err.DeclineBelow = "A price can't be negative."
+		valid = false
+	}
+	if r.AcceptAt != nil && r.DeclineBelow != nil &&
+		*r.DeclineBelow > *r.AcceptAt {
+
+		err.DeclineBelow = "Offers can't be declined above the price they " +
+			"are accepted at."
+		valid = false
+	}
+	if len(r.DeclineReply) > 140 {
+		err.DeclineReply = "A reply can't be longer than 140 characters."
+		valid = false
+	}
+	return valid, err
+}
+
+// Empty checks whether a set of offer rules has no rules in it
+func (r *OfferRules) Empty() bool {
+	return r.AcceptAt == nil && r.DeclineBelow == nil
+}
+
+// Decide gets the action the rules take on an offer of price, or an empty
+// string if the offer is left for the seller to answer
+func (r *OfferRules) Decide(price int) string {
+	if r.AcceptAt != nil && price >= *r.AcceptAt {
+		return OfferActionAccept
+	}
+	if r.DeclineBelow != nil && price < *r.DeclineBelow {
+		return OfferActionDecline
+	}
+	return ""
+}
+
+// offerRulesPrices sets the prices shown to users for a set of offer rules
+func offerRulesPrices(rules *OfferRules) {
+	if rules.AcceptAt != nil {
+		rules.AcceptAtClient = utils.PriceServerToClient(*rules.AcceptAt)
+	}
+	if rules.DeclineBelow != nil {
+		rules.DeclineBelowClient = utils.PriceServerToClient(*rules.DeclineBelow)
+	}
+}
+
+// GetOfferRules gets the offer rules for a listing. A listing without any
+// gets an empty set of rules
+func GetOfferRules(db *sql.DB, listingID int) (*OfferRules, error) {
+	rules := OfferRules{ListingID: listingID}
+	var reply sql.NullString
+	err := db.QueryRow("SELECT accept_at, decline_below, decline_reply FROM "+
+		"listing_offer_rules WHERE listing_id = $1", listingID).Scan(
+		&rules.AcceptAt, &rules.DeclineBelow, &reply)
+	if err == sql.ErrNoRows {
+		return &rules, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rules.DeclineReply = reply.String
+	offerRulesPrices(&rules)
+	return &rules, nil
+}
+
+// Save replaces the offer rules for a listing. Saving an empty set of rules
+// removes them
+func (r *OfferRules) Save(db *sql.DB) (bool, *OfferRulesError) {
+	valid, validationError := r.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	var err error
+	if r.Empty() {
+		_, err = db.Exec("DELETE FROM listing_offer_rules WHERE listing_id = $1",
+			r.ListingID)
+	} else {
+		_, err = db.Exec("INSERT INTO listing_offer_rules (listing_id, "+
+			"accept_at, decline_below, decline_reply) VALUES ($1, $2, $3, $4) "+
+			"ON CONFLICT (listing_id) DO UPDATE SET accept_at = $2, "+
+			"decline_below = $3, decline_reply = $4", r.ListingID, r.AcceptAt,
+			r.DeclineBelow, r.DeclineReply)
+	}
+	if err != nil {
+		fmt.Println("[ERROR] models.OfferRules.Save: " + err.Error())
+		return false, &OfferRulesError{Global: "An unexpected error occurred."}
+	}
+	offerRulesPrices(r)
+	return true, nil
+}
+
+// ApplyRules answers a new or revised offer with the offer rules of its
+// listing, recording the answer in the offer's history just like one the
+// seller gave. It returns the action taken, or an empty string if the
+// rules left the offer alone
+func (o *Offer) ApplyRules(db *sql.DB) (string, error) {
+	var event OfferEvent
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		listings, err := lockOfferListings(tx, o)
+		if err != nil {
+			return err
+		}
+		// The rules of a single listing can't price a bundle
+		if len(listings) > 1 || checkListingsOpen(listings) != nil {
+			return nil
+		}
+
+		rules := OfferRules{}
+		var reply sql.NullString
+		err = tx.QueryRow("SELECT accept_at, decline_below, decline_reply "+
+			"FROM listing_offer_rules WHERE listing_id = $1", o.Listing.ID).Scan(
+			&rules.AcceptAt, &rules.DeclineBelow, &reply)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		event.Action = rules.Decide(o.Price)
+		if len(event.Action) == 0 {
+			return nil
+		}
+		event.Automatic = true
+		if event.Action == OfferActionDecline {
+			event.Comment = reply.String
+		}
+		if err := transitionOffer(tx, o.ID, &event); err != nil {
+			return err
+		}
+		if event.Action == OfferActionAccept {
+			// Like an accepted offer without a deadline from the seller
+			_, err = tx.Exec("UPDATE offers SET expires = NULL WHERE id = $1",
+				o.ID)
+		}
+		return err
+	})
+	if err == ErrOfferStatus {
+		// The offer was answered some other way first
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if len(event.Status) > 0 {
+		o.Status = event.Status
+		if event.Action == OfferActionAccept {
+			o.Expires = nil
+		}
+	}
+	return event.Action, nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import "github.com/anishmgoyal/calagora/utils"
+
+const (
+	// OfferActionOffer is a buyer proposing a price, either in a new offer or
+	// in reply to a counter offer
+	OfferActionOffer = "offer"
+	// OfferActionCounter is a seller proposing a different price
+	OfferActionCounter = "counter"
+	// OfferActionAccept is a seller accepting an offer
+	OfferActionAccept = "accept"
+	// OfferActionComplete is a seller selling the listing under an offer
+	OfferActionComplete = "complete"
+	// OfferActionDecline is a seller turning an offer down
+	OfferActionDecline = "decline"
+	// OfferActionWithdraw is a buyer taking their offer back
+	OfferActionWithdraw = "withdraw"
+	// OfferActionExpire is an offer running out of time without an answer
+	OfferActionExpire = "expire"
+)
+
+const (
+	// OfferBuyer is the party an offer is made by
+	OfferBuyer = "buyer"
+	// OfferSeller is the party an offer is made to
+	OfferSeller = "seller"
+	// OfferSystem is for actions taken on an offer by Calagora itself
+	OfferSystem = "system"
+)
+
+// offerTransition describes one action that can be taken on an offer
+type offerTransition struct {
+	by          string
+	from        []string
+	to          string
+	description string
+}
+
+// offerTransitions is the state machine offers move through. Every change
+// to an offer's status must go through nextOfferStatus, so that this is the
+// one place where legal moves are decided. A buyer only has one offer on a
+// listing, so making an offer again reopens one that was closed
+var offerTransitions = map[string]offerTransition{
+	OfferActionOffer: {
+		by: OfferBuyer,
+		from: []string{"", OfferOffered, OfferCountered, OfferDeclined,
+			OfferWithdrawn, OfferExpired},
+		to:          OfferOffered,
+		description: "Offered",
+	},
+	OfferActionCounter: {
+		by:          OfferSeller,
+		from:        []string{OfferOffered, OfferCountered},
+		to:          OfferCountered,
+		description: "Countered at",
+	},
+	OfferActionAccept: {
+		by:          OfferSeller,
+		from:        []string{OfferOffered, OfferCountered},
+		to:          OfferAccepted,
+		description: "Accepted the offer",
+	},
+	OfferActionComplete: {
+		by:          OfferSeller,
+		from:        []string{OfferOffered, OfferCountered, OfferAccepted},
+		to:          OfferCompleted,
+		description: "Sold the listing",
+	},
+	OfferActionDecline: {
+		by:          OfferSeller,
+		from:        []string{OfferOffered, OfferCountered, OfferAccepted},
+		to:          OfferDeclined,
+		description: "Declined the offer",
+	},
+	OfferActionWithdraw: {
+		by:          OfferBuyer,
+		from:        []string{OfferOffered, OfferCountered, OfferAccepted},
+		to:          OfferWithdrawn,
+		description: "Withdrew the offer",
+	},
+	OfferActionExpire: {
+		by:          OfferSystem,
+		from:        []string{OfferOffered, OfferCountered, OfferAccepted},
+		to:          OfferExpired,
+		description: "The offer expired",
+	},
+}
+
+// nextOfferStatus gets the status an offer moves to when action is taken on
+// it, or ErrOfferStatus if the action can't be taken from status
+func nextOfferStatus(status, action string) (string, error) {
+	transition, ok := offerTransitions[action]
+	if !ok {
+		return "", ErrOfferStatus
+	}
+	for _, from := range transition.from {
+		if from == status {
+			return transition.to, nil
+		}
+	}
+	return "", ErrOfferStatus
+}
+
+// Can checks whether an action can be taken on an offer in its current
+// status
+func (o Offer) Can(action string) bool {
+	_, err := nextOfferStatus(o.Status, action)
+	return err == nil
+}
+
+// describeOfferEvent sets the fields of an event shown to users
+func describeOfferEvent(event *OfferEvent) {
+	event.Description = offerTransitions[event.Action].description
+	if event.Price != nil {
+		event.PriceClient = utils.PriceServerToClient(*event.Price)
+		event.Description += " $" + event.PriceClient
+	}
+	if event.Automatic {
+		event.Description += " automatically"
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import "testing"
+
+func TestNextOfferStatus(t *testing.T) {
+	tests := []struct {
+		status, action, next string
+	}{
+		{"", OfferActionOffer, OfferOffered},
+		{OfferOffered, OfferActionCounter, OfferCountered},
+		{OfferCountered, OfferActionOffer, OfferOffered},
+		{OfferCountered, OfferActionAccept, OfferAccepted},
+		{OfferAccepted, OfferActionComplete, OfferCompleted},
+		{OfferWithdrawn, OfferActionOffer, OfferOffered},
+		{OfferAccepted, OfferActionCounter, ""},
+		{OfferAccepted, OfferActionExpire, OfferExpired},
+		{OfferCompleted, OfferActionExpire, ""},
+		{OfferCompleted, OfferActionDecline, ""},
+		{OfferDeclined, OfferActionAccept, ""},
+		{OfferOffered, "haggle", ""},
+	}
+	for _, test := range tests {
+		next, err := nextOfferStatus(test.status, test.action)
+		if test.next == "" && err != ErrOfferStatus {
+			t.Errorf("%s from %q was allowed, moving to %s", test.action,
+				test.status, next)
+		} else if test.next != "" && next != test.next {
+			t.Errorf("%s from %q moved to %q, expected %s", test.action,
+				test.status, next, test.next)
+		}
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func TestFindDomain(t *testing.T) {
-	db := getDBConnection()
+	db := testDB(t)
 	id, err := FindPlaceID(db, "test@rutgers.edu")
 	if err != nil {
 		t.Error("Error: " + err.Error())
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MinReviewRating is the lowest rating a review can give
+	MinReviewRating = 1
+	// MaxReviewRating is the highest rating a review can give
+	MaxReviewRating = 5
+	// ReviewsPageSize is how many reviews are loaded at a time
+	ReviewsPageSize = 20
+)
+
+var (
+	// ErrReviewNotAllowed is returned when reviewing an offer which isn't
+	// completed, or which the reviewer wasn't the buyer or seller under
+	ErrReviewNotAllowed = errors.New("The offer can't be reviewed")
+	// ErrAlreadyReviewed is returned when a user reviews an offer twice
+	ErrAlreadyReviewed = errors.New("The offer has already been reviewed")
+)
+
+// Review is a rating one party under a completed offer gives the other.
+// Each party can review an offer once. Role is the part the reviewee played
+// under the offer, OfferBuyer or OfferSeller
+type Review struct {
+	ID       int       `json:"id"`
+	OfferID  int       `json:"offer_id"`
+	Reviewer User      `json:"reviewer"`
+	Reviewee User      `json:"reviewee"`
+	Role     string    `json:"role"`
+	Rating   int       `json:"rating"`
+	Comment  string    `json:"comment"`
+	Listing  Listing   `json:"listing"`
+	Created  time.Time `json:"created"`
+}
+
+// ReviewError contains descriptions of validation errors that may exist in
+// a review
+type ReviewError struct {
+	Rating  string `json:"rating"`
+	Comment string `json:"comment"`
+	Global  string `json:"global"`
+}
+
+// Reputation sums up the reviews a user has received
+type Reputation struct {
+	ReviewCount int     `json:"review_count"`
+	Rating      float64 `json:"rating"`
+	// RatingClient is the average rating as it is shown to users
+	RatingClient string `json:"rating_client"`
+}
+
+// newReputation gets a reputation from the number and sum of the ratings a
+// user has received
+func newReputation(count, total int) Reputation {
+	reputation := Reputation{ReviewCount: count}
+	if count > 0 {
+		reputation.Rating = float64(total) / float64(count)
+		reputation.RatingClient = strconv.FormatFloat(reputation.Rating, 'f', 1,
+			64)
+	}
+	return reputation
+}
+
+// Validate checks if the fields of a review are valid
+func (r *Review) Validate() (bool, ReviewError) {
+	err := ReviewError{}
+	valid := true
+	if r.Rating < MinReviewRating || r.Rating > MaxReviewRating {
+		err.Rating = "A rating must be from " + strconv.Itoa(MinReviewRating) +
+			" to " + strconv.Itoa(MaxReviewRating) + "."
+		valid = false
+	}
+	if len(r.Comment) > 280 {
+		err.Comment = "A review can't be longer than 280 characters."
+		valid = false
+	}
+	return valid, err
+}
+
+// reviewError gets the error shown to users for a failure to save a review
+func reviewError(err error, caller string) *ReviewError {
+	switch err {
+	case ErrReviewNotAllowed:
+		return &ReviewError{Global: "Only the buyer and seller of a completed " +
+			"sale can review it."}
+	case ErrAlreadyReviewed:
+		return &ReviewError{Global: "You have already reviewed this sale."}
+	}
+	fmt.Println("[ERROR] " + caller + ": " + err.Error())
+	return &ReviewError{Global: "An unexpected error occurred."}
+}
+
+// reviewParties finds the reviewee and their role for a review of an offer
+// by reviewerID, failing with ErrReviewNotAllowed if the offer can't be
+// reviewed by them
+func reviewParties(status string, buyerID, sellerID, reviewerID int) (int,
+	string, error) {
+
+	if status != OfferCompleted {
+		return 0, "", ErrReviewNotAllowed
+	}
+	switch reviewerID {
+	case buyerID:
+		return sellerID, OfferSeller, nil
+	case sellerID:
+		return buyerID, OfferBuyer, nil
+	}
+	return 0, "", ErrReviewNotAllowed
+}
+
+// Create inserts a review from Reviewer of the offer OfferID, filling in
+// the reviewee from the offer
+func (r *Review) Create(db *sql.DB) (bool, *ReviewError) {
+	valid, validationError := r.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		var status string
+		var buyerID, sellerID int
+		err := tx.QueryRow("SELECT status, buyer_id, seller_id, listing_id "+
+			"FROM offers WHERE id = $1 FOR UPDATE", r.OfferID).Scan(&status,
+			&buyerID, &sellerID, &r.Listing.ID)
+		if err == sql.ErrNoRows {
+			return ErrReviewNotAllowed
+		} else if err != nil {
+			return err
+		}
+		r.Reviewee.ID, r.Role, err = reviewParties(status, buyerID, sellerID,
+			r.Reviewer.ID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow("INSERT INTO reviews (offer_id, reviewer_id, "+
+			"reviewee_id, role, rating, comment) VALUES ($1, $2, $3, $4, $5, $6) "+
+			"ON CONFLICT (offer_id, reviewer_id) DO NOTHING RETURNING id, created",
+			r.OfferID, r.Reviewer.ID, r.Reviewee.ID, r.Role, r.Rating,
+			r.Comment).Scan(&r.ID, &r.Created)
+		if err == sql.ErrNoRows {
+			return ErrAlreadyReviewed
+		}
+		return err
+	})
+	if err != nil {
+		return false, reviewError(err, "models.Review.Create")
+	}
+	return true, nil
+}
+
+// reviewColumns are the columns scanned by scanReview
+const reviewColumns = "r.id, r.offer_id, r.reviewer_id, u.username, " +
+	"u.display_name, r.reviewee_id, r.role, r.rating, r.comment, " +
+	"o.listing_id, l.name, r.created FROM reviews r, users u, offers o, " +
+	"listings l WHERE r.reviewer_id = u.id AND r.offer_id = o.id AND " +
+	"o.listing_id = l.id"
+
+// scanReview scans the reviewColumns of a row into a review
+func scanReview(rows *sql.Rows) (Review, error) {
+	var review Review
+	var comment sql.NullString
+	err := rows.Scan(&review.ID, &review.OfferID, &review.Reviewer.ID,
+		&review.Reviewer.Username, &review.Reviewer.DisplayName,
+		&review.Reviewee.ID, &review.Role, &review.Rating, &comment,
+		&review.Listing.ID, &review.Listing.Name, &review.Created)
+	review.Comment = comment.String
+	return review, err
+}
+
+// queryReviews gets the reviews matching a condition on reviewColumns
+func queryReviews(db *sql.DB, caller string, condition string,
+	args ...interface{}) ([]Review, error) {
+
+	rows, err := db.Query("SELECT "+reviewColumns+" AND "+condition, args...)
+	if err != nil {
+		fmt.Println("[ERROR] " + caller + ": " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make([]Review, 0)
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			fmt.Println("[ERROR] " + caller + ": " + err.Error())
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// GetReviewsForUser gets a page of the reviews a user has received, newest
+// first
+func GetReviewsForUser(db *sql.DB, userID, page int) ([]Review, error) {
+	return queryReviews(db, "models.GetReviewsForUser", "r.reviewee_id = $1 "+
+		"ORDER BY r.created DESC, r.id DESC LIMIT $2 OFFSET $3", userID,
+		ReviewsPageSize, page*ReviewsPageSize)
+}
+
+// GetReviewsForOffer gets the reviews left on an offer
+func GetReviewsForOffer(db *sql.DB, offerID int) ([]Review, error) {
+	return queryReviews(db, "models.GetReviewsForOffer", "r.offer_id = $1 "+
+		"ORDER BY r.created ASC, r.id ASC", offerID)
+}
+
+// GetReputations gets the reputation of each of a set of users, keyed by
+// user ID. Users without any reviews get an empty reputation
+func GetReputations(db *sql.DB, userIDs []int) (map[int]Reputation, error) {
+	reputations := make(map[int]Reputation)
+	if len(userIDs) == 0 {
+		return reputations, nil
+	}
+
+	placeholders := make([]string, 0, len(userIDs))
+	args := make([]interface{}, 0, len(userIDs))
+	for i, id := range userIDs {
+		placeholders = append(placeholders, "$"+strconv.Itoa(i+1))
+		args = append(args, id)
+		reputations[id] = Reputation{}
+	}
+
+	rows, err := db.Query("SELECT reviewee_id, COUNT(*), SUM(rating) FROM "+
+		"reviews WHERE reviewee_id IN ("+strings.Join(placeholders, ", ")+") "+
+		"GROUP BY reviewee_id", args...)
+	if err != nil {
+		fmt.Println("[ERROR] models.GetReputations: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count, total int
+		if err := rows.Scan(&id, &count, &total); err != nil {
+			fmt.Println("[ERROR] models.GetReputations: " + err.Error())
+			return nil, err
+		}
+		reputations[id] = newReputation(count, total)
+	}
+	return reputations, rows.Err()
+}
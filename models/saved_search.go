@@ -0,0 +1,290 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/constants"
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+const (
+	// MaxSavedSearches is the number of searches a user may save
+	MaxSavedSearches = 20
+)
+
+// SavedSearch is a search a user has asked to be alerted about when new
+// listings matching it are published
+type SavedSearch struct {
+	ID             int       `json:"id"`
+	User           User      `json:"-"`
+	PlaceID        int       `json:"-"`
+	Query          string    `json:"query"`
+	MinPrice       *int      `json:"-"`
+	MinPriceClient string    `json:"min_price,omitempty"`
+	MaxPrice       *int      `json:"-"`
+	MaxPriceClient string    `json:"max_price,omitempty"`
+	Type           string    `json:"type,omitempty"`
+	Condition      string    `json:"condition,omitempty"`
+	EmailAlerts    bool      `json:"email_alerts"`
+	Created        time.Time `json:"created"`
+
+	// Attributes are the attribute filters a search was made with. They
+	// aren't stored, so searches filtered by attributes can't be saved
+	Attributes []AttributeFilter `json:"-"`
+}
+
+// SavedSearchError contains error messages from failures in validations
+type SavedSearchError struct {
+	Query  string `json:"query"`
+	Global string `json:"global"`
+}
+
+// Filters converts a saved search to the filters used to run it
+func (s *SavedSearch) Filters() SearchFilters {
+	filters := SearchFilters{
+		PlaceID:         s.PlaceID,
+		RestrictByPlace: true,
+	}
+	if s.MinPrice != nil {
+		filters.MinPrice = *s.MinPrice
+		filters.RestrictByMinPrice = true
+	}
+	if s.MaxPrice != nil {
+		filters.MaxPrice = *s.MaxPrice
+		filters.RestrictByMaxPrice = true
+	}
+	if len(s.Type) > 0 {
+		filters.Types = []string{s.Type}
+	}
+	if len(s.Condition) > 0 {
+		filters.Conditions = ListingConditionsAtLeast(s.Condition)
+	}
+	filters.Attributes = s.Attributes
+	return filters
+}
+
+// Validate checks if a saved search is valid
+func (s *SavedSearch) Validate(db *sql.DB) (bool, SavedSearchError) {
+	var err SavedSearchError
+	var valid = true
+
+	if len(s.Query) > 255 {
+		err.Query = "Searches can't be longer than 255 characters"
+		valid = false
+	} else if !canSearch(utils.ParseSearchQuery(s.Query), s.Filters()) {
+		err.Query = "Enter something to search for, or choose a filter"
+		valid = false
+	}
+
+	if _, ok := ListingTypes[s.Type]; len(s.Type) > 0 && !ok {
+		err.Global = "Invalid category"
+		valid = false
+	}
+	if ListingConditionsAtLeast(s.Condition) == nil && len(s.Condition) > 0 {
+		err.Global = "Invalid condition"
+		valid = false
+	}
+	if len(s.Attributes) > 0 {
+		err.Global = "Searches filtered by attributes can't be saved"
+		valid = false
+	}
+
+	var count int
+	row := db.QueryRow("SELECT COUNT(1) FROM saved_searches WHERE user_id = $1",
+		s.User.ID)
+	if row.Scan(&count) == nil && count >= MaxSavedSearches {
+		err.Global = "You can't save more than " +
+			strconv.Itoa(MaxSavedSearches) + " searches"
+		valid = false
+	}
+
+	return valid, err
+}
+
+// Create saves a search for a user
+func (s *SavedSearch) Create(db *sql.DB) (bool, *SavedSearchError) {
+	valid, validationError := s.Validate(db)
+	if !valid {
+		return false, &validationError
+	}
+
+	var listingType, listingCondition *string
+	if len(s.Type) > 0 {
+		listingType = &s.Type
+	}
+	if len(s.Condition) > 0 {
+		listingCondition = &s.Condition
+	}
+
+	// The tsquery is built once here, so that matching new listings against
+	// saved searches doesn't have to parse every query again. It is built
+	// again by RebuildStaleSavedSearches if the analyzer changes
+	args := []interface{}{s.User.ID, s.PlaceID, s.Query, s.MinPrice,
+		s.MaxPrice, listingType, listingCondition, s.EmailAlerts,
+		constants.SearchAnalyzerVersion}
+	searchQuery, args := savedSearchTSQuery(s.Query, args)
+
+	row := db.QueryRow("INSERT INTO saved_searches (user_id, place_id, query, "+
+		"min_price, max_price, listing_type, listing_condition, email_alerts, "+
+		"analyzer_version, search_query) VALUES ($1, $2, $3, $4, $5, $6, $7, "+
+		"$8, $9, "+searchQuery+") RETURNING id, created", args...)
+	err := row.Scan(&s.ID, &s.Created)
+	if err != nil {
+		fmt.Println(err.Error())
+		return false, &SavedSearchError{Global: "An unexpected error occurred."}
+	}
+	return true, nil
+}
+
+// savedSearchTSQuery builds the tsquery expression stored for a saved
+// search query, which is NULL for searches made only of filters
+func savedSearchTSQuery(query string, args []interface{}) (string,
+	[]interface{}) {
+
+	parsed := utils.ParseSearchQuery(query)
+	if parsed.IsEmpty() {
+		return "NULL", args
+	}
+	return searchTSQuery(parsed, args)
+}
+
+// RebuildStaleSavedSearches compiles the queries of any saved searches
+// compiled by an older analyzer again, so that they keep matching listings
+// indexed by the current one
+func RebuildStaleSavedSearches(db *sql.DB) {
+	rows, err := db.Query("SELECT id, query FROM saved_searches WHERE "+
+		"analyzer_version < $1 ORDER BY id", constants.SearchAnalyzerVersion)
+	if err != nil {
+		fmt.Println("[ERROR] models.RebuildStaleSavedSearches: " + err.Error())
+		return
+	}
+	var searches []SavedSearch
+	for rows.Next() {
+		var search SavedSearch
+		if err := rows.Scan(&search.ID, &search.Query); err != nil {
+			rows.Close()
+			fmt.Println("[ERROR] models.RebuildStaleSavedSearches: " +
+				err.Error())
+			return
+		}
+		searches = append(searches, search)
+	}
+	rows.Close()
+
+	numRebuilt := 0
+	for _, search := range searches {
+		searchQuery, args := savedSearchTSQuery(search.Query,
+			[]interface{}{search.ID, constants.SearchAnalyzerVersion})
+		_, err := db.Exec("UPDATE saved_searches SET search_query = "+
+			searchQuery+", analyzer_version = $2 WHERE id = $1", args...)
+		if err != nil {
+			fmt.Println("[ERROR] models.RebuildStaleSavedSearches: saved " +
+				"search " + strconv.Itoa(search.ID) + ": " + err.Error())
+			continue
+		}
+		numRebuilt++
+	}
+	if numRebuilt > 0 {
+		fmt.Println("[INFO] models.RebuildStaleSavedSearches: " +
+			strconv.Itoa(numRebuilt) + " saved searches compiled")
+	}
+}
+
+// Delete removes a saved search belonging to a user
+func (s *SavedSearch) Delete(db *sql.DB) (bool, error) {
+	res, err := db.Exec("DELETE FROM saved_searches WHERE id = $1 AND "+
+		"user_id = $2", s.ID, s.User.ID)
+	if err != nil {
+		fmt.Println(err.Error())
+		return false, err
+	}
+	numAffected, _ := res.RowsAffected()
+	return numAffected == 1, nil
+}
+
+// GetSavedSearches gets all of the searches a user has saved
+func (u *User) GetSavedSearches(db *sql.DB) ([]SavedSearch, error) {
+	rows, err := db.Query("SELECT id, place_id, query, min_price, max_price, "+
+		"listing_type, listing_condition, email_alerts, created FROM "+
+		"saved_searches WHERE user_id = $1 ORDER BY id DESC", u.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := make([]SavedSearch, 0, MaxSavedSearches)
+	for rows.Next() {
+		search := SavedSearch{User: *u}
+		if err := search.scan(rows); err == nil {
+			searches = append(searches, search)
+		}
+	}
+	return searches, nil
+}
+
+// scan reads a saved search from a row of id, place_id, query, min_price,
+// max_price, listing_type, listing_condition, email_alerts, created
+func (s *SavedSearch) scan(rows *sql.Rows, extra ...interface{}) error {
+	var listingType, listingCondition sql.NullString
+	dest := append([]interface{}{&s.ID, &s.PlaceID, &s.Query, &s.MinPrice,
+		&s.MaxPrice, &listingType, &listingCondition, &s.EmailAlerts,
+		&s.Created}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	s.Type = listingType.String
+	s.Condition = listingCondition.String
+	if s.MinPrice != nil {
+		s.MinPriceClient = utils.PriceServerToClient(*s.MinPrice)
+	}
+	if s.MaxPrice != nil {
+		s.MaxPriceClient = utils.PriceServerToClient(*s.MaxPrice)
+	}
+	return nil
+}
+
+// MatchSavedSearches finds the saved searches a listing matches which
+// haven't been alerted about it yet, and records that they have been.
+// The listing must already be in the search index, and be shown in
+// search results
+func (l *Listing) MatchSavedSearches(db *sql.DB) ([]SavedSearch, error) {
+	// Conditions are declared from best to worst in the listing_condition
+	// type, so "this condition or better" is a range starting at 'new'
+	rows, err := db.Query("WITH alerted AS (INSERT INTO saved_search_alerts "+
+		"(saved_search_id, listing_id) SELECT s.id, d.listing_id FROM "+
+		"saved_searches s, search_documents d, listings l WHERE "+
+		"d.listing_id = $1 AND l.id = d.listing_id AND l.published AND "+
+		searchVisibleCondition+" AND s.place_id = d.place_id AND "+
+		"s.user_id <> l.user_id AND (s.search_query IS NULL OR "+
+		"d.document @@ s.search_query) AND (s.min_price IS NULL OR "+
+		"d.listing_price >= s.min_price) AND (s.max_price IS NULL OR "+
+		"d.listing_price <= s.max_price) AND (s.listing_type IS NULL OR "+
+		"d.listing_type = s.listing_type) AND (s.listing_condition IS NULL OR "+
+		"d.listing_condition BETWEEN 'new' AND s.listing_condition) "+
+		"ON CONFLICT DO NOTHING RETURNING saved_search_id) "+
+		"SELECT s.id, s.place_id, s.query, s.min_price, s.max_price, "+
+		"s.listing_type, s.listing_condition, s.email_alerts, s.created, "+
+		"u.id, u.username, u.display_name, u.email_address FROM alerted a, "+
+		"saved_searches s, users u WHERE a.saved_search_id = s.id AND "+
+		"s.user_id = u.id", l.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := make([]SavedSearch, 0)
+	for rows.Next() {
+		var search SavedSearch
+		err := search.scan(rows, &search.User.ID, &search.User.Username,
+			&search.User.DisplayName, &search.User.EmailAddress)
+		if err == nil {
+			searches = append(searches, search)
+		} else {
+			fmt.Println(err.Error())
+		}
+	}
+	return searches, nil
+}
@@ -2,15 +2,18 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/anishmgoyal/calagora/constants"
 	"github.com/anishmgoyal/calagora/utils"
 )
 
 const (
-	maxQueryTermsToConsider = 10
-	searchPageSize          = 50
+	// SearchPageSize is the number of listings on a page of search results
+	SearchPageSize = 50
 )
 
 // SearchEntry encapsulates a search entry index for a word in a listing
@@ -23,151 +26,597 @@ type SearchEntry struct {
 	Modified time.Time `json:"modified"`
 }
 
+// SearchFilters narrows down the listings returned by a search
+type SearchFilters struct {
+	PlaceID         int
+	RestrictByPlace bool
+
+	MinPrice           int
+	RestrictByMinPrice bool
+	MaxPrice           int
+	RestrictByMaxPrice bool
+
+	// Types and Conditions restrict results to listings with any of the
+	// given types or conditions when they are not empty
+	Types      []string
+	Conditions []string
+
+	// Attributes restrict results to listings whose attributes match every
+	// filter. They only make sense when searching a single type
+	Attributes []AttributeFilter
+}
+
+// IsActive returns true if a filter other than place has been set
+func (f SearchFilters) IsActive() bool {
+	return f.RestrictByMinPrice || f.RestrictByMaxPrice || len(f.Types) > 0 ||
+		len(f.Conditions) > 0 || len(f.Attributes) > 0
+}
+
+// SearchFacets contains the number of listings matching a search for each
+// listing type and condition
+type SearchFacets struct {
+	Types      map[string]int `json:"types"`
+	Conditions map[string]int `json:"conditions"`
+}
+
+// Total gets the number of listings found by a search with the given
+// filters. Type counts ignore the type filter, so only the counts for the
+// types searched for are added up
+func (f *SearchFacets) Total(filters SearchFilters) int {
+	total := 0
+	if len(filters.Types) > 0 {
+		for _, typeName := range filters.Types {
+			total += f.Types[typeName]
+		}
+		return total
+	}
+	for _, count := range f.Types {
+		total += count
+	}
+	return total
+}
+
+// OnListingIndexed, if set, is called after a published listing has been
+// added to the search index successfully
+var OnListingIndexed func(l *Listing)
+
 // DoRebuildSearchIndex deletes any search index entries for a listing,
 // then rebuilds them
 func (l *Listing) DoRebuildSearchIndex(db *sql.DB) (bool, error) {
-	deleteStatement := "DELETE FROM search_entries WHERE listing_id = $1"
-	_, err := db.Exec(deleteStatement, l.ID)
-	if err != nil {
-		return false, err
-	}
+	return l.rebuildSearchIndex(db, true)
+}
 
+// rebuildSearchIndex rebuilds the search index entries for a listing.
+// OnListingIndexed is only called if notify is set
+func (l *Listing) rebuildSearchIndex(db *sql.DB, notify bool) (bool, error) {
+	var images []Image
 	if l.Published {
-		success := true
-		var lastError error
-
-		typeName, _ := ListingTypes[l.Type]
-		fullString := l.Name + " " + l.Name + " " + typeName + " " + l.Description
-
-		images, err := l.GetImages(db)
+		var err error
+		images, err = l.GetImages(db)
 		if err != nil {
 			return false, err
 		}
-
 		if len(images) == 0 {
 			images = append(images, Image{URL: ImageNotFound})
 		}
+	}
 
-		minOrdinal := 0
-		for i := 0; i < len(images); i++ {
-			if images[i].Ordinal < minOrdinal {
-				images[0] = images[i]
-				minOrdinal = images[i].Ordinal
-			}
-		}
-
-		termMap := utils.GetSearchTermsForString(fullString, true)
-		for word, count := range termMap {
-			insertStatement := "INSERT INTO search_entries (word, count, " +
-				"listing_id, listing_name, listing_price, listing_image, " +
-				"place_id, listing_type) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
-			_, err := db.Exec(insertStatement, word, count, l.ID, l.Name, l.Price,
-				images[0].URL, l.User.PlaceID, l.Type)
-			if err != nil {
-				success = false
-				lastError = err
-			}
-		}
-		return success, lastError
+	// The old entries are replaced in a transaction, so that a listing never
+	// goes missing from search results while it is being indexed
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	if err := l.writeSearchIndex(tx, images); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
 	}
 
+	if l.Published && notify && OnListingIndexed != nil {
+		OnListingIndexed(l)
+	}
 	return true, nil
 }
 
-// GetPageCountForTerms gets the number of pages available for
-// a given set of search terms
-func GetPageCountForTerms(db *sql.DB, terms []string, placeID int) int {
-	wordList := ""
-	args := make([]interface{}, len(terms))
-	for i := 0; i < len(terms); i++ {
-		if i > 0 {
-			wordList = wordList + ", "
+// writeSearchIndex deletes a listing's search index entries, and writes
+// new ones if it is published. images must hold at least one image if the
+// listing is published
+func (l *Listing) writeSearchIndex(tx *sql.Tx, images []Image) error {
+	_, err := tx.Exec("DELETE FROM search_entries WHERE listing_id = $1", l.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM search_documents WHERE listing_id = $1", l.ID)
+	if err != nil {
+		return err
+	}
+
+	if !l.Published {
+		return nil
+	}
+
+	typeName, _ := ListingTypes[l.Type]
+	attributes := l.searchableAttributes()
+	fullString := l.Name + " " + l.Name + " " + typeName + " " + attributes +
+		" " + l.Description
+
+	// The name of a listing carries the most weight when ranking results,
+	// followed by its category and attributes, then its description. Each is
+	// analyzed here the same way queries are, rather than by PostgreSQL. The
+	// plain words for prefix terms carry the least
+	documentStatement := "INSERT INTO search_documents (listing_id, " +
+		"document, listing_name, listing_price, listing_image, place_id, " +
+		"listing_type, listing_condition, analyzer_version) VALUES ($1, " +
+		"setweight(to_tsvector('" + constants.SearchConfiguration + "', $2), " +
+		"'A') || setweight(to_tsvector('" + constants.SearchConfiguration +
+		"', $3), 'B') || setweight(to_tsvector('" +
+		constants.SearchConfiguration + "', $4), 'C') || setweight(" +
+		"to_tsvector('" + constants.SearchConfiguration + "', $12), 'D'), $5, " +
+		"$6, $7, $8, $9, $10, $11)"
+	_, err = tx.Exec(documentStatement, l.ID,
+		utils.SearchAnalyzer.AnalyzeString(l.Name),
+		utils.SearchAnalyzer.AnalyzeString(typeName+" "+attributes),
+		utils.SearchAnalyzer.AnalyzeString(l.Description), l.Name, l.Price,
+		images[0].URL, l.User.PlaceID, l.Type, l.Condition,
+		constants.SearchAnalyzerVersion, utils.SearchPrefixWords(fullString))
+	if err != nil {
+		return err
+	}
+
+	// Plain words are kept in search_entries, rather than stemmed terms,
+	// since they are shown back to users as suggestions
+	termMap := utils.GetSearchWordsForString(fullString)
+	for word, count := range termMap {
+		insertStatement := "INSERT INTO search_entries (word, count, " +
+			"listing_id, listing_name, listing_price, listing_image, " +
+			"place_id, listing_type) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+		_, err := tx.Exec(insertStatement, word, count, l.ID, l.Name, l.Price,
+			images[0].URL, l.User.PlaceID, l.Type)
+		if err != nil {
+			return err
 		}
-		wordList = wordList + "$" + strconv.Itoa(i+1)
-		args[i] = terms[i]
+	}
+	return nil
+}
+
+// searchTSQuery builds a tsquery expression for a parsed search query,
+// appending any arguments it needs to args
+func searchTSQuery(query utils.SearchQuery, args []interface{}) (
+	string, []interface{}) {
+
+	parts := make([]string, 0, 1+len(query.Phrases)+len(query.Prefixes))
+
+	if len(query.Words) > 0 {
+		args = append(args, strings.Join(query.Words, " "))
+		parts = append(parts, "plainto_tsquery('"+constants.SearchConfiguration+
+			"', $"+strconv.Itoa(len(args))+")")
+	}
+	for _, phrase := range query.Phrases {
+		args = append(args, phrase)
+		parts = append(parts, "phraseto_tsquery('"+constants.SearchConfiguration+
+			"', $"+strconv.Itoa(len(args))+")")
+	}
+	for _, prefix := range query.Prefixes {
+		// Prefixes are restricted to letters and digits by the parser, so
+		// they are safe to use as a raw tsquery. They match the plain words
+		// indexed along with the stemmed terms
+		args = append(args, prefix+":*")
+		parts = append(parts, "to_tsquery('"+constants.SearchConfiguration+
+			"', $"+strconv.Itoa(len(args))+")")
 	}
 
-	query := "SELECT COUNT(1) FROM search_entries WHERE word IN (" +
-		wordList + ")"
-	if placeID > -1 {
-		query += " AND place_id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, placeID)
+	return "(" + strings.Join(parts, " && ") + ")", args
+}
+
+// searchInList builds a list of placeholders for values, appending them
+// to args
+func searchInList(values []string, args []interface{}) (string,
+	[]interface{}) {
+
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		args = append(args, value)
+		placeholders[i] = "$" + strconv.Itoa(len(args))
 	}
-	query += " GROUP BY listing_id"
+	return "(" + strings.Join(placeholders, ", ") + ")", args
+}
 
-	res := db.QueryRow(query, args...)
-	var numRecords int
+// searchFilterClause builds the conditions applied to search_documents d
+// for a set of filters. The type and condition filters can be skipped so
+// that facet counts for those fields aren't narrowed by their own filter
+func searchFilterClause(filters SearchFilters, args []interface{},
+	skipTypes, skipConditions bool) (string, []interface{}) {
+
+	var clause string
+	var list string
+
+	if filters.RestrictByPlace {
+		args = append(args, filters.PlaceID)
+		clause += " AND d.place_id = $" + strconv.Itoa(len(args))
+	}
+	if filters.RestrictByMinPrice {
+		args = append(args, filters.MinPrice)
+		clause += " AND d.listing_price >= $" + strconv.Itoa(len(args))
+	}
+	if filters.RestrictByMaxPrice {
+		args = append(args, filters.MaxPrice)
+		clause += " AND d.listing_price <= $" + strconv.Itoa(len(args))
+	}
+	if len(filters.Types) > 0 && !skipTypes {
+		list, args = searchInList(filters.Types, args)
+		clause += " AND d.listing_type IN " + list
+
+		// Attributes belong to a type, so counts for the other types leave
+		// them out along with the type filter
+		var attributeClause string
+		attributeClause, args = attributeFilterClause(filters.Attributes, args)
+		clause += attributeClause
+	}
+	if len(filters.Conditions) > 0 && !skipConditions {
+		list, args = searchInList(filters.Conditions, args)
+		clause += " AND d.listing_condition IN " + list
+	}
+
+	return clause, args
+}
+
+// searchWhereClause builds the WHERE clause for a search over
+// search_documents d, with the parsed query available as q.query
+func searchWhereClause(query utils.SearchQuery, filters SearchFilters,
+	args []interface{}, skipTypes, skipConditions bool) (string,
+	[]interface{}) {
+
+	var from string
+	var where = " WHERE true"
+	if !query.IsEmpty() {
+		var tsQuery string
+		tsQuery, args = searchTSQuery(query, args)
+		from = ", (SELECT " + tsQuery + " AS query) q"
+		where = " WHERE d.document @@ q.query"
+	}
+
+	// Listings on hold for a buyer or past their expiry stay indexed, so
+	// that they come back as soon as the hold is released or they are
+	// renewed
+	where += " AND NOT EXISTS (SELECT 1 FROM listings h WHERE h.id = " +
+		"d.listing_id AND (h.status = '" + ListingTransaction + "' OR " +
+		"h.expires <= now()))"
+
+	filterClause, args := searchFilterClause(filters, args, skipTypes,
+		skipConditions)
+	return from + where + filterClause, args
+}
+
+// canSearch determines whether there is anything to search for; a search
+// needs either a query or some filter beyond the user's place
+func canSearch(query utils.SearchQuery, filters SearchFilters) bool {
+	return !query.IsEmpty() || filters.IsActive()
+}
+
+// GetPageCountForTerms gets the number of pages available for
+// a given search query and set of filters
+func GetPageCountForTerms(db *sql.DB, query utils.SearchQuery,
+	filters SearchFilters) int {
 
-	err := res.Scan(&numRecords)
+	if !canSearch(query, filters) {
+		return 0
+	}
+
+	where, args := searchWhereClause(query, filters, make([]interface{}, 0, 8),
+		false, false)
+
+	var numRecords int
+	err := db.QueryRow("SELECT COUNT(1) FROM search_documents d"+where,
+		args...).Scan(&numRecords)
 	if err != nil {
 		return 0
 	}
 
-	pageCount := numRecords / 50
-	if numRecords%50 > 0 {
+	pageCount := numRecords / SearchPageSize
+	if numRecords%SearchPageSize > 0 {
 		pageCount++
 	}
 	return pageCount
 }
 
-// DoSearchForTerms attempts to find listings matching a list of query
-// terms
-func DoSearchForTerms(db *sql.DB, terms []string, page int, placeID int) (
-	[]Listing, error) {
+// GetSearchFacets counts the listings matching a search for each listing
+// type and condition
+func GetSearchFacets(db *sql.DB, query utils.SearchQuery,
+	filters SearchFilters) (*SearchFacets, error) {
+
+	facets := &SearchFacets{
+		Types:      make(map[string]int),
+		Conditions: make(map[string]int),
+	}
+	if !canSearch(query, filters) {
+		return facets, nil
+	}
+
+	where, args := searchWhereClause(query, filters, make([]interface{}, 0, 8),
+		true, false)
+	err := countSearchFacet(db, "SELECT d.listing_type, COUNT(1) FROM "+
+		"search_documents d"+where+" GROUP BY d.listing_type", args,
+		facets.Types)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = searchWhereClause(query, filters, make([]interface{}, 0, 8),
+		false, true)
+	err = countSearchFacet(db, "SELECT d.listing_condition, COUNT(1) FROM "+
+		"search_documents d"+where+" GROUP BY d.listing_condition", args,
+		facets.Conditions)
+	if err != nil {
+		return nil, err
+	}
 
-	args := make([]interface{}, 0, maxQueryTermsToConsider+2)
-	argCount := 0
+	return facets, nil
+}
 
-	listings := make([]Listing, 0, 50)
-	numFound := 0
+func countSearchFacet(db *sql.DB, statement string, args []interface{},
+	counts map[string]int) error {
 
-	queryTermCount := len(terms)
-	if queryTermCount > maxQueryTermsToConsider {
-		queryTermCount = maxQueryTermsToConsider
+	rows, err := db.Query(statement, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		var count int
+		if err := rows.Scan(&value, &count); err == nil {
+			counts[value] = count
+		}
 	}
+	return nil
+}
 
-	termList := ""
-	for i := 0; i < queryTermCount; i++ {
-		args = append(args, terms[i])
-		argCount++
-		if i > 0 {
-			termList = termList + ", "
+// searchOrderClause builds the keyset condition and ORDER BY clause for a
+// page of search results. Sorting by relevance falls back to newest first
+// when there is no query to rank listings against
+func searchOrderClause(query utils.SearchQuery, sort string,
+	cursor *ListingCursor, args []interface{}) (string, []interface{}) {
+
+	var keyset string
+	var order string
+	switch {
+	case sort == SortPriceAsc:
+		if cursor != nil {
+			args = append(args, cursor.Price, cursor.ID)
+			keyset = " AND (d.listing_price, d.listing_id) > ($" +
+				strconv.Itoa(len(args)-1) + ", $" + strconv.Itoa(len(args)) + ")"
+		}
+		order = " ORDER BY d.listing_price ASC, d.listing_id ASC"
+	case sort == SortPriceDesc:
+		if cursor != nil {
+			args = append(args, cursor.Price, cursor.ID)
+			keyset = " AND (d.listing_price, d.listing_id) < ($" +
+				strconv.Itoa(len(args)-1) + ", $" + strconv.Itoa(len(args)) + ")"
 		}
-		termList = termList + "$" + strconv.Itoa(argCount)
+		order = " ORDER BY d.listing_price DESC, d.listing_id DESC"
+	case sort == SortRelevance && !query.IsEmpty():
+		if cursor != nil {
+			args = append(args, cursor.Rank, cursor.ID)
+			keyset = " AND (ts_rank_cd(d.document, q.query), d.listing_id) < " +
+				"($" + strconv.Itoa(len(args)-1) + "::real, $" +
+				strconv.Itoa(len(args)) + ")"
+		}
+		order = " ORDER BY ts_rank_cd(d.document, q.query) DESC, " +
+			"d.listing_id DESC"
+	default:
+		if cursor != nil {
+			args = append(args, cursor.ID)
+			keyset = " AND d.listing_id < $" + strconv.Itoa(len(args))
+		}
+		order = " ORDER BY d.listing_id DESC"
+	}
+
+	return keyset + order, args
+}
+
+// SearchPaging selects which page of search results to return, and in what
+// order. If Cursor is set, the page after the cursor is returned and Page
+// is ignored
+type SearchPaging struct {
+	Sort   string
+	Page   int
+	Cursor *ListingCursor
+}
+
+// DoSearchForTerms attempts to find listings matching a search query and
+// set of filters, ordered by the sort given in paging
+func DoSearchForTerms(db *sql.DB, query utils.SearchQuery,
+	filters SearchFilters, paging SearchPaging) ([]Listing, error) {
+
+	listings := make([]Listing, 0, SearchPageSize)
+	if !canSearch(query, filters) {
+		return listings, nil
+	}
+
+	where, args := searchWhereClause(query, filters, make([]interface{}, 0, 12),
+		false, false)
+	rank := "0::real"
+	if !query.IsEmpty() {
+		rank = "ts_rank_cd(d.document, q.query)"
+	}
+	statement := "SELECT d.listing_id, d.listing_name, d.listing_price, " +
+		"d.listing_image, d.listing_type, d.listing_condition, " + rank +
+		" FROM search_documents d" + where
+
+	// A cursor from a different sort order doesn't mark a position in this
+	// one, so the first page is returned instead
+	cursor := paging.Cursor
+	if cursor != nil && strings.Compare(cursor.Sort, paging.Sort) != 0 {
+		cursor = nil
 	}
 
-	query := "SELECT listing_id, min(listing_name), min(listing_price), " +
-		"min(listing_image) FROM search_entries WHERE word IN (" + termList + ")"
+	var order string
+	order, args = searchOrderClause(query, paging.Sort, cursor, args)
+	statement += order
+
+	args = append(args, SearchPageSize)
+	statement += " LIMIT $" + strconv.Itoa(len(args))
+	if cursor == nil {
+		args = append(args, SearchPageSize*paging.Page)
+		statement += " OFFSET $" + strconv.Itoa(len(args))
+	}
 
-	if placeID > -1 {
-		args = append(args, placeID)
-		argCount++
-		query = query + " AND place_id = $" + strconv.Itoa(argCount)
+	rows, err := db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var listing Listing
+		err := rows.Scan(&listing.ID, &listing.Name, &listing.Price,
+			&listing.ImageURL, &listing.Type, &listing.Condition,
+			&listing.searchRank)
+		if err == nil {
+			listing.PriceClient = utils.PriceServerToClient(listing.Price)
+			if listing.ImageURL == nil {
+				listing.ImageURL = &ImageNotFound
+			}
+			listings = append(listings, listing)
+		}
 	}
 
-	query = query + " GROUP BY listing_id ORDER BY sum(count) DESC LIMIT $" +
-		strconv.Itoa(argCount+1) + " OFFSET $" + strconv.Itoa(argCount+2)
+	return listings, nil
+}
+
+const (
+	// SimilarListingsCount is the number of similar listings shown with a
+	// listing
+	SimilarListingsCount = 6
+
+	// similarTypeWeight and similarPriceWeight are added to a listing's
+	// similarity score if it has the same type, or is in the same price band.
+	// Each shared word adds 1 divided by the number of listings using it
+	similarTypeWeight  = 0.5
+	similarPriceWeight = 0.25
+	// similarPriceBand is how many times cheaper or more expensive a listing
+	// can be and still be in the same price band
+	similarPriceBand = 2
+)
+
+// GetSimilarListings finds published listings in the same place as a
+// listing which share words with it, or have the same type and a price in
+// the same band. Rarer shared words count for more than common ones
+func (l *Listing) GetSimilarListings(db *sql.DB, limit int) ([]Listing,
+	error) {
 
-	args = append(args, searchPageSize, searchPageSize*page)
+	listings := make([]Listing, 0, limit)
+	minPrice := l.Price / similarPriceBand
+	maxPrice := l.Price * similarPriceBand
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.Query("WITH terms AS (SELECT word, 1.0 / COUNT(1) AS "+
+		"weight FROM search_entries WHERE place_id = $2 AND word IN (SELECT "+
+		"word FROM search_entries WHERE listing_id = $1) GROUP BY word) "+
+		"SELECT e.listing_id, e.listing_name, e.listing_price, e.listing_image, "+
+		"e.listing_type FROM search_entries e LEFT JOIN terms t ON "+
+		"t.word = e.word WHERE e.place_id = $2 AND e.listing_id <> $1 AND "+
+		"NOT EXISTS (SELECT 1 FROM listings h WHERE h.id = e.listing_id AND "+
+		"(h.status = '"+ListingTransaction+"' OR h.expires <= now())) AND "+
+		"(t.word IS NOT NULL OR (e.listing_type = $3 AND e.listing_price "+
+		"BETWEEN $4 AND $5)) GROUP BY e.listing_id, e.listing_name, "+
+		"e.listing_price, e.listing_image, e.listing_type ORDER BY "+
+		"COALESCE(SUM(t.weight), 0) + CASE WHEN e.listing_type = $3 THEN "+
+		"$6::float8 ELSE 0 END + CASE WHEN e.listing_price BETWEEN $4 AND $5 "+
+		"THEN $7::float8 ELSE 0 END DESC, e.listing_id DESC LIMIT $8", l.ID, l.User.PlaceID,
+		l.Type, minPrice, maxPrice, similarTypeWeight, similarPriceWeight,
+		limit)
 	if err != nil {
+		fmt.Println("[ERROR] models.Listing.GetSimilarListings: " + err.Error())
 		return nil, err
 	}
 	defer rows.Close()
+
 	for rows.Next() {
 		var listing Listing
 		err := rows.Scan(&listing.ID, &listing.Name, &listing.Price,
-			&listing.ImageURL)
+			&listing.ImageURL, &listing.Type)
 		if err == nil {
 			listing.PriceClient = utils.PriceServerToClient(listing.Price)
 			if listing.ImageURL == nil {
 				listing.ImageURL = &ImageNotFound
 			}
 			listings = append(listings, listing)
-			numFound++
 		}
 	}
 
-	return listings[:numFound], nil
+	return listings, nil
+}
+
+// SearchSuggestionSource holds the indexed words and title of a listing,
+// which are suggested to users typing a search query in its place
+type SearchSuggestionSource struct {
+	ListingID int
+	PlaceID   int
+	Title     string
+	Words     []string
+	// Visible is unset for listings which can't be shown in search results,
+	// so their words and title shouldn't be suggested any more
+	Visible bool
+}
+
+// searchVisibleCondition holds for listings l which can be shown in search
+// results, the same as in searchWhereClause
+const searchVisibleCondition = "NOT (l.status = '" + ListingTransaction +
+	"' OR l.expires IS NOT NULL AND l.expires <= now())"
+
+// GetSearchSuggestionSources gets the words and titles of the listings
+// whose search index entries or visibility changed after since, or of every
+// indexed listing which can be shown if since is zero. Deleted listings
+// aren't returned. asOf is the database time the sources were read at
+func GetSearchSuggestionSources(db *sql.DB, since time.Time) (
+	sources []SearchSuggestionSource, asOf time.Time, err error) {
+
+	if err := db.QueryRow("SELECT now()").Scan(&asOf); err != nil {
+		return nil, asOf, err
+	}
+
+	var rows *sql.Rows
+	if since.IsZero() {
+		rows, err = db.Query("SELECT DISTINCT l.id, l.place_id, l.name, " +
+			"e.word, true FROM search_entries e JOIN listings l ON l.id = " +
+			"e.listing_id WHERE " + searchVisibleCondition + " ORDER BY l.id")
+	} else {
+		// Listings drop out of search results without being modified when
+		// they expire, so those are picked up by their expiry
+		rows, err = db.Query("SELECT DISTINCT l.id, l.place_id, l.name, "+
+			"e.word, "+searchVisibleCondition+" FROM listings l LEFT JOIN "+
+			"search_entries e ON e.listing_id = l.id WHERE l.modified > $1 OR "+
+			"(l.expires > $1 AND l.expires <= now()) OR l.id IN (SELECT "+
+			"listing_id FROM search_entries WHERE modified > $1) ORDER BY l.id",
+			since)
+	}
+	if err != nil {
+		return nil, asOf, err
+	}
+	defer rows.Close()
+
+	sources = make([]SearchSuggestionSource, 0, 64)
+	for rows.Next() {
+		var source SearchSuggestionSource
+		var word sql.NullString
+		err := rows.Scan(&source.ListingID, &source.PlaceID, &source.Title,
+			&word, &source.Visible)
+		if err != nil {
+			return nil, asOf, err
+		}
+		last := len(sources) - 1
+		if last < 0 || sources[last].ListingID != source.ListingID {
+			sources = append(sources, source)
+			last++
+		}
+		// Listings without entries, like drafts, have nothing to suggest
+		if word.Valid {
+			sources[last].Words = append(sources[last].Words, word.String)
+		} else {
+			sources[last].Visible = false
+		}
+	}
+	return sources, asOf, rows.Err()
 }
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/anishmgoyal/calagora/constants"
+)
+
+// SearchIndexReport lists the listings whose search index entries don't
+// match the listings table
+type SearchIndexReport struct {
+	// Missing are published listings which aren't in the index
+	Missing []int
+	// Unpublished are listings in the index which aren't published
+	Unpublished []int
+	// Orphaned are listing IDs in the index which no longer exist
+	Orphaned []int
+	// Stale are listings indexed by an older analyzer
+	Stale []int
+}
+
+// IsConsistent returns true if no problems were found with the index
+func (r *SearchIndexReport) IsConsistent() bool {
+	return len(r.Missing) == 0 && len(r.Unpublished) == 0 &&
+		len(r.Orphaned) == 0 && len(r.Stale) == 0
+}
+
+// ListingIDs gets every listing ID in the report, without duplicates
+func (r *SearchIndexReport) ListingIDs() []int {
+	seen := make(map[int]bool)
+	ids := make([]int, 0)
+	for _, group := range [][]int{r.Missing, r.Unpublished, r.Orphaned,
+		r.Stale} {
+
+		for _, id := range group {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// VerifySearchIndex checks that every published listing is in the search
+// index, and that no unpublished or deleted listing is
+func VerifySearchIndex(db *sql.DB) (*SearchIndexReport, error) {
+	var report SearchIndexReport
+	var err error
+
+	report.Missing, err = queryListingIDs(db, "SELECT l.id FROM listings l "+
+		"LEFT JOIN search_documents d ON d.listing_id = l.id WHERE "+
+		"l.published = true AND d.listing_id IS NULL ORDER BY l.id")
+	if err != nil {
+		return nil, err
+	}
+
+	report.Unpublished, err = queryListingIDs(db, "SELECT DISTINCT l.id FROM "+
+		"listings l WHERE l.published = false AND (EXISTS (SELECT 1 FROM "+
+		"search_documents d WHERE d.listing_id = l.id) OR EXISTS (SELECT 1 FROM "+
+		"search_entries e WHERE e.listing_id = l.id)) ORDER BY l.id")
+	if err != nil {
+		return nil, err
+	}
+
+	report.Orphaned, err = queryListingIDs(db, "SELECT listing_id FROM "+
+		"(SELECT listing_id FROM search_documents UNION SELECT listing_id FROM "+
+		"search_entries) i WHERE NOT EXISTS (SELECT 1 FROM listings l WHERE "+
+		"l.id = i.listing_id) ORDER BY listing_id")
+	if err != nil {
+		return nil, err
+	}
+
+	report.Stale, err = queryListingIDs(db, "SELECT listing_id FROM "+
+		"search_documents WHERE analyzer_version < $1 ORDER BY listing_id",
+		constants.SearchAnalyzerVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+func queryListingIDs(db *sql.DB, statement string, args ...interface{}) (
+	[]int, error) {
+
+	rows, err := db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CountListings gets the number of listings, published or not
+func CountListings(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(1) FROM listings").Scan(&count)
+	return count, err
+}
+
+// GetListingIDsAfter gets up to limit listing IDs greater than afterID, in
+// order. It is used to walk through every listing in batches
+func GetListingIDsAfter(db *sql.DB, afterID, limit int) ([]int, error) {
+	return queryListingIDs(db, "SELECT id FROM listings WHERE id > $1 "+
+		"ORDER BY id LIMIT $2", afterID, limit)
+}
+
+// ReindexListing rebuilds the search index entries for a listing by its
+// ID, without alerting saved searches. If the listing no longer exists, any
+// entries left for it are removed
+func ReindexListing(db *sql.DB, id int) error {
+	listing, err := GetListingByID(db, id)
+	if err != nil {
+		return err
+	}
+	if listing == nil {
+		_, err = db.Exec("DELETE FROM search_entries WHERE listing_id = $1", id)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("DELETE FROM search_documents WHERE listing_id = $1",
+			id)
+		return err
+	}
+	_, err = listing.rebuildSearchIndex(db, false)
+	return err
+}
+
+// RebuildStaleSearchIndex indexes any published listings which are missing
+// from the search index, or were indexed by an older analyzer. Listings are
+// indexed one at a time, and saved search alerts aren't sent for them
+func RebuildStaleSearchIndex(db *sql.DB) {
+	ids, err := queryListingIDs(db, "SELECT l.id FROM listings l LEFT JOIN "+
+		"search_documents d ON d.listing_id = l.id WHERE l.published = true AND "+
+		"(d.listing_id IS NULL OR d.analyzer_version < $1) ORDER BY l.id",
+		constants.SearchAnalyzerVersion)
+	if err != nil {
+		fmt.Println("[ERROR] models.RebuildStaleSearchIndex: " + err.Error())
+		return
+	}
+
+	numRebuilt := 0
+	for _, id := range ids {
+		if err := ReindexListing(db, id); err != nil {
+			fmt.Println("[ERROR] models.RebuildStaleSearchIndex: listing " +
+				strconv.Itoa(id) + ": " + err.Error())
+			continue
+		}
+		numRebuilt++
+	}
+	if numRebuilt > 0 {
+		fmt.Println("[INFO] models.RebuildStaleSearchIndex: " +
+			strconv.Itoa(numRebuilt) + " listings indexed")
+	}
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// maxLoggedQueryLength is the most characters of a query that are logged
+const maxLoggedQueryLength = 255
+
+// SearchQueryLog is a record of a search made by a user, used to find out
+// what people search for and whether they find it
+type SearchQueryLog struct {
+	ID          int
+	PlaceID     int
+	Query       string
+	Terms       string
+	ResultCount int
+	Latency     time.Duration
+	Corrected   bool
+}
+
+// NewSearchQueryLog creates a log entry for a query, normalizing its terms
+// so that it can be grouped with similar queries
+func NewSearchQueryLog(placeID int, query string, resultCount int,
+	latency time.Duration, corrected bool) *SearchQueryLog {
+
+	terms := utils.NormalizeSearchQuery(query)
+	return &SearchQueryLog{
+		PlaceID:     placeID,
+		Query:       truncateRunes(query, maxLoggedQueryLength),
+		Terms:       truncateRunes(terms, maxLoggedQueryLength),
+		ResultCount: resultCount,
+		Latency:     latency,
+		Corrected:   corrected,
+	}
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// Create saves a search query log entry, and sets its ID
+func (q *SearchQueryLog) Create(db *sql.DB) error {
+	var placeID *int
+	if q.PlaceID > 0 {
+		placeID = &q.PlaceID
+	}
+
+	err := db.QueryRow("INSERT INTO search_queries (place_id, query, terms, "+
+		"result_count, latency_ms, corrected) VALUES ($1, $2, $3, $4, $5, $6) "+
+		"RETURNING id", placeID, q.Query, q.Terms, q.ResultCount,
+		int(q.Latency/time.Millisecond), q.Corrected).Scan(&q.ID)
+	if err != nil {
+		fmt.Println("[ERROR] models.SearchQueryLog.Create: " + err.Error())
+	}
+	return err
+}
+
+// RecordSearchClick records that a user opened a listing from the results
+// of a search. Only the first click on each listing is kept, and clicks
+// for searches that were never logged are ignored
+func RecordSearchClick(db *sql.DB, searchQueryID, listingID, position int) {
+	_, err := db.Exec("INSERT INTO search_clicks (search_query_id, listing_id, "+
+		"position) SELECT $1, $2, $3 WHERE EXISTS (SELECT 1 FROM search_queries "+
+		"WHERE id = $1) ON CONFLICT DO NOTHING", searchQueryID, listingID,
+		position)
+	if err != nil {
+		fmt.Println("[ERROR] models.RecordSearchClick: " + err.Error())
+	}
+}
+
+// SearchQueryStat summarizes every logged search for the same terms
+type SearchQueryStat struct {
+	Terms       string
+	Example     string
+	Searches    int
+	ZeroResults int
+	Clicked     int
+	Corrected   int
+	AvgResults  float64
+	AvgLatency  float64
+}
+
+// ClickThroughRate gets the percentage of searches where a user opened at
+// least one of the results
+func (s SearchQueryStat) ClickThroughRate() float64 {
+	if s.Searches == 0 {
+		return 0
+	}
+	return float64(s.Clicked) * 100 / float64(s.Searches)
+}
+
+// SearchReport summarizes the searches made since a point in time
+type SearchReport struct {
+	Since             time.Time
+	Totals            SearchQueryStat
+	TopQueries        []SearchQueryStat
+	ZeroResultQueries []SearchQueryStat
+}
+
+// searchStatColumns are the columns scanned by scanSearchQueryStat, over
+// search_queries q joined to the clicked searches c
+const searchStatColumns = "COUNT(1), " +
+	"COUNT(CASE WHEN q.result_count = 0 THEN 1 END), " +
+	"COUNT(c.search_query_id), COUNT(CASE WHEN q.corrected THEN 1 END), " +
+	"COALESCE(AVG(q.result_count), 0), COALESCE(AVG(q.latency_ms), 0)"
+
+const searchStatFrom = " FROM search_queries q LEFT JOIN (SELECT DISTINCT " +
+	"search_query_id FROM search_clicks) c ON c.search_query_id = q.id"
+
+// GetSearchReport builds a report of searches made since a point in time,
+// in a single place or every place if placeID is 0. At most limit queries
+// are included in each list
+func GetSearchReport(db *sql.DB, placeID int, since time.Time,
+	limit int) (*SearchReport, error) {
+
+	where := " WHERE q.created >= $1"
+	args := []interface{}{since}
+	if placeID > 0 {
+		args = append(args, placeID)
+		where += " AND q.place_id = $" + strconv.Itoa(len(args))
+	}
+
+	report := &SearchReport{Since: since}
+	err := scanSearchQueryStat(db.QueryRow("SELECT '', '', "+
+		searchStatColumns+searchStatFrom+where, args...), &report.Totals)
+	if err != nil {
+		fmt.Println("[ERROR] models.GetSearchReport: " + err.Error())
+		return nil, err
+	}
+
+	args = append(args, limit)
+	limitArg := "$" + strconv.Itoa(len(args))
+
+	report.TopQueries, err = getSearchQueryStats(db, where+
+		" GROUP BY q.terms ORDER BY COUNT(1) DESC, q.terms LIMIT "+limitArg,
+		args)
+	if err != nil {
+		return nil, err
+	}
+
+	report.ZeroResultQueries, err = getSearchQueryStats(db, where+
+		" GROUP BY q.terms HAVING MIN(q.result_count) = 0 ORDER BY "+
+		"COUNT(CASE WHEN q.result_count = 0 THEN 1 END) DESC, q.terms LIMIT "+
+		limitArg, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func getSearchQueryStats(db *sql.DB, clauses string,
+	args []interface{}) ([]SearchQueryStat, error) {
+
+	rows, err := db.Query("SELECT q.terms, MIN(q.query), "+searchStatColumns+
+		searchStatFrom+clauses, args...)
+	if err != nil {
+		fmt.Println("[ERROR] models.getSearchQueryStats: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]SearchQueryStat, 0, 50)
+	for rows.Next() {
+		var stat SearchQueryStat
+		if err := scanSearchQueryStat(rows, &stat); err != nil {
+			fmt.Println("[ERROR] models.getSearchQueryStats: " + err.Error())
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+type searchStatScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSearchQueryStat(row searchStatScanner, stat *SearchQueryStat) error {
+	return row.Scan(&stat.Terms, &stat.Example, &stat.Searches,
+		&stat.ZeroResults, &stat.Clicked, &stat.Corrected, &stat.AvgResults,
+		&stat.AvgLatency)
+}
@@ -125,7 +125,7 @@ func isSessionIDTaken(db *sql.DB, sessionID string) bool {
 
 // GetSessionFromRequest checks if the current request
 // has session data; if so, attempts to get a session
-func GetSessionFromRequest(db *sql.DB, w http.ResponseWriter,
+func GetSessionFromRequest(sessions SessionStore, w http.ResponseWriter,
 	r *http.Request) *Session {
 
 	sessionID := utils.GetCookie(r, "session_id")
@@ -139,7 +139,7 @@ func GetSessionFromRequest(db *sql.DB, w http.ResponseWriter,
 		return nil
 	}
 
-	session := GetSession(db, sessionID, sessionSecret, r.Header.Get("User-Agent"))
+	session := sessions.Get(sessionID, sessionSecret, r.Header.Get("User-Agent"))
 	if session == nil {
 		utils.DeleteCookie(w, "session_id")
 		utils.DeleteCookie(w, "session_secret")
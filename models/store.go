@@ -0,0 +1,195 @@
+package models
+
+import "time"
+
+// Store holds the repositories used to load and save models. Controllers go
+// through a Store rather than a database connection, so that the same code
+// can run against PostgreSQL or against memory in tests and demos. Search
+// and the features built on it still need PostgreSQL
+type Store struct {
+	Users         UserStore
+	Places        PlaceStore
+	Listings      ListingStore
+	Offers        OfferStore
+	Messages      MessageStore
+	Meetups       MeetupStore
+	Reviews       ReviewStore
+	Images        ImageStore
+	Notifications NotificationStore
+	Sessions      SessionStore
+}
+
+// UserStore loads and saves users
+type UserStore interface {
+	// Create validates and inserts a new user, setting its ID and activation
+	Create(user *User) (bool, *UserError)
+	// Save validates and saves changes to a user's profile
+	Save(user *User) (bool, *UserError)
+	// Validate checks if the fields in a user are valid
+	Validate(user *User, validatePassword bool,
+		validateUserExists bool) (bool, UserError)
+	// Activate marks a user's account as active
+	Activate(user *User) error
+	GetByID(id int) *User
+	GetByUsername(username string) *User
+	GetByEmailAddress(emailAddress string) (*User, error)
+}
+
+// PlaceStore loads places
+type PlaceStore interface {
+	GetByID(id int) (*Place, error)
+	// FindID gets the ID of the place with an email domain matching an email
+	// address, or -1 if there isn't one
+	FindID(emailAddress string) (int, error)
+}
+
+// ListingStore loads and saves listings
+type ListingStore interface {
+	Create(listing *Listing) (bool, *ListingError)
+	Save(listing *Listing) (bool, *ListingError)
+	// Delete removes a listing along with its images
+	Delete(listing *Listing) (bool, error)
+	MarkSold(listing *Listing) (bool, error)
+	// Renew pushes back the expiry of a published listing, and Bump moves
+	// it to the top of the listing feed. Bump fails with ErrBumpTooSoon if
+	// the listing was bumped within ListingBumpInterval
+	Renew(listing *Listing) error
+	Bump(listing *Listing) error
+	// RemindExpiring marks the listings for sale expiring within
+	// ListingReminderWindow of now whose sellers haven't been reminded yet,
+	// and returns them with the email addresses of their sellers
+	RemindExpiring(now time.Time) ([]Listing, error)
+	// PublishScheduled publishes the drafts scheduled to be published by
+	// now, and returns them with the email addresses of their sellers
+	PublishScheduled(now time.Time) ([]Listing, error)
+	GetByID(id int) (*Listing, error)
+	GetList(options ListingQueryOpts) []Listing
+	// GetOfferRules gets the offer rules for a listing, which are empty if
+	// the seller hasn't set any
+	GetOfferRules(listingID int) (*OfferRules, error)
+	// SaveOfferRules validates and replaces the offer rules for a listing
+	SaveOfferRules(rules *OfferRules) (bool, *OfferRulesError)
+}
+
+// OfferStore loads and saves offers
+type OfferStore interface {
+	Create(offer *Offer) (bool, *OfferError)
+	// Revise saves a new price from the buyer, reopening the offer if it was
+	// closed
+	Revise(offer *Offer) (bool, *OfferError)
+	// CounterOffer saves a new price from the seller
+	CounterOffer(offer *Offer) (bool, *OfferError)
+	// Decline and Withdraw close an offer for the seller and the buyer,
+	// taking its listing off hold if it was held for the offer, and fail
+	// with ErrOfferStatus if it is already closed
+	Decline(offer *Offer) error
+	Withdraw(offer *Offer) error
+	// Accept marks an open offer as accepted, holding its listing for the
+	// buyer until the offer expires if Holding is set. It fails with
+	// ErrListingSold, ErrListingHeld or ErrOfferStatus if it can't be
+	Accept(offer *Offer) error
+	// Finalize completes an offer, marks its listings sold and declines the
+	// other open offers on any of them in one step, returning the declined
+	// offers. A listing on hold can only be sold to the buyer it is held for
+	Finalize(offer *Offer) ([]Offer, error)
+	// ApplyRules accepts or declines a new or revised offer if the offer
+	// rules of its listing say to, returning the action taken or an empty
+	// string if there wasn't one
+	ApplyRules(offer *Offer) (string, error)
+	// Expire expires every offer past its expiry at now, taking the
+	// listings of lapsed deals off hold, and returns the expired offers
+	// with the email addresses of their buyers and sellers
+	Expire(now time.Time) ([]ExpiredOffer, error)
+	// GetHistory gets the events of each of a set of offers, oldest first,
+	// keyed by offer ID
+	GetHistory(offerIDs []int) (map[int][]OfferEvent, error)
+	// GetBundles gets the listings covered by each of a set of bundle
+	// offers, keyed by offer ID
+	GetBundles(offerIDs []int) (map[int][]Listing, error)
+	GetByID(id int) (*Offer, error)
+	GetForListing(listing *Listing, pageNum, pageSize int) ([]Offer, error)
+	GetAsSeller(user *User, pageNum, pageSize int) ([]Offer, error)
+	GetAsBuyer(user *User) ([]Offer, error)
+	// GetOnListing gets the offer a user has made on a listing by itself
+	GetOnListing(user *User, listingID int) (*Offer, error)
+	// GetConversations gets the accepted offers a user is buying or selling
+	// under, which are the conversations they can send messages in
+	GetConversations(user *User) ([]Offer, error)
+}
+
+// MessageStore loads and saves messages
+type MessageStore interface {
+	Create(message *Message) (bool, *MessageError)
+	MarkRead(message *Message, recepientID int)
+	// GetForOffer gets a page of the messages sent under an offer, newest
+	// first, and marks the ones sent to recepientID as read
+	GetForOffer(offer *Offer, pageSize, page int, recepientID int) ([]Message,
+		error)
+	GetLast(offer *Offer) (*Message, error)
+	GetUnreadCount(user *User) int
+}
+
+// MeetupStore loads and saves the meetups planned under accepted offers
+type MeetupStore interface {
+	// Propose validates and saves a meetup, replacing the offer's meetup if
+	// it already had one
+	Propose(meetup *Meetup) (bool, *MeetupError)
+	// Answer accepts or declines a proposed meetup for the party who didn't
+	// propose it, and fails with ErrMeetupStatus if it can't
+	Answer(meetup *Meetup, user *User, status string) error
+	// GetForOffer gets the meetup under an offer, or nil if there isn't one
+	GetForOffer(offerID int) (*Meetup, error)
+}
+
+// ReviewStore loads and saves the reviews left under completed offers
+type ReviewStore interface {
+	// Create validates and inserts a review from its reviewer, filling in
+	// the reviewee from its offer. It fails if the offer isn't completed,
+	// the reviewer wasn't a party to it or they already reviewed it
+	Create(review *Review) (bool, *ReviewError)
+	// GetForUser gets a page of the reviews a user received, newest first
+	GetForUser(userID, page int) ([]Review, error)
+	GetForOffer(offerID int) ([]Review, error)
+	// GetReputations gets the reputation of each of a set of users, keyed by
+	// user ID
+	GetReputations(userIDs []int) (map[int]Reputation, error)
+}
+
+// ImageStore loads and saves images
+type ImageStore interface {
+	// Create inserts an image, and fails if its listing has too many images
+	Create(image *Image) (bool, error)
+	Save(image *Image) (bool, error)
+	// Delete removes an image along with its uploaded file
+	Delete(image *Image) (bool, error)
+	GetByID(id int) (*Image, error)
+	GetForListing(listing *Listing) ([]Image, error)
+	GetCountForListing(listing *Listing) (int, error)
+	// SetPrimary makes an image the first one shown for a listing
+	SetPrimary(listing *Listing, id int) (bool, error)
+}
+
+// NotificationStore loads and saves notifications
+type NotificationStore interface {
+	// Create inserts a notification, dropping the user's oldest ones past
+	// MaxNotificationsToKeep
+	Create(notification *Notification) (bool, error)
+	GetRecent(user *User, page int) []Notification
+	GetUnreadCount(user *User) int
+	MarkRead(user *User, id int) error
+	// MarkReadUpTo marks every notification up to and including id as read
+	MarkReadUpTo(user *User, id int) error
+}
+
+// SessionStore loads and saves sessions
+type SessionStore interface {
+	// Create inserts a session for an authenticated user, generating its ID,
+	// secret and CSRF token
+	Create(session *Session) (bool, error)
+	// Update keeps an active session from timing out
+	Update(session *Session)
+	// Get finds a session, or returns nil if there isn't one or it has
+	// timed out
+	Get(sessionID string, sessionSecret string, browserAgent string) *Session
+	Delete(session *Session) bool
+}
@@ -0,0 +1,1876 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// memoryData holds every model kept by a memory store. Each repository in
+// the store is a view over the same data, so that listings can be joined to
+// their users, offers to their listings, and so on, like the tables in
+// PostgreSQL are
+type memoryData struct {
+	sync.Mutex
+	lastID        map[string]int
+	places        []Place
+	users         map[int]User
+	listings      map[int]Listing
+	offers        map[int]Offer
+	offerEvents   []OfferEvent
+	offerRules    map[int]OfferRules
+	offerBundles  map[int][]int
+	messages      map[int]Message
+	meetups       map[int]Meetup
+	reviews       map[int]Review
+	images        map[int]Image
+	notifications map[int]Notification
+	sessions      map[string]Session
+	// reminded holds the listings whose sellers were reminded that they
+	// are about to expire
+	reminded map[int]bool
+}
+
+// NewMemoryStore creates a Store which keeps models in memory, for tests
+// and demos. Nothing is saved when the process exits. Users can only sign
+// up with an email address in one of places
+func NewMemoryStore(places ...Place) *Store {
+	data := &memoryData{
+		lastID:        make(map[string]int),
+		places:        places,
+		users:         make(map[int]User),
+		listings:      make(map[int]Listing),
+		offers:        make(map[int]Offer),
+		offerRules:    make(map[int]OfferRules),
+		offerBundles:  make(map[int][]int),
+		messages:      make(map[int]Message),
+		meetups:       make(map[int]Meetup),
+		reviews:       make(map[int]Review),
+		images:        make(map[int]Image),
+		notifications: make(map[int]Notification),
+		sessions:      make(map[string]Session),
+		reminded:      make(map[int]bool),
+	}
+	return &Store{
+		Users:         &memUserStore{data},
+		Places:        &memPlaceStore{data},
+		Listings:      &memListingStore{data},
+		Offers:        &memOfferStore{data},
+		Messages:      &memMessageStore{data},
+		Meetups:       &memMeetupStore{data},
+		Reviews:       &memReviewStore{data},
+		Images:        &memImageStore{data},
+		Notifications: &memNotificationStore{data},
+		Sessions:      &memSessionStore{data},
+	}
+}
+
+// nextID gets the next ID for a table, like a SERIAL column would
+func (d *memoryData) nextID(table string) int {
+	d.lastID[table]++
+	return d.lastID[table]
+}
+
+// userRef gets the public fields of a user, as they are joined onto other
+// models
+func (d *memoryData) userRef(id int) User {
+	user := d.users[id]
+	return User{
+		ID:           user.ID,
+		Username:     user.Username,
+		DisplayName:  user.DisplayName,
+		EmailAddress: user.EmailAddress,
+		PlaceID:      user.PlaceID,
+	}
+}
+
+// listingUser gets the user who posted a listing, in the place the
+// listing was posted in
+func (d *memoryData) listingUser(listing *Listing) User {
+	user := d.userRef(listing.User.ID)
+	user.PlaceID = listing.User.PlaceID
+	return user
+}
+
+// primaryImageURL gets the URL of the first image of a listing
+func (d *memoryData) primaryImageURL(listingID int) *string {
+	var primary *Image
+	for _, id := range d.imageIDs() {
+		image := d.images[id]
+		if image.Media == MediaListing && image.MediaID == listingID &&
+			(primary == nil || image.Ordinal < primary.Ordinal) {
+
+			primary = &image
+		}
+	}
+	if primary == nil {
+		return &ImageNotFound
+	}
+	url := primary.URL
+	return &url
+}
+
+// sortedIntKeys collects the keys of a map with collect, and sorts them so
+// that models are always visited in the order they were created
+func sortedIntKeys(size int, collect func(ids []int) []int) []int {
+	ids := collect(make([]int, 0, size))
+	sort.Ints(ids)
+	return ids
+}
+
+func (d *memoryData) listingIDs() []int {
+	return sortedIntKeys(len(d.listings), func(ids []int) []int {
+		for id := range d.listings {
+			ids = append(ids, id)
+		}
+		return ids
+	})
+}
+
+func (d *memoryData) offerIDs() []int {
+	return sortedIntKeys(len(d.offers), func(ids []int) []int {
+		for id := range d.offers {
+			ids = append(ids, id)
+		}
+		return ids
+	})
+}
+
+func (d *memoryData) messageIDs() []int {
+	return sortedIntKeys(len(d.messages), func(ids []int) []int {
+		for id := range d.messages {
+			ids = append(ids, id)
+		}
+		return ids
+	})
+}
+
+func (d *memoryData) imageIDs() []int {
+	return sortedIntKeys(len(d.images), func(ids []int) []int {
+		for id := range d.images {
+			ids = append(ids, id)
+		}
+		return ids
+	})
+}
+
+func (d *memoryData) reviewIDs() []int {
+	return sortedIntKeys(len(d.reviews), func(ids []int) []int {
+		for id := range d.reviews {
+			ids = append(ids, id)
+		}
+		return ids
+	})
+}
+
+func (d *memoryData) notificationIDs() []int {
+	return sortedIntKeys(len(d.notifications), func(ids []int) []int {
+		for id := range d.notifications {
+			ids = append(ids, id)
+		}
+		return ids
+	})
+}
+
+// page gets the bounds of a page of n results, for use in slicing
+func page(n, offset, limit int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	end := offset + limit
+	if end > n || limit < 0 {
+		end = n
+	}
+	return offset, end
+}
+
+type memUserStore struct {
+	data *memoryData
+}
+
+func (s *memUserStore) Create(user *User) (bool, *UserError) {
+	user.Normalize()
+	valid, validationError := s.Validate(user, true, true)
+	if !valid {
+		return false, &validationError
+	}
+
+	encryptedPassword, salt, err := encryptPassword(user.Password, nil)
+	if err != nil {
+		return false, &UserError{
+			Global: "An unexpected error occurred.",
+		}
+	}
+	activationString, err := generateActivationString()
+	if err != nil {
+		return false, &UserError{
+			Global: "An unexpected error occurred.",
+		}
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	for _, existing := range s.data.users {
+		if existing.Username == user.Username {
+			return false, &UserError{Username: "That username is taken, sorry!"}
+		}
+	}
+
+	user.ID = s.data.nextID("users")
+	user.Password = encryptedPassword
+	user.Salt = salt
+	user.PasswordConfirmation = ""
+	user.Activation = activationString
+	s.data.users[user.ID] = *user
+	return true, nil
+}
+
+func (s *memUserStore) Save(user *User) (bool, *UserError) {
+	if user == nil {
+		return false, &UserError{
+			Global: "User not found",
+		}
+	}
+
+	user.Normalize()
+	validatePassword := len(user.Password) > 0
+	valid, validationErr := s.Validate(user, validatePassword, false)
+	if !valid {
+		return valid, &validationErr
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.users[user.ID]
+	if !ok {
+		return false, &UserError{
+			Global: "An unexpected error occurred.",
+		}
+	}
+
+	saved.DisplayName = user.DisplayName
+	if validatePassword {
+		encryptedPassword, salt, err := encryptPassword(user.Password, nil)
+		if err != nil {
+			return false, &UserError{
+				Global: "An unexpected error occurred.",
+			}
+		}
+		saved.Password = encryptedPassword
+		saved.Salt = salt
+	}
+	s.data.users[user.ID] = saved
+	return true, nil
+}
+
+func (s *memUserStore) Validate(user *User, validatePassword bool,
+	validateUserExists bool) (bool, UserError) {
+
+	places := memPlaceStore{s.data}
+	return user.validate(validatePassword, func() bool {
+		if !validateUserExists {
+			return false
+		}
+		return s.GetByUsername(user.Username) != nil
+	}, places.FindID)
+}
+
+func (s *memUserStore) Activate(user *User) error {
+	if user == nil {
+		return errors.New("No user specified.")
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	if saved, ok := s.data.users[user.ID]; ok {
+		saved.Activation = "ACTIVATION_ACTIVE"
+		s.data.users[user.ID] = saved
+	}
+	return nil
+}
+
+func (s *memUserStore) GetByID(id int) *User {
+	s.data.Lock()
+	defer s.data.Unlock()
+	user, ok := s.data.users[id]
+	if !ok {
+		return nil
+	}
+	return &user
+}
+
+func (s *memUserStore) GetByUsername(username string) *User {
+	username = strings.TrimSpace(strings.ToLower(username))
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	for _, user := range s.data.users {
+		if user.Username == username {
+			return &user
+		}
+	}
+	return nil
+}
+
+func (s *memUserStore) GetByEmailAddress(emailAddress string) (*User,
+	error) {
+
+	emailAddress = strings.TrimSpace(strings.ToLower(emailAddress))
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	for id, user := range s.data.users {
+		if user.EmailAddress == emailAddress {
+			found := s.data.userRef(id)
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+type memPlaceStore struct {
+	data *memoryData
+}
+
+func (s *memPlaceStore) GetByID(id int) (*Place, error) {
+	for _, place := range s.data.places {
+		if place.ID == id {
+			return &place, nil
+		}
+	}
+	return &unknownPlace, nil
+}
+
+func (s *memPlaceStore) FindID(emailAddress string) (int, error) {
+	parts := strings.Split(emailAddress, "@")
+	if len(parts) != 2 {
+		return -1, nil
+	}
+	domain := parts[1]
+	for {
+		for _, place := range s.data.places {
+			if place.EmailDomain == domain {
+				return place.ID, nil
+			}
+		}
+
+		index := strings.Index(domain, ".")
+		if index == -1 {
+			return -1, nil
+		}
+		domain = domain[index+1:]
+	}
+}
+
+type memListingStore struct {
+	data *memoryData
+}
+
+func (s *memListingStore) Create(listing *Listing) (bool, *ListingError) {
+	listing.Normalize()
+	valid, validationError := listing.Validate()
+	if !valid {
+		return false, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	listing.ID = s.data.nextID("listings")
+	listing.Created = time.Now()
+	listing.Modified = listing.Created
+	listing.Bumped = listing.Created
+	listing.Expires = nil
+	if listing.Published {
+		expires := listing.Created.Add(ListingLifetime)
+		listing.Expires = &expires
+	}
+	saved := *listing
+	saved.Attributes = copyAttributes(listing.Attributes)
+	s.data.listings[listing.ID] = saved
+	return true, nil
+}
+
+func (s *memListingStore) Save(listing *Listing) (bool, *ListingError) {
+	listing.Normalize()
+	valid, validationError := listing.Validate()
+	if !valid {
+		return false, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.listings[listing.ID]
+	if !ok {
+		return true, &ListingError{
+			Global: "Wrong number of rows updated: 0",
+		}
+	}
+
+	saved.Name = listing.Name
+	saved.Price = listing.Price
+	saved.Type = listing.Type
+	saved.Condition = listing.Condition
+	saved.Status = listing.Status
+	saved.Description = listing.Description
+	saved.Attributes = copyAttributes(listing.Attributes)
+	saved.Modified = time.Now()
+	// A draft being published gets a fresh expiry, and goes to the top of
+	// the listing feed
+	if listing.Published && !saved.Published {
+		expires := saved.Modified.Add(ListingLifetime)
+		saved.Expires = &expires
+		saved.Bumped = saved.Modified
+		delete(s.data.reminded, listing.ID)
+	}
+	saved.Published = listing.Published
+	saved.PublishAt = listing.PublishAt
+	s.data.listings[listing.ID] = saved
+	return true, nil
+}
+
+func (s *memListingStore) Renew(listing *Listing) error {
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.listings[listing.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkRenew(&saved); err != nil {
+		return err
+	}
+	expires := time.Now().Add(ListingLifetime)
+	saved.Expires = &expires
+	s.data.listings[listing.ID] = saved
+	delete(s.data.reminded, listing.ID)
+	listing.Expires = saved.Expires
+	return nil
+}
+
+func (s *memListingStore) Bump(listing *Listing) error {
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.listings[listing.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	if err := checkBump(&saved, now); err != nil {
+		return err
+	}
+	saved.Bumped = now
+	s.data.listings[listing.ID] = saved
+	listing.Bumped = now
+	return nil
+}
+
+func (s *memListingStore) RemindExpiring(now time.Time) ([]Listing, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	listings := make([]Listing, 0, 10)
+	for _, id := range s.data.listingIDs() {
+		l := s.data.listings[id]
+		if !l.Published || l.Status != ListingListed || l.Expires == nil ||
+			l.Expires.After(now.Add(ListingReminderWindow)) ||
+			s.data.reminded[id] {
+
+			continue
+		}
+		s.data.reminded[id] = true
+		l.User = s.data.listingUser(&l)
+		l.Attributes = nil
+		listings = append(listings, l)
+	}
+	return listings, nil
+}
+
+func (s *memListingStore) PublishScheduled(now time.Time) ([]Listing, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	listings := make([]Listing, 0, 10)
+	for _, id := range s.data.listingIDs() {
+		l := s.data.listings[id]
+		if !l.IsScheduled() || l.PublishAt.After(now) {
+			continue
+		}
+		expires := now.Add(ListingLifetime)
+		l.Published = true
+		l.PublishAt = nil
+		l.Expires = &expires
+		l.Bumped = time.Now()
+		l.Modified = l.Bumped
+		s.data.listings[id] = l
+		delete(s.data.reminded, id)
+
+		l.User = s.data.listingUser(&l)
+		l.PriceClient = utils.PriceServerToClient(l.Price)
+		l.Attributes = copyAttributes(l.Attributes)
+		listings = append(listings, l)
+	}
+	return listings, nil
+}
+
+func (s *memListingStore) Delete(listing *Listing) (bool, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	if _, ok := s.data.listings[listing.ID]; !ok {
+		return false, errors.New("Deleted incorrect number of rows (0)")
+	}
+
+	images := make([]Image, 0, MaxListingImages)
+	for _, id := range s.data.imageIDs() {
+		image := s.data.images[id]
+		if image.Media == MediaListing && image.MediaID == listing.ID {
+			images = append(images, image)
+			delete(s.data.images, id)
+		}
+	}
+	for _, id := range s.data.offerIDs() {
+		if s.data.offers[id].Listing.ID == listing.ID {
+			deleteMemoryOffer(s.data, id)
+		}
+	}
+	delete(s.data.offerRules, listing.ID)
+	delete(s.data.listings, listing.ID)
+
+	for _, image := range images {
+		if len(image.URL) > 0 && !utils.DeleteImage(image.URL) {
+			fmt.Println("[WARN] models.memListingStore.Delete: failed to " +
+				"delete " + image.URL)
+		}
+	}
+	return true, nil
+}
+
+func (s *memListingStore) MarkSold(listing *Listing) (bool, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.listings[listing.ID]
+	if !ok {
+		return false, errors.New("Updated incorrect number of rows (0)")
+	}
+	saved.Status = ListingSold
+	s.data.listings[listing.ID] = saved
+	return true, nil
+}
+
+func (s *memListingStore) GetByID(id int) (*Listing, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	listing, ok := s.data.listings[id]
+	if !ok {
+		return nil, nil
+	}
+	listing.User = s.data.listingUser(&listing)
+	listing.PriceClient = utils.PriceServerToClient(listing.Price)
+	listing.Attributes = copyAttributes(listing.Attributes)
+	return &listing, nil
+}
+
+func (s *memListingStore) GetList(options ListingQueryOpts) []Listing {
+	s.data.Lock()
+	defer s.data.Unlock()
+
+	listings := make([]Listing, 0, 10)
+	for _, id := range s.data.listingIDs() {
+		l := s.data.listings[id]
+		if !listingMatchesOpts(&l, &options) {
+			continue
+		}
+		l.User = s.data.listingUser(&l)
+		l.ImageURL = s.data.primaryImageURL(l.ID)
+		l.PriceClient = utils.PriceServerToClient(l.Price)
+		// Attributes are only loaded with a single listing, as they are
+		// from PostgreSQL
+		l.Attributes = nil
+		listings = append(listings, l)
+	}
+
+	var less func(a, b *Listing) bool
+	switch options.Sort {
+	case SortPriceAsc:
+		less = func(a, b *Listing) bool {
+			return a.Price < b.Price || a.Price == b.Price && a.ID < b.ID
+		}
+	case SortPriceDesc:
+		less = func(a, b *Listing) bool {
+			return a.Price > b.Price || a.Price == b.Price && a.ID > b.ID
+		}
+	default:
+		less = func(a, b *Listing) bool {
+			return a.Bumped.After(b.Bumped) ||
+				a.Bumped.Equal(b.Bumped) && a.ID > b.ID
+		}
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		return less(&listings[i], &listings[j])
+	})
+
+	if !options.UsePaging {
+		return listings
+	}
+
+	useCursor := options.Cursor != nil &&
+		strings.Compare(options.Cursor.Sort, options.Sort) == 0
+	offset := options.PageNum * options.PageSize
+	if useCursor {
+		after := Listing{ID: options.Cursor.ID, Price: options.Cursor.Price,
+			Bumped: options.Cursor.Bumped}
+		offset = sort.Search(len(listings), func(i int) bool {
+			return less(&after, &listings[i])
+		})
+	}
+	start, end := page(len(listings), offset, options.PageSize)
+	return listings[start:end]
+}
+
+func (s *memListingStore) GetOfferRules(listingID int) (*OfferRules,
+	error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	rules, ok := s.data.offerRules[listingID]
+	if !ok {
+		return &OfferRules{ListingID: listingID}, nil
+	}
+	offerRulesPrices(&rules)
+	return &rules, nil
+}
+
+func (s *memListingStore) SaveOfferRules(rules *OfferRules) (bool,
+	*OfferRulesError) {
+
+	valid, validationError := rules.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	if rules.Empty() {
+		delete(s.data.offerRules, rules.ListingID)
+	} else {
+		saved := OfferRules{
+			ListingID:    rules.ListingID,
+			DeclineReply: rules.DeclineReply,
+		}
+		// The prices are copied so that the caller can't change them
+		if rules.AcceptAt != nil {
+			acceptAt := *rules.AcceptAt
+			saved.AcceptAt = &acceptAt
+		}
+		if rules.DeclineBelow != nil {
+			declineBelow := *rules.DeclineBelow
+			saved.DeclineBelow = &declineBelow
+		}
+		s.data.offerRules[rules.ListingID] = saved
+	}
+	offerRulesPrices(rules)
+	return true, nil
+}
+
+// listingMatchesOpts checks a listing against the filters in options
+func listingMatchesOpts(l *Listing, options *ListingQueryOpts) bool {
+	if options.RestrictByPlace {
+		if l.User.PlaceID != options.PlaceID {
+			return false
+		}
+	} else if options.SkipByPlace && l.User.PlaceID == options.PlaceID {
+		return false
+	}
+
+	if options.RestrictByUser {
+		if l.User.ID != options.UserID {
+			return false
+		}
+	} else if options.SkipByUser && l.User.ID == options.UserID {
+		return false
+	}
+
+	if options.RestrictByStatus {
+		if l.Status != options.Status {
+			return false
+		}
+	} else if options.SkipByStatus && l.Status == options.Status {
+		return false
+	}
+
+	if options.RestrictByType {
+		if l.Type != options.Type {
+			return false
+		}
+	} else if options.SkipByType && l.Type == options.Type {
+		return false
+	}
+
+	if options.HideHeld && l.Status == ListingTransaction {
+		return false
+	}
+
+	if options.HideExpired && l.IsExpired() {
+		return false
+	}
+
+	if len(options.ISBN) > 0 && l.Attributes["isbn"] != options.ISBN {
+		return false
+	}
+
+	if options.HideDraft {
+		return l.Published
+	} else if options.HidePublished {
+		return !l.Published
+	}
+	return true
+}
+
+type memOfferStore struct {
+	data *memoryData
+}
+
+// deleteMemoryOffer removes an offer with its messages and history. The data
+// must be locked by the caller
+func deleteMemoryOffer(data *memoryData, id int) {
+	delete(data.offerBundles, id)
+	for _, messageID := range data.messageIDs() {
+		if data.messages[messageID].Offer.ID == id {
+			delete(data.messages, messageID)
+		}
+	}
+	events := data.offerEvents[:0]
+	for _, event := range data.offerEvents {
+		if event.OfferID != id {
+			events = append(events, event)
+		}
+	}
+	data.offerEvents = events
+	for _, reviewID := range data.reviewIDs() {
+		if data.reviews[reviewID].OfferID == id {
+			delete(data.reviews, reviewID)
+		}
+	}
+	delete(data.meetups, id)
+	delete(data.offers, id)
+}
+
+// recordMemoryOfferEvent adds an event to the history of an offer. The data
+// must be locked by the caller
+func recordMemoryOfferEvent(data *memoryData, event *OfferEvent) {
+	event.ID = data.nextID("offer_events")
+	event.Actor = offerTransitions[event.Action].by
+	event.Created = time.Now()
+	describeOfferEvent(event)
+	data.offerEvents = append(data.offerEvents, *event)
+}
+
+// transitionMemoryOffer takes the action in event on an offer, like
+// transitionOffer does. The data must be locked by the caller
+func transitionMemoryOffer(data *memoryData, offerID int,
+	event *OfferEvent) error {
+
+	saved, ok := data.offers[offerID]
+	if !ok {
+		return ErrOfferStatus
+	}
+	next, err := nextOfferStatus(saved.Status, event.Action)
+	if err != nil {
+		return err
+	}
+	saved.Status = next
+	saved.Modified = time.Now()
+	data.offers[offerID] = saved
+
+	event.OfferID = offerID
+	event.Status = next
+	recordMemoryOfferEvent(data, event)
+	return nil
+}
+
+// memoryOfferListingIDs gets the IDs of the listings a saved offer is on,
+// like offerListingIDs does. The data must be locked by the caller
+func memoryOfferListingIDs(data *memoryData, offer Offer) []int {
+	if ids, ok := data.offerBundles[offer.ID]; ok {
+		return ids
+	}
+	return []int{offer.Listing.ID}
+}
+
+// memoryOfferCovers checks if a saved offer is on a listing, either by
+// itself or as part of a bundle. The data must be locked by the caller
+func memoryOfferCovers(data *memoryData, offer Offer, listingID int) bool {
+	for _, id := range memoryOfferListingIDs(data, offer) {
+		if id == listingID {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryOfferListings gets the listings a saved offer is on. The data must
+// be locked by the caller
+func memoryOfferListings(data *memoryData, offer Offer) []Listing {
+	ids := memoryOfferListingIDs(data, offer)
+	listings := make([]Listing, 0, len(ids))
+	for _, id := range ids {
+		listings = append(listings, data.listings[id])
+	}
+	return listings
+}
+
+// setMemoryListingStatus changes the status of a listing. The data must be
+// locked by the caller
+func setMemoryListingStatus(data *memoryData, listingID int, status string) {
+	listing := data.listings[listingID]
+	listing.Status = status
+	listing.Modified = time.Now()
+	data.listings[listingID] = listing
+}
+
+// releaseMemoryListingHold puts an offer's listings back on the market if
+// they were held for the offer, like releaseListingHold does. The data must
+// be locked by the caller
+func releaseMemoryListingHold(data *memoryData, offerID int) {
+	offer := data.offers[offerID]
+	if !offer.Holding {
+		return
+	}
+	offer.Holding = false
+	data.offers[offerID] = offer
+
+	for _, listing := range memoryOfferListings(data, offer) {
+		if listing.Status == ListingTransaction {
+			setMemoryListingStatus(data, listing.ID, ListingListed)
+		}
+	}
+}
+
+func (s *memOfferStore) Create(offer *Offer) (bool, *OfferError) {
+	if valid, validationError := offer.prepare(); !valid {
+		return valid, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	ids := offer.bundleListingIDs()
+	listings := make([]Listing, 0, len(ids))
+	for _, id := range ids {
+		listing, ok := s.data.listings[id]
+		if !ok {
+			return false, offerError(sql.ErrNoRows, "models.memOfferStore.Create")
+		}
+		if offer.IsBundle &&
+			(listing.User.ID != offer.Seller.ID || !listing.Published) {
+
+			return false, offerError(ErrBundleListing,
+				"models.memOfferStore.Create")
+		}
+		listings = append(listings, listing)
+	}
+	if err := checkListingsOpen(listings); err != nil {
+		return false, offerError(err, "models.memOfferStore.Create")
+	}
+	for _, existing := range s.data.offers {
+		if !offer.IsBundle && !existing.IsBundle &&
+			existing.Listing.ID == offer.Listing.ID &&
+			existing.Buyer.ID == offer.Buyer.ID {
+
+			return false, &OfferError{Global: "An unexpected error occurred."}
+		}
+	}
+
+	offer.ID = s.data.nextID("offers")
+	offer.Created = time.Now()
+	offer.Modified = offer.Created
+	s.data.offers[offer.ID] = Offer{
+		ID:            offer.ID,
+		Price:         offer.Price,
+		Counter:       offer.Counter,
+		IsCountered:   offer.IsCountered,
+		BuyerComment:  offer.BuyerComment,
+		SellerComment: offer.SellerComment,
+		Status:        offer.Status,
+		Listing:       Listing{ID: offer.Listing.ID},
+		Buyer:         User{ID: offer.Buyer.ID},
+		Seller:        User{ID: offer.Seller.ID},
+		Expires:       offer.Expires,
+		IsBundle:      offer.IsBundle,
+		Created:       offer.Created,
+		Modified:      offer.Modified,
+	}
+	if offer.IsBundle {
+		s.data.offerBundles[offer.ID] = ids
+	}
+
+	price := offer.Price
+	recordMemoryOfferEvent(s.data, &OfferEvent{
+		OfferID: offer.ID,
+		Action:  OfferActionOffer,
+		Status:  offer.Status,
+		Price:   &price,
+		Comment: offer.BuyerComment,
+	})
+	return true, nil
+}
+
+func (s *memOfferStore) Revise(offer *Offer) (bool, *OfferError) {
+	return s.propose(offer, OfferActionOffer, offer.Price, offer.BuyerComment,
+		func(saved *Offer) {
+			saved.Price = offer.Price
+			saved.BuyerComment = offer.BuyerComment
+		})
+}
+
+func (s *memOfferStore) CounterOffer(offer *Offer) (bool, *OfferError) {
+	offer.IsCountered = true
+	return s.propose(offer, OfferActionCounter, offer.Counter,
+		offer.SellerComment, func(saved *Offer) {
+			saved.Counter = offer.Counter
+			saved.SellerComment = offer.SellerComment
+			saved.IsCountered = true
+		})
+}
+
+// propose mirrors Offer.propose, with update setting the price and comment
+// on the saved offer
+func (s *memOfferStore) propose(offer *Offer, action string, price int,
+	comment string, update func(saved *Offer)) (bool, *OfferError) {
+
+	valid, validationError := offer.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	listings := memoryOfferListings(s.data, s.data.offers[offer.ID])
+	if err := checkListingsOpen(listings); err != nil {
+		return false, offerError(err, "models.memOfferStore.propose")
+	}
+	event := OfferEvent{Action: action, Price: &price, Comment: comment}
+	if err := transitionMemoryOffer(s.data, offer.ID, &event); err != nil {
+		return false, offerError(err, "models.memOfferStore.propose")
+	}
+	saved := s.data.offers[offer.ID]
+	update(&saved)
+	saved.Expires = offer.Expires
+	s.data.offers[offer.ID] = saved
+	offer.Status = event.Status
+	return true, nil
+}
+
+func (s *memOfferStore) Decline(offer *Offer) error {
+	return s.close(offer, OfferActionDecline)
+}
+
+func (s *memOfferStore) Withdraw(offer *Offer) error {
+	return s.close(offer, OfferActionWithdraw)
+}
+
+func (s *memOfferStore) close(offer *Offer, action string) error {
+	s.data.Lock()
+	defer s.data.Unlock()
+	event := OfferEvent{Action: action}
+	if err := transitionMemoryOffer(s.data, offer.ID, &event); err != nil {
+		return err
+	}
+	releaseMemoryListingHold(s.data, offer.ID)
+	offer.Status = event.Status
+	offer.Holding = false
+	return nil
+}
+
+func (s *memOfferStore) Accept(offer *Offer) error {
+	s.data.Lock()
+	defer s.data.Unlock()
+	if offer.Holding && offer.Expires == nil {
+		return ErrOfferStatus
+	}
+	listings := memoryOfferListings(s.data, s.data.offers[offer.ID])
+	if err := checkListingsOpen(listings); err != nil {
+		return err
+	}
+	event := OfferEvent{Action: OfferActionAccept}
+	if err := transitionMemoryOffer(s.data, offer.ID, &event); err != nil {
+		return err
+	}
+	saved := s.data.offers[offer.ID]
+	saved.Expires = offer.Expires
+	saved.Holding = offer.Holding
+	s.data.offers[offer.ID] = saved
+	offer.Status = OfferAccepted
+	if offer.Holding {
+		for _, listing := range listings {
+			setMemoryListingStatus(s.data, listing.ID, ListingTransaction)
+		}
+		offer.Listing.Status = ListingTransaction
+	}
+	return nil
+}
+
+func (s *memOfferStore) Finalize(offer *Offer) ([]Offer, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.offers[offer.ID]
+	if !ok {
+		return nil, ErrOfferStatus
+	}
+	ids := memoryOfferListingIDs(s.data, saved)
+	for _, id := range ids {
+		listing, ok := s.data.listings[id]
+		if !ok {
+			return nil, sql.ErrNoRows
+		}
+		if listing.Status == ListingSold {
+			return nil, ErrListingSold
+		}
+		for _, other := range s.data.offers {
+			if other.ID != offer.ID && other.Holding &&
+				memoryOfferCovers(s.data, other, id) {
+
+				return nil, ErrListingHeld
+			}
+		}
+	}
+	event := OfferEvent{Action: OfferActionComplete}
+	if err := transitionMemoryOffer(s.data, offer.ID, &event); err != nil {
+		return nil, err
+	}
+	releaseMemoryListingHold(s.data, offer.ID)
+	for _, id := range ids {
+		setMemoryListingStatus(s.data, id, ListingSold)
+	}
+
+	closed := make([]Offer, 0, 10)
+	for _, listingID := range ids {
+		for _, id := range s.data.offerIDs() {
+			other := s.data.offers[id]
+			if id == offer.ID || !memoryOfferCovers(s.data, other, listingID) ||
+				!other.Can(OfferActionDecline) {
+
+				continue
+			}
+			event := OfferEvent{Action: OfferActionDecline}
+			if err := transitionMemoryOffer(s.data, id, &event); err != nil {
+				return nil, err
+			}
+			other.Status = event.Status
+			other.Listing = Listing{ID: listingID}
+			offerPrices(&other)
+			closed = append(closed, other)
+		}
+	}
+	offer.Status = OfferCompleted
+	offer.Holding = false
+	offer.Listing.Status = ListingSold
+	return closed, nil
+}
+
+func (s *memOfferStore) ApplyRules(offer *Offer) (string, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	listings := memoryOfferListings(s.data, s.data.offers[offer.ID])
+	if len(listings) > 1 || checkListingsOpen(listings) != nil {
+		return "", nil
+	}
+	rules, ok := s.data.offerRules[offer.Listing.ID]
+	if !ok {
+		return "", nil
+	}
+
+	event := OfferEvent{Action: rules.Decide(offer.Price), Automatic: true}
+	if len(event.Action) == 0 {
+		return "", nil
+	}
+	if event.Action == OfferActionDecline {
+		event.Comment = rules.DeclineReply
+	}
+	err := transitionMemoryOffer(s.data, offer.ID, &event)
+	if err == ErrOfferStatus {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	offer.Status = event.Status
+	if event.Action == OfferActionAccept {
+		saved := s.data.offers[offer.ID]
+		saved.Expires = nil
+		s.data.offers[offer.ID] = saved
+		offer.Expires = nil
+	}
+	return event.Action, nil
+}
+
+func (s *memOfferStore) Expire(now time.Time) ([]ExpiredOffer, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	expired := make([]ExpiredOffer, 0, 10)
+	for _, id := range s.data.offerIDs() {
+		offer := s.data.offers[id]
+		if offer.Expires == nil || offer.Expires.After(now) ||
+			!offer.Can(OfferActionExpire) {
+
+			continue
+		}
+		lapsed := offer.Status == OfferAccepted
+		event := OfferEvent{Action: OfferActionExpire}
+		if err := transitionMemoryOffer(s.data, id, &event); err != nil {
+			return nil, err
+		}
+
+		releaseMemoryListingHold(s.data, id)
+		listing := s.data.listings[offer.Listing.ID]
+
+		offer = s.data.offers[id]
+		offer.Listing.Name = listing.Name
+		offer.Buyer = s.data.userRef(offer.Buyer.ID)
+		offer.Seller = s.data.userRef(offer.Seller.ID)
+		offerPrices(&offer)
+		expired = append(expired, ExpiredOffer{Offer: offer, Lapsed: lapsed})
+	}
+	return expired, nil
+}
+
+func (s *memOfferStore) GetHistory(offerIDs []int) (map[int][]OfferEvent,
+	error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	wanted := make(map[int]bool, len(offerIDs))
+	for _, id := range offerIDs {
+		wanted[id] = true
+	}
+	history := make(map[int][]OfferEvent)
+	for _, event := range s.data.offerEvents {
+		if wanted[event.OfferID] {
+			history[event.OfferID] = append(history[event.OfferID], event)
+		}
+	}
+	return history, nil
+}
+
+func (s *memOfferStore) GetBundles(offerIDs []int) (map[int][]Listing,
+	error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	bundles := make(map[int][]Listing)
+	for _, offerID := range offerIDs {
+		for _, id := range s.data.offerBundles[offerID] {
+			listing := s.data.listings[id]
+			bundles[offerID] = append(bundles[offerID], Listing{
+				ID:          id,
+				Name:        listing.Name,
+				Price:       listing.Price,
+				PriceClient: utils.PriceServerToClient(listing.Price),
+				Status:      listing.Status,
+			})
+		}
+	}
+	return bundles, nil
+}
+
+func (s *memOfferStore) GetByID(id int) (*Offer, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	offer, ok := s.data.offers[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	offerPrices(&offer)
+	return &offer, nil
+}
+
+func (s *memOfferStore) GetForListing(listing *Listing, pageNum,
+	pageSize int) ([]Offer, error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	offers := make([]Offer, 0, 20)
+	for _, id := range s.data.offerIDs() {
+		offer := s.data.offers[id]
+		if memoryOfferCovers(s.data, offer, listing.ID) {
+			offer.Buyer = s.data.userRef(offer.Buyer.ID)
+			offer.Seller = s.data.userRef(offer.Seller.ID)
+			offerPrices(&offer)
+			offers = append(offers, offer)
+		}
+	}
+	start, end := page(len(offers), pageNum*pageSize, pageSize)
+	return offers[start:end], nil
+}
+
+func (s *memOfferStore) GetAsSeller(user *User, pageNum,
+	pageSize int) ([]Offer, error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	offers := make([]Offer, 0, 50)
+	for _, id := range s.data.offerIDs() {
+		offer := s.data.offers[id]
+		if offer.Seller.ID == user.ID {
+			offer.Listing.Name = s.data.listings[offer.Listing.ID].Name
+			offer.Buyer = s.data.userRef(offer.Buyer.ID)
+			offerPrices(&offer)
+			offers = append(offers, offer)
+		}
+	}
+	sort.SliceStable(offers, func(i, j int) bool {
+		return offers[i].Modified.After(offers[j].Modified)
+	})
+	start, end := page(len(offers), pageNum*pageSize, pageSize)
+	return offers[start:end], nil
+}
+
+func (s *memOfferStore) GetAsBuyer(user *User) ([]Offer, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	offers := make([]Offer, 0, 50)
+	for _, id := range s.data.offerIDs() {
+		offer := s.data.offers[id]
+		if offer.Buyer.ID == user.ID {
+			listing := s.data.listings[offer.Listing.ID]
+			offer.Listing.Name = listing.Name
+			offer.Listing.Price = listing.Price
+			offer.Listing.PriceClient = utils.PriceServerToClient(listing.Price)
+			offer.Listing.ImageURL = s.data.primaryImageURL(listing.ID)
+			offer.Seller = s.data.userRef(offer.Seller.ID)
+			offerPrices(&offer)
+			offers = append(offers, offer)
+		}
+	}
+	return offers, nil
+}
+
+func (s *memOfferStore) GetOnListing(user *User, listingID int) (*Offer,
+	error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	for _, offer := range s.data.offers {
+		if offer.Buyer.ID == user.ID && offer.Listing.ID == listingID &&
+			!offer.IsBundle {
+
+			offer.Seller = s.data.userRef(offer.Seller.ID)
+			offerPrices(&offer)
+			return &offer, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memOfferStore) GetConversations(user *User) ([]Offer, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	offers := make([]Offer, 0, 10)
+	for _, id := range s.data.offerIDs() {
+		offer := s.data.offers[id]
+		if offer.Status != OfferAccepted ||
+			offer.Buyer.ID != user.ID && offer.Seller.ID != user.ID {
+			continue
+		}
+
+		offer.Listing.Name = s.data.listings[offer.Listing.ID].Name
+		offer.Buyer = s.data.userRef(offer.Buyer.ID)
+		offer.Seller = s.data.userRef(offer.Seller.ID)
+		for _, message := range s.data.messages {
+			if message.Offer.ID == offer.ID &&
+				message.Recepient.ID == user.ID && !message.Seen {
+				offer.UnreadCount++
+			}
+		}
+		offerPrices(&offer)
+		offers = append(offers, offer)
+	}
+	return offers, nil
+}
+
+type memMessageStore struct {
+	data *memoryData
+}
+
+func (s *memMessageStore) Create(message *Message) (bool, *MessageError) {
+	valid, validationError := message.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	message.ID = s.data.nextID("messages")
+	message.Seen = false
+	message.Created = time.Now()
+	message.Modified = message.Created
+	s.data.messages[message.ID] = Message{
+		ID:        message.ID,
+		Message:   message.Message,
+		Sender:    User{ID: message.Sender.ID},
+		Recepient: User{ID: message.Recepient.ID},
+		Offer:     Offer{ID: message.Offer.ID},
+		Created:   message.Created,
+		Modified:  message.Modified,
+	}
+	return true, nil
+}
+
+func (s *memMessageStore) MarkRead(message *Message, recepientID int) {
+	message.Seen = true
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	markMemoryMessageRead(s.data, message.ID, recepientID)
+}
+
+// markMemoryMessageRead marks a message as read if it was sent to
+// recepientID. The data must be locked by the caller
+func markMemoryMessageRead(data *memoryData, id, recepientID int) {
+	saved, ok := data.messages[id]
+	if ok && saved.Recepient.ID == recepientID {
+		saved.Seen = true
+		data.messages[id] = saved
+	}
+}
+
+func (s *memMessageStore) GetForOffer(offer *Offer, pageSize, page int,
+	recepientID int) ([]Message, error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	ids := s.data.messageIDs()
+	messages := make([]Message, 0, pageSize)
+	skip := (page - 1) * pageSize
+	for i := len(ids) - 1; i >= 0 && len(messages) < pageSize; i-- {
+		message := s.data.messages[ids[i]]
+		if message.Offer.ID != offer.ID {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		message.Sender = s.data.userRef(message.Sender.ID)
+		message.Sender.EmailAddress = ""
+		message.Sender.PlaceID = 0
+		if message.Recepient.ID == recepientID {
+			markMemoryMessageRead(s.data, message.ID, recepientID)
+			message.Seen = true
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (s *memMessageStore) GetLast(offer *Offer) (*Message, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	ids := s.data.messageIDs()
+	for i := len(ids) - 1; i >= 0; i-- {
+		message := s.data.messages[ids[i]]
+		if message.Offer.ID == offer.ID {
+			message.Recepient = User{}
+			message.Offer = Offer{}
+			return &message, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memMessageStore) GetUnreadCount(user *User) int {
+	s.data.Lock()
+	defer s.data.Unlock()
+	count := 0
+	for _, message := range s.data.messages {
+		if message.Recepient.ID == user.ID && !message.Seen {
+			count++
+		}
+	}
+	return count
+}
+
+// memMeetupStore keeps meetups keyed by the ID of their offer, since an
+// offer has at most one
+type memMeetupStore struct {
+	data *memoryData
+}
+
+func (s *memMeetupStore) Propose(meetup *Meetup) (bool, *MeetupError) {
+	valid, validationError := meetup.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	now := time.Now()
+	saved, ok := s.data.meetups[meetup.OfferID]
+	if !ok {
+		saved = Meetup{
+			ID:      s.data.nextID("meetups"),
+			OfferID: meetup.OfferID,
+			Created: now,
+		}
+	} else {
+		saved.Sequence++
+	}
+	saved.Proposer = User{ID: meetup.Proposer.ID}
+	saved.Time = meetup.Time
+	saved.Location = meetup.Location
+	saved.Status = MeetupProposed
+	saved.Modified = now
+	s.data.meetups[meetup.OfferID] = saved
+
+	meetup.ID = saved.ID
+	meetup.Status = saved.Status
+	meetup.Sequence = saved.Sequence
+	meetup.Created = saved.Created
+	meetup.Modified = saved.Modified
+	return true, nil
+}
+
+func (s *memMeetupStore) Answer(meetup *Meetup, user *User,
+	status string) error {
+
+	if status != MeetupAccepted && status != MeetupDeclined {
+		return ErrMeetupStatus
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.meetups[meetup.OfferID]
+	if !ok || saved.ID != meetup.ID || saved.Status != MeetupProposed ||
+		saved.Proposer.ID == user.ID {
+
+		return ErrMeetupStatus
+	}
+	saved.Status = status
+	saved.Sequence++
+	saved.Modified = time.Now()
+	s.data.meetups[meetup.OfferID] = saved
+	meetup.Status = saved.Status
+	meetup.Sequence = saved.Sequence
+	meetup.Modified = saved.Modified
+	return nil
+}
+
+func (s *memMeetupStore) GetForOffer(offerID int) (*Meetup, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	meetup, ok := s.data.meetups[offerID]
+	if !ok {
+		return nil, nil
+	}
+	proposer := s.data.userRef(meetup.Proposer.ID)
+	meetup.Proposer = User{
+		ID:          meetup.Proposer.ID,
+		Username:    proposer.Username,
+		DisplayName: proposer.DisplayName,
+	}
+	return &meetup, nil
+}
+
+type memReviewStore struct {
+	data *memoryData
+}
+
+func (s *memReviewStore) Create(review *Review) (bool, *ReviewError) {
+	valid, validationError := review.Validate()
+	if !valid {
+		return valid, &validationError
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	offer, ok := s.data.offers[review.OfferID]
+	if !ok {
+		return false, reviewError(ErrReviewNotAllowed,
+			"models.memReviewStore.Create")
+	}
+	revieweeID, role, err := reviewParties(offer.Status, offer.Buyer.ID,
+		offer.Seller.ID, review.Reviewer.ID)
+	if err != nil {
+		return false, reviewError(err, "models.memReviewStore.Create")
+	}
+	for _, saved := range s.data.reviews {
+		if saved.OfferID == review.OfferID &&
+			saved.Reviewer.ID == review.Reviewer.ID {
+
+			return false, reviewError(ErrAlreadyReviewed,
+				"models.memReviewStore.Create")
+		}
+	}
+
+	review.ID = s.data.nextID("reviews")
+	review.Reviewee = User{ID: revieweeID}
+	review.Role = role
+	review.Listing = Listing{ID: offer.Listing.ID}
+	review.Created = time.Now()
+	s.data.reviews[review.ID] = *review
+	return true, nil
+}
+
+// reviewRef gets a review as it is loaded, with the names of its reviewer
+// and listing
+func (d *memoryData) reviewRef(review Review) Review {
+	reviewer := d.userRef(review.Reviewer.ID)
+	review.Reviewer = User{
+		ID:          review.Reviewer.ID,
+		Username:    reviewer.Username,
+		DisplayName: reviewer.DisplayName,
+	}
+	review.Listing = Listing{
+		ID:   review.Listing.ID,
+		Name: d.listings[review.Listing.ID].Name,
+	}
+	return review
+}
+
+func (s *memReviewStore) GetForUser(userID, pageNum int) ([]Review, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	reviews := make([]Review, 0)
+	ids := s.data.reviewIDs()
+	for i := len(ids) - 1; i >= 0; i-- {
+		review := s.data.reviews[ids[i]]
+		if review.Reviewee.ID == userID {
+			reviews = append(reviews, s.data.reviewRef(review))
+		}
+	}
+	start, end := page(len(reviews), pageNum*ReviewsPageSize, ReviewsPageSize)
+	return reviews[start:end], nil
+}
+
+func (s *memReviewStore) GetForOffer(offerID int) ([]Review, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	reviews := make([]Review, 0)
+	for _, id := range s.data.reviewIDs() {
+		review := s.data.reviews[id]
+		if review.OfferID == offerID {
+			reviews = append(reviews, s.data.reviewRef(review))
+		}
+	}
+	return reviews, nil
+}
+
+func (s *memReviewStore) GetReputations(userIDs []int) (map[int]Reputation,
+	error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	counts := make(map[int]int)
+	totals := make(map[int]int)
+	for _, review := range s.data.reviews {
+		counts[review.Reviewee.ID]++
+		totals[review.Reviewee.ID] += review.Rating
+	}
+	reputations := make(map[int]Reputation)
+	for _, id := range userIDs {
+		reputations[id] = newReputation(counts[id], totals[id])
+	}
+	return reputations, nil
+}
+
+type memImageStore struct {
+	data *memoryData
+}
+
+// deleteMemoryImage removes an image and its uploaded file. The data must
+// be locked by the caller
+func deleteMemoryImage(data *memoryData, image *Image) (bool, error) {
+	if len(image.URL) > 0 && !utils.DeleteImage(image.URL) {
+		return false, errors.New("Failed to delete image from S3")
+	}
+	if _, ok := data.images[image.ID]; !ok {
+		return false, errors.New("Deleted unexpected number of rows")
+	}
+	delete(data.images, image.ID)
+	return true, nil
+}
+
+func (s *memImageStore) Create(image *Image) (bool, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	image.ID = s.data.nextID("images")
+	image.Created = time.Now()
+	image.Modified = image.Created
+	s.data.images[image.ID] = *image
+
+	if image.Media == MediaListing &&
+		countMemoryImages(s.data, image.MediaID) > MaxListingImages {
+
+		deleteMemoryImage(s.data, image)
+		return false, errors.New("Exceeded image count limit")
+	}
+	return true, nil
+}
+
+// countMemoryImages counts the images for a listing. The data must be
+// locked by the caller
+func countMemoryImages(data *memoryData, listingID int) int {
+	count := 0
+	for _, image := range data.images {
+		if image.Media == MediaListing && image.MediaID == listingID {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *memImageStore) Save(image *Image) (bool, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	saved, ok := s.data.images[image.ID]
+	if !ok {
+		return false, errors.New("Updated an unexpected number of rows")
+	}
+	saved.Media = image.Media
+	saved.MediaID = image.MediaID
+	saved.Ordinal = image.Ordinal
+	saved.URL = image.URL
+	saved.Modified = time.Now()
+	s.data.images[image.ID] = saved
+	return true, nil
+}
+
+func (s *memImageStore) Delete(image *Image) (bool, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	return deleteMemoryImage(s.data, image)
+}
+
+func (s *memImageStore) GetByID(id int) (*Image, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	image, ok := s.data.images[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &image, nil
+}
+
+func (s *memImageStore) GetForListing(listing *Listing) ([]Image, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	images := make([]Image, 0, 8)
+	for _, id := range s.data.imageIDs() {
+		image := s.data.images[id]
+		if image.Media == MediaListing && image.MediaID == listing.ID {
+			images = append(images, image)
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Ordinal < images[j].Ordinal
+	})
+	return images, nil
+}
+
+func (s *memImageStore) GetCountForListing(listing *Listing) (int, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	return countMemoryImages(s.data, listing.ID), nil
+}
+
+func (s *memImageStore) SetPrimary(listing *Listing, id int) (bool, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	for imageID, image := range s.data.images {
+		if image.Media == MediaListing && image.MediaID == listing.ID {
+			image.Ordinal = 0
+			if imageID == id {
+				image.Ordinal = -1
+			}
+			s.data.images[imageID] = image
+		}
+	}
+	return true, nil
+}
+
+type memNotificationStore struct {
+	data *memoryData
+}
+
+func (s *memNotificationStore) Create(notification *Notification) (bool,
+	error) {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	notification.ID = s.data.nextID("notifications")
+	notification.Read = false
+	notification.Created = time.Now()
+	s.data.notifications[notification.ID] = Notification{
+		ID:      notification.ID,
+		User:    User{ID: notification.User.ID},
+		Value:   notification.Value,
+		Created: notification.Created,
+	}
+
+	ids := s.data.notificationIDs()
+	kept := 0
+	for i := len(ids) - 1; i >= 0; i-- {
+		if s.data.notifications[ids[i]].User.ID != notification.User.ID {
+			continue
+		}
+		kept++
+		if kept > MaxNotificationsToKeep {
+			delete(s.data.notifications, ids[i])
+		}
+	}
+	return true, nil
+}
+
+func (s *memNotificationStore) GetRecent(user *User,
+	page int) []Notification {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	ids := s.data.notificationIDs()
+	notifications := make([]Notification, 0, NotificationsPerPage)
+	skip := page * NotificationsPerPage
+	for i := len(ids) - 1; i >= 0 &&
+		len(notifications) < NotificationsPerPage; i-- {
+
+		notification := s.data.notifications[ids[i]]
+		if notification.User.ID != user.ID {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		notification.User = *user
+		notifications = append(notifications, notification)
+	}
+	return notifications
+}
+
+func (s *memNotificationStore) GetUnreadCount(user *User) int {
+	s.data.Lock()
+	defer s.data.Unlock()
+	count := 0
+	for _, notification := range s.data.notifications {
+		if notification.User.ID == user.ID && !notification.Read {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *memNotificationStore) MarkRead(user *User, id int) error {
+	return s.markRead(user, func(notificationID int) bool {
+		return notificationID == id
+	})
+}
+
+func (s *memNotificationStore) MarkReadUpTo(user *User, id int) error {
+	return s.markRead(user, func(notificationID int) bool {
+		return notificationID <= id
+	})
+}
+
+func (s *memNotificationStore) markRead(user *User,
+	matches func(id int) bool) error {
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	for id, notification := range s.data.notifications {
+		if notification.User.ID == user.ID && matches(id) {
+			notification.Read = true
+			s.data.notifications[id] = notification
+		}
+	}
+	return nil
+}
+
+type memSessionStore struct {
+	data *memoryData
+}
+
+func (s *memSessionStore) Create(session *Session) (bool, error) {
+	s.data.Lock()
+	defer s.data.Unlock()
+
+	var sessionID string
+	var err error
+	for i := 0; i < 10 && len(sessionID) == 0; i++ {
+		sessionID, err = randomString()
+		if err != nil {
+			return false, err
+		}
+		if _, taken := s.data.sessions[sessionID]; taken {
+			sessionID = ""
+		}
+	}
+	if len(sessionID) == 0 {
+		return false, errors.New("Failed to generate session id for new session.")
+	}
+
+	if session.SessionSecret, err = randomString(); err != nil {
+		return false, err
+	}
+	if session.CsrfToken, err = randomString(); err != nil {
+		return false, err
+	}
+	session.SessionID = sessionID
+	if len(session.BrowserAgent) > 200 {
+		session.BrowserAgent = session.BrowserAgent[:200]
+	}
+	session.Created = time.Now()
+	session.Modified = session.Created
+
+	saved := *session
+	saved.User = User{ID: session.User.ID}
+	s.data.sessions[sessionID] = saved
+	return true, nil
+}
+
+func (s *memSessionStore) Update(session *Session) {
+	s.data.Lock()
+	defer s.data.Unlock()
+	if saved, ok := s.data.sessions[session.SessionID]; ok &&
+		saved.SessionSecret == session.SessionSecret {
+
+		saved.Modified = time.Now()
+		s.data.sessions[session.SessionID] = saved
+	}
+}
+
+func (s *memSessionStore) Get(sessionID string, sessionSecret string,
+	browserAgent string) *Session {
+
+	if len(browserAgent) > 200 {
+		browserAgent = browserAgent[:200]
+	}
+
+	s.data.Lock()
+	defer s.data.Unlock()
+	session, ok := s.data.sessions[sessionID]
+	if !ok || session.SessionSecret != sessionSecret ||
+		session.BrowserAgent != browserAgent {
+		return nil
+	}
+
+	if time.Now().AddDate(0, 0, -14).After(session.Modified) {
+		delete(s.data.sessions, sessionID)
+		return nil
+	}
+
+	session.User = s.data.userRef(session.User.ID)
+	return &session
+}
+
+func (s *memSessionStore) Delete(session *Session) bool {
+	s.data.Lock()
+	defer s.data.Unlock()
+	if _, ok := s.data.sessions[session.SessionID]; !ok {
+		return false
+	}
+	delete(s.data.sessions, session.SessionID)
+	return true
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+)
+
+func newTestMemoryStore() *Store {
+	return NewMemoryStore(
+		Place{ID: 1, Abbreviation: "RU", Name: "Rutgers", EmailDomain: "rutgers.edu"},
+		Place{ID: 2, Abbreviation: "CUNY", Name: "CUNY", EmailDomain: "cuny.edu"})
+}
+
+func TestMemoryStoreFindPlace(t *testing.T) {
+	store := newTestMemoryStore()
+
+	id, _ := store.Places.FindID("amg380@scarletmail.rutgers.edu")
+	if id != 1 {
+		t.Error("Got ID " + strconv.Itoa(id) + ", expected 1")
+	}
+	id, _ = store.Places.FindID("test@example.com")
+	if id != -1 {
+		t.Error("Got ID " + strconv.Itoa(id) + ", expected -1")
+	}
+}
+
+func TestMemoryStoreCreateUser(t *testing.T) {
+	store := newTestMemoryStore()
+
+	user := User{
+		Username:             "TestUser1",
+		DisplayName:          "Test User",
+		EmailAddress:         "test@cuny.edu",
+		Password:             "password1",
+		PasswordConfirmation: "password1",
+	}
+	if ok, err := store.Users.Create(&user); !ok {
+		t.Fatalf("Failed to create user: %+v", err)
+	}
+	if user.PlaceID != 2 {
+		t.Error("Got place " + strconv.Itoa(user.PlaceID) + ", expected 2")
+	}
+
+	saved := store.Users.GetByUsername("testuser1")
+	if saved == nil || saved.ID != user.ID {
+		t.Fatal("Could not find the created user by username")
+	}
+	if ok, _ := saved.Authenticate("password1"); ok {
+		t.Error("Authenticated before the user was activated")
+	}
+	store.Users.Activate(saved)
+	saved = store.Users.GetByID(user.ID)
+	if ok, _ := saved.Authenticate("password1"); !ok {
+		t.Error("Could not authenticate with the user's password")
+	}
+
+	duplicate := User{
+		Username:             "testuser1",
+		DisplayName:          "Another User",
+		EmailAddress:         "other@cuny.edu",
+		Password:             "password1",
+		PasswordConfirmation: "password1",
+	}
+	if ok, _ := store.Users.Create(&duplicate); ok {
+		t.Error("Created a user with a taken username")
+	}
+}
+
+func TestMemoryStoreListingList(t *testing.T) {
+	store := newTestMemoryStore()
+
+	prices := []string{"30.00", "10.00", "20.00"}
+	for i, price := range prices {
+		listing := Listing{
+			Name:        "Listing " + strconv.Itoa(i),
+			Type:        ListingTextbook,
+			Status:      ListingListed,
+			Condition:   "na",
+			PriceClient: price,
+			Published:   true,
+			User:        User{ID: 1, PlaceID: 1},
+		}
+		if ok, err := store.Listings.Create(&listing); !ok {
+			t.Fatalf("Failed to create listing: %+v", err)
+		}
+	}
+	other := Listing{
+		Name:        "Other Place",
+		Type:        ListingMisc,
+		Status:      ListingListed,
+		Condition:   "na",
+		PriceClient: "5.00",
+		Published:   true,
+		User:        User{ID: 2, PlaceID: 2},
+	}
+	store.Listings.Create(&other)
+
+	listings := store.Listings.GetList(ListingQueryOpts{
+		PlaceID:         1,
+		RestrictByPlace: true,
+		Sort:            SortPriceAsc,
+		UsePaging:       true,
+		PageSize:        2,
+	})
+	if len(listings) != 2 || listings[0].PriceClient != "10.00" ||
+		listings[1].PriceClient != "20.00" {
+
+		t.Fatalf("Got unexpected first page: %+v", listings)
+	}
+
+	listings = store.Listings.GetList(ListingQueryOpts{
+		PlaceID:         1,
+		RestrictByPlace: true,
+		Sort:            SortPriceAsc,
+		UsePaging:       true,
+		PageSize:        2,
+		Cursor:          NewListingCursor(SortPriceAsc, &listings[1]),
+	})
+	if len(listings) != 1 || listings[0].PriceClient != "30.00" {
+		t.Errorf("Got unexpected second page: %+v", listings)
+	}
+
+	listings = store.Listings.GetList(ListingQueryOpts{
+		PlaceID:     1,
+		SkipByPlace: true,
+	})
+	if len(listings) != 1 || listings[0].ID != other.ID {
+		t.Errorf("Expected only the listing in the other place, got %+v",
+			listings)
+	}
+}
+
+func TestMemoryStoreConversations(t *testing.T) {
+	store := newTestMemoryStore()
+
+	listing := Listing{
+		Name:        "Listing",
+		Type:        ListingMisc,
+		Status:      ListingListed,
+		Condition:   "na",
+		PriceClient: "10.00",
+		Published:   true,
+		User:        User{ID: 1, PlaceID: 1},
+	}
+	store.Listings.Create(&listing)
+
+	offer := Offer{
+		Price:   900,
+		Listing: listing,
+		Buyer:   User{ID: 2},
+		Seller:  User{ID: 1},
+	}
+	if ok, err := store.Offers.Create(&offer); !ok {
+		t.Fatalf("Failed to create offer: %+v", err)
+	}
+	if ok, _ := store.Offers.Create(&offer); ok {
+		t.Error("Created a second offer on the same listing")
+	}
+
+	store.Offers.Accept(&offer)
+	for i := 0; i < 3; i++ {
+		store.Messages.Create(&Message{
+			Message:   "Message " + strconv.Itoa(i),
+			Sender:    User{ID: 1},
+			Recepient: User{ID: 2},
+			Offer:     offer,
+		})
+	}
+
+	buyer := User{ID: 2}
+	if count := store.Messages.GetUnreadCount(&buyer); count != 3 {
+		t.Error("Got " + strconv.Itoa(count) + " unread messages, expected 3")
+	}
+	conversations, _ := store.Offers.GetConversations(&buyer)
+	if len(conversations) != 1 || conversations[0].UnreadCount != 3 {
+		t.Fatalf("Got unexpected conversations: %+v", conversations)
+	}
+
+	messages, _ := store.Messages.GetForOffer(&offer, 2, 1, buyer.ID)
+	if len(messages) != 2 || messages[0].Message != "Message 2" {
+		t.Fatalf("Got unexpected messages: %+v", messages)
+	}
+	if count := store.Messages.GetUnreadCount(&buyer); count != 1 {
+		t.Error("Got " + strconv.Itoa(count) + " unread messages, expected 1")
+	}
+
+	store.Listings.Delete(&listing)
+	if _, err := store.Offers.GetByID(offer.ID); err == nil {
+		t.Error("Offer was not deleted with its listing")
+	}
+}
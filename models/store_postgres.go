@@ -0,0 +1,350 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// NewPostgresStore creates a Store which keeps models in PostgreSQL
+func NewPostgresStore(db *sql.DB) *Store {
+	return &Store{
+		Users:         &pgUserStore{db},
+		Places:        &pgPlaceStore{db},
+		Listings:      &pgListingStore{db},
+		Offers:        &pgOfferStore{db},
+		Messages:      &pgMessageStore{db},
+		Meetups:       &pgMeetupStore{db},
+		Reviews:       &pgReviewStore{db},
+		Images:        &pgImageStore{db},
+		Notifications: &pgNotificationStore{db},
+		Sessions:      &pgSessionStore{db},
+	}
+}
+
+type pgUserStore struct {
+	db *sql.DB
+}
+
+func (s *pgUserStore) Create(user *User) (bool, *UserError) {
+	return user.Create(s.db)
+}
+
+func (s *pgUserStore) Save(user *User) (bool, *UserError) {
+	return user.Save(s.db)
+}
+
+func (s *pgUserStore) Validate(user *User, validatePassword bool,
+	validateUserExists bool) (bool, UserError) {
+
+	return user.Validate(s.db, validatePassword, validateUserExists)
+}
+
+func (s *pgUserStore) Activate(user *User) error {
+	return user.Activate(s.db)
+}
+
+func (s *pgUserStore) GetByID(id int) *User {
+	return GetUserByID(s.db, id)
+}
+
+func (s *pgUserStore) GetByUsername(username string) *User {
+	return GetUserByUsername(s.db, username)
+}
+
+func (s *pgUserStore) GetByEmailAddress(emailAddress string) (*User, error) {
+	return GetUserByEmailAddress(s.db, emailAddress)
+}
+
+type pgPlaceStore struct {
+	db *sql.DB
+}
+
+func (s *pgPlaceStore) GetByID(id int) (*Place, error) {
+	return GetPlaceByID(s.db, id)
+}
+
+func (s *pgPlaceStore) FindID(emailAddress string) (int, error) {
+	return FindPlaceID(s.db, emailAddress)
+}
+
+type pgListingStore struct {
+	db *sql.DB
+}
+
+func (s *pgListingStore) Create(listing *Listing) (bool, *ListingError) {
+	return listing.Create(s.db)
+}
+
+func (s *pgListingStore) Save(listing *Listing) (bool, *ListingError) {
+	return listing.Save(s.db)
+}
+
+func (s *pgListingStore) Delete(listing *Listing) (bool, error) {
+	return listing.Delete(s.db)
+}
+
+func (s *pgListingStore) MarkSold(listing *Listing) (bool, error) {
+	return listing.MarkSold(s.db)
+}
+
+func (s *pgListingStore) Renew(listing *Listing) error {
+	return listing.Renew(s.db)
+}
+
+func (s *pgListingStore) Bump(listing *Listing) error {
+	return listing.Bump(s.db)
+}
+
+func (s *pgListingStore) RemindExpiring(now time.Time) ([]Listing, error) {
+	return RemindExpiringListings(s.db, now)
+}
+
+func (s *pgListingStore) PublishScheduled(now time.Time) ([]Listing, error) {
+	return PublishScheduledListings(s.db, now)
+}
+
+func (s *pgListingStore) GetByID(id int) (*Listing, error) {
+	return GetListingByID(s.db, id)
+}
+
+func (s *pgListingStore) GetList(options ListingQueryOpts) []Listing {
+	return GetListingList(s.db, options)
+}
+
+func (s *pgListingStore) GetOfferRules(listingID int) (*OfferRules, error) {
+	return GetOfferRules(s.db, listingID)
+}
+
+func (s *pgListingStore) SaveOfferRules(rules *OfferRules) (bool,
+	*OfferRulesError) {
+
+	return rules.Save(s.db)
+}
+
+type pgOfferStore struct {
+	db *sql.DB
+}
+
+func (s *pgOfferStore) Create(offer *Offer) (bool, *OfferError) {
+	return offer.Create(s.db)
+}
+
+func (s *pgOfferStore) Revise(offer *Offer) (bool, *OfferError) {
+	return offer.Revise(s.db)
+}
+
+func (s *pgOfferStore) CounterOffer(offer *Offer) (bool, *OfferError) {
+	return offer.CounterOffer(s.db)
+}
+
+func (s *pgOfferStore) Decline(offer *Offer) error {
+	return offer.Decline(s.db)
+}
+
+func (s *pgOfferStore) Withdraw(offer *Offer) error {
+	return offer.Withdraw(s.db)
+}
+
+func (s *pgOfferStore) Accept(offer *Offer) error {
+	return offer.Accept(s.db)
+}
+
+func (s *pgOfferStore) Finalize(offer *Offer) ([]Offer, error) {
+	return offer.Finalize(s.db)
+}
+
+func (s *pgOfferStore) ApplyRules(offer *Offer) (string, error) {
+	return offer.ApplyRules(s.db)
+}
+
+func (s *pgOfferStore) Expire(now time.Time) ([]ExpiredOffer, error) {
+	return ExpireOffers(s.db, now)
+}
+
+func (s *pgOfferStore) GetHistory(offerIDs []int) (map[int][]OfferEvent,
+	error) {
+
+	return GetOfferHistory(s.db, offerIDs)
+}
+
+func (s *pgOfferStore) GetBundles(offerIDs []int) (map[int][]Listing,
+	error) {
+
+	return GetOfferBundles(s.db, offerIDs)
+}
+
+func (s *pgOfferStore) GetByID(id int) (*Offer, error) {
+	return GetOfferByID(s.db, id)
+}
+
+func (s *pgOfferStore) GetForListing(listing *Listing, pageNum,
+	pageSize int) ([]Offer, error) {
+
+	return listing.GetOffers(s.db, pageNum, pageSize)
+}
+
+func (s *pgOfferStore) GetAsSeller(user *User, pageNum,
+	pageSize int) ([]Offer, error) {
+
+	return user.GetOffersAsSeller(s.db, pageNum, pageSize)
+}
+
+func (s *pgOfferStore) GetAsBuyer(user *User) ([]Offer, error) {
+	return user.GetOffersAsBuyer(s.db)
+}
+
+func (s *pgOfferStore) GetOnListing(user *User, listingID int) (*Offer,
+	error) {
+
+	return user.GetOfferOnListing(s.db, listingID)
+}
+
+func (s *pgOfferStore) GetConversations(user *User) ([]Offer, error) {
+	return user.GetConversationsForUser(s.db)
+}
+
+type pgMessageStore struct {
+	db *sql.DB
+}
+
+func (s *pgMessageStore) Create(message *Message) (bool, *MessageError) {
+	return message.Create(s.db)
+}
+
+func (s *pgMessageStore) MarkRead(message *Message, recepientID int) {
+	message.MarkRead(s.db, recepientID)
+}
+
+func (s *pgMessageStore) GetForOffer(offer *Offer, pageSize, page int,
+	recepientID int) ([]Message, error) {
+
+	return offer.GetMessages(s.db, pageSize, page, recepientID)
+}
+
+func (s *pgMessageStore) GetLast(offer *Offer) (*Message, error) {
+	return offer.GetLastMessage(s.db)
+}
+
+func (s *pgMessageStore) GetUnreadCount(user *User) int {
+	return user.GetUnreadMessageCount(s.db)
+}
+
+type pgMeetupStore struct {
+	db *sql.DB
+}
+
+func (s *pgMeetupStore) Propose(meetup *Meetup) (bool, *MeetupError) {
+	return meetup.Propose(s.db)
+}
+
+func (s *pgMeetupStore) Answer(meetup *Meetup, user *User,
+	status string) error {
+
+	return meetup.Answer(s.db, user, status)
+}
+
+func (s *pgMeetupStore) GetForOffer(offerID int) (*Meetup, error) {
+	return GetMeetupForOffer(s.db, offerID)
+}
+
+type pgReviewStore struct {
+	db *sql.DB
+}
+
+func (s *pgReviewStore) Create(review *Review) (bool, *ReviewError) {
+	return review.Create(s.db)
+}
+
+func (s *pgReviewStore) GetForUser(userID, page int) ([]Review, error) {
+	return GetReviewsForUser(s.db, userID, page)
+}
+
+func (s *pgReviewStore) GetForOffer(offerID int) ([]Review, error) {
+	return GetReviewsForOffer(s.db, offerID)
+}
+
+func (s *pgReviewStore) GetReputations(userIDs []int) (map[int]Reputation,
+	error) {
+
+	return GetReputations(s.db, userIDs)
+}
+
+type pgImageStore struct {
+	db *sql.DB
+}
+
+func (s *pgImageStore) Create(image *Image) (bool, error) {
+	return image.Create(s.db)
+}
+
+func (s *pgImageStore) Save(image *Image) (bool, error) {
+	return image.Save(s.db)
+}
+
+func (s *pgImageStore) Delete(image *Image) (bool, error) {
+	return image.Delete(s.db)
+}
+
+func (s *pgImageStore) GetByID(id int) (*Image, error) {
+	return GetImageByID(s.db, id)
+}
+
+func (s *pgImageStore) GetForListing(listing *Listing) ([]Image, error) {
+	return listing.GetImages(s.db)
+}
+
+func (s *pgImageStore) GetCountForListing(listing *Listing) (int, error) {
+	return listing.GetImageCount(s.db)
+}
+
+func (s *pgImageStore) SetPrimary(listing *Listing, id int) (bool, error) {
+	return listing.UpdatePrimaryImage(s.db, id)
+}
+
+type pgNotificationStore struct {
+	db *sql.DB
+}
+
+func (s *pgNotificationStore) Create(notification *Notification) (bool,
+	error) {
+
+	return notification.Create(s.db)
+}
+
+func (s *pgNotificationStore) GetRecent(user *User, page int) []Notification {
+	return user.GetRecentNotifications(s.db, page)
+}
+
+func (s *pgNotificationStore) GetUnreadCount(user *User) int {
+	return user.GetUnreadNotificationCount(s.db)
+}
+
+func (s *pgNotificationStore) MarkRead(user *User, id int) error {
+	return user.MarkNotificationRead(s.db, id)
+}
+
+func (s *pgNotificationStore) MarkReadUpTo(user *User, id int) error {
+	return user.MarkNotificationsRead(s.db, id)
+}
+
+type pgSessionStore struct {
+	db *sql.DB
+}
+
+func (s *pgSessionStore) Create(session *Session) (bool, error) {
+	return session.Create(s.db)
+}
+
+func (s *pgSessionStore) Update(session *Session) {
+	session.Update(s.db)
+}
+
+func (s *pgSessionStore) Get(sessionID string, sessionSecret string,
+	browserAgent string) *Session {
+
+	return GetSession(s.db, sessionID, sessionSecret, browserAgent)
+}
+
+func (s *pgSessionStore) Delete(session *Session) bool {
+	return session.Delete(s.db)
+}
@@ -0,0 +1,954 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+// storeTest is a store under test. It keeps track of the users it creates,
+// so that they and everything they made can be removed from the database
+// afterwards
+type storeTest struct {
+	*Store
+	db    *sql.DB
+	users []int
+}
+
+// testStores runs a test against the memory store, and against the
+// PostgreSQL store if there is a database connection
+func testStores(t *testing.T, test func(t *testing.T, s *storeTest)) {
+	t.Run("Memory", func(t *testing.T) {
+		test(t, &storeTest{Store: newTestMemoryStore()})
+	})
+	t.Run("Postgres", func(t *testing.T) {
+		testPostgres(t, test)
+	})
+}
+
+// testPostgres runs a test against the PostgreSQL store, for features the
+// memory store doesn't have
+func testPostgres(t *testing.T, test func(t *testing.T, s *storeTest)) {
+	db := testDB(t)
+	s := &storeTest{Store: NewPostgresStore(db), db: db}
+	defer s.cleanup()
+	test(t, s)
+}
+
+// cleanup deletes the users made by a test from the database, which
+// cascades to their listings, offers and everything on them
+func (s *storeTest) cleanup() {
+	for _, id := range s.users {
+		if _, err := s.db.Exec("DELETE FROM users WHERE id = $1", id); err != nil {
+			fmt.Fprintln(os.Stderr, "Error deleting user with id "+
+				strconv.Itoa(id))
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// user creates a user at Rutgers
+func (s *storeTest) user(t *testing.T) User {
+	username := "test" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	user := User{
+		Username:             username,
+		DisplayName:          "Test User",
+		EmailAddress:         username + "@rutgers.edu",
+		Password:             "password1",
+		PasswordConfirmation: "password1",
+	}
+	if ok, err := s.Users.Create(&user); !ok {
+		t.Fatalf("Failed to create user: %+v", err)
+	}
+	s.users = append(s.users, user.ID)
+	return user
+}
+
+// listing creates a published listing for $10.00 sold by seller
+func (s *storeTest) listing(t *testing.T, seller User) Listing {
+	listing := Listing{
+		Name:        "Listing",
+		Type:        ListingMisc,
+		Status:      ListingListed,
+		Condition:   "na",
+		PriceClient: "10.00",
+		Published:   true,
+		User:        seller,
+	}
+	if ok, err := s.Listings.Create(&listing); !ok {
+		t.Fatalf("Failed to create listing: %+v", err)
+	}
+	return listing
+}
+
+// offer makes an offer of price from buyer on a listing
+func (s *storeTest) offer(t *testing.T, listing Listing, buyer User,
+	price int) Offer {
+
+	offer := Offer{
+		Price:   price,
+		Listing: listing,
+		Buyer:   buyer,
+		Seller:  listing.User,
+	}
+	if ok, err := s.Offers.Create(&offer); !ok {
+		t.Fatalf("Failed to make offer: %+v", err)
+	}
+	return offer
+}
+
+// backdateListing sets when a listing expires and when it was last bumped,
+// which the store only ever moves forward
+func (s *storeTest) backdateListing(t *testing.T, id int, expires,
+	bumped time.Time) {
+
+	if s.db == nil {
+		data := s.Listings.(*memListingStore).data
+		saved := data.listings[id]
+		saved.Expires = &expires
+		saved.Bumped = bumped
+		data.listings[id] = saved
+		return
+	}
+	_, err := s.db.Exec("UPDATE listings SET expires = $1, bumped = $2 "+
+		"WHERE id = $3", expires, bumped, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ownExpired leaves out expired offers which weren't made by a test, since
+// the database can have others
+func ownExpired(expired []ExpiredOffer, offers ...Offer) []ExpiredOffer {
+	own := make([]ExpiredOffer, 0, len(expired))
+	for _, e := range expired {
+		for _, offer := range offers {
+			if e.ID == offer.ID {
+				own = append(own, e)
+			}
+		}
+	}
+	return own
+}
+
+// ownListings leaves out listings which aren't sold by seller, since the
+// database can have others
+func ownListings(listings []Listing, seller User) []Listing {
+	own := make([]Listing, 0, len(listings))
+	for _, listing := range listings {
+		if listing.User.ID == seller.ID {
+			own = append(own, listing)
+		}
+	}
+	return own
+}
+
+func TestStoreListingAttributes(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		listing := Listing{
+			Name:        "Used Sedan",
+			Type:        ListingAutomotive,
+			Status:      ListingListed,
+			Condition:   "good",
+			PriceClient: "4000.00",
+			Published:   true,
+			Attributes:  map[string]string{"year": "1850", "isbn": "0131103628"},
+			User:        s.user(t),
+		}
+		ok, err := s.Listings.Create(&listing)
+		if ok || err.Attributes["year"] == "" || err.Attributes["isbn"] == "" {
+			t.Fatalf("Created a listing with invalid attributes: %+v", err)
+		}
+
+		listing.Attributes = map[string]string{"year": " 2009 ",
+			"mileage": "120,000", "make": ""}
+		if ok, err := s.Listings.Create(&listing); !ok {
+			t.Fatalf("Failed to create listing: %+v", err)
+		}
+		listing.Attributes["year"] = "2010"
+
+		saved, _ := s.Listings.GetByID(listing.ID)
+		if len(saved.Attributes) != 2 || saved.Attributes["year"] != "2009" ||
+			saved.Attributes["mileage"] != "120000" {
+
+			t.Fatalf("Got unexpected attributes: %+v", saved.Attributes)
+		}
+
+		saved.Type = ListingMisc
+		saved.Attributes = nil
+		if ok, err := s.Listings.Save(saved); !ok {
+			t.Fatalf("Failed to save listing: %+v", err)
+		}
+		saved, _ = s.Listings.GetByID(listing.ID)
+		if len(saved.Attributes) != 0 {
+			t.Errorf("Attributes were kept after the type changed: %+v",
+				saved.Attributes)
+		}
+	})
+}
+
+func TestStoreListingsByISBN(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		isbns := []string{"0-262-03384-4", "9780262033848", "9780131103627"}
+		ids := make([]int, len(isbns))
+		for i, isbn := range isbns {
+			listing := Listing{
+				Name:        "Algorithms",
+				Type:        ListingTextbook,
+				Status:      ListingListed,
+				Condition:   "good",
+				PriceClient: strconv.Itoa(50-i) + ".00",
+				Published:   true,
+				Attributes:  map[string]string{"isbn": isbn},
+				User:        seller,
+			}
+			if ok, err := s.Listings.Create(&listing); !ok {
+				t.Fatalf("Failed to create listing: %+v", err)
+			}
+			ids[i] = listing.ID
+		}
+
+		copies := s.Listings.GetList(ListingQueryOpts{
+			UserID:         seller.ID,
+			RestrictByUser: true,
+			ISBN:           "9780262033848",
+			Sort:           SortPriceAsc,
+		})
+		if len(copies) != 2 || copies[0].ID != ids[1] || copies[1].ID != ids[0] {
+			t.Errorf("Got unexpected copies: %+v", copies)
+		}
+	})
+}
+
+func TestStoreFinalizeOffer(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		listing := s.listing(t, s.user(t))
+		offers := make([]Offer, 4)
+		for i := range offers {
+			offers[i] = s.offer(t, listing, s.user(t), 800+i)
+		}
+
+		if err := s.Offers.Decline(&offers[3]); err != nil {
+			t.Fatal(err)
+		}
+		if offers[3].Status != OfferDeclined {
+			t.Errorf("Got status %s after declining", offers[3].Status)
+		}
+		if err := s.Offers.Accept(&offers[3]); err != ErrOfferStatus {
+			t.Errorf("Accepted a declined offer, got %v", err)
+		}
+
+		if err := s.Offers.Accept(&offers[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Offers.Accept(&offers[0]); err != ErrOfferStatus {
+			t.Errorf("Accepted an offer twice, got %v", err)
+		}
+
+		closed, err := s.Offers.Finalize(&offers[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(closed) != 2 || closed[0].ID != offers[1].ID ||
+			closed[1].ID != offers[2].ID {
+
+			t.Errorf("Got unexpected closed offers: %+v", closed)
+		}
+
+		saved, _ := s.Listings.GetByID(listing.ID)
+		if saved.Status != ListingSold {
+			t.Error("Listing was not marked sold")
+		}
+		if other, _ := s.Offers.GetByID(offers[1].ID); other == nil ||
+			other.Status != OfferDeclined {
+
+			t.Error("A competing offer was not declined")
+		}
+		if _, err := s.Offers.Finalize(&offers[0]); err != ErrListingSold {
+			t.Errorf("Finalized an offer on a sold listing, got %v", err)
+		}
+	})
+}
+
+func TestStoreOfferHistory(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		listing := s.listing(t, s.user(t))
+		offer := s.offer(t, listing, s.user(t), 700)
+
+		offer.Counter = 950
+		offer.SellerComment = "Meet me halfway?"
+		if ok, err := s.Offers.CounterOffer(&offer); !ok {
+			t.Fatalf("Failed to counter offer: %+v", err)
+		}
+		offer.Counter = 900
+		s.Offers.CounterOffer(&offer)
+		offer.Price = 850
+		s.Offers.Revise(&offer)
+		if offer.Status != OfferOffered {
+			t.Errorf("Got status %s after revising, expected offered",
+				offer.Status)
+		}
+		if err := s.Offers.Withdraw(&offer); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Offers.Accept(&offer); err != ErrOfferStatus {
+			t.Errorf("Accepted a withdrawn offer, got %v", err)
+		}
+
+		history, _ := s.Offers.GetHistory([]int{offer.ID})
+		events := history[offer.ID]
+		expected := []string{"Offered $7.00", "Countered at $9.50",
+			"Countered at $9.00", "Offered $8.50", "Withdrew the offer"}
+		if len(events) != len(expected) {
+			t.Fatalf("Got unexpected history: %+v", events)
+		}
+		for i, event := range events {
+			if event.Description != expected[i] {
+				t.Errorf("Got event %q, expected %q", event.Description,
+					expected[i])
+			}
+		}
+		if events[1].Actor != OfferSeller ||
+			events[1].Comment != "Meet me halfway?" {
+
+			t.Errorf("Got unexpected counter event: %+v", events[1])
+		}
+	})
+}
+
+func TestStoreExpireOffers(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		listing := s.listing(t, s.user(t))
+		offers := make([]Offer, 3)
+		for i := range offers {
+			offers[i] = Offer{
+				Price:   800 + i,
+				Listing: listing,
+				Buyer:   s.user(t),
+				Seller:  listing.User,
+				Expires: OfferExpiry(1),
+			}
+			s.Offers.Create(&offers[i])
+		}
+		offers[0].Expires = OfferExpiry(2)
+		if err := s.Offers.Accept(&offers[0]); err != nil {
+			t.Fatal(err)
+		}
+		offers[1].Expires = nil
+		s.Offers.Revise(&offers[1])
+
+		expired, _ := s.Offers.Expire(time.Now().Add(time.Hour * 25))
+		expired = ownExpired(expired, offers...)
+		if len(expired) != 1 || expired[0].ID != offers[2].ID ||
+			expired[0].Lapsed {
+
+			t.Fatalf("Got unexpected expired offers: %+v", expired)
+		}
+
+		expired, _ = s.Offers.Expire(time.Now().Add(time.Hour * 49))
+		expired = ownExpired(expired, offers...)
+		if len(expired) != 1 || expired[0].ID != offers[0].ID ||
+			!expired[0].Lapsed || expired[0].Status != OfferExpired {
+
+			t.Fatalf("Got unexpected lapsed offers: %+v", expired)
+		}
+		if open, _ := s.Offers.GetByID(offers[1].ID); open.Status != OfferOffered {
+			t.Error("Expired an offer without an expiry")
+		}
+	})
+}
+
+func TestStoreOfferRules(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		listing := s.listing(t, s.user(t))
+
+		acceptAt, declineBelow := 900, 500
+		rules := OfferRules{
+			ListingID:    listing.ID,
+			AcceptAt:     &declineBelow,
+			DeclineBelow: &acceptAt,
+		}
+		if valid, _ := s.Listings.SaveOfferRules(&rules); valid {
+			t.Fatal("Saved rules declining offers above the accepted price")
+		}
+		rules.AcceptAt, rules.DeclineBelow = &acceptAt, &declineBelow
+		rules.DeclineReply = "Too low, sorry"
+		if valid, _ := s.Listings.SaveOfferRules(&rules); !valid {
+			t.Fatal("Failed to save valid rules")
+		}
+
+		expected := []struct {
+			price  int
+			action string
+			status string
+		}{
+			{400, OfferActionDecline, OfferDeclined},
+			{700, "", OfferOffered},
+			{900, OfferActionAccept, OfferAccepted},
+		}
+		for _, e := range expected {
+			offer := s.offer(t, listing, s.user(t), e.price)
+			action, err := s.Offers.ApplyRules(&offer)
+			if err != nil || action != e.action || offer.Status != e.status {
+				t.Errorf("Offer of %d got action %q and status %q, expected "+
+					"%q and %q", e.price, action, offer.Status, e.action,
+					e.status)
+			}
+
+			history, _ := s.Offers.GetHistory([]int{offer.ID})
+			last := history[offer.ID][len(history[offer.ID])-1]
+			if len(e.action) > 0 && (!last.Automatic || last.Action != e.action) {
+				t.Errorf("Offer of %d has unexpected history: %+v", e.price,
+					history[offer.ID])
+			}
+			if e.action == OfferActionDecline &&
+				last.Comment != rules.DeclineReply {
+
+				t.Errorf("Declined offer got reply %q", last.Comment)
+			}
+		}
+
+		rules = OfferRules{ListingID: listing.ID}
+		s.Listings.SaveOfferRules(&rules)
+		if saved, _ := s.Listings.GetOfferRules(listing.ID); !saved.Empty() {
+			t.Error("Failed to remove rules by saving empty ones")
+		}
+	})
+}
+
+func TestStoreListingHold(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		listing := s.listing(t, seller)
+		offers := make([]Offer, 2)
+		for i := range offers {
+			offers[i] = s.offer(t, listing, s.user(t), 800+i)
+		}
+
+		offers[0].Holding = true
+		offers[0].Expires = OfferExpiry(1)
+		if err := s.Offers.Accept(&offers[0]); err != nil {
+			t.Fatal(err)
+		}
+		held, _ := s.Listings.GetByID(listing.ID)
+		if held.Status != ListingTransaction {
+			t.Fatalf("Listing has status %q after being held", held.Status)
+		}
+		listings := s.Listings.GetList(ListingQueryOpts{UserID: seller.ID,
+			RestrictByUser: true, HideHeld: true})
+		if len(listings) != 0 {
+			t.Error("Listed a listing on hold")
+		}
+
+		if err := s.Offers.Accept(&offers[1]); err != ErrListingHeld {
+			t.Errorf("Accepted an offer on a held listing, got %v", err)
+		}
+		late := Offer{Price: 900, Listing: listing, Buyer: s.user(t),
+			Seller: seller}
+		if ok, _ := s.Offers.Create(&late); ok {
+			t.Error("Made an offer on a held listing")
+		}
+
+		expired, _ := s.Offers.Expire(time.Now().Add(time.Hour * 25))
+		expired = ownExpired(expired, offers...)
+		if len(expired) != 1 || !expired[0].Lapsed {
+			t.Fatalf("Got unexpected expired offers: %+v", expired)
+		}
+		released, _ := s.Listings.GetByID(listing.ID)
+		if released.Status != ListingListed {
+			t.Errorf("Listing has status %q after its hold lapsed",
+				released.Status)
+		}
+
+		offers[1].Holding = true
+		offers[1].Expires = OfferExpiry(1)
+		if err := s.Offers.Accept(&offers[1]); err != nil {
+			t.Fatalf("Failed to accept an offer after a hold lapsed: %v", err)
+		}
+		if err := s.Offers.Withdraw(&offers[1]); err != nil {
+			t.Fatal(err)
+		}
+		released, _ = s.Listings.GetByID(listing.ID)
+		if released.Status != ListingListed {
+			t.Errorf("Listing has status %q after its buyer withdrew",
+				released.Status)
+		}
+	})
+}
+
+func TestStoreMeetups(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		buyer := s.user(t)
+		offer := s.offer(t, s.listing(t, seller), buyer, 800)
+		if meetup, _ := s.Meetups.GetForOffer(offer.ID); meetup != nil {
+			t.Fatalf("Got a meetup before one was proposed: %+v", meetup)
+		}
+
+		past := Meetup{OfferID: offer.ID, Proposer: buyer,
+			Time: time.Now().Add(-time.Hour), Location: "Library"}
+		if ok, _ := s.Meetups.Propose(&past); ok {
+			t.Error("Proposed a meetup in the past")
+		}
+
+		meetup := Meetup{OfferID: offer.ID, Proposer: buyer,
+			Time: time.Now().Add(time.Hour), Location: "Library"}
+		if ok, err := s.Meetups.Propose(&meetup); !ok {
+			t.Fatalf("Failed to propose a meetup: %+v", err)
+		}
+		if err := s.Meetups.Answer(&meetup, &buyer,
+			MeetupAccepted); err != ErrMeetupStatus {
+
+			t.Errorf("Accepted a meetup as its proposer, got %v", err)
+		}
+		if err := s.Meetups.Answer(&meetup, &seller,
+			MeetupDeclined); err != nil {
+
+			t.Fatalf("Failed to decline a meetup: %v", err)
+		}
+
+		rescheduled := Meetup{OfferID: offer.ID, Proposer: seller,
+			Time: time.Now().Add(time.Hour * 2), Location: "Student Center"}
+		if ok, err := s.Meetups.Propose(&rescheduled); !ok {
+			t.Fatalf("Failed to reschedule a meetup: %+v", err)
+		}
+		if rescheduled.ID != meetup.ID {
+			t.Error("Rescheduling a meetup made another one")
+		}
+		if err := s.Meetups.Answer(&rescheduled, &buyer,
+			MeetupAccepted); err != nil {
+
+			t.Fatalf("Failed to accept a meetup: %v", err)
+		}
+		saved, _ := s.Meetups.GetForOffer(offer.ID)
+		if saved == nil || saved.Status != MeetupAccepted ||
+			saved.Location != "Student Center" ||
+			saved.Proposer.ID != seller.ID || saved.Sequence != 3 {
+
+			t.Errorf("Got unexpected meetup: %+v", saved)
+		}
+		if err := s.Meetups.Answer(saved, &buyer,
+			MeetupDeclined); err != ErrMeetupStatus {
+
+			t.Errorf("Answered a meetup twice, got %v", err)
+		}
+	})
+}
+
+func TestStoreReviews(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		buyer := s.user(t)
+		stranger := s.user(t)
+		offer := s.offer(t, s.listing(t, seller), buyer, 800)
+
+		early := Review{OfferID: offer.ID, Reviewer: buyer, Rating: 5}
+		if ok, _ := s.Reviews.Create(&early); ok {
+			t.Error("Reviewed an offer which wasn't completed")
+		}
+
+		if _, err := s.Offers.Finalize(&offer); err != nil {
+			t.Fatal(err)
+		}
+		outsider := Review{OfferID: offer.ID, Reviewer: stranger, Rating: 5}
+		if ok, _ := s.Reviews.Create(&outsider); ok {
+			t.Error("Reviewed an offer without being a party to it")
+		}
+		invalid := Review{OfferID: offer.ID, Reviewer: buyer, Rating: 6}
+		if ok, _ := s.Reviews.Create(&invalid); ok {
+			t.Error("Saved a review with an invalid rating")
+		}
+
+		byBuyer := Review{OfferID: offer.ID, Reviewer: buyer, Rating: 4}
+		if ok, err := s.Reviews.Create(&byBuyer); !ok {
+			t.Fatalf("Failed to review the seller: %+v", err)
+		}
+		if byBuyer.Reviewee.ID != seller.ID || byBuyer.Role != OfferSeller {
+			t.Errorf("Got unexpected reviewee: %+v", byBuyer)
+		}
+		again := Review{OfferID: offer.ID, Reviewer: buyer, Rating: 1}
+		if ok, _ := s.Reviews.Create(&again); ok {
+			t.Error("Reviewed an offer twice")
+		}
+		bySeller := Review{OfferID: offer.ID, Reviewer: seller, Rating: 5}
+		if ok, err := s.Reviews.Create(&bySeller); !ok {
+			t.Fatalf("Failed to review the buyer: %+v", err)
+		}
+
+		reputations, _ := s.Reviews.GetReputations([]int{seller.ID,
+			buyer.ID, stranger.ID})
+		if reputations[seller.ID].ReviewCount != 1 ||
+			reputations[seller.ID].RatingClient != "4.0" {
+
+			t.Errorf("Got unexpected seller reputation: %+v",
+				reputations[seller.ID])
+		}
+		if reputations[stranger.ID].ReviewCount != 0 {
+			t.Errorf("Got unexpected reputation: %+v",
+				reputations[stranger.ID])
+		}
+		reviews, _ := s.Reviews.GetForUser(buyer.ID, 0)
+		if len(reviews) != 1 || reviews[0].Rating != 5 ||
+			reviews[0].Listing.Name != "Listing" {
+
+			t.Errorf("Got unexpected reviews: %+v", reviews)
+		}
+	})
+}
+
+func TestStoreBundleOffers(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		buyer := s.user(t)
+		listings := make([]Listing, 4)
+		for i := range listings[:3] {
+			listings[i] = s.listing(t, seller)
+		}
+		listings[3] = s.listing(t, s.user(t))
+
+		single := s.offer(t, listings[0], buyer, 800)
+		s.offer(t, listings[2], s.user(t), 800)
+
+		mixed := Offer{Price: 2000, Listing: listings[0],
+			Bundle: []Listing{listings[3]}, Buyer: buyer, Seller: seller}
+		if ok, err := s.Offers.Create(&mixed); ok || len(err.Bundle) == 0 {
+			t.Error("Made a bundle offer across sellers")
+		}
+
+		bundle := Offer{Price: 2000, Listing: listings[0],
+			Bundle: []Listing{listings[1], listings[2]}, Buyer: buyer,
+			Seller: seller}
+		if ok, err := s.Offers.Create(&bundle); !ok {
+			t.Fatalf("Failed to make a bundle offer: %+v", err)
+		}
+
+		onListing, _ := s.Offers.GetOnListing(&buyer, listings[0].ID)
+		if onListing == nil || onListing.ID != single.ID {
+			t.Errorf("Got %+v as the offer on a listing instead of %d",
+				onListing, single.ID)
+		}
+		forListing, _ := s.Offers.GetForListing(&listings[1], 0, 10)
+		if len(forListing) != 1 || forListing[0].ID != bundle.ID {
+			t.Errorf("Got %+v as the offers on a bundled listing", forListing)
+		}
+		bundles, _ := s.Offers.GetBundles([]int{single.ID, bundle.ID})
+		if len(bundles) != 1 || len(bundles[bundle.ID]) != 3 {
+			t.Errorf("Got unexpected bundles: %+v", bundles)
+		}
+
+		if err := s.Offers.Accept(&bundle); err != nil {
+			t.Fatal(err)
+		}
+		closed, err := s.Offers.Finalize(&bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(closed) != 2 {
+			t.Errorf("Declined %d offers instead of 2", len(closed))
+		}
+		for _, listing := range listings[:3] {
+			sold, _ := s.Listings.GetByID(listing.ID)
+			if sold.Status != ListingSold {
+				t.Errorf("Listing %d has status %q after its bundle was sold",
+					listing.ID, sold.Status)
+			}
+		}
+	})
+}
+
+func TestStoreListingExpiry(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		listings := make([]Listing, 2)
+		for i := range listings {
+			listings[i] = s.listing(t, seller)
+		}
+		if listings[0].Expires == nil || listings[0].Expires.Before(
+			time.Now().Add(ListingLifetime-time.Minute)) {
+
+			t.Fatalf("Got unexpected expiry: %v", listings[0].Expires)
+		}
+		if err := s.Listings.Bump(&listings[0]); err != ErrBumpTooSoon {
+			t.Errorf("Bumped a new listing: %v", err)
+		}
+
+		early := s.offer(t, listings[0], s.user(t), 800)
+		s.backdateListing(t, listings[0].ID, time.Now().Add(-time.Hour),
+			time.Now().Add(-ListingLifetime))
+		if err := s.Offers.Accept(&early); err != ErrListingExpired {
+			t.Errorf("Accepted an offer on an expired listing, got %v", err)
+		}
+		late := Offer{Price: 800, Listing: listings[0], Buyer: s.user(t),
+			Seller: seller}
+		if ok, _ := s.Offers.Create(&late); ok {
+			t.Error("Made an offer on an expired listing")
+		}
+
+		reminded, _ := s.Listings.RemindExpiring(time.Now())
+		reminded = ownListings(reminded, seller)
+		if len(reminded) != 1 || reminded[0].ID != listings[0].ID {
+			t.Fatalf("Got unexpected reminders: %+v", reminded)
+		}
+		reminded, _ = s.Listings.RemindExpiring(time.Now())
+		if reminded = ownListings(reminded, seller); len(reminded) != 0 {
+			t.Errorf("Reminded a seller twice: %+v", reminded)
+		}
+
+		opts := ListingQueryOpts{UserID: seller.ID, RestrictByUser: true,
+			HideExpired: true}
+		visible := s.Listings.GetList(opts)
+		if len(visible) != 1 || visible[0].ID != listings[1].ID {
+			t.Fatalf("Got unexpected visible listings: %+v", visible)
+		}
+		if err := s.Listings.Bump(&listings[0]); err != ErrListingExpired {
+			t.Errorf("Bumped an expired listing: %v", err)
+		}
+
+		if err := s.Listings.Renew(&listings[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Listings.Bump(&listings[0]); err != nil {
+			t.Fatal(err)
+		}
+		visible = s.Listings.GetList(opts)
+		if len(visible) != 2 || visible[0].ID != listings[0].ID {
+			t.Errorf("Bumped listing isn't first: %+v", visible)
+		}
+	})
+}
+
+func TestStoreExpiryRemindersSkipHeld(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		held := s.listing(t, seller)
+		offer := s.offer(t, held, s.user(t), 800)
+		offer.Holding = true
+		offer.Expires = OfferExpiry(1)
+		if err := s.Offers.Accept(&offer); err != nil {
+			t.Fatal(err)
+		}
+		s.backdateListing(t, held.ID, time.Now().Add(time.Hour),
+			time.Now().Add(-ListingLifetime))
+
+		reminded, _ := s.Listings.RemindExpiring(time.Now())
+		if reminded = ownListings(reminded, seller); len(reminded) != 0 {
+			t.Errorf("Reminded a seller about a held listing: %+v", reminded)
+		}
+	})
+}
+
+func TestStoreScheduledListings(t *testing.T) {
+	testStores(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		past := time.Now().Add(-time.Hour)
+		listing := Listing{
+			Name:        "Listing",
+			Type:        ListingMisc,
+			Status:      ListingListed,
+			Condition:   "na",
+			PriceClient: "10.00",
+			PublishAt:   &past,
+			User:        seller,
+		}
+		if ok, err := s.Listings.Create(&listing); ok ||
+			len(err.PublishAt) == 0 {
+
+			t.Fatal("Scheduled a draft in the past")
+		}
+
+		publishAt := time.Now().Add(time.Hour)
+		listing.PublishAt = &publishAt
+		if ok, err := s.Listings.Create(&listing); !ok {
+			t.Fatalf("Failed to create listing: %+v", err)
+		}
+
+		published, _ := s.Listings.PublishScheduled(time.Now())
+		if published = ownListings(published, seller); len(published) != 0 {
+			t.Fatalf("Published a draft early: %+v", published)
+		}
+		opts := ListingQueryOpts{UserID: seller.ID, RestrictByUser: true,
+			HidePublished: true}
+		drafts := s.Listings.GetList(opts)
+		if len(drafts) != 1 || !drafts[0].IsScheduled() {
+			t.Fatalf("Got unexpected drafts: %+v", drafts)
+		}
+
+		published, _ = s.Listings.PublishScheduled(publishAt)
+		published = ownListings(published, seller)
+		if len(published) != 1 || !published[0].Published ||
+			published[0].PublishAt != nil || published[0].Expires == nil {
+
+			t.Fatalf("Got unexpected published listings: %+v", published)
+		}
+		published, _ = s.Listings.PublishScheduled(publishAt)
+		if published = ownListings(published, seller); len(published) != 0 {
+			t.Errorf("Published a listing twice: %+v", published)
+		}
+		if drafts = s.Listings.GetList(opts); len(drafts) != 0 {
+			t.Errorf("Got unexpected drafts: %+v", drafts)
+		}
+	})
+}
+
+func TestSimilarListings(t *testing.T) {
+	testPostgres(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		names := []string{"Quokka calculus textbook", "Quokka calculus workbook"}
+		listings := make([]Listing, len(names))
+		for i, name := range names {
+			listings[i] = Listing{
+				Name:        name,
+				Type:        ListingTextbook,
+				Status:      ListingListed,
+				Condition:   "good",
+				PriceClient: "20.00",
+				Published:   true,
+				User:        seller,
+			}
+			if ok, err := s.Listings.Create(&listings[i]); !ok {
+				t.Fatalf("Failed to create listing: %+v", err)
+			}
+			// Create indexes the listing in the background
+			if _, err := listings[i].rebuildSearchIndex(s.db, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		similar, err := listings[0].GetSimilarListings(s.db,
+			SimilarListingsCount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(similar) == 0 || similar[0].ID != listings[1].ID {
+			t.Errorf("Got unexpected similar listings: %+v", similar)
+		}
+	})
+}
+
+func TestSearchPrefixes(t *testing.T) {
+	testPostgres(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		tests := []struct {
+			query string
+			name  string
+		}{
+			{"quokka calculat*", "Quokka graphing calculator"},
+			{"quokka bicy*", "Quokka road bicycle"},
+			{"quokka textb*", "Quokka chemistry textbooks"},
+		}
+		for _, test := range tests {
+			listing := Listing{
+				Name:        test.name,
+				Type:        ListingMisc,
+				Status:      ListingListed,
+				Condition:   "good",
+				PriceClient: "20.00",
+				Published:   true,
+				User:        seller,
+			}
+			if ok, err := s.Listings.Create(&listing); !ok {
+				t.Fatalf("Failed to create listing: %+v", err)
+			}
+			if _, err := listing.rebuildSearchIndex(s.db, false); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := DoSearchForTerms(s.db,
+				utils.ParseSearchQuery(test.query), SearchFilters{},
+				SearchPaging{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, result := range results {
+				if result.ID == listing.ID {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected %q to find %q, got %+v", test.query, test.name,
+					results)
+			}
+		}
+	})
+}
+
+func TestMatchSavedSearches(t *testing.T) {
+	testPostgres(t, func(t *testing.T, s *storeTest) {
+		seller := s.user(t)
+		buyer := s.user(t)
+		search := SavedSearch{
+			User:    buyer,
+			PlaceID: seller.PlaceID,
+			Query:   "quokka",
+		}
+		if ok, err := search.Create(s.db); !ok {
+			t.Fatalf("Failed to save search: %+v", err)
+		}
+
+		listings := make([]Listing, 2)
+		for i := range listings {
+			listings[i] = Listing{
+				Name:        "Quokka lamp",
+				Type:        ListingMisc,
+				Status:      ListingListed,
+				Condition:   "good",
+				PriceClient: "20.00",
+				Published:   true,
+				User:        seller,
+			}
+			if ok, err := s.Listings.Create(&listings[i]); !ok {
+				t.Fatalf("Failed to create listing: %+v", err)
+			}
+		}
+		listed, expired := listings[0], listings[1]
+		s.backdateListing(t, expired.ID, time.Now().Add(-time.Hour),
+			time.Now().Add(-ListingLifetime))
+
+		for _, test := range []struct {
+			listing Listing
+			matches int
+		}{{listed, 1}, {expired, 0}} {
+			if _, err := test.listing.rebuildSearchIndex(s.db, false); err != nil {
+				t.Fatal(err)
+			}
+			searches, err := test.listing.MatchSavedSearches(s.db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(searches) != test.matches {
+				t.Errorf("Expected listing %d to match %d searches, got %+v",
+					test.listing.ID, test.matches, searches)
+			}
+		}
+	})
+}
+
+func TestWantedRespondClosed(t *testing.T) {
+	testPostgres(t, func(t *testing.T, s *storeTest) {
+		buyer := s.user(t)
+		post := WantedPost{Title: "Quokka desk lamp", User: buyer,
+			PlaceID: buyer.PlaceID}
+		if ok, err := post.Create(s.db); !ok {
+			t.Fatalf("Failed to create wanted post: %+v", err)
+		}
+		// The post is closed after it was loaded to respond to
+		stale := post
+		if ok, err := post.Close(s.db); !ok {
+			t.Fatalf("Failed to close wanted post: %v", err)
+		}
+
+		listing := s.listing(t, s.user(t))
+		if _, err := stale.Respond(s.db, &listing); err == nil ||
+			err.Global != wantedError(ErrWantedClosed, "").Global {
+
+			t.Errorf("Responded to a closed wanted post, got %+v", err)
+		}
+	})
+}
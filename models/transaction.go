@@ -0,0 +1,41 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// inTransaction runs fn in a transaction, which is committed if fn returns
+// nil and rolled back otherwise
+func inTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockListings locks the rows of a set of listings until the end of a
+// transaction, in order of ID so that transactions locking listings which
+// overlap can't deadlock, and gets their statuses, sellers, whether they
+// are published and when they expire
+func lockListings(tx *sql.Tx, ids []int) ([]Listing, error) {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+	listings := make([]Listing, 0, len(sorted))
+	for _, id := range sorted {
+		listing := Listing{ID: id}
+		err := tx.QueryRow("SELECT status, user_id, published, expires FROM "+
+			"listings WHERE id = $1 FOR UPDATE", id).Scan(&listing.Status,
+			&listing.User.ID, &listing.Published, &listing.Expires)
+		if err != nil {
+			return nil, err
+		}
+		listings = append(listings, listing)
+	}
+	return listings, nil
+}
@@ -38,6 +38,8 @@ type User struct {
 	Activation           string `json:"-"`
 	PlaceID              int    `json:"-"`
 	PlaceName            string `json:"place"`
+	// Reputation is only loaded where it is shown, and is nil elsewhere
+	Reputation *Reputation `json:"reputation,omitempty"`
 }
 
 // UserLimited is a version of user which is rendered
@@ -165,6 +167,18 @@ func (user *User) Authenticate(password string) (bool, error) {
 func (user *User) Validate(db *sql.DB, validatePassword bool,
 	validateUserExists bool) (bool, UserError) {
 
+	return user.validate(validatePassword, func() bool {
+		return validateUserExists && user.checkExistsUsername(db)
+	}, func(emailAddress string) (int, error) {
+		return FindPlaceID(db, emailAddress)
+	})
+}
+
+// validate checks the fields in user, using usernameTaken to check if the
+// username is in use and findPlaceID to find the user's place
+func (user *User) validate(validatePassword bool, usernameTaken func() bool,
+	findPlaceID func(emailAddress string) (int, error)) (bool, UserError) {
+
 	var userError UserError
 	var valid = true
 
@@ -175,7 +189,7 @@ func (user *User) Validate(db *sql.DB, validatePassword bool,
 		userError.Username = "Usernames must be between 6 and 20 characters, and " +
 			"can only contain letters, numbers, and spaces."
 		valid = false
-	} else if validateUserExists && user.checkExistsUsername(db) {
+	} else if usernameTaken() {
 		userError.Username = "That username is taken, sorry!"
 		valid = false
 	}
@@ -199,7 +213,7 @@ func (user *User) Validate(db *sql.DB, validatePassword bool,
 		valid = false
 	}
 
-	place, err := FindPlaceID(db, user.EmailAddress)
+	place, err := findPlaceID(user.EmailAddress)
 	if err != nil {
 		userError.Global = "An unexpected error occurred."
 		valid = false
@@ -0,0 +1,465 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anishmgoyal/calagora/constants"
+	"github.com/anishmgoyal/calagora/utils"
+)
+
+const (
+	// WantedOpen is for a wanted post sellers can still respond to
+	WantedOpen = "open"
+	// WantedClosed is for a wanted post its author no longer needs answered
+	WantedClosed = "closed"
+	// WantedPageSize is the number of wanted posts on a page of results
+	WantedPageSize = 20
+)
+
+var (
+	// ErrWantedClosed is returned when responding to a closed wanted post
+	ErrWantedClosed = errors.New("The wanted post is closed")
+	// ErrWantedListing is returned when responding to a wanted post with a
+	// listing which can't be offered to its author
+	ErrWantedListing = errors.New("The listing can't be offered for the " +
+		"wanted post")
+	// ErrWantedResponded is returned when a listing is offered for the same
+	// wanted post twice, or its author already made an offer on it
+	ErrWantedResponded = errors.New("The listing has already been offered " +
+		"for the wanted post")
+)
+
+// WantedPost is a buyer asking for something nobody has listed yet, such as
+// "Wanted: CS 111 textbook, up to $40". Sellers at the same place respond by
+// linking one of their listings, which makes an offer on it for the buyer
+type WantedPost struct {
+	ID             int    `json:"id"`
+	User           User   `json:"user"`
+	PlaceID        int    `json:"-"`
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	MaxPrice       *int   `json:"-"`
+	MaxPriceClient string `json:"max_price,omitempty"`
+	Status         string `json:"status"`
+	// ResponseCount is the number of listings sellers have offered for the
+	// post, when it is loaded
+	ResponseCount int       `json:"response_count"`
+	Created       time.Time `json:"created"`
+	Modified      time.Time `json:"modified"`
+}
+
+// WantedError contains descriptions of validation errors that may exist in
+// a wanted post, or in a response to one
+type WantedError struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	MaxPrice    string `json:"max_price"`
+	Listing     string `json:"listing"`
+	Global      string `json:"global"`
+}
+
+// WantedResponse is a listing a seller offered for a wanted post, along
+// with the offer it made for the post's author
+type WantedResponse struct {
+	ID       int       `json:"id"`
+	WantedID int       `json:"wanted_id"`
+	OfferID  int       `json:"offer_id"`
+	Listing  Listing   `json:"listing"`
+	Created  time.Time `json:"created"`
+}
+
+// wantedError describes an error from responding to a wanted post in a way
+// that can be shown to the seller responding
+func wantedError(err error, caller string) *WantedError {
+	switch err {
+	case ErrWantedClosed:
+		return &WantedError{Global: "This post is no longer looking for " +
+			"responses."}
+	case ErrWantedListing:
+		return &WantedError{Listing: "Only your own published listings at " +
+			"the same school can be offered."}
+	case ErrWantedResponded:
+		return &WantedError{Listing: "This listing has already been offered " +
+			"to the buyer."}
+	case ErrListingSold, ErrListingHeld, ErrListingExpired:
+		return &WantedError{Listing: "This listing is no longer for sale."}
+	}
+	fmt.Println("[ERROR] " + caller + ": " + err.Error())
+	return &WantedError{Global: "An unexpected error occurred."}
+}
+
+// Normalize removes artifacts like extra spaces
+func (p *WantedPost) Normalize() {
+	p.Title = strings.TrimSpace(p.Title)
+	p.Description = strings.TrimSpace(p.Description)
+}
+
+// Validate checks if the fields of a wanted post are valid
+func (p *WantedPost) Validate() (bool, WantedError) {
+	err := WantedError{}
+	valid := true
+	if len(p.Title) < 3 || len(p.Title) > 100 {
+		err.Title = "Titles may be between 3 and 100 characters long."
+		valid = false
+	}
+	if len(p.Description) >= 2500 {
+		err.Description = "The description cannot exceed 2500 characters."
+		valid = false
+	}
+	if p.MaxPrice != nil && *p.MaxPrice < 0 {
+		err.MaxPrice = "Prices can't be negative."
+		valid = false
+	}
+	return valid, err
+}
+
+// offerPrice gets the price offered for a listing in response to a wanted
+// post, which is the listing's price unless the buyer won't pay that much
+func (p *WantedPost) offerPrice(listing *Listing) int {
+	if p.MaxPrice != nil && *p.MaxPrice < listing.Price {
+		return *p.MaxPrice
+	}
+	return listing.Price
+}
+
+// offerComment gets the comment left on offers made in response to a
+// wanted post, which fits within the limit on offer comments. Long titles
+// are only cut between UTF-8 characters
+func (p *WantedPost) offerComment() string {
+	comment := "Wanted: " + p.Title
+	if len(comment) > 140 {
+		cut := 137
+		for cut > 0 && !utf8.RuneStart(comment[cut]) {
+			cut--
+		}
+		comment = comment[:cut] + "..."
+	}
+	return comment
+}
+
+// wantedDocumentStatement is the expression a wanted post's search
+// document is built from, with its title as $1, description as $2 and the
+// plain words for prefix terms as $3. The title carries the most weight
+// when ranking results
+const wantedDocumentStatement = "setweight(to_tsvector('" +
+	constants.SearchConfiguration + "', $1), 'A') || setweight(to_tsvector('" +
+	constants.SearchConfiguration + "', $2), 'C') || setweight(to_tsvector('" +
+	constants.SearchConfiguration + "', $3), 'D')"
+
+// Create inserts a wanted post along with its search document
+func (p *WantedPost) Create(db *sql.DB) (bool, *WantedError) {
+	p.Normalize()
+	p.Status = WantedOpen
+	valid, validationError := p.Validate()
+	if !valid {
+		return false, &validationError
+	}
+
+	err := db.QueryRow("INSERT INTO wanted_posts (document, user_id, "+
+		"place_id, title, description, max_price, analyzer_version) VALUES ("+
+		wantedDocumentStatement+", $4, $5, $6, $7, $8, $9) RETURNING id, "+
+		"created, modified", utils.SearchAnalyzer.AnalyzeString(p.Title),
+		utils.SearchAnalyzer.AnalyzeString(p.Description),
+		utils.SearchPrefixWords(p.Title+" "+p.Description), p.User.ID,
+		p.PlaceID, p.Title, p.Description, p.MaxPrice,
+		constants.SearchAnalyzerVersion).Scan(&p.ID, &p.Created, &p.Modified)
+	if err != nil {
+		fmt.Println("[ERROR] models.WantedPost.Create: " + err.Error())
+		return false, &WantedError{Global: "An unexpected error occurred."}
+	}
+	wantedPrices(p)
+	return true, nil
+}
+
+// Close stops a wanted post belonging to its user from taking responses,
+// and takes it out of search results
+func (p *WantedPost) Close(db *sql.DB) (bool, error) {
+	res, err := db.Exec("UPDATE wanted_posts SET status = $1, modified = "+
+		"now() WHERE id = $2 AND user_id = $3 AND status = $4", WantedClosed,
+		p.ID, p.User.ID, WantedOpen)
+	if err != nil {
+		return false, err
+	}
+	numAffected, _ := res.RowsAffected()
+	if numAffected == 1 {
+		p.Status = WantedClosed
+	}
+	return numAffected == 1, nil
+}
+
+// Respond offers one of a seller's listings for a wanted post. An offer is
+// made on the listing for the post's author, at the listing's price or the
+// most the author will pay, whichever is lower, so that the two can carry on
+// as they would with any other offer
+func (p *WantedPost) Respond(db *sql.DB, listing *Listing) (*Offer,
+	*WantedError) {
+
+	if p.Status != WantedOpen {
+		return nil, wantedError(ErrWantedClosed, "models.WantedPost.Respond")
+	}
+	if !listing.Published || listing.Status != ListingListed ||
+		listing.IsExpired() || listing.User.ID == p.User.ID ||
+		listing.User.PlaceID != p.PlaceID {
+
+		return nil, wantedError(ErrWantedListing, "models.WantedPost.Respond")
+	}
+
+	offer := &Offer{
+		Price:        p.offerPrice(listing),
+		BuyerComment: p.offerComment(),
+		Listing:      *listing,
+		Buyer:        p.User,
+		Seller:       listing.User,
+	}
+	if valid, _ := offer.prepare(); !valid {
+		return nil, &WantedError{Global: "An unexpected error occurred."}
+	}
+
+	err := inTransaction(db, func(tx *sql.Tx) error {
+		// The post is locked and checked again, so that it can't be closed
+		// while the offer is made
+		var status string
+		err := tx.QueryRow("SELECT status FROM wanted_posts WHERE id = $1 "+
+			"FOR UPDATE", p.ID).Scan(&status)
+		if err == sql.ErrNoRows || err == nil && status != WantedOpen {
+			return ErrWantedClosed
+		} else if err != nil {
+			return err
+		}
+
+		// The listing is locked next, so that another response can't make
+		// an offer on it between the check and the insert
+		if _, err := lockListings(tx, []int{listing.ID}); err != nil {
+			return err
+		}
+		var count int
+		err = tx.QueryRow("SELECT COUNT(1) FROM offers WHERE buyer_id = $1 "+
+			"AND listing_id = $2 AND NOT bundle", p.User.ID,
+			listing.ID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrWantedResponded
+		}
+		if err := offer.insert(tx); err != nil {
+			return err
+		}
+
+		// Each listing can answer a post once, which the unique constraint
+		// on wanted_responses enforces
+		res, err := tx.Exec("INSERT INTO wanted_responses (wanted_id, "+
+			"listing_id, offer_id) VALUES ($1, $2, $3) ON CONFLICT (wanted_id, "+
+			"listing_id) DO NOTHING", p.ID, listing.ID, offer.ID)
+		if err != nil {
+			return err
+		}
+		if num, err := res.RowsAffected(); err != nil {
+			return err
+		} else if num == 0 {
+			return ErrWantedResponded
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wantedError(err, "models.WantedPost.Respond")
+	}
+	offerPrices(offer)
+	return offer, nil
+}
+
+// GetResponses gets the listings sellers have offered for a wanted post,
+// newest first
+func (p *WantedPost) GetResponses(db *sql.DB) ([]WantedResponse, error) {
+	rows, err := db.Query("SELECT r.id, r.offer_id, r.created, l.id, l.name, "+
+		"l.price, l.status, u.id, u.username, u.display_name FROM "+
+		"wanted_responses r, listings l, users u WHERE r.listing_id = l.id AND "+
+		"l.user_id = u.id AND r.wanted_id = $1 ORDER BY r.id DESC", p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	responses := make([]WantedResponse, 0)
+	for rows.Next() {
+		response := WantedResponse{WantedID: p.ID}
+		err := rows.Scan(&response.ID, &response.OfferID, &response.Created,
+			&response.Listing.ID, &response.Listing.Name, &response.Listing.Price,
+			&response.Listing.Status, &response.Listing.User.ID,
+			&response.Listing.User.Username, &response.Listing.User.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+		response.Listing.PriceClient = utils.PriceServerToClient(
+			response.Listing.Price)
+		responses = append(responses, response)
+	}
+	return responses, rows.Err()
+}
+
+// wantedPrices sets the prices shown to users for a wanted post
+func wantedPrices(p *WantedPost) {
+	p.MaxPriceClient = ""
+	if p.MaxPrice != nil {
+		p.MaxPriceClient = utils.PriceServerToClient(*p.MaxPrice)
+	}
+}
+
+// wantedColumns are the columns scanned by scanWantedPosts, from wanted
+// posts w joined with their users u
+const wantedColumns = "w.id, w.place_id, w.title, w.description, " +
+	"w.max_price, w.status, w.created, w.modified, u.id, u.username, " +
+	"u.display_name, u.email_address, (SELECT COUNT(1) FROM wanted_responses " +
+	"r WHERE r.wanted_id = w.id)"
+
+func scanWantedPosts(rows *sql.Rows) ([]WantedPost, error) {
+	defer rows.Close()
+	posts := make([]WantedPost, 0)
+	for rows.Next() {
+		var post WantedPost
+		err := rows.Scan(&post.ID, &post.PlaceID, &post.Title,
+			&post.Description, &post.MaxPrice, &post.Status, &post.Created,
+			&post.Modified, &post.User.ID, &post.User.Username,
+			&post.User.DisplayName, &post.User.EmailAddress, &post.ResponseCount)
+		if err != nil {
+			return nil, err
+		}
+		post.User.PlaceID = post.PlaceID
+		wantedPrices(&post)
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// GetWantedPostByID gets a wanted post by its ID, or nil if there isn't one
+func GetWantedPostByID(db *sql.DB, id int) (*WantedPost, error) {
+	rows, err := db.Query("SELECT "+wantedColumns+" FROM wanted_posts w, "+
+		"users u WHERE w.user_id = u.id AND w.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := scanWantedPosts(rows)
+	if err != nil || len(posts) == 0 {
+		return nil, err
+	}
+	return &posts[0], nil
+}
+
+// GetWantedPosts gets every wanted post a user has made, newest first
+func (u *User) GetWantedPosts(db *sql.DB) ([]WantedPost, error) {
+	rows, err := db.Query("SELECT "+wantedColumns+" FROM wanted_posts w, "+
+		"users u WHERE w.user_id = u.id AND w.user_id = $1 ORDER BY w.id DESC",
+		u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return scanWantedPosts(rows)
+}
+
+// wantedSearchClause builds the FROM and WHERE clauses for a search over
+// the open wanted posts w at a place. Posts are matched against a query the
+// same way listings are
+func wantedSearchClause(placeID int, query utils.SearchQuery,
+	args []interface{}) (string, []interface{}) {
+
+	args = append(args, placeID, WantedOpen)
+	from := " FROM wanted_posts w JOIN users u ON w.user_id = u.id"
+	where := " WHERE w.place_id = $" + strconv.Itoa(len(args)-1) +
+		" AND w.status = $" + strconv.Itoa(len(args))
+	if !query.IsEmpty() {
+		var tsQuery string
+		tsQuery, args = searchTSQuery(query, args)
+		from += ", (SELECT " + tsQuery + " AS query) q"
+		where += " AND w.document @@ q.query"
+	}
+	return from + where, args
+}
+
+// SearchWantedPosts gets a page of the open wanted posts at a place which
+// match a query, best matches first. Without a query, every open post is
+// returned, newest first
+func SearchWantedPosts(db *sql.DB, placeID int, query utils.SearchQuery,
+	page int) ([]WantedPost, error) {
+
+	clause, args := wantedSearchClause(placeID, query,
+		make([]interface{}, 0, 8))
+	order := " ORDER BY w.id DESC"
+	if !query.IsEmpty() {
+		order = " ORDER BY ts_rank_cd(w.document, q.query) DESC, w.id DESC"
+	}
+	args = append(args, WantedPageSize, page*WantedPageSize)
+	rows, err := db.Query("SELECT "+wantedColumns+clause+order+" LIMIT $"+
+		strconv.Itoa(len(args)-1)+" OFFSET $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanWantedPosts(rows)
+}
+
+// GetWantedPageCount gets the number of pages of open wanted posts at a
+// place which match a query
+func GetWantedPageCount(db *sql.DB, placeID int, query utils.SearchQuery) int {
+	clause, args := wantedSearchClause(placeID, query,
+		make([]interface{}, 0, 8))
+
+	var numRecords int
+	err := db.QueryRow("SELECT COUNT(1)"+clause, args...).Scan(&numRecords)
+	if err != nil {
+		return 0
+	}
+
+	pageCount := numRecords / WantedPageSize
+	if numRecords%WantedPageSize > 0 {
+		pageCount++
+	}
+	return pageCount
+}
+
+// RebuildStaleWantedIndex rebuilds the search documents of any wanted posts
+// indexed by an older analyzer
+func RebuildStaleWantedIndex(db *sql.DB) {
+	rows, err := db.Query("SELECT id, title, description FROM wanted_posts "+
+		"WHERE analyzer_version < $1 ORDER BY id",
+		constants.SearchAnalyzerVersion)
+	if err != nil {
+		fmt.Println("[ERROR] models.RebuildStaleWantedIndex: " + err.Error())
+		return
+	}
+	var posts []WantedPost
+	for rows.Next() {
+		var post WantedPost
+		if err := rows.Scan(&post.ID, &post.Title, &post.Description); err != nil {
+			rows.Close()
+			fmt.Println("[ERROR] models.RebuildStaleWantedIndex: " + err.Error())
+			return
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+
+	numRebuilt := 0
+	for _, post := range posts {
+		_, err := db.Exec("UPDATE wanted_posts SET document = "+
+			wantedDocumentStatement+", analyzer_version = $4 WHERE id = $5",
+			utils.SearchAnalyzer.AnalyzeString(post.Title),
+			utils.SearchAnalyzer.AnalyzeString(post.Description),
+			utils.SearchPrefixWords(post.Title+" "+post.Description),
+			constants.SearchAnalyzerVersion, post.ID)
+		if err != nil {
+			fmt.Println("[ERROR] models.RebuildStaleWantedIndex: wanted post " +
+				strconv.Itoa(post.ID) + ": " + err.Error())
+			continue
+		}
+		numRebuilt++
+	}
+	if numRebuilt > 0 {
+		fmt.Println("[INFO] models.RebuildStaleWantedIndex: " +
+			strconv.Itoa(numRebuilt) + " wanted posts indexed")
+	}
+}
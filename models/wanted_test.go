@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWantedOfferPrice(t *testing.T) {
+	max := 4000
+	listing := &Listing{Price: 5500}
+
+	post := WantedPost{MaxPrice: &max}
+	if price := post.offerPrice(listing); price != max {
+		t.Errorf("offered %d for a listing over the max price, expected %d",
+			price, max)
+	}
+
+	listing.Price = 2500
+	if price := post.offerPrice(listing); price != listing.Price {
+		t.Errorf("offered %d for a listing under the max price, expected %d",
+			price, listing.Price)
+	}
+
+	post.MaxPrice = nil
+	listing.Price = 9900
+	if price := post.offerPrice(listing); price != listing.Price {
+		t.Errorf("offered %d without a max price, expected %d", price,
+			listing.Price)
+	}
+}
+
+func TestWantedValidate(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		post  WantedPost
+		valid bool
+	}{
+		{WantedPost{Title: "CS 111 textbook"}, true},
+		{WantedPost{Title: "CS"}, false},
+		{WantedPost{Title: strings.Repeat("a", 101)}, false},
+		{WantedPost{Title: "Desk lamp", MaxPrice: &negative}, false},
+	}
+	for _, test := range tests {
+		if valid, _ := test.post.Validate(); valid != test.valid {
+			t.Errorf("%q was valid: %v, expected %v", test.post.Title, valid,
+				test.valid)
+		}
+	}
+
+	for _, title := range []string{strings.Repeat("a", 100),
+		strings.Repeat("\u00e9", 100)} {
+
+		post := WantedPost{Title: title}
+		comment := post.offerComment()
+		if len(comment) > 140 {
+			t.Errorf("offer comment is %d characters long", len(comment))
+		}
+		if !utf8.ValidString(comment) {
+			t.Errorf("offer comment %q was cut inside a character", comment)
+		}
+	}
+}
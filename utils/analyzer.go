@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/anishmgoyal/calagora/constants"
+)
+
+// Tokenizer splits text into tokens
+type Tokenizer func(s string) []string
+
+// TokenFilter transforms a list of tokens, and may add, remove or replace
+// tokens
+type TokenFilter func(tokens []string) []string
+
+// Analyzer breaks text into the terms stored in and looked up from the
+// search index. The same analyzer has to be used for listings and queries,
+// or the terms they produce won't match
+type Analyzer struct {
+	Tokenizer Tokenizer
+	Filters   []TokenFilter
+}
+
+// NewAnalyzer creates an analyzer which runs tokens from a tokenizer through
+// a series of filters, in order
+func NewAnalyzer(tokenizer Tokenizer, filters ...TokenFilter) *Analyzer {
+	return &Analyzer{
+		Tokenizer: tokenizer,
+		Filters:   filters,
+	}
+}
+
+// Analyze splits text into terms
+func (a *Analyzer) Analyze(s string) []string {
+	tokens := a.Tokenizer(s)
+	for _, filter := range a.Filters {
+		tokens = filter(tokens)
+	}
+	return tokens
+}
+
+// AnalyzeString splits text into terms, and joins them back together with
+// spaces, keeping their order
+func (a *Analyzer) AnalyzeString(s string) string {
+	return strings.Join(a.Analyze(s), " ")
+}
+
+// minTokenLength is the fewest characters in a token. Two characters is
+// enough to keep words like "TV" searchable
+const minTokenLength = 2
+
+// UnicodeTokenizer splits text into runs of letters and digits in any
+// script. Combining marks are kept with the letters they modify
+func UnicodeTokenizer(s string) []string {
+	tokens := make([]string, 0, len(s)/5+1)
+	start := -1
+	for pos, r := range s {
+		isWordChar := unicode.IsLetter(r) || unicode.IsDigit(r) ||
+			unicode.Is(unicode.Mn, r)
+		if isWordChar && start == -1 {
+			start = pos
+		} else if !isWordChar && start != -1 {
+			tokens = appendToken(tokens, s[start:pos])
+			start = -1
+		}
+	}
+	if start != -1 {
+		tokens = appendToken(tokens, s[start:])
+	}
+	return tokens
+}
+
+func appendToken(tokens []string, token string) []string {
+	if len([]rune(token)) >= minTokenLength {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// CaseFoldFilter lower cases every token
+func CaseFoldFilter(tokens []string) []string {
+	for i, token := range tokens {
+		tokens[i] = strings.ToLower(token)
+	}
+	return tokens
+}
+
+// accentFolds maps accented lower case latin letters to the letters
+// without their accents
+var accentFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a",
+	'ą': "a", 'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'è': "e",
+	'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e", 'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o",
+	'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe", 'ř': "r", 'ś': "s",
+	'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ù': "u", 'ú': "u", 'û': "u",
+	'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ý': "y", 'ÿ': "y", 'ź': "z",
+	'ż': "z", 'ž': "z",
+}
+
+// AccentFoldFilter strips accents from latin letters, so that "café" and
+// "cafe" are the same term. It expects tokens to already be lower case
+func AccentFoldFilter(tokens []string) []string {
+	for i, token := range tokens {
+		var folded strings.Builder
+		changed := false
+		for _, r := range token {
+			if fold, ok := accentFolds[r]; ok {
+				folded.WriteString(fold)
+				changed = true
+			} else if unicode.Is(unicode.Mn, r) {
+				changed = true
+			} else {
+				folded.WriteRune(r)
+			}
+		}
+		if changed {
+			tokens[i] = folded.String()
+		}
+	}
+	return tokens
+}
+
+// StopWordFilter removes common words which don't help find a listing
+func StopWordFilter(tokens []string) []string {
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if !isStopWord(token) {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// StemFilter reduces English words to their stems
+func StemFilter(tokens []string) []string {
+	for i, token := range tokens {
+		tokens[i] = Stem(token)
+	}
+	return tokens
+}
+
+// SynonymFilter creates a filter which replaces each token found in
+// synonyms with the term it maps to
+func SynonymFilter(synonyms map[string]string) TokenFilter {
+	return func(tokens []string) []string {
+		for i, token := range tokens {
+			if synonym, ok := synonyms[token]; ok {
+				tokens[i] = synonym
+			}
+		}
+		return tokens
+	}
+}
+
+// WordAnalyzer breaks text into plain words, without stemming them or
+// replacing synonyms. Its words are suitable to show back to users
+var WordAnalyzer = NewAnalyzer(UnicodeTokenizer, CaseFoldFilter,
+	AccentFoldFilter, StopWordFilter)
+
+// SearchAnalyzer breaks text into the terms used by the full text search
+// index, for both listings and queries
+var SearchAnalyzer = NewAnalyzer(UnicodeTokenizer, CaseFoldFilter,
+	AccentFoldFilter, StopWordFilter, StemFilter,
+	SynonymFilter(stemSynonyms(constants.SearchSynonyms)))
+
+// searchAnalyzerAllWords is SearchAnalyzer without stop words removed
+var searchAnalyzerAllWords = NewAnalyzer(UnicodeTokenizer, CaseFoldFilter,
+	AccentFoldFilter, StemFilter,
+	SynonymFilter(stemSynonyms(constants.SearchSynonyms)))
+
+// stemSynonyms runs a synonym table through the same folding and stemming
+// as search terms, since synonyms are replaced after stemming
+func stemSynonyms(synonyms map[string]string) map[string]string {
+	analyzer := NewAnalyzer(UnicodeTokenizer, CaseFoldFilter, AccentFoldFilter,
+		StemFilter)
+	stemmed := make(map[string]string, len(synonyms))
+	for word, synonym := range synonyms {
+		words := analyzer.Analyze(word)
+		synonyms := analyzer.Analyze(synonym)
+		if len(words) == 1 && len(synonyms) == 1 {
+			stemmed[words[0]] = synonyms[0]
+		}
+	}
+	return stemmed
+}
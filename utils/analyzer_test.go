@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnicodeTokenizer(t *testing.T) {
+	tokens := UnicodeTokenizer("Sony TV, PS4 & a Crème brûlée torch!")
+	expected := []string{"Sony", "TV", "PS4", "Crème", "brûlée", "torch"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Error("Expected ", expected, ", got ", tokens)
+	}
+}
+
+func TestSearchAnalyzer(t *testing.T) {
+	terms := SearchAnalyzer.Analyze("Comfy Couches for the Café")
+	expected := []string{"comfi", "sofa", "cafe"}
+	if !reflect.DeepEqual(terms, expected) {
+		t.Error("Expected ", expected, ", got ", terms)
+	}
+}
+
+func TestSearchAnalyzerMatchesForms(t *testing.T) {
+	pairs := [][2]string{
+		{"chairs", "chair"},
+		{"running", "run"},
+		{"TV", "television"},
+		{"Sofas", "couch"},
+		{"RÉSUMÉ", "resume"},
+	}
+	for _, pair := range pairs {
+		a := SearchAnalyzer.AnalyzeString(pair[0])
+		b := SearchAnalyzer.AnalyzeString(pair[1])
+		if a != b {
+			t.Error("Expected ", pair[0], " and ", pair[1], " to match, got ",
+				a, " and ", b)
+		}
+	}
+}
+
+func TestWordAnalyzer(t *testing.T) {
+	words := WordAnalyzer.Analyze("The Couches are Great")
+	expected := []string{"couches", "great"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Error("Expected ", expected, ", got ", words)
+	}
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarTimeFormat is the format of UTC times in iCalendar files
+const calendarTimeFormat = "20060102T150405Z"
+
+// calendarLineLength is the most octets allowed on a line of an iCalendar
+// file before it has to be folded
+const calendarLineLength = 75
+
+// CalendarEvent is a single event which can be saved to a calendar.
+// Sequence must go up each time an event with the same UID changes, since
+// calendars keep the copy with the highest sequence
+type CalendarEvent struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+	URL         string
+}
+
+// calendarTextEscaper escapes the characters with special meaning in
+// iCalendar text values
+var calendarTextEscaper = strings.NewReplacer("\\", "\\\\", ";", "\\;",
+	",", "\\,", "\r\n", "\\n", "\n", "\\n")
+
+// ICS renders an event as an iCalendar (RFC 5545) file
+func (e CalendarEvent) ICS() []byte {
+	var buff bytes.Buffer
+	writeCalendarLine(&buff, "BEGIN:VCALENDAR")
+	writeCalendarLine(&buff, "VERSION:2.0")
+	writeCalendarLine(&buff, "PRODID:-//Calagora//Calagora//EN")
+	writeCalendarLine(&buff, "METHOD:PUBLISH")
+	writeCalendarLine(&buff, "BEGIN:VEVENT")
+	writeCalendarLine(&buff, "UID:"+e.UID)
+	writeCalendarLine(&buff, "SEQUENCE:"+strconv.Itoa(e.Sequence))
+	writeCalendarLine(&buff, "DTSTAMP:"+
+		time.Now().UTC().Format(calendarTimeFormat))
+	writeCalendarLine(&buff, "DTSTART:"+e.Start.UTC().Format(calendarTimeFormat))
+	writeCalendarLine(&buff, "DTEND:"+e.End.UTC().Format(calendarTimeFormat))
+	writeCalendarLine(&buff, "SUMMARY:"+calendarTextEscaper.Replace(e.Summary))
+	if len(e.Location) > 0 {
+		writeCalendarLine(&buff, "LOCATION:"+
+			calendarTextEscaper.Replace(e.Location))
+	}
+	if len(e.Description) > 0 {
+		writeCalendarLine(&buff, "DESCRIPTION:"+
+			calendarTextEscaper.Replace(e.Description))
+	}
+	if len(e.URL) > 0 {
+		writeCalendarLine(&buff, "URL:"+e.URL)
+	}
+	writeCalendarLine(&buff, "END:VEVENT")
+	writeCalendarLine(&buff, "END:VCALENDAR")
+	return buff.Bytes()
+}
+
+// writeCalendarLine writes a content line, folding it onto continuation
+// lines which start with a space if it is too long. Lines are only folded
+// between UTF-8 characters
+func writeCalendarLine(buff *bytes.Buffer, line string) {
+	limit := calendarLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		buff.WriteString(line[:cut])
+		buff.WriteString("\r\n ")
+		line = line[cut:]
+		// The space starting a continuation line counts towards its length
+		limit = calendarLineLength - 1
+	}
+	buff.WriteString(line)
+	buff.WriteString("\r\n")
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarEventICS(t *testing.T) {
+	start := time.Date(2016, 11, 3, 15, 30, 0, 0, time.UTC)
+	event := CalendarEvent{
+		UID:         "meetup-1@calagora.com",
+		Sequence:    3,
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Summary:     "Pick up: desk, chair; lamp",
+		Location:    strings.Repeat("Library ", 12),
+		Description: "Bring cash\nand a bag",
+	}
+	ics := string(event.ICS())
+
+	if !strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n") ||
+		!strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+
+		t.Error("Expected a calendar, got ", ics)
+	}
+	if !strings.Contains(ics, "\r\nSEQUENCE:3\r\n") {
+		t.Error("Expected the sequence, got ", ics)
+	}
+	if !strings.Contains(ics, "\r\nDTSTART:20161103T153000Z\r\n") {
+		t.Error("Expected the start in UTC, got ", ics)
+	}
+	if !strings.Contains(ics, `SUMMARY:Pick up: desk\, chair\; lamp`+"\r\n") ||
+		!strings.Contains(ics, `DESCRIPTION:Bring cash\nand a bag`+"\r\n") {
+
+		t.Error("Expected escaped text, got ", ics)
+	}
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Error("Expected lines to be folded, got ", line)
+		}
+	}
+	unfolded := strings.Replace(ics, "\r\n ", "", -1)
+	if !strings.Contains(unfolded, "LOCATION:"+strings.Repeat("Library ", 12)) {
+
+		t.Error("Expected the location to be unfolded, got ", ics)
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"math/rand"
 	"net/smtp"
@@ -23,8 +24,21 @@ type Email struct {
 	Subject       string   `json:"subject"`
 	PlainText     string   `json:"plain_text"`
 	FormattedText string   `json:"formatted_text"`
+	// Attachments are files sent along with the email
+	Attachments []EmailAttachment `json:"attachments,omitempty"`
 }
 
+// EmailAttachment is a file attached to an email
+type EmailAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// attachmentLineLength is the length lines of base64 encoded attachments
+// are wrapped at
+const attachmentLineLength = 76
+
 // StartEmailService spawns a few threads to handle emails, and returns
 // the channel through which emails can be queued up for delivery
 func StartEmailService() chan *Email {
@@ -55,29 +69,28 @@ func SendMail(ch chan *Email) {
 		buff.WriteString(email.Subject)
 		buff.WriteString("\r\n")
 
-		buff.WriteString("Content-Type: multipart/alternative; boundary=")
-		buff.WriteString(boundaryStr)
-		buff.WriteString("\r\n\r\n")
-
-		buff.WriteString("--" + boundaryStr)
-
-		buff.WriteString("\r\n")
-		buff.WriteString("Content-Type: text/plain; charset=UTF-8")
-		buff.WriteString("\r\n\r\n")
-
-		buff.WriteString(email.PlainText)
-		buff.WriteString("\r\n\r\n")
-
-		buff.WriteString("--" + boundaryStr)
-
-		buff.WriteString("\r\n")
-		buff.WriteString("Content-Type: text/html; charset=UTF-8")
-		buff.WriteString("\r\n\r\n")
-
-		buff.WriteString(email.FormattedText)
-		buff.WriteString("\r\n\r\n")
+		if len(email.Attachments) > 0 {
+			var mixedBoundaryStr = boundary()
+			buff.WriteString("Content-Type: multipart/mixed; boundary=")
+			buff.WriteString(mixedBoundaryStr)
+			buff.WriteString("\r\n\r\n")
+
+			buff.WriteString("--" + mixedBoundaryStr)
+			buff.WriteString("\r\n")
+			writeAlternativeBody(&buff, email, boundaryStr)
+			buff.WriteString("\r\n\r\n")
+
+			for _, attachment := range email.Attachments {
+				buff.WriteString("--" + mixedBoundaryStr)
+				buff.WriteString("\r\n")
+				writeAttachment(&buff, attachment)
+				buff.WriteString("\r\n")
+			}
 
-		buff.WriteString("--" + boundaryStr + "--")
+			buff.WriteString("--" + mixedBoundaryStr + "--")
+		} else {
+			writeAlternativeBody(&buff, email, boundaryStr)
+		}
 
 		if constants.DoSendEmails {
 			auth := smtp.PlainAuth(
@@ -115,6 +128,58 @@ func SendMail(ch chan *Email) {
 	}
 }
 
+// writeAlternativeBody writes the plain text and HTML versions of an email
+// as a multipart/alternative part
+func writeAlternativeBody(buff *bytes.Buffer, email *Email,
+	boundaryStr string) {
+
+	buff.WriteString("Content-Type: multipart/alternative; boundary=")
+	buff.WriteString(boundaryStr)
+	buff.WriteString("\r\n\r\n")
+
+	buff.WriteString("--" + boundaryStr)
+
+	buff.WriteString("\r\n")
+	buff.WriteString("Content-Type: text/plain; charset=UTF-8")
+	buff.WriteString("\r\n\r\n")
+
+	buff.WriteString(email.PlainText)
+	buff.WriteString("\r\n\r\n")
+
+	buff.WriteString("--" + boundaryStr)
+
+	buff.WriteString("\r\n")
+	buff.WriteString("Content-Type: text/html; charset=UTF-8")
+	buff.WriteString("\r\n\r\n")
+
+	buff.WriteString(email.FormattedText)
+	buff.WriteString("\r\n\r\n")
+
+	buff.WriteString("--" + boundaryStr + "--")
+}
+
+// writeAttachment writes a file attached to an email as a base64 encoded
+// part
+func writeAttachment(buff *bytes.Buffer, attachment EmailAttachment) {
+	buff.WriteString("Content-Type: " + attachment.ContentType +
+		"; name=\"" + attachment.Filename + "\"")
+	buff.WriteString("\r\n")
+	buff.WriteString("Content-Disposition: attachment; filename=\"" +
+		attachment.Filename + "\"")
+	buff.WriteString("\r\n")
+	buff.WriteString("Content-Transfer-Encoding: base64")
+	buff.WriteString("\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+	for len(encoded) > attachmentLineLength {
+		buff.WriteString(encoded[:attachmentLineLength])
+		buff.WriteString("\r\n")
+		encoded = encoded[attachmentLineLength:]
+	}
+	buff.WriteString(encoded)
+	buff.WriteString("\r\n")
+}
+
 const characters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ" +
 	"0123456789"
 
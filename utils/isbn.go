@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeISBN checks the check digit of an ISBN-10 or ISBN-13, ignoring
+// any spaces and hyphens in it, and returns it as an ISBN-13 without
+// separators. Converting ISBN-10s means that both forms of a book's ISBN
+// normalize to the same string
+func NormalizeISBN(isbn string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, isbn)
+
+	switch len(digits) {
+	case 10:
+		if !validISBN10(digits) {
+			return "", false
+		}
+		isbn13 := "978" + digits[:9]
+		return isbn13 + string(isbn13CheckDigit(isbn13)), true
+	case 13:
+		if !isDigits(digits) ||
+			isbn13CheckDigit(digits[:12]) != digits[12] {
+			return "", false
+		}
+		return digits, true
+	}
+	return "", false
+}
+
+// validISBN10 checks the check digit of an ISBN-10, which may be an X
+// standing for 10
+func validISBN10(isbn string) bool {
+	if !isDigits(isbn[:9]) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(isbn[i]-'0') * (10 - i)
+	}
+	switch check := isbn[9]; {
+	case check == 'X':
+		sum += 10
+	case check >= '0' && check <= '9':
+		sum += int(check - '0')
+	default:
+		return false
+	}
+	return sum%11 == 0
+}
+
+// isbn13CheckDigit works out the check digit for the first 12 digits of an
+// ISBN-13
+func isbn13CheckDigit(isbn string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(isbn[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		isbn     string
+		expected string
+		valid    bool
+	}{
+		{"978-0-262-03384-8", "9780262033848", true},
+		{"0262033844", "9780262033848", true},
+		{"0-8044-2957-x", "9780804429573", true},
+		{"978 0 262 03384 8", "9780262033848", true},
+		{"9780262033847", "", false},
+		{"0262033845", "", false},
+		{"026203384", "", false},
+		{"97802620338X8", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		isbn, valid := NormalizeISBN(test.isbn)
+		if isbn != test.expected || valid != test.valid {
+			t.Errorf("NormalizeISBN(%q) = %q, %v, expected %q, %v", test.isbn,
+				isbn, valid, test.expected, test.valid)
+		}
+	}
+}
@@ -2,61 +2,154 @@ package utils
 
 import (
 	"bytes"
+	"sort"
+	"strings"
 
 	"github.com/anishmgoyal/calagora/constants"
 )
 
-var stopWords map[string]int
+// stopWords is built from the same tokens the analyzers see, before they
+// are stemmed
+var stopWords = loadStopWords()
 
-func isStopWord(word string) bool {
-	if stopWords == nil {
-		stopWords = GetSearchTermsForString(constants.StopWords, false)
+func loadStopWords() map[string]bool {
+	words := make(map[string]bool)
+	analyzer := NewAnalyzer(UnicodeTokenizer, CaseFoldFilter)
+	for _, word := range analyzer.Analyze(constants.StopWords) {
+		words[word] = true
 	}
-	_, ok := stopWords[word]
-	return ok
+	return words
+}
+
+func isStopWord(word string) bool {
+	return stopWords[word]
 }
 
-// GetSearchTermsForString extracts alphanumeric words from
-// a string, with the requirement that each word is at least
-// 3 letters long, and the first character is a letter.
+// GetSearchTermsForString breaks a string into search index terms using
+// SearchAnalyzer, and counts how many times each term appears
 func GetSearchTermsForString(s string, enforceStopwords bool) map[string]int {
+	analyzer := SearchAnalyzer
+	if !enforceStopwords {
+		analyzer = searchAnalyzerAllWords
+	}
+	return countTerms(analyzer.Analyze(s))
+}
+
+// GetSearchWordsForString breaks a string into plain words using
+// WordAnalyzer, and counts how many times each word appears
+func GetSearchWordsForString(s string) map[string]int {
+	return countTerms(WordAnalyzer.Analyze(s))
+}
+
+// NormalizeSearchQuery reduces a query to its sorted, distinct search terms,
+// so that queries asking for the same thing can be grouped together. Stop
+// words are kept, since seeing them in queries is how stop words get tuned
+func NormalizeSearchQuery(s string) string {
+	terms := searchAnalyzerAllWords.Analyze(s)
+	sort.Strings(terms)
+	distinct := terms[:0]
+	for i, term := range terms {
+		if i == 0 || term != terms[i-1] {
+			distinct = append(distinct, term)
+		}
+	}
+	return strings.Join(distinct, " ")
+}
+
+func countTerms(terms []string) map[string]int {
 	termMap := make(map[string]int)
-	var buff bytes.Buffer
-
-	for pos := 0; pos < len(s); pos++ {
-		isFirst := buff.Len() == 0
-		if isSearchChar(s[pos], isFirst) {
-			buff.WriteByte(toLower(s[pos]))
-		} else {
-			if buff.Len() >= 3 {
-				currTerm := buff.String()
-				if !enforceStopwords || !isStopWord(currTerm) {
-					termMap[currTerm] = termMap[currTerm] + 1
-				}
+	for _, term := range terms {
+		termMap[term] = termMap[term] + 1
+	}
+	return termMap
+}
+
+const maxSearchQueryParts = 10
+
+// SearchQuery is a user's search query, broken up into the pieces that
+// the full text search index understands
+type SearchQuery struct {
+	// Words must all appear in a listing, in any order
+	Words []string
+	// Phrases must appear in a listing with their words in order
+	Phrases []string
+	// Prefixes match any word in a listing beginning with the prefix
+	Prefixes []string
+}
+
+// ParseSearchQuery splits a query string into words, "quoted phrases"
+// and prefix* terms
+func ParseSearchQuery(s string) SearchQuery {
+	var query SearchQuery
+	var plain bytes.Buffer
+
+	for len(s) > 0 {
+		start := strings.IndexByte(s, '"')
+		if start == -1 {
+			plain.WriteString(s)
+			break
+		}
+		plain.WriteString(s[:start])
+		plain.WriteByte(' ')
+
+		end := strings.IndexByte(s[start+1:], '"')
+		if end == -1 {
+			plain.WriteString(s[start+1:])
+			break
+		}
+		phrase := SearchAnalyzer.AnalyzeString(s[start+1 : start+1+end])
+		if len(phrase) > 0 && len(query.Phrases) < maxSearchQueryParts {
+			query.Phrases = append(query.Phrases, phrase)
+		}
+		s = s[start+end+2:]
+	}
+
+	var words bytes.Buffer
+	for _, field := range strings.Fields(plain.String()) {
+		if strings.HasSuffix(field, "*") {
+			prefix := searchPrefix(field)
+			if len(prefix) >= 2 && len(query.Prefixes) < maxSearchQueryParts {
+				query.Prefixes = append(query.Prefixes, prefix)
 			}
-			buff.Reset()
+			continue
 		}
+		words.WriteString(field)
+		words.WriteByte(' ')
 	}
 
-	if buff.Len() >= 3 {
-		currTerm := buff.String()
-		if !enforceStopwords || !isStopWord(currTerm) {
-			termMap[currTerm] = termMap[currTerm] + 1
+	// Words are kept in the order they were typed, so that the same words
+	// are dropped every time from a query with too many
+	seen := make(map[string]bool)
+	for _, word := range SearchAnalyzer.Analyze(words.String()) {
+		if len(query.Words) >= maxSearchQueryParts {
+			break
+		}
+		if seen[word] {
+			continue
 		}
+		seen[word] = true
+		query.Words = append(query.Words, word)
 	}
 
-	return termMap
+	return query
 }
 
-func isSearchChar(c byte, isFirst bool) bool {
-	return (c >= 'a' && c <= 'z') ||
-		(c >= 'A' && c <= 'Z') ||
-		(c >= '0' && c <= '9' && !isFirst)
+// IsEmpty returns true if there is nothing in a query to search for
+func (q SearchQuery) IsEmpty() bool {
+	return len(q.Words) == 0 && len(q.Phrases) == 0 && len(q.Prefixes) == 0
 }
 
-func toLower(c byte) byte {
-	if c >= 'A' && c <= 'Z' {
-		c = c + 32
-	}
-	return c
+// searchPrefix folds the case and accents of a prefix* term. A partial
+// word can't be stemmed like a whole one, so prefixes are matched against
+// the plain words from SearchPrefixWords instead of the stemmed terms
+func searchPrefix(field string) string {
+	analyzer := NewAnalyzer(UnicodeTokenizer, CaseFoldFilter, AccentFoldFilter)
+	return strings.Join(analyzer.Analyze(field), "")
+}
+
+// SearchPrefixWords gets the plain words of text, which are indexed next
+// to its stemmed terms so that prefix* terms can match them. "calculator"
+// is stemmed to calcul, which calculat* doesn't match
+func SearchPrefixWords(s string) string {
+	return WordAnalyzer.AnalyzeString(s)
 }
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	query := ParseSearchQuery("calc* \"linear algebra\" the Textbooks")
+
+	if len(query.Prefixes) != 1 || strings.Compare(query.Prefixes[0], "calc") != 0 {
+		t.Error("Expected prefix calc, got ", query.Prefixes)
+	}
+	if len(query.Phrases) != 1 ||
+		strings.Compare(query.Phrases[0], "linear algebra") != 0 {
+
+		t.Error("Expected phrase \"linear algebra\", got ", query.Phrases)
+	}
+	if len(query.Words) != 1 || strings.Compare(query.Words[0], "textbook") != 0 {
+		t.Error("Expected word textbook, got ", query.Words)
+	}
+}
+
+func TestParseSearchQueryUnterminatedPhrase(t *testing.T) {
+	query := ParseSearchQuery("desk \"oak chair")
+	if len(query.Phrases) != 0 {
+		t.Error("Expected no phrases, got ", query.Phrases)
+	}
+	if len(query.Words) != 3 {
+		t.Error("Expected three words, got ", query.Words)
+	}
+}
+
+func TestParseSearchQueryEmpty(t *testing.T) {
+	if !ParseSearchQuery("  the * \"\" ").IsEmpty() {
+		t.Error("Expected an empty query")
+	}
+}
+
+func TestParseSearchQueryKeepsWordOrder(t *testing.T) {
+	expected := []string{"desk", "lamp", "sofa", "bed", "rug", "mug", "pan",
+		"pot", "cup", "fan"}
+	for i := 0; i < 20; i++ {
+		query := ParseSearchQuery("desk lamp desk sofa bed rug mug pan pot cup " +
+			"fan chair oven")
+		if strings.Join(query.Words, " ") != strings.Join(expected, " ") {
+			t.Fatal("Expected words ", expected, ", got ", query.Words)
+		}
+	}
+}
+
+func TestNormalizeSearchQuery(t *testing.T) {
+	normalized := NormalizeSearchQuery("Textbooks for the textbook CALC*")
+	if strings.Compare(normalized, "calc for textbook the") != 0 {
+		t.Error("Expected \"calc for textbook the\", got ", normalized)
+	}
+}
+
+func TestParseSearchQueryPrefixes(t *testing.T) {
+	tests := []struct {
+		query    string
+		prefix   string
+		document string
+	}{
+		{"calculat*", "calculat", "TI-84 graphing calculator"},
+		{"Bicy*", "bicy", "Road bicycle, barely ridden"},
+		{"textb*", "textb", "Organic chemistry textbooks"},
+		{"caf*", "caf", "Café table"},
+	}
+	for _, test := range tests {
+		query := ParseSearchQuery(test.query)
+		if len(query.Prefixes) != 1 ||
+			strings.Compare(query.Prefixes[0], test.prefix) != 0 {
+
+			t.Error("Expected prefix "+test.prefix+", got ", query.Prefixes)
+			continue
+		}
+		// The document holds the stemmed terms and the plain words, the way
+		// a listing is indexed
+		indexed := append(SearchAnalyzer.Analyze(test.document),
+			strings.Fields(SearchPrefixWords(test.document))...)
+		matched := false
+		for _, term := range indexed {
+			if strings.HasPrefix(term, query.Prefixes[0]) {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Error("Expected "+test.query+" to match "+test.document+", got ",
+				indexed)
+		}
+	}
+}
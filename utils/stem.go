@@ -0,0 +1,300 @@
+package utils
+
+// This is an implementation of the Porter stemming algorithm, as described
+// in M.F. Porter, "An algorithm for suffix stripping", 1980. It only
+// handles lower case ASCII words; anything else is left alone by Stem.
+
+type porterStemmer struct {
+	b []byte
+	// k is the index of the last letter of the word
+	k int
+	// j is the index of the last letter of the stem, set by ends
+	j int
+}
+
+// Stem reduces an English word to its stem, so that different forms of the
+// same word ("chairs", "chair") can be matched against each other
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	z := &porterStemmer{b: []byte(word), k: len(word) - 1}
+	z.step1ab()
+	if z.k > 0 {
+		z.step1c()
+		z.step2()
+		z.step3()
+		z.step4()
+		z.step5()
+	}
+	return string(z.b[:z.k+1])
+}
+
+// cons returns true if b[i] is a consonant
+func (z *porterStemmer) cons(i int) bool {
+	switch z.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		if i == 0 {
+			return true
+		}
+		return !z.cons(i - 1)
+	}
+	return true
+}
+
+// m measures the number of vowel-consonant sequences in b[0..j]
+func (z *porterStemmer) m() int {
+	n := 0
+	i := 0
+	for {
+		if i > z.j {
+			return n
+		}
+		if !z.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > z.j {
+				return n
+			}
+			if z.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > z.j {
+				return n
+			}
+			if !z.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// vowelInStem returns true if b[0..j] contains a vowel
+func (z *porterStemmer) vowelInStem() bool {
+	for i := 0; i <= z.j; i++ {
+		if !z.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleC returns true if b[i-1..i] is a double consonant
+func (z *porterStemmer) doubleC(i int) bool {
+	if i < 1 || z.b[i] != z.b[i-1] {
+		return false
+	}
+	return z.cons(i)
+}
+
+// cvc returns true if b[i-2..i] is consonant-vowel-consonant, and the
+// last consonant isn't w, x or y. This is used to restore an e at the end
+// of short words, like cav(e) or hop(e)
+func (z *porterStemmer) cvc(i int) bool {
+	if i < 2 || !z.cons(i) || z.cons(i-1) || !z.cons(i-2) {
+		return false
+	}
+	switch z.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends returns true if b[0..k] ends with s, setting j to the end of the
+// stem before it
+func (z *porterStemmer) ends(s string) bool {
+	l := len(s)
+	if l > z.k+1 || string(z.b[z.k-l+1:z.k+1]) != s {
+		return false
+	}
+	z.j = z.k - l
+	return true
+}
+
+// setTo replaces b[j+1..k] with s
+func (z *porterStemmer) setTo(s string) {
+	z.b = append(z.b[:z.j+1], s...)
+	z.k = z.j + len(s)
+}
+
+// r replaces the suffix with s if the stem has a non-zero measure
+func (z *porterStemmer) r(s string) {
+	if z.m() > 0 {
+		z.setTo(s)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing
+func (z *porterStemmer) step1ab() {
+	if z.b[z.k] == 's' {
+		if z.ends("sses") {
+			z.k -= 2
+		} else if z.ends("ies") {
+			z.setTo("i")
+		} else if z.b[z.k-1] != 's' {
+			z.k--
+		}
+	}
+	z.b = z.b[:z.k+1]
+
+	if z.ends("eed") {
+		if z.m() > 0 {
+			z.k--
+		}
+	} else if (z.ends("ed") || z.ends("ing")) && z.vowelInStem() {
+		z.k = z.j
+		z.b = z.b[:z.k+1]
+		if z.ends("at") {
+			z.setTo("ate")
+		} else if z.ends("bl") {
+			z.setTo("ble")
+		} else if z.ends("iz") {
+			z.setTo("ize")
+		} else if z.doubleC(z.k) {
+			z.k--
+			switch z.b[z.k] {
+			case 'l', 's', 'z':
+				z.k++
+			}
+		} else if z.j = z.k; z.m() == 1 && z.cvc(z.k) {
+			z.setTo("e")
+		}
+	}
+	z.b = z.b[:z.k+1]
+}
+
+// step1c turns a terminal y into i when there is another vowel in the stem
+func (z *porterStemmer) step1c() {
+	if z.ends("y") && z.vowelInStem() {
+		z.b[z.k] = 'i'
+	}
+}
+
+// suffixRule replaces a suffix with another when the stem before it is
+// long enough
+type suffixRule struct {
+	suffix      string
+	replacement string
+}
+
+// applyRules applies the first rule matching the end of the word
+func (z *porterStemmer) applyRules(rules []suffixRule) {
+	for _, rule := range rules {
+		if z.ends(rule.suffix) {
+			z.r(rule.replacement)
+			return
+		}
+	}
+}
+
+var porterStep2Rules = map[byte][]suffixRule{
+	'a': {{"ational", "ate"}, {"tional", "tion"}},
+	'c': {{"enci", "ence"}, {"anci", "ance"}},
+	'e': {{"izer", "ize"}},
+	'l': {{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"},
+		{"ousli", "ous"}},
+	'o': {{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}},
+	's': {{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+		{"ousness", "ous"}},
+	't': {{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}},
+	'g': {{"logi", "log"}},
+}
+
+// step2 maps double suffixes to single ones, e.g. -ization to -ize
+func (z *porterStemmer) step2() {
+	if z.k < 1 {
+		return
+	}
+	z.applyRules(porterStep2Rules[z.b[z.k-1]])
+}
+
+var porterStep3Rules = map[byte][]suffixRule{
+	'e': {{"icate", "ic"}, {"ative", ""}, {"alize", "al"}},
+	'i': {{"iciti", "ic"}},
+	'l': {{"ical", "ic"}, {"ful", ""}},
+	's': {{"ness", ""}},
+}
+
+// step3 handles -ic-, -full, -ness and similar suffixes
+func (z *porterStemmer) step3() {
+	z.applyRules(porterStep3Rules[z.b[z.k]])
+	z.b = z.b[:z.k+1]
+}
+
+var porterStep4Suffixes = map[byte][]string{
+	'a': {"al"},
+	'c': {"ance", "ence"},
+	'e': {"er"},
+	'i': {"ic"},
+	'l': {"able", "ible"},
+	'n': {"ant", "ement", "ment", "ent"},
+	's': {"ism"},
+	't': {"ate", "iti"},
+	'u': {"ous"},
+	'v': {"ive"},
+	'z': {"ize"},
+}
+
+// step4 removes -ant, -ence and similar suffixes from longer stems
+func (z *porterStemmer) step4() {
+	if z.k < 1 {
+		return
+	}
+
+	matched := false
+	if z.b[z.k-1] == 'o' {
+		if z.ends("ion") && z.j >= 0 && (z.b[z.j] == 's' || z.b[z.j] == 't') {
+			matched = true
+		} else if z.ends("ou") {
+			matched = true
+		}
+	} else {
+		for _, suffix := range porterStep4Suffixes[z.b[z.k-1]] {
+			if z.ends(suffix) {
+				matched = true
+				break
+			}
+		}
+	}
+
+	if matched && z.m() > 1 {
+		z.k = z.j
+		z.b = z.b[:z.k+1]
+	}
+}
+
+// step5 removes a final -e and changes -ll to -l on longer stems
+func (z *porterStemmer) step5() {
+	z.j = z.k
+	if z.b[z.k] == 'e' {
+		a := z.m()
+		if a > 1 || a == 1 && !z.cvc(z.k-1) {
+			z.k--
+		}
+	}
+	if z.b[z.k] == 'l' && z.doubleC(z.k) && z.m() > 1 {
+		z.k--
+	}
+	z.b = z.b[:z.k+1]
+}
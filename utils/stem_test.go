@@ -0,0 +1,31 @@
+package utils
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	stems := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"hopping":        "hop",
+		"filing":         "file",
+		"happy":          "happi",
+		"relational":     "relat",
+		"generalization": "gener",
+		"electrical":     "electr",
+		"hopeful":        "hope",
+		"adjustment":     "adjust",
+		"controll":       "control",
+		"textbooks":      "textbook",
+		"ps4":            "ps4",
+		"tv":             "tv",
+	}
+	for word, expected := range stems {
+		if stem := Stem(word); stem != expected {
+			t.Error("Expected ", word, " to stem to ", expected, ", got ", stem)
+		}
+	}
+}
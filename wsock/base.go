@@ -1,14 +1,14 @@
 package wsock
 
-import "database/sql"
+import "github.com/anishmgoyal/calagora/models"
 
 // Base contains all info needed by wsock code
 var Base struct {
-	// Db is the connection to the database
-	Db *sql.DB
+	// Store is where notifications are saved
+	Store *models.Store
 }
 
 // BaseInitialization sets up the wsock module
-func BaseInitialization(db *sql.DB) {
-	Base.Db = db
+func BaseInitialization(store *models.Store) {
+	Base.Store = store
 }
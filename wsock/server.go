@@ -1,7 +1,6 @@
 package wsock
 
 import (
-	"database/sql"
 	"strconv"
 	"strings"
 	"sync"
@@ -11,7 +10,7 @@ import (
 	"golang.org/x/net/websocket"
 )
 
-var gDB *sql.DB
+var gStore *models.Store
 var wSockets map[string]map[string]*websocket.Conn
 var wSocketID = uint64(0)
 var connectionMutex sync.Mutex
@@ -41,9 +40,9 @@ func init() {
 }
 
 // StartWebsocketService creates goroutines for sending messages via websockets
-func StartWebsocketService(db *sql.DB) chan *Message {
+func StartWebsocketService(store *models.Store) chan *Message {
 	ch := make(chan *Message, websockChannelSize)
-	gDB = db
+	gStore = store
 	for i := 0; i < websockThreadCount; i++ {
 		go websocketSender(ch)
 	}
@@ -142,13 +141,13 @@ func Connect(ws *websocket.Conn) {
 				idStr := string(buff)[2:count]
 				id, err := strconv.Atoi(idStr)
 				if err == nil {
-					session.User.MarkNotificationsRead(gDB, id)
+					gStore.Notifications.MarkReadUpTo(&session.User, id)
 				}
 			} else if strings.Index(string(buff), "-r") == 0 {
 				idStr := string(buff)[2:count]
 				id, err := strconv.Atoi(idStr)
 				if err == nil {
-					session.User.MarkNotificationRead(gDB, id)
+					gStore.Notifications.MarkRead(&session.User, id)
 				}
 			}
 		}
@@ -186,7 +185,7 @@ func checkCredentials(credentials string) (*models.Session, bool) {
 	sessionSecret := credentialList[1]
 	browserAgent := credentialList[2]
 
-	session := models.GetSession(gDB, sessionID, sessionSecret, browserAgent)
+	session := gStore.Sessions.Get(sessionID, sessionSecret, browserAgent)
 	if session == nil {
 		return nil, false
 	}
@@ -43,7 +43,7 @@ func UserJSONNotification(u *models.User, notifType string,
 	}
 
 	if createRecord {
-		notificationRecord.Create(Base.Db)
+		Base.Store.Notifications.Create(&notificationRecord)
 	}
 
 	b, err = json.Marshal(notificationRecord)